@@ -0,0 +1,160 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"golang.org/x/exp/slog"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/catalog"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+type searchResultClient interface {
+	Ping(context.Context) error
+	StoreOffers(ctx context.Context, transactionID string, offers []catalog.Offer) error
+	Offers(ctx context.Context, transactionID string) ([]catalog.Offer, error)
+}
+
+// searchResultsResponse is the response of the search result API.
+type searchResultsResponse struct {
+	Offers []catalog.Offer `json:"offers"`
+}
+
+// querySearchResults handles GET /search/results?transaction_id={id}, returning the merged offers of the on_search
+// responses of the transaction.
+//
+// The offers are filtered by the min_price, max_price, currency, gps with max_distance in kilometers, and min_rating
+// parameters, sorted by the sort parameter of price, distance or rating in the order parameter of asc or desc,
+// and limited by the limit parameter.
+func (s *server) querySearchResults(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	params := r.URL.Query()
+	transactionID := params.Get("transaction_id")
+	if transactionID == "" {
+		http.Error(w, "transaction_id is required", http.StatusBadRequest)
+		return
+	}
+	query, err := parseQuery(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offers, err := s.searchResults.Offers(ctx, transactionID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Reading search results failed", "transaction_id", transactionID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := searchResultsResponse{Offers: query.Apply(offers)}
+	if response.Offers == nil {
+		response.Offers = []catalog.Offer{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.ErrorContext(ctx, "Writing search results failed", "error", err)
+	}
+}
+
+// parseQuery returns the query of the search result API parameters.
+func parseQuery(params url.Values) (catalog.Query, error) {
+	var (
+		q   catalog.Query
+		err error
+	)
+	parseFloat := func(name string) *float64 {
+		v := params.Get(name)
+		if v == "" || err != nil {
+			return nil
+		}
+		f, parseErr := strconv.ParseFloat(v, 64)
+		if parseErr != nil || f < 0 {
+			err = fmt.Errorf("invalid %s %q", name, v)
+			return nil
+		}
+		return &f
+	}
+
+	q.MinPrice = parseFloat("min_price")
+	q.MaxPrice = parseFloat("max_price")
+	q.Currency = params.Get("currency")
+	q.GPS = params.Get("gps")
+	if d := parseFloat("max_distance"); d != nil {
+		q.MaxDistance = *d
+	}
+	if r := parseFloat("min_rating"); r != nil {
+		q.MinRating = *r
+	}
+	if err != nil {
+		return catalog.Query{}, err
+	}
+	if l := params.Get("limit"); l != "" {
+		if q.Limit, err = strconv.Atoi(l); err != nil || q.Limit < 0 {
+			return catalog.Query{}, fmt.Errorf("invalid limit %q", l)
+		}
+	}
+
+	if q.MaxDistance > 0 && q.GPS == "" {
+		return catalog.Query{}, errors.New("max_distance requires gps")
+	}
+	switch q.SortBy = params.Get("sort"); q.SortBy {
+	case "", catalog.SortByPrice, catalog.SortByRating:
+	case catalog.SortByDistance:
+		if q.GPS == "" {
+			return catalog.Query{}, errors.New("sorting by distance requires gps")
+		}
+	default:
+		return catalog.Query{}, fmt.Errorf("invalid sort %q", q.SortBy)
+	}
+	switch order := params.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return catalog.Query{}, fmt.Errorf("invalid order %q", order)
+	}
+	return q, nil
+}
+
+// storeSearchResults stores the offers of the on_search for merging them with the other responses of the transaction.
+func (s *server) storeSearchResults(ctx context.Context, data []byte) error {
+	var req model.OnSearchRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("unmarshal on_search: %v", err)
+	}
+	if req.Context == nil || req.Context.TransactionID == nil {
+		return errors.New("on_search without transaction ID")
+	}
+	if req.Message == nil || req.Message.Catalog == nil {
+		return nil
+	}
+
+	offers := catalog.Offers(*req.Context, *req.Message.Catalog)
+	if err := s.searchResults.StoreOffers(ctx, *req.Context.TransactionID, offers); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Search results are stored", "offers", len(offers))
+	return nil
+}
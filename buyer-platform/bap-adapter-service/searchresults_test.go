@@ -0,0 +1,124 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/searchresultclienttest"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+)
+
+// onSearch returns an on_search of the transaction from the BPP with an item of each price.
+func onSearch(t *testing.T, bppID string, prices map[string]string) []byte {
+	t.Helper()
+
+	var items []map[string]any
+	for id, price := range prices {
+		items = append(items, map[string]any{
+			"id":    id,
+			"price": map[string]string{"currency": "INR", "value": price},
+		})
+	}
+	data, err := json.Marshal(map[string]any{
+		"context": map[string]any{
+			"transaction_id": "T1",
+			"message_id":     "M1",
+			"bpp_id":         bppID,
+			"bpp_uri":        "https://" + bppID,
+		},
+		"message": map[string]any{
+			"catalog": map[string]any{
+				"bpp/providers": []map[string]any{{"id": "P1", "items": items}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSearchResults(t *testing.T) {
+	ctx := context.Background()
+	s := &server{
+		config:        config.BuyerAdapterConfig{SearchResults: &config.SearchResultsConfig{}},
+		searchResults: searchresultclienttest.NewStub(),
+	}
+
+	responses := [][]byte{
+		onSearch(t, "bpp1.com", map[string]string{"I1": "300", "I2": "100"}),
+		onSearch(t, "bpp2.com", map[string]string{"I1": "200"}),
+		// The later response of the item replaces the earlier one.
+		onSearch(t, "bpp1.com", map[string]string{"I1": "50"}),
+	}
+	for _, data := range responses {
+		if err := s.storeSearchResults(ctx, data); err != nil {
+			t.Fatalf("storeSearchResults() failed: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/search/results?transaction_id=T1&sort=price&order=desc&max_price=250", nil)
+	rec := httptest.NewRecorder()
+	s.apiHandler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /search/results status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var res searchResultsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Unmarshal response failed: %v", err)
+	}
+	var got []string
+	for _, o := range res.Offers {
+		got = append(got, o.BppID+"/"+o.Item.ID)
+	}
+	want := []string{"bpp2.com/I1", "bpp1.com/I2", "bpp1.com/I1"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GET /search/results returned unexpected offers (-want +got):\n%s", diff)
+	}
+}
+
+func TestSearchResultsBadRequest(t *testing.T) {
+	s := &server{searchResults: searchresultclienttest.NewStub()}
+
+	tests := []struct {
+		method string
+		target string
+		want   int
+	}{
+		{method: http.MethodPost, target: "/search/results?transaction_id=T1", want: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, target: "/search/results", want: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/search/results?transaction_id=T1&min_price=cheap", want: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/search/results?transaction_id=T1&sort=name", want: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/search/results?transaction_id=T1&sort=distance", want: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/search/results?transaction_id=T1&order=up", want: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/search/results?transaction_id=T1&limit=-1", want: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/search/results?transaction_id=T1&limit=10", want: http.StatusOK},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		s.apiHandler().ServeHTTP(rec, httptest.NewRequest(test.method, test.target, nil))
+		if rec.Code != test.want {
+			t.Errorf("%s %s status = %d, want %d", test.method, test.target, rec.Code, test.want)
+		}
+	}
+}
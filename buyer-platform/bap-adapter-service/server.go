@@ -16,60 +16,127 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"errors"
-	"flag"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"cloud.google.com/go/pubsub"
-	log "github.com/golang/glog"
+	"golang.org/x/exp/slog"
 	"golang.org/x/sync/errgroup"
 
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/claimcheck"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/deliveryclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/keyclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/searchresultclient"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/health"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/logging"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/metrics"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/tracing"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/webhook"
 )
 
+// defaultAPIPort is the port serving the APIs for the buyer app if the config has none.
+const defaultAPIPort = 8080
+
 type server struct {
 	pubsubClient *pubsub.Client
-	httpClient   *http.Client
 	config       config.BuyerAdapterConfig
 	subs         []*pubsub.Subscription
+	claimCheck   *claimcheck.ClaimCheck
+
+	// searchResults merges the on_search responses for the search result API if set.
+	searchResults searchResultClient
+
+	// signingKey signs the deliveries if set.
+	signingKey []byte
+	deliverer  *webhook.Deliverer
+	// deliveries logs the deliveries for the webhook delivery API if set.
+	deliveries deliveryClient
+
+	health          *health.Checker
+	shutdownTimeout time.Duration
 }
 
 func main() {
-	flag.Set("alsologtostderr", "true")
+	logging.Init()
 	ctx := context.Background()
 
 	configPath, ok := os.LookupEnv("CONFIG")
 	if !ok {
-		log.Exit("CONFIG env is not set")
+		logging.Exit("CONFIG env is not set")
 	}
 
 	conf, err := config.Read[config.BuyerAdapterConfig](configPath)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Read config failed", "error", err)
 	}
 
+	shutdownTracing, err := tracing.Init(ctx, "bap-adapter-service")
+	if err != nil {
+		logging.Exit("Init tracing failed", "error", err)
+	}
+	defer shutdownTracing(ctx)
+
 	pubsubClient, err := pubsub.NewClient(ctx, conf.ProjectID)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create Pub/Sub client failed", "error", err)
+	}
+
+	var searchResults searchResultClient
+	if conf.SearchResults != nil {
+		searchResultClient, err := searchresultclient.New(ctx, conf.ProjectID, conf.SearchResults.InstanceID, conf.SearchResults.DatabaseID)
+		if err != nil {
+			logging.Exit("Create search result client failed", "error", err)
+		}
+		defer searchResultClient.Close()
+		searchResults = searchResultClient
+	}
+
+	var keyClient keyClient
+	if conf.Webhook.SecretID != "" {
+		secretManagerKeyClient, err := keyclient.New(ctx, conf.ProjectID, conf.Webhook.SecretID)
+		if err != nil {
+			logging.Exit("Create key client failed", "error", err)
+		}
+		defer secretManagerKeyClient.Close()
+		keyClient = secretManagerKeyClient
 	}
 
-	srv, err := initServer(ctx, http.DefaultClient, pubsubClient, conf)
+	var deliveries deliveryClient
+	if conf.Webhook.DeliveryLog != nil {
+		deliveryClient, err := deliveryclient.New(ctx, conf.ProjectID, conf.Webhook.DeliveryLog.InstanceID, conf.Webhook.DeliveryLog.DatabaseID)
+		if err != nil {
+			logging.Exit("Create delivery client failed", "error", err)
+		}
+		defer deliveryClient.Close()
+		deliveries = deliveryClient
+	}
+
+	srv, err := initServer(ctx, tracing.InstrumentClient(metrics.InstrumentClient(http.DefaultClient)), pubsubClient, searchResults, keyClient, deliveries, conf)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Init server failed", "error", err)
 	}
-	log.Info("Server initialization successs")
+	slog.Info("Server initialization successs")
 
-	if err := srv.serve(ctx); err != nil {
-		log.Exitf("Serving failed: %v", err)
+	// Kubernetes sends SIGTERM for stopping the pod.
+	serveCtx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	health.ServeInBackground(serveCtx, conf.MetricsPort, srv.health)
+
+	if err := srv.serve(serveCtx); err != nil {
+		logging.Exit("Serving failed", "error", err)
 	}
+	slog.Info("Server is closed")
 }
 
-func initServer(ctx context.Context, httpClient *http.Client, pubsubClient *pubsub.Client, conf config.BuyerAdapterConfig) (*server, error) {
+func initServer(ctx context.Context, httpClient *http.Client, pubsubClient *pubsub.Client, searchResults searchResultClient, keyClient keyClient, deliveries deliveryClient, conf config.BuyerAdapterConfig) (*server, error) {
 	// validate clients
 	if httpClient == nil {
 		return nil, errors.New("init server: HTTP client is nil")
@@ -77,6 +144,15 @@ func initServer(ctx context.Context, httpClient *http.Client, pubsubClient *pubs
 	if pubsubClient == nil {
 		return nil, errors.New("init server: Pub/Sub client is nil")
 	}
+	if conf.SearchResults != nil && searchResults == nil {
+		return nil, errors.New("init server: search result client is nil")
+	}
+	if conf.Webhook.SecretID != "" && keyClient == nil {
+		return nil, errors.New("init server: key client is nil")
+	}
+	if conf.Webhook.DeliveryLog != nil && deliveries == nil {
+		return nil, errors.New("init server: delivery client is nil")
+	}
 
 	// validate the subscriptions
 	subs := make([]*pubsub.Subscription, 0, len(conf.SubscriptionID))
@@ -93,11 +169,48 @@ func initServer(ctx context.Context, httpClient *http.Client, pubsubClient *pubs
 		subs = append(subs, sub)
 	}
 
+	shutdownTimeout, err := health.ParseShutdownTimeout(conf.ShutdownTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	claimCheck, err := claimcheck.Open(ctx, conf.ClaimCheck.StoreURL, conf.ClaimCheck.Threshold)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	deliverer, err := newDeliverer(httpClient, conf.Webhook)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	var signingKey []byte
+	if keyClient != nil {
+		if signingKey, err = keyClient.WebhookSigningKey(ctx); err != nil {
+			return nil, fmt.Errorf("init server: read webhook signing key: %v", err)
+		}
+	}
+	checks := make([]health.Check, 0, len(subs)+3)
+	for _, sub := range subs {
+		checks = append(checks, health.SubscriptionCheck(sub))
+	}
+	if searchResults != nil {
+		checks = append(checks, health.Check{Name: "spanner", Check: searchResults.Ping})
+	}
+	if deliveries != nil {
+		checks = append(checks, health.Check{Name: "delivery-log", Check: deliveries.Ping})
+	}
+
 	server := &server{
 		pubsubClient: pubsubClient,
-		httpClient:   httpClient,
 		config:       conf,
 		subs:         subs,
+		claimCheck:   claimCheck,
+
+		searchResults: searchResults,
+		signingKey:    signingKey,
+		deliverer:     deliverer,
+		deliveries:    deliveries,
+
+		health:          health.NewChecker(checks...),
+		shutdownTimeout: shutdownTimeout,
 	}
 	return server, nil
 }
@@ -115,49 +228,106 @@ func (s *server) serve(ctx context.Context) error {
 		})
 	}
 
-	log.Info("Ready to receive messages")
+	if s.searchResults != nil || s.deliveries != nil {
+		g.Go(func() error {
+			return s.serveAPI(ctx)
+		})
+	}
+
+	slog.Info("Ready to receive messages")
 	return g.Wait()
 }
 
+// serveAPI serves the search result and webhook delivery APIs for the buyer app until ctx is done.
+func (s *server) serveAPI(ctx context.Context) error {
+	port := s.config.APIPort
+	if port == 0 {
+		port = defaultAPIPort
+	}
+	slog.Info("API is serving", "port", port)
+	return health.ListenAndServe(ctx, &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: s.apiHandler()}, s.health, s.shutdownTimeout)
+}
+
+// apiHandler returns the handler of the APIs for the buyer app.
+//
+//	GET /search/results queries the merged search results of a transaction if the search results are stored.
+//	GET /webhook/deliveries lists the deliveries of the callbacks of a transaction if the deliveries are logged.
+func (s *server) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			handler(w, r)
+		})
+	}
+	if s.searchResults != nil {
+		handle("/search/results", s.querySearchResults)
+	}
+	if s.deliveries != nil {
+		handle("/webhook/deliveries", s.listDeliveries)
+	}
+	return mux
+}
+
 // handleSubscription receives and handles messages from the Pub/Sub subscription.
 func (s *server) handleSubscription(ctx context.Context, sub *pubsub.Subscription) error {
 	err := sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		// The context is canceled as soon as the shutdown starts, but the in-flight message can be finished.
+		ctx, cancel := health.DelayCancel(ctx, s.shutdownTimeout)
+		defer cancel()
+		ctx, span := tracing.StartPubSubSpan(ctx, sub.ID(), msg)
+		defer span.End()
+		ctx = logging.With(ctx, slog.String(logging.PubSubMessageIDKey, msg.ID), slog.String(logging.ActionKey, msg.Attributes["action"]))
+		start := time.Now()
+		action, outcome := msg.Attributes["action"], metrics.OutcomeFailure
 		defer func() {
 			// Ack the msg irrespective of whether the message was successfully processed or not
 			// since we do not want the msg to be retried.
 			msg.Ack()
-			log.Infof("Handling of message %q ends", msg.ID)
+			metrics.ObservePubSubMessage(sub.ID(), action, outcome, time.Since(start))
+			slog.InfoContext(ctx, "Handling of message ends")
 		}()
 
-		log.Infof("Receiving a message from %q, message ID: %q", sub.ID(), msg.ID)
+		slog.InfoContext(ctx, "Receiving a message", "subscription", sub.ID())
 
 		// example actions: `on_search`, `on_select`
 		action, ok := msg.Attributes["action"]
 		if !ok {
-			log.Error(`"action" attribute is not present in the message`)
+			slog.ErrorContext(ctx, `"action" attribute is not present in the message`)
 			return
 		}
 
-		buyerEndpoint := s.config.BuyerAppURL + "/" + action
-		response, err := s.httpClient.Post(buyerEndpoint, "application/json", bytes.NewReader(msg.Data))
+		// Large payloads are offloaded to the claim check store by the publisher.
+		data, err := s.claimCheck.Data(ctx, msg)
 		if err != nil {
-			log.Errorf("Calling Buyer App failed: %v", err)
+			slog.ErrorContext(ctx, "Resolving payload failed", "error", err)
 			return
 		}
-		defer response.Body.Close()
 
-		responseBody, err := io.ReadAll(response.Body)
-		if err != nil {
-			log.Errorf("Reading response body failed: %v", err)
-			return
+		tracing.SetPayloadAttributes(ctx, data)
+		ctx = logging.WithPayloadContext(ctx, data)
+
+		// The buyer app still receives every on_search, so it is not failed on storing the results.
+		if action == "on_search" && s.searchResults != nil {
+			if err := s.storeSearchResults(ctx, data); err != nil {
+				slog.ErrorContext(ctx, "Storing search results failed", "error", err)
+			}
 		}
 
-		if response.StatusCode != http.StatusOK {
-			log.Errorf("Calling Buyer App got an error: status code %d, body %s", response.StatusCode, responseBody)
+		if err := s.deliver(ctx, msg.ID, action, data); err != nil {
+			slog.ErrorContext(ctx, "Delivering to Buyer App failed", "error", err)
 			return
 		}
 
-		log.Info("Handle the message successfully")
+		if err := s.claimCheck.Release(ctx, msg); err != nil {
+			slog.WarnContext(ctx, "Releasing payload failed", "error", err)
+		}
+
+		slog.InfoContext(ctx, "Handle the message successfully")
+		outcome = metrics.OutcomeSuccess
 		msg.Ack()
 	})
 
@@ -15,6 +15,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
@@ -24,6 +25,7 @@ import (
 
 	"cloud.google.com/go/pubsub"
 
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/keyclienttest"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/pubsubtest"
 )
@@ -59,13 +61,50 @@ func TestInitServerSuccess(t *testing.T) {
 		SubscriptionID: []string{subID},
 	}
 
-	_, err = initServer(ctx, httpClient, pubsubClient, conf)
+	_, err = initServer(ctx, httpClient, pubsubClient, nil, nil, nil, conf)
 
 	if err != nil {
 		t.Errorf("initServer() failed: %v", err)
 	}
 }
 
+func TestInitServerSigningKey(t *testing.T) {
+	const (
+		projectID = "test-project"
+		subID     = "test-subscription"
+	)
+	ctx := context.Background()
+	_, opt := pubsubtest.InitServer(t, projectID, []pubsubtest.PubsubSetup{
+		{
+			TopicID:   "test-topic",
+			SubSetups: []pubsubtest.SubSetup{{SubID: subID}},
+		},
+	})
+	pubsubClient, err := pubsub.NewClient(ctx, projectID, opt)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	keyClient := keyclienttest.NewStub(t)
+	want, err := keyClient.WebhookSigningKey(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := config.BuyerAdapterConfig{
+		ProjectID:      projectID,
+		BuyerAppURL:    "buyer.com/api",
+		SubscriptionID: []string{subID},
+		Webhook:        config.WebhookConfig{SecretID: "webhook-secret"},
+	}
+	srv, err := initServer(ctx, http.DefaultClient, pubsubClient, nil, keyClient, nil, conf)
+	if err != nil {
+		t.Fatalf("initServer() failed: %v", err)
+	}
+	if !bytes.Equal(srv.signingKey, want) {
+		t.Errorf("initServer() signing key = %x, want %x", srv.signingKey, want)
+	}
+}
+
 func TestInitServerFailed(t *testing.T) {
 	const (
 		projectID = "test-project"
@@ -109,9 +148,33 @@ func TestInitServerFailed(t *testing.T) {
 				SubscriptionID: []string{"non-exist-topic"},
 			},
 		},
+		{
+			httpClient: http.DefaultClient,
+			psClient:   pubsubClient,
+			config: config.BuyerAdapterConfig{
+				SubscriptionID: []string{subID},
+				SearchResults:  &config.SearchResultsConfig{InstanceID: "instance", DatabaseID: "database"},
+			},
+		},
+		{
+			httpClient: http.DefaultClient,
+			psClient:   pubsubClient,
+			config: config.BuyerAdapterConfig{
+				SubscriptionID: []string{subID},
+				Webhook:        config.WebhookConfig{SecretID: "webhook-secret"},
+			},
+		},
+		{
+			httpClient: http.DefaultClient,
+			psClient:   pubsubClient,
+			config: config.BuyerAdapterConfig{
+				SubscriptionID: []string{subID},
+				Webhook:        config.WebhookConfig{InitialBackoff: "soon"},
+			},
+		},
 	}
 	for _, test := range tests {
-		_, err = initServer(ctx, test.httpClient, test.psClient, test.config)
+		_, err = initServer(ctx, test.httpClient, test.psClient, nil, nil, nil, test.config)
 
 		if err == nil { // If NO error
 			t.Error("initServer() success unexpectedly")
@@ -151,7 +214,7 @@ func TestServSuccess(t *testing.T) {
 		SubscriptionID: []string{subID},
 	}
 
-	srv, err := initServer(ctx, httpClient, pubsubClient, conf)
+	srv, err := initServer(ctx, httpClient, pubsubClient, nil, nil, nil, conf)
 	if err != nil {
 		t.Errorf("initServer() failed: %v", err)
 	}
@@ -0,0 +1,167 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/deliveryclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/webhook"
+)
+
+// Defaults of the webhook config.
+const (
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 10 * time.Second
+)
+
+type keyClient interface {
+	WebhookSigningKey(context.Context) ([]byte, error)
+}
+
+type deliveryClient interface {
+	Ping(context.Context) error
+	RecordDelivery(context.Context, deliveryclient.Delivery) error
+	Deliveries(ctx context.Context, transactionID string) ([]deliveryclient.Delivery, error)
+}
+
+// deliveriesResponse is the response of the webhook delivery API.
+type deliveriesResponse struct {
+	Deliveries []deliveryclient.Delivery `json:"deliveries"`
+}
+
+// newDeliverer creates the deliverer of the callbacks with the retries of the config.
+func newDeliverer(httpClient *http.Client, conf config.WebhookConfig) (*webhook.Deliverer, error) {
+	maxAttempts := conf.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	initialBackoff, err := parseDuration(conf.InitialBackoff, defaultInitialBackoff)
+	if err != nil {
+		return nil, fmt.Errorf("invalid initial backoff: %v", err)
+	}
+	maxBackoff, err := parseDuration(conf.MaxBackoff, defaultMaxBackoff)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max backoff: %v", err)
+	}
+	return webhook.NewDeliverer(httpClient, maxAttempts, initialBackoff, maxBackoff)
+}
+
+// parseDuration parses the duration, or returns the default if it is empty.
+func parseDuration(s string, defaultDuration time.Duration) (time.Duration, error) {
+	if s == "" {
+		return defaultDuration, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// webhookURL returns the URL receiving the callback of the action for the buyer app of the BAP ID.
+func (s *server) webhookURL(action, bapID string) string {
+	if url, ok := s.config.Webhook.TenantURLs[bapID]; ok {
+		return url + "/" + action
+	}
+	if url, ok := s.config.Webhook.ActionURLs[action]; ok {
+		return url
+	}
+	return s.config.BuyerAppURL + "/" + action
+}
+
+// deliver delivers the callback of the Pub/Sub message to the buyer app, and logs the delivery if the log is set.
+func (s *server) deliver(ctx context.Context, deliveryID, action string, data []byte) error {
+	// The callback is delivered as is, even if its context cannot be read for routing it to the tenant.
+	var req struct {
+		Context model.Context `json:"context"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		slog.WarnContext(ctx, "Reading callback context failed", "error", err)
+	}
+	var bapID, transactionID, messageID string
+	if req.Context.BapID != nil {
+		bapID = *req.Context.BapID
+	}
+	if req.Context.TransactionID != nil {
+		transactionID = *req.Context.TransactionID
+	}
+	if req.Context.MessageID != nil {
+		messageID = *req.Context.MessageID
+	}
+
+	url := s.webhookURL(action, bapID)
+	result, err := s.deliverer.Deliver(ctx, url, deliveryID, s.signingKey, data)
+	slog.InfoContext(ctx, "Callback is delivered", "url", url, "attempts", result.Attempts, "status_code", result.StatusCode, "delivered", err == nil)
+
+	if s.deliveries == nil {
+		return err
+	}
+	if transactionID == "" {
+		slog.WarnContext(ctx, "Delivery of callback without transaction ID is not logged")
+		return err
+	}
+	d := deliveryclient.Delivery{
+		TransactionID: transactionID,
+		DeliveryID:    deliveryID,
+		MessageID:     messageID,
+		Action:        action,
+		URL:           url,
+		Attempts:      int64(result.Attempts),
+		StatusCode:    int64(result.StatusCode),
+		Delivered:     err == nil,
+	}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	// The delivery log is for reconciling the callbacks, so the outcome is that of the delivery.
+	if err := s.deliveries.RecordDelivery(ctx, d); err != nil {
+		slog.ErrorContext(ctx, "Logging delivery failed", "error", err)
+	}
+	return err
+}
+
+// listDeliveries handles GET /webhook/deliveries?transaction_id={id}, returning the deliveries of the callbacks
+// of the transaction in the order of their last attempt.
+func (s *server) listDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	transactionID := r.URL.Query().Get("transaction_id")
+	if transactionID == "" {
+		http.Error(w, "transaction_id is required", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := s.deliveries.Deliveries(ctx, transactionID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Reading deliveries failed", "transaction_id", transactionID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := deliveriesResponse{Deliveries: deliveries}
+	if response.Deliveries == nil {
+		response.Deliveries = []deliveryclient.Delivery{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.ErrorContext(ctx, "Writing deliveries failed", "error", err)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/deliveryclienttest"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/keyclienttest"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/webhook"
+)
+
+func TestWebhookURL(t *testing.T) {
+	s := &server{config: config.BuyerAdapterConfig{
+		BuyerAppURL: "https://buyer.com/api",
+		Webhook: config.WebhookConfig{
+			ActionURLs: map[string]string{"on_search": "https://search.buyer.com/results"},
+			TenantURLs: map[string]string{"tenant.com": "https://tenant.com/ondc"},
+		},
+	}}
+
+	tests := []struct {
+		action string
+		bapID  string
+		want   string
+	}{
+		{action: "on_select", bapID: "other.com", want: "https://buyer.com/api/on_select"},
+		{action: "on_search", bapID: "other.com", want: "https://search.buyer.com/results"},
+		{action: "on_search", bapID: "tenant.com", want: "https://tenant.com/ondc/on_search"},
+		{action: "on_select", bapID: "tenant.com", want: "https://tenant.com/ondc/on_select"},
+	}
+	for _, test := range tests {
+		if got := s.webhookURL(test.action, test.bapID); got != test.want {
+			t.Errorf("webhookURL(%q, %q) = %q, want %q", test.action, test.bapID, got, test.want)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	keyClient := keyclienttest.NewStub(t)
+	key, err := keyClient.WebhookSigningKey(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests int
+	buyerApp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify(key, r.Header, body, time.Now(), time.Minute); err != nil {
+			t.Errorf("Verify() of the delivery failed: %v", err)
+		}
+		if r.URL.Path != "/tenant/on_select" {
+			t.Errorf("Delivered to %q, want the tenant URL", r.URL.Path)
+		}
+		// The first attempt fails and is retried.
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer buyerApp.Close()
+
+	conf := config.WebhookConfig{
+		TenantURLs:     map[string]string{"tenant.com": buyerApp.URL + "/tenant"},
+		InitialBackoff: "1ms",
+	}
+	deliverer, err := newDeliverer(buyerApp.Client(), conf)
+	if err != nil {
+		t.Fatalf("newDeliverer() failed: %v", err)
+	}
+	deliveries := deliveryclienttest.NewStub()
+	s := &server{
+		config:     config.BuyerAdapterConfig{BuyerAppURL: buyerApp.URL, Webhook: conf},
+		signingKey: key,
+		deliverer:  deliverer,
+		deliveries: deliveries,
+	}
+
+	data := []byte(`{"context": {"bap_id": "tenant.com", "transaction_id": "T1", "message_id": "M1", "action": "on_select"}}`)
+	if err := s.deliver(context.Background(), "pubsub-1", "on_select", data); err != nil {
+		t.Fatalf("deliver() failed: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Buyer app got %d requests, want 2", requests)
+	}
+
+	// The delivery log is listed by the API.
+	rec := httptest.NewRecorder()
+	s.apiHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/webhook/deliveries?transaction_id=T1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /webhook/deliveries status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var res deliveriesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Unmarshal response failed: %v", err)
+	}
+	if len(res.Deliveries) != 1 {
+		t.Fatalf("GET /webhook/deliveries returned %d deliveries, want 1", len(res.Deliveries))
+	}
+	d := res.Deliveries[0]
+	if d.DeliveryID != "pubsub-1" || d.MessageID != "M1" || d.Action != "on_select" || d.Attempts != 2 || d.StatusCode != http.StatusOK || !d.Delivered {
+		t.Errorf("GET /webhook/deliveries = %+v, want a delivery of pubsub-1 after 2 attempts", d)
+	}
+}
+
+func TestDeliverFailed(t *testing.T) {
+	buyerApp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer buyerApp.Close()
+
+	deliverer, err := newDeliverer(buyerApp.Client(), config.WebhookConfig{})
+	if err != nil {
+		t.Fatalf("newDeliverer() failed: %v", err)
+	}
+	deliveries := deliveryclienttest.NewStub()
+	s := &server{
+		config:     config.BuyerAdapterConfig{BuyerAppURL: buyerApp.URL},
+		deliverer:  deliverer,
+		deliveries: deliveries,
+	}
+
+	data := []byte(`{"context": {"transaction_id": "T1", "message_id": "M1"}}`)
+	if err := s.deliver(context.Background(), "pubsub-1", "on_select", data); err == nil {
+		t.Fatal("deliver() succeeded unexpectedly")
+	}
+	got, err := deliveries.Deliveries(context.Background(), "T1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Delivered || got[0].Attempts != 1 || got[0].StatusCode != http.StatusBadRequest || got[0].Error == "" {
+		t.Errorf("Deliveries() = %+v, want a failed delivery after 1 attempt", got)
+	}
+}
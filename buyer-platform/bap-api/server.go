@@ -16,31 +16,42 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/pubsub"
 	"github.com/benbjohnson/clock"
-	log "github.com/golang/glog"
+	"golang.org/x/exp/slog"
 
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/claimcheck"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registryclient"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/transactionclient"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/errorcode"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/health"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/logging"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/middleware"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/ordering"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/policy"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/ratelimit"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/tracing"
 )
 
 const psMsgIDHeader = "Pubsub-Message-ID"
 
+// inFlightRetryAfter is the Retry-After in seconds of the retries received while the original is being published.
+const inFlightRetryAfter = "1"
+
 var validate = model.Validator()
 
 type server struct {
@@ -49,49 +60,63 @@ type server struct {
 	mux               http.Handler
 	port              int
 	transactionClient *transactionclient.Client
+	claimCheck        *claimcheck.ClaimCheck
+
+	health          *health.Checker
+	shutdownTimeout time.Duration
 }
 
 func main() {
-	flag.Set("alsologtostderr", "true")
+	logging.Init()
 	ctx := context.Background()
 
 	configPath, ok := os.LookupEnv("CONFIG")
 	if !ok {
-		log.Exit("CONFIG env is not set")
+		logging.Exit("CONFIG env is not set")
 	}
 
 	conf, err := config.Read[config.BAPAPIConfig](configPath)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Read config failed", "error", err)
+	}
+
+	shutdownTracing, err := tracing.Init(ctx, "bap-api")
+	if err != nil {
+		logging.Exit("Init tracing failed", "error", err)
 	}
+	defer shutdownTracing(ctx)
 
 	registryClient, err := registryclient.New(conf.RegistryURL, conf.ONDCEnvironment)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create registry client failed", "error", err)
 	}
 
 	pubsubClient, err := pubsub.NewClient(ctx, conf.ProjectID)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create Pub/Sub client failed", "error", err)
 	}
 
 	transactionClient, err := transactionclient.New(ctx, conf.ProjectID, conf.InstanceID, conf.DatabaseID)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create transaction client failed", "error", err)
 	}
 
 	srv, err := initServer(ctx, conf, pubsubClient, registryClient, transactionClient, clock.New())
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Init server failed", "error", err)
 	}
-	log.Info("Server initialization successs")
+	slog.Info("Server initialization successs")
 
-	err = srv.serve()
-	if errors.Is(err, http.ErrServerClosed) {
-		log.Info("Server is closed")
-	} else if err != nil {
-		log.Exitf("Serving failed: %v", err)
+	// Kubernetes sends SIGTERM for stopping the pod.
+	serveCtx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	health.ServeInBackground(serveCtx, conf.MetricsPort, srv.health)
+
+	if err := srv.serve(serveCtx); err != nil {
+		logging.Exit("Serving failed", "error", err)
 	}
+	slog.Info("Server is closed")
 }
 
 func initServer(ctx context.Context, conf config.BAPAPIConfig, pubsubClient *pubsub.Client, registryClient middleware.RegistryClient, transactionClient *transactionclient.Client, clk clock.Clock) (*server, error) {
@@ -106,7 +131,7 @@ func initServer(ctx context.Context, conf config.BAPAPIConfig, pubsubClient *pub
 		return nil, errors.New("init server: transaction client is nil")
 	}
 
-	topic := pubsubClient.Topic(conf.TopicID)
+	topic := ordering.Topic(pubsubClient, conf.TopicID)
 	exist, err := topic.Exists(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("init server: %v", err)
@@ -115,11 +140,37 @@ func initServer(ctx context.Context, conf config.BAPAPIConfig, pubsubClient *pub
 		return nil, fmt.Errorf("init server: topic %q does not exist", conf.TopicID)
 	}
 
+	shutdownTimeout, err := health.ParseShutdownTimeout(conf.ShutdownTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	claimCheck, err := claimcheck.Open(ctx, conf.ClaimCheck.StoreURL, conf.ClaimCheck.Threshold)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	limiter, err := ratelimit.New(conf.RateLimit, clk)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	pol := policy.New(config.PolicyConfig{})
+	if conf.PolicyPath != "" {
+		if pol, err = policy.Load(conf.PolicyPath); err != nil {
+			return nil, fmt.Errorf("init server: %v", err)
+		}
+		go pol.Watch(ctx, conf.PolicyPath, policy.ReloadInterval)
+	}
+	checks := []health.Check{health.TopicCheck(topic)}
+	checks = append(checks, health.Check{Name: "spanner", Check: transactionClient.Ping})
+
 	srv := &server{
 		pubsubClient:      pubsubClient,
 		topic:             topic,
 		port:              conf.Port,
 		transactionClient: transactionClient,
+		claimCheck:        claimCheck,
+
+		health:          health.NewChecker(checks...),
+		shutdownTimeout: shutdownTimeout,
 	}
 
 	mux := http.NewServeMux()
@@ -143,22 +194,69 @@ func initServer(ctx context.Context, conf config.BAPAPIConfig, pubsubClient *pub
 
 	srv.mux = middleware.Adapt(
 		mux,
+		middleware.RateLimit(mux, limiter, errorcode.RoleBuyerApp),
+		middleware.Policy(pol, errorcode.RoleBuyerApp),
 		middleware.NPAuthentication(registryClient, clk, errorcode.RoleBuyerApp, conf.SubscriberID),
 		middleware.OnlyPostMethod(),
 		middleware.Logging(),
+		middleware.ReadBody(conf.MaxBodySize, errorcode.RoleBuyerApp),
+		middleware.Metrics(mux),
+		middleware.Tracing(),
 	)
 
 	return srv, nil
 }
 
+// messageKey returns the key detecting the retries of the request.
+//
+// The sender is the authenticated subscriber, or the BPP of the context if the request is not authenticated.
+func messageKey(ctx context.Context, action string, msgContext model.Context) transactionclient.MessageKey {
+	subscriberID, ok := middleware.AuthenticatedSubscriber(ctx)
+	if !ok {
+		subscriberID = msgContext.BppID
+	}
+	return transactionclient.MessageKey{
+		SubscriberID:  subscriberID,
+		TransactionID: *msgContext.TransactionID,
+		MessageID:     *msgContext.MessageID,
+		Action:        action,
+	}
+}
+
 // decodeAndValidate decodes JSON body and validate the payload.
+//
+// The catalog of on_search requests is decoded from the body as a stream, validating each provider as it is decoded,
+// so the decoded request does not hold the providers besides the body.
 func decodeAndValidate(body []byte, payload any) error {
+	if onSearch, ok := payload.(*model.OnSearchRequest); ok {
+		var err error
+		if *onSearch, err = model.DecodeOnSearchRequest(bytes.NewReader(body)); err != nil {
+			return err
+		}
+		return validate.Struct(onSearch)
+	}
+
 	if err := json.Unmarshal(body, &payload); err != nil {
 		return err
 	}
 	return validate.Struct(payload)
 }
 
+// bodyContext decodes the context of the request body, which may be otherwise invalid.
+//
+// It reports whether the body has a context with the transaction and message IDs.
+func bodyContext(body []byte) (model.Context, bool) {
+	var req struct {
+		Context *model.Context `json:"context"`
+	}
+	// The errors of the other fields are ignored, as the context is decoded whenever it is valid.
+	json.Unmarshal(body, &req)
+	if req.Context == nil || req.Context.TransactionID == nil || req.Context.MessageID == nil {
+		return model.Context{}, false
+	}
+	return *req.Context, true
+}
+
 // nackResponse returns an appropriate status code and response body for invalid request body.
 func nackResponse(w http.ResponseWriter, errType, errCode string) {
 	res := model.AckResponse{
@@ -205,38 +303,44 @@ func ackResponse(w http.ResponseWriter) {
 	w.Write(resJSON)
 }
 
-func (s *server) serve() error {
+// serve serves the requests until ctx is done, then shuts down gracefully.
+func (s *server) serve(ctx context.Context) error {
 	addr := fmt.Sprintf(":%d", s.port)
-	log.Info("Server is serving")
-	return http.ListenAndServe(addr, s.mux)
+	slog.Info("Server is serving")
+	return health.ListenAndServe(ctx, &http.Server{Addr: addr, Handler: s.mux}, s.health, s.shutdownTimeout)
 }
 
 // publishMessage publishes incoming request to the topic and return the publishing result.
-func (s *server) publishMessage(ctx context.Context, body []byte, action string) (msgID string, err error) {
+//
+// The messages of a transaction are published in order. Large bodies are offloaded to the claim check store.
+func (s *server) publishMessage(ctx context.Context, body []byte, action, transactionID string) (msgID string, err error) {
 	msg := &pubsub.Message{
-		Data: body,
 		Attributes: map[string]string{
 			"action": action,
 		},
+		OrderingKey: transactionID,
 	}
-	result := s.topic.Publish(ctx, msg)
-	return result.Get(ctx)
+	if err := s.claimCheck.SetData(ctx, msg, body); err != nil {
+		return "", err
+	}
+	tracing.InjectPubSub(ctx, msg)
+	return ordering.Publish(ctx, s.topic, msg)
 }
 
 // genericHandler can handles all kind of ONDC request.
 func genericHandler[R model.BAPRequest](s *server, action string, w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	body, err := io.ReadAll(r.Body)
+	body, err := middleware.RequestBody(r)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Errorf("Read request body: %v", err)
+		slog.ErrorContext(ctx, "Read request body", "error", err)
 		return
 	}
 
 	var payload R
 	if err := decodeAndValidate(body, &payload); err != nil {
-		log.Errorf("Request body is invalid: %v", err)
+		slog.ErrorContext(ctx, "Request body is invalid", "error", err)
 		errCodeInt, ok := errorcode.Lookup(errorcode.RoleSellerApp, errorcode.ErrInvalidRequest)
 		if !ok {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -245,8 +349,15 @@ func genericHandler[R model.BAPRequest](s *server, action string, w http.Respons
 
 		errType := "JSON-SCHEMA-ERROR"
 		errCode := strconv.Itoa(errCodeInt)
-		if err := s.storeTransaction(ctx, action, "NACK", payload, payload.GetContext(), errType, errCode, err.Error()); err != nil {
-			log.Errorf("Store transaction for invalid request failed: %v", err)
+		// The payload may be partly decoded, so the context is decoded from the body.
+		msgContext, ok := bodyContext(body)
+		if !ok {
+			slog.WarnContext(ctx, "Invalid request without context is not stored")
+			nackResponse(w, errType, errCode)
+			return
+		}
+		if err := s.storeTransaction(ctx, action, "NACK", payload, msgContext, errType, errCode, err.Error()); err != nil {
+			slog.ErrorContext(ctx, "Store transaction for invalid request failed", "error", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(err.Error()))
 			return
@@ -256,23 +367,60 @@ func genericHandler[R model.BAPRequest](s *server, action string, w http.Respons
 		return
 	}
 
-	if err := s.storeTransaction(ctx, action, "ACK", payload, payload.GetContext(), "", "", ""); err != nil {
-		log.Errorf("Store transaction for valid request failed: %v", err)
+	key := messageKey(ctx, action, payload.GetContext())
+	originalMsgID, err := s.transactionClient.ClaimMessage(ctx, key)
+	if errors.Is(err, transactionclient.ErrDuplicate) {
+		slog.InfoContext(ctx, "Duplicate request is acknowledged without publishing", "original_pubsub_message_id", originalMsgID)
+		if err := s.storeDuplicateTransaction(ctx, action, json.RawMessage(body), payload.GetContext()); err != nil {
+			slog.ErrorContext(ctx, "Store transaction for duplicate request failed", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.Header().Set(psMsgIDHeader, originalMsgID)
+		ackResponse(w)
+		return
+	}
+	if errors.Is(err, transactionclient.ErrInFlight) {
+		// The retry is not acknowledged, as it is lost if the original fails to be published.
+		slog.InfoContext(ctx, "Retry of the request being published is rejected")
+		w.Header().Set("Retry-After", inFlightRetryAfter)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Claim message failed", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	// The received body is stored, as on_search requests are decoded without their providers.
+	if err := s.storeTransaction(ctx, action, "ACK", json.RawMessage(body), payload.GetContext(), "", "", ""); err != nil {
+		slog.ErrorContext(ctx, "Store transaction for valid request failed", "error", err)
+		s.releaseMessage(ctx, key)
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
 		return
 	}
 
-	msgID, err := s.publishMessage(ctx, body, action)
+	msgID, err := s.publishMessage(ctx, body, action, *payload.GetContext().TransactionID)
 	if err != nil {
+		s.releaseMessage(ctx, key)
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Errorf("Publish Pub/Sub message: %v", err)
+		slog.ErrorContext(ctx, "Publish Pub/Sub message", "error", err)
 		return
 	}
 	w.Header().Set(psMsgIDHeader, msgID)
+	ctx = logging.With(ctx, slog.String(logging.PubSubMessageIDKey, msgID))
+
+	if err := s.transactionClient.CompleteMessage(ctx, key, msgID); err != nil {
+		// The message is published, so the request is acknowledged. Its retries are published again after the claim times out.
+		slog.ErrorContext(ctx, "Complete message failed", "error", err)
+	}
 
 	ackResponse(w)
-	log.Infof("Successfully ack request: TransactionID: %q, MessageID: %q", *payload.GetContext().TransactionID, *payload.GetContext().MessageID)
+	slog.InfoContext(ctx, "Successfully ack request")
 }
 
 func (s *server) storeTransaction(ctx context.Context, action, status string, payload any, msgContext model.Context, errType, errCode, errMsg string) error {
@@ -292,6 +440,29 @@ func (s *server) storeTransaction(ctx context.Context, action, status string, pa
 	return s.transactionClient.StoreTransaction(ctx, transactionData)
 }
 
+// storeDuplicateTransaction records a retry of a received request, which is acknowledged without publishing.
+func (s *server) storeDuplicateTransaction(ctx context.Context, action string, payload any, msgContext model.Context) error {
+	transactionData := transactionclient.TransactionData{
+		ID:              *msgContext.TransactionID,
+		Type:            "CALLBACK-ACTION",
+		API:             action,
+		MessageID:       *msgContext.MessageID,
+		Payload:         payload,
+		ProviderID:      msgContext.BppID,
+		MessageStatus:   "ACK",
+		ReqReceivedTime: time.Now(),
+		Duplicate:       true,
+	}
+	return s.transactionClient.StoreTransaction(ctx, transactionData)
+}
+
+// releaseMessage releases the claim of a request failed to be published, so its retry is published.
+func (s *server) releaseMessage(ctx context.Context, key transactionclient.MessageKey) {
+	if err := s.transactionClient.ReleaseMessage(ctx, key); err != nil {
+		slog.ErrorContext(ctx, "Release message failed", "error", err)
+	}
+}
+
 func (s *server) onSearchHandler(w http.ResponseWriter, r *http.Request) {
 	genericHandler[model.OnSearchRequest](s, "on_search", w, r)
 }
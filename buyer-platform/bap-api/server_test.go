@@ -304,6 +304,55 @@ func TestHandlersSuccess(t *testing.T) {
 	}
 }
 
+func TestHandlersDuplicateRequest(t *testing.T) {
+	hash := uuid.New().String()[:8]
+	projectID := fmt.Sprintf("test-project-%s", hash)
+	topicID := fmt.Sprintf("bap-topic-%s", hash)
+	instanceID := fmt.Sprintf("test-instance-%s", hash)
+	databaseID := fmt.Sprintf("test-database-%s", hash)
+
+	ctx := context.Background()
+	psSrv, opt := pubsubtest.InitServer(t, projectID, []pubsubtest.PubsubSetup{{TopicID: topicID}})
+	pubsubClient, err := pubsub.NewClient(ctx, projectID, opt)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	conf := config.BAPAPIConfig{
+		ProjectID: projectID,
+		TopicID:   topicID,
+	}
+	opts := transactiontest.NewDatabase(ctx, t, projectID, instanceID, databaseID)
+	transactionClient, err := transactionclient.New(ctx, projectID, instanceID, databaseID, opts...)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	srv, err := initServer(ctx, conf, pubsubClient, registryclienttest.NewStub(), transactionClient, clock.New())
+	if err != nil {
+		t.Fatalf("initServer() failed: %v", err)
+	}
+
+	var msgIDs []string
+	for i := 0; i < 2; i++ {
+		request := httptest.NewRequest(http.MethodPost, "/on_select", bytes.NewReader(onSelectRequestPayload))
+		response := httptest.NewRecorder()
+
+		srv.onSelectHandler(response, request)
+
+		if got, want := response.Code, http.StatusOK; got != want {
+			t.Fatalf("onSelectHandler() #%d got status %d, want %d", i, got, want)
+		}
+		msgIDs = append(msgIDs, response.Header().Get(psMsgIDHeader))
+	}
+
+	if msgIDs[0] == "" || msgIDs[1] != msgIDs[0] {
+		t.Errorf("onSelectHandler() Pub/Sub message IDs = %q, want the ID of the original message", msgIDs)
+	}
+	if got, want := len(psSrv.Messages()), 1; got != want {
+		t.Errorf("onSelectHandler() published %d messages, want %d", got, want)
+	}
+}
+
 func TestHandlersInvalidPayload(t *testing.T) {
 	hash := uuid.New().String()[:8]
 	projectID := fmt.Sprintf("test-project-%s", hash)
@@ -430,3 +479,69 @@ func TestHandlersInvalidPayload(t *testing.T) {
 		})
 	}
 }
+
+func TestOnSearchHandlerMalformedProvider(t *testing.T) {
+	hash := uuid.New().String()[:8]
+	projectID := fmt.Sprintf("test-project-%s", hash)
+	topicID := fmt.Sprintf("bap-topic-%s", hash)
+	instanceID := fmt.Sprintf("test-instance-%s", hash)
+	databaseID := fmt.Sprintf("test-database-%s", hash)
+
+	ctx := context.Background()
+	psSrv, opt := pubsubtest.InitServer(t, projectID, []pubsubtest.PubsubSetup{{TopicID: topicID}})
+	pubsubClient, err := pubsub.NewClient(ctx, projectID, opt)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	opts := transactiontest.NewDatabase(ctx, t, projectID, instanceID, databaseID)
+	transactionClient, err := transactionclient.New(ctx, projectID, instanceID, databaseID, opts...)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	srv, err := initServer(ctx, config.BAPAPIConfig{ProjectID: projectID, TopicID: topicID}, pubsubClient, registryclienttest.NewStub(), transactionClient, clock.New())
+	if err != nil {
+		t.Fatalf("initServer() failed: %v", err)
+	}
+
+	// The price value of the provider item must be a string.
+	payload := bytes.Replace(onSearchRequestPayload, []byte(`"parent_item_id": "string",`), []byte(`"parent_item_id": "string", "price": {"value": 12},`), 1)
+	request := httptest.NewRequest(http.MethodPost, "/on_search", bytes.NewReader(payload))
+	response := httptest.NewRecorder()
+	srv.onSearchHandler(response, request)
+
+	if got, want := response.Code, http.StatusBadRequest; got != want {
+		t.Fatalf("onSearchHandler got status %d, want %d", got, want)
+	}
+	var wantAck, gotAck model.AckResponse
+	if err := json.Unmarshal(nackResponsePayload, &wantAck); err != nil {
+		t.Fatalf("Unmarshal want response body got error: %v", err)
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &gotAck); err != nil {
+		t.Fatalf("Unmarshal response body got error: %v", err)
+	}
+	if diff := cmp.Diff(wantAck, gotAck); diff != "" {
+		t.Errorf("onSearchHandler response body diff (-want, +got):\n%s", diff)
+	}
+	if got := len(psSrv.Messages()); got != 0 {
+		t.Errorf("onSearchHandler published %d messages, want 0", got)
+	}
+}
+
+func TestBodyContext(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{name: "valid", body: string(onSearchRequestPayload), want: true},
+		{name: "malformed message", body: `{"context": {"transaction_id": "transaction-id", "message_id": "message-id"}, "message": {"catalog": 1}}`, want: true},
+		{name: "no message ID", body: `{"context": {"transaction_id": "transaction-id"}}`},
+		{name: "no context", body: `{"message": {}}`},
+		{name: "not JSON", body: `not JSON`},
+	}
+	for _, test := range tests {
+		if _, got := bodyContext([]byte(test.body)); got != test.want {
+			t.Errorf("%s: bodyContext() = %t, want %t", test.name, got, test.want)
+		}
+	}
+}
@@ -18,21 +18,27 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"errors"
-	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"cloud.google.com/go/pubsub"
-	log "github.com/golang/glog"
+	"golang.org/x/exp/slog"
 
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/claimcheck"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/errorcode"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/health"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/logging"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/middleware"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/ordering"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/tracing"
 )
 
 const psMsgIDHeader = "Pubsub-Message-ID"
@@ -44,43 +50,57 @@ type server struct {
 	topic        *pubsub.Topic
 	mux          http.Handler
 	conf         config.BuyerAppConfig
+	claimCheck   *claimcheck.ClaimCheck
+
+	health          *health.Checker
+	shutdownTimeout time.Duration
 }
 
 func main() {
-	flag.Set("alsologtostderr", "true")
+	logging.Init()
 	ctx := context.Background()
 
 	configPath, ok := os.LookupEnv("CONFIG")
 	if !ok {
-		log.Exit("CONFIG env is not set")
+		logging.Exit("CONFIG env is not set")
 	}
 
 	conf, err := config.Read[config.BuyerAppConfig](configPath)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Read config failed", "error", err)
+	}
+
+	shutdownTracing, err := tracing.Init(ctx, "buyer-app-service")
+	if err != nil {
+		logging.Exit("Init tracing failed", "error", err)
 	}
+	defer shutdownTracing(ctx)
 
 	pubsubClient, err := pubsub.NewClient(ctx, conf.ProjectID)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create Pub/Sub client failed", "error", err)
 	}
 
 	srv, err := initServer(ctx, conf, pubsubClient)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Init server failed", "error", err)
 	}
-	log.Info("Server initialization successs")
+	slog.Info("Server initialization successs")
 
-	err = srv.serve()
-	if errors.Is(err, http.ErrServerClosed) {
-		log.Info("Server is closed")
-	} else if err != nil {
-		log.Exitf("Serving failed: %v", err)
+	// Kubernetes sends SIGTERM for stopping the pod.
+	serveCtx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	health.ServeInBackground(serveCtx, conf.MetricsPort, srv.health)
+
+	if err := srv.serve(serveCtx); err != nil {
+		logging.Exit("Serving failed", "error", err)
 	}
+	slog.Info("Server is closed")
 }
 
 func initServer(ctx context.Context, conf config.BuyerAppConfig, pubsubClient *pubsub.Client) (*server, error) {
-	topic := pubsubClient.Topic(conf.TopicID)
+	topic := ordering.Topic(pubsubClient, conf.TopicID)
 	exist, err := topic.Exists(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("init server: checking if the topic %q exists: %v", conf.TopicID, err)
@@ -89,10 +109,24 @@ func initServer(ctx context.Context, conf config.BuyerAppConfig, pubsubClient *p
 		return nil, fmt.Errorf("init server: topic %q does not exist", conf.TopicID)
 	}
 
+	shutdownTimeout, err := health.ParseShutdownTimeout(conf.ShutdownTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	claimCheck, err := claimcheck.Open(ctx, conf.ClaimCheck.StoreURL, conf.ClaimCheck.Threshold)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	checks := []health.Check{health.TopicCheck(topic)}
+
 	srv := &server{
 		pubsubClient: pubsubClient,
 		topic:        topic,
 		conf:         conf,
+		claimCheck:   claimCheck,
+
+		health:          health.NewChecker(checks...),
+		shutdownTimeout: shutdownTimeout,
 	}
 
 	mux := http.NewServeMux()
@@ -119,15 +153,18 @@ func initServer(ctx context.Context, conf config.BuyerAppConfig, pubsubClient *p
 		mux,
 		middleware.OnlyPostMethod(),
 		middleware.Logging(),
+		middleware.Metrics(mux),
+		middleware.Tracing(),
 	)
 
 	return srv, nil
 }
 
-func (s *server) serve() error {
+// serve serves the requests until ctx is done, then shuts down gracefully.
+func (s *server) serve(ctx context.Context) error {
 	addr := fmt.Sprintf(":%d", s.conf.Port)
-	log.Info("Server is serving")
-	return http.ListenAndServe(addr, s.mux)
+	slog.Info("Server is serving")
+	return health.ListenAndServe(ctx, &http.Server{Addr: addr, Handler: s.mux}, s.health, s.shutdownTimeout)
 }
 
 // genericHandler can handles all kind of ONDC request.
@@ -138,22 +175,23 @@ func genericHandler[R model.BPPRequest](s *server, action string, w http.Respons
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
-		log.Errorf("Read request body: %v", err)
+		slog.ErrorContext(ctx, "Read request body", "error", err)
 		return
 	}
 
 	var payload R
 	if err := decodeAndValidate(body, &payload); err != nil {
 		nackResponse(w)
-		log.Errorf("Request body is invalid: %v", err)
+		slog.ErrorContext(ctx, "Request body is invalid", "error", err)
 		return
 	}
+	tracing.SetContextAttributes(ctx, payload.GetContext())
 
-	msgID, err := s.publishMessage(ctx, body, action)
+	msgID, err := s.publishMessage(ctx, body, action, *payload.GetContext().TransactionID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
-		log.Errorf("Publish Pub/Sub message: %v", err)
+		slog.ErrorContext(ctx, "Publish Pub/Sub message", "error", err)
 		return
 	}
 	w.Header().Set(psMsgIDHeader, msgID)
@@ -225,15 +263,20 @@ func nackResponse(w http.ResponseWriter) {
 }
 
 // publishMessage publishes incoming request to the topic and return the publishing result.
-func (s *server) publishMessage(ctx context.Context, body []byte, action string) (msgID string, err error) {
+//
+// The messages of a transaction are published in order. Large bodies are offloaded to the claim check store.
+func (s *server) publishMessage(ctx context.Context, body []byte, action, transactionID string) (msgID string, err error) {
 	msg := &pubsub.Message{
-		Data: body,
 		Attributes: map[string]string{
 			"action": action,
 		},
+		OrderingKey: transactionID,
+	}
+	if err := s.claimCheck.SetData(ctx, msg, body); err != nil {
+		return "", err
 	}
-	result := s.topic.Publish(ctx, msg)
-	return result.Get(ctx)
+	tracing.InjectPubSub(ctx, msg)
+	return ordering.Publish(ctx, s.topic, msg)
 }
 
 func (s *server) searchHandler(w http.ResponseWriter, r *http.Request) {
@@ -26,7 +26,9 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/health"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/ordering"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/pubsubtest"
 
 	_ "embed"
@@ -88,6 +90,61 @@ func TestInitServerSuccess(t *testing.T) {
 	}
 }
 
+func TestInitServerInvalidShutdownTimeout(t *testing.T) {
+	const (
+		projectID = "test-project"
+		topicID   = "test-topic"
+	)
+	ctx := context.Background()
+	conf := config.BuyerAppConfig{
+		ProjectID:       projectID,
+		TopicID:         topicID,
+		ShutdownTimeout: "30",
+	}
+
+	_, opt := pubsubtest.InitServer(t, projectID, []pubsubtest.PubsubSetup{{TopicID: topicID}})
+	pubsubClient, err := pubsub.NewClient(ctx, conf.ProjectID, opt)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	if _, err := initServer(ctx, conf, pubsubClient); err == nil {
+		t.Errorf("initServer() succeeded unexpectedly")
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	const (
+		projectID = "test-project"
+		topicID   = "test-topic"
+	)
+	ctx := context.Background()
+	conf := config.BuyerAppConfig{
+		ProjectID: projectID,
+		TopicID:   topicID,
+	}
+
+	_, opt := pubsubtest.InitServer(t, projectID, []pubsubtest.PubsubSetup{{TopicID: topicID}})
+	pubsubClient, err := pubsub.NewClient(ctx, conf.ProjectID, opt)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	srv, err := initServer(ctx, conf, pubsubClient)
+	if err != nil {
+		t.Fatalf("initServer() failed: %v", err)
+	}
+
+	// The metrics, health and readiness endpoints are served on the metrics port only.
+	for _, path := range []string{"/metrics", health.LivenessPath, health.ReadinessPath} {
+		response := httptest.NewRecorder()
+		srv.mux.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+		if response.Code == http.StatusOK {
+			t.Errorf("GET %s status = %d, want the endpoint not served", path, response.Code)
+		}
+	}
+}
+
 func TestHandlersSuccess(t *testing.T) {
 	const (
 		projectID  = "test-project"
@@ -217,6 +274,9 @@ func TestHandlersSuccess(t *testing.T) {
 			if bytes.Compare(psMsg.Data, test.body) != 0 {
 				t.Errorf("%s Pub/Sub message data is not equal to request body", test.handlerName)
 			}
+			if got, want := psMsg.OrderingKey, ordering.Key(test.body); got == "" || got != want {
+				t.Errorf("%s Pub/Sub message ordering key = %q, want the transaction ID %q", test.handlerName, got, want)
+			}
 		})
 	}
 }
@@ -19,24 +19,31 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/pubsub"
 	"github.com/benbjohnson/clock"
-	log "github.com/golang/glog"
+	"golang.org/x/exp/slog"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/api/option"
 
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/claimcheck"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/keyclient"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/transactionclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/compression"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/health"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/logging"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/metrics"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/signing-authentication/authentication"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/tracing"
 )
 
 type server struct {
@@ -47,7 +54,11 @@ type server struct {
 	transactionClient *transactionclient.Client
 	clk               clock.Clock
 
-	subs []*pubsub.Subscription
+	subs       []*pubsub.Subscription
+	claimCheck *claimcheck.ClaimCheck
+
+	health          *health.Checker
+	shutdownTimeout time.Duration
 }
 
 type keyClient interface {
@@ -55,34 +66,47 @@ type keyClient interface {
 }
 
 func main() {
-	flag.Set("alsologtostderr", "true")
+	logging.Init()
 	ctx := context.Background()
 
 	configPath, ok := os.LookupEnv("CONFIG")
 	if !ok {
-		log.Exit("CONFIG env is not set")
+		logging.Exit("CONFIG env is not set")
 	}
 
 	conf, err := config.Read[config.RequestActionConfig](configPath)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Read config failed", "error", err)
 	}
 
+	shutdownTracing, err := tracing.Init(ctx, "request-action-service")
+	if err != nil {
+		logging.Exit("Init tracing failed", "error", err)
+	}
+	defer shutdownTracing(ctx)
+
 	keyClient, err := keyclient.New(ctx, conf.ProjectID, conf.SecretID)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create key client failed", "error", err)
 	}
 
 	srv, err := initServer(ctx, conf, clock.New(), keyClient, nil, nil)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Init server failed", "error", err)
 	}
 	defer srv.close()
-	log.Info("Server initialization successs")
+	slog.Info("Server initialization successs")
+
+	// Kubernetes sends SIGTERM for stopping the pod.
+	serveCtx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	if err := srv.serve(ctx); err != nil {
-		log.Exitf("Serving failed: %v", err)
+	health.ServeInBackground(serveCtx, conf.MetricsPort, srv.health)
+
+	if err := srv.serve(serveCtx); err != nil {
+		logging.Exit("Serving failed", "error", err)
 	}
+	slog.Info("Server is closed")
 }
 
 func initServer(ctx context.Context, conf config.RequestActionConfig, clk clock.Clock, keyClient keyClient, pubsubOpts, transportOpts []option.ClientOption) (*server, error) {
@@ -117,14 +141,39 @@ func initServer(ctx context.Context, conf config.RequestActionConfig, clk clock.
 		subs = append(subs, sub)
 	}
 
+	shutdownTimeout, err := health.ParseShutdownTimeout(conf.ShutdownTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	claimCheck, err := claimcheck.Open(ctx, conf.ClaimCheck.StoreURL, conf.ClaimCheck.Threshold)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	checks := make([]health.Check, 0, len(subs)+2)
+	for _, sub := range subs {
+		checks = append(checks, health.SubscriptionCheck(sub))
+	}
+	checks = append(checks, health.Check{Name: "spanner", Check: transactionClient.Ping})
+	checks = append(checks, health.Check{
+		Name: "signing key",
+		Check: func(ctx context.Context) error {
+			_, err := keyClient.ServiceSigningPrivateKeyset(ctx)
+			return err
+		},
+	})
+
 	server := &server{
 		conf:              conf,
 		pubsubClient:      pubsubClient,
-		httpClient:        http.DefaultClient,
+		httpClient:        tracing.InstrumentClient(metrics.InstrumentClient(compression.InstrumentClient(http.DefaultClient))),
 		keyClient:         keyClient,
 		transactionClient: transactionClient,
 		clk:               clk,
 		subs:              subs,
+		claimCheck:        claimCheck,
+
+		health:          health.NewChecker(checks...),
+		shutdownTimeout: shutdownTimeout,
 	}
 	return server, nil
 }
@@ -132,6 +181,7 @@ func initServer(ctx context.Context, conf config.RequestActionConfig, clk clock.
 // close closed underlying connections.
 func (s *server) close() {
 	s.pubsubClient.Close()
+	s.claimCheck.Close()
 }
 
 // serve handles multiple Pub/Sub subscriptions in parallel.
@@ -146,34 +196,53 @@ func (s *server) serve(ctx context.Context) error {
 		})
 	}
 
-	log.Info("Ready to receive messages")
+	slog.Info("Ready to receive messages")
 	return g.Wait()
 }
 
 // handleSubscription receives and handles messages from the Pub/Sub subscription.
 func (s *server) handleSubscription(ctx context.Context, sub *pubsub.Subscription) error {
 	err := sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		// The context is canceled as soon as the shutdown starts, but the in-flight message can be finished.
+		ctx, cancel := health.DelayCancel(ctx, s.shutdownTimeout)
+		defer cancel()
+		ctx, span := tracing.StartPubSubSpan(ctx, sub.ID(), msg)
+		defer span.End()
+		ctx = logging.With(ctx, slog.String(logging.PubSubMessageIDKey, msg.ID), slog.String(logging.ActionKey, msg.Attributes["action"]))
+		start := time.Now()
+		action, outcome := msg.Attributes["action"], metrics.OutcomeFailure
 		defer func() {
 			// Ack the msg irrespective of whether the message was successfully processed or not
 			// since we do not want the msg to be retried.
 			msg.Ack()
-			log.Infof("Handling of message %q ends", msg.ID)
+			metrics.ObservePubSubMessage(sub.ID(), action, outcome, time.Since(start))
+			slog.InfoContext(ctx, "Handling of message ends")
 		}()
 
-		log.Infof("Receiving a message from %q, message ID: %q", sub.ID(), msg.ID)
+		slog.InfoContext(ctx, "Receiving a message", "subscription", sub.ID())
 
 		// example action: `search`, `select`
 		action, ok := msg.Attributes["action"]
 		if !ok {
-			log.Error(`"action" attribute is not present in the message`)
+			slog.ErrorContext(ctx, `"action" attribute is not present in the message`)
+			return
+		}
+
+		// Large payloads are offloaded to the claim check store by the publisher.
+		data, err := s.claimCheck.Data(ctx, msg)
+		if err != nil {
+			slog.ErrorContext(ctx, "Resolving payload failed", "error", err)
 			return
 		}
 
 		var originalReq model.GenericRequest
-		if err := json.Unmarshal(msg.Data, &originalReq); err != nil {
-			log.Errorf("Unmarshal request failed: %v", err)
+		if err := json.Unmarshal(data, &originalReq); err != nil {
+			slog.ErrorContext(ctx, "Unmarshal request failed", "error", err)
 			return
 		}
+		tracing.SetContextAttributes(ctx, *originalReq.Context)
+		ctx = logging.WithMessageContext(ctx, *originalReq.Context)
+		ctx = logging.With(ctx, slog.String(logging.SubscriberIDKey, originalReq.Context.BppID))
 
 		// Determine the request endpoint
 		var url string
@@ -188,41 +257,46 @@ func (s *server) handleSubscription(ctx context.Context, sub *pubsub.Subscriptio
 		*originalReq.Context.BapURI = s.conf.SubscriberURL
 		adjustedReqJSON, err := json.Marshal(originalReq)
 		if err != nil {
-			log.Errorf("Marshal adjusted request failed: %v", err)
+			slog.ErrorContext(ctx, "Marshal adjusted request failed", "error", err)
 			return
 		}
 
 		request, err := s.createONDCRequest(ctx, action, url, adjustedReqJSON)
 		if err != nil {
-			log.Errorf("Creating request failed: %v", err)
+			slog.ErrorContext(ctx, "Creating request failed", "error", err)
 			return
 		}
 
 		// send a request to ONDC network
 		response, err := s.httpClient.Do(request)
 		if err != nil {
-			log.Errorf("Sending request to ONDC network failed: %v", err)
+			slog.ErrorContext(ctx, "Sending request to ONDC network failed", "error", err)
 			return
 		}
 		defer response.Body.Close()
 
 		responseBody, err := io.ReadAll(response.Body)
 		if err != nil {
-			log.Errorf("Reading response body failed: %v", err)
+			slog.ErrorContext(ctx, "Reading response body failed", "error", err)
 			return
 		}
 
 		if err := s.storeTransaction(ctx, action, adjustedReqJSON, responseBody); err != nil {
-			log.Errorf("Storing transaction failed: %v", err)
+			slog.ErrorContext(ctx, "Storing transaction failed", "error", err)
 			return
 		}
 
 		if response.StatusCode != http.StatusOK {
-			log.Infof("Sending request to ONDC network got an error: status code %d, body %s", response.StatusCode, responseBody)
+			slog.ErrorContext(ctx, "Sending request to ONDC network got an error", "status_code", response.StatusCode, "body", string(responseBody))
 			return
 		}
 
-		log.Info("Handle the message successfully")
+		if err := s.claimCheck.Release(ctx, msg); err != nil {
+			slog.WarnContext(ctx, "Releasing payload failed", "error", err)
+		}
+
+		slog.InfoContext(ctx, "Handle the message successfully")
+		outcome = metrics.OutcomeSuccess
 		msg.Ack()
 	})
 
@@ -245,7 +319,7 @@ func (s *server) createONDCRequest(ctx context.Context, action, url string, body
 	}
 
 	requestURL := url + "/" + action
-	request, err := http.NewRequest(http.MethodPost, requestURL, bytes.NewReader(body))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -19,18 +19,21 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
-	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
-	log "github.com/golang/glog"
+	"golang.org/x/exp/slog"
 
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/keyclient"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registryclient"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/crypto"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/health"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/logging"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/signing-authentication/authentication"
 )
@@ -46,6 +49,11 @@ type config struct {
 	SubscriberID    string
 	RotationPeriod  time.Duration
 	ONDCEnvironment string
+
+	// MetricsPort is the port serving the /metrics, /healthz and /readyz endpoints. The default is 9090.
+	MetricsPort int
+	// ShutdownTimeout is the time for finishing the in-flight requests on SIGTERM.
+	ShutdownTimeout time.Duration
 }
 
 // secretManagerEvent is a Pub/Sub message describing an event of the Secret Manager.
@@ -84,76 +92,91 @@ type server struct {
 	keyClient      keyClient
 	registryClient registryClient
 
-	conf config
+	conf   config
+	health *health.Checker
 }
 
 func main() {
-	flag.Set("alsologtostderr", "true")
+	logging.Init()
 	ctx := context.Background()
 
 	projectId, ok := os.LookupEnv("PROJECT_ID")
 	if !ok {
-		log.Exit("PROJECT_ID env is not set")
+		logging.Exit("PROJECT_ID env is not set")
 	}
 
 	secretId, ok := os.LookupEnv("SECRET_ID")
 	if !ok {
-		log.Exit("SECRET_ID env is not set")
-	}
-
-	registryUrl, ok := os.LookupEnv("REGISTRY_URL")
-	if !ok {
-		log.Exit("REGISTRY_URL env is not set")
+		logging.Exit("SECRET_ID env is not set")
 	}
 
 	requestID, ok := os.LookupEnv("REQUEST_ID")
 	if !ok {
-		log.Exit("REQUEST_ID env is not set")
+		logging.Exit("REQUEST_ID env is not set")
 	}
 
 	subscriberID, ok := os.LookupEnv("SUBSCRIBER_ID")
 	if !ok {
-		log.Exit("SUBSCRIBER_ID env is not set")
+		logging.Exit("SUBSCRIBER_ID env is not set")
 	}
 
 	rotationPeriod, ok := os.LookupEnv("ROTATION_PERIOD")
 	if !ok {
-		log.Exit("ROTATION_PERIOD env is not set")
+		logging.Exit("ROTATION_PERIOD env is not set")
 	}
 	rotationDuration, err := time.ParseDuration(rotationPeriod)
 	if err != nil {
-		log.Exitf("ROTATION_PERIOD is invalid: %v", err)
+		logging.Exit("ROTATION_PERIOD is invalid", "error", err)
+	}
+
+	var metricsPort int
+	if metricsPortNumber := os.Getenv("METRICS_PORT"); metricsPortNumber != "" {
+		if metricsPort, err = strconv.Atoi(metricsPortNumber); err != nil {
+			logging.Exit("METRICS_PORT is invalid", "error", err)
+		}
+	}
+	shutdownTimeout, err := health.ParseShutdownTimeout(os.Getenv("SHUTDOWN_TIMEOUT"))
+	if err != nil {
+		logging.Exit("SHUTDOWN_TIMEOUT is invalid", "error", err)
 	}
 
 	conf := config{
 		ProjectID:      projectId,
 		SecretID:       secretId,
-		RegistryURL:    registryUrl,
 		RequestID:      requestID,
 		SubscriberID:   subscriberID,
 		RotationPeriod: rotationDuration,
+		// The registry URL of the ONDC environment is used if REGISTRY_URL is not set.
+		RegistryURL:     os.Getenv("REGISTRY_URL"),
+		ONDCEnvironment: os.Getenv("ONDC_ENVIRONMENT"),
+		MetricsPort:     metricsPort,
+		ShutdownTimeout: shutdownTimeout,
 	}
 
 	registryClient, err := registryclient.New(conf.RegistryURL, conf.ONDCEnvironment)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create registry client failed", "error", err)
 	}
 
 	keyClient, err := keyclient.New(ctx, conf.ProjectID, conf.SecretID)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create key client failed", "error", err)
 	}
 	defer keyClient.Close()
 
 	srv := initServer(keyClient, registryClient, conf)
-	log.Info("Server initialization successs")
+	slog.Info("Server initialization successs")
+
+	// Cloud Run sends SIGTERM for stopping the instance.
+	serveCtx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	err = srv.serve()
-	if errors.Is(err, http.ErrServerClosed) {
-		log.Info("Server is closed")
-	} else if err != nil {
-		log.Exitf("Serving failed: %v", err)
+	health.ServeInBackground(serveCtx, conf.MetricsPort, srv.health)
+
+	if err := srv.serve(serveCtx); err != nil {
+		logging.Exit("Serving failed", "error", err)
 	}
+	slog.Info("Server is closed")
 }
 
 func initServer(keyClient keyClient, registryClient registryClient, conf config) *server {
@@ -162,18 +185,20 @@ func initServer(keyClient keyClient, registryClient registryClient, conf config)
 		keyClient:      keyClient,
 		registryClient: registryClient,
 		conf:           conf,
+		health:         health.NewChecker(),
 	}
 	server.mux.HandleFunc("/", server.rotationHandler)
 	return server
 }
 
-func (s *server) serve() error {
+// serve serves the requests until ctx is done, then shuts down gracefully.
+func (s *server) serve(ctx context.Context) error {
 	portNumber := os.Getenv("PORT")
 	if portNumber == "" {
 		portNumber = "8080"
 	}
-	log.Info("Server is serving")
-	return http.ListenAndServe(":"+portNumber, s.mux)
+	slog.Info("Server is serving")
+	return health.ListenAndServe(ctx, &http.Server{Addr: ":" + portNumber, Handler: s.mux}, s.health, s.conf.ShutdownTimeout)
 }
 
 func (s *server) rotationHandler(w http.ResponseWriter, r *http.Request) {
@@ -186,7 +211,7 @@ func (s *server) rotationHandler(w http.ResponseWriter, r *http.Request) {
 
 	var event secretManagerEvent
 	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
-		log.Infof("Decode request body failed: %s", err)
+		slog.InfoContext(ctx, "Decode request body failed", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -197,7 +222,7 @@ func (s *server) rotationHandler(w http.ResponseWriter, r *http.Request) {
 	eventType := event.Message.Attributes.EventType
 	if eventType != "SECRET_ROTATE" {
 		msg := fmt.Sprintf("Ignore event type: %q", eventType)
-		log.Info(msg)
+		slog.InfoContext(ctx, "Ignore event", "event_type", eventType)
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(msg))
 		return
@@ -205,45 +230,34 @@ func (s *server) rotationHandler(w http.ResponseWriter, r *http.Request) {
 
 	encryptionPrivateKey, encryptionPublicKey, encryptionPublicKeyDER, err := crypto.GenerateEncryptionKeyPair()
 	if err != nil {
-		log.Errorf("Generate encryption key pair failed: %s", err)
+		slog.ErrorContext(ctx, "Generate encryption key pair failed", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	signingKeyset, err := authentication.GenerateKeysetJSON()
 	if err != nil {
-		log.Errorf("Generate signing keyset failed: %s", err)
+		slog.ErrorContext(ctx, "Generate signing keyset failed", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	signingPublicKey, err := authentication.ExtractRawPublicKey(signingKeyset)
 	if err != nil {
-		log.Errorf("Extract raw public signing key failed: %s", err)
+		slog.ErrorContext(ctx, "Extract raw public signing key failed", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	payload := map[string]any{
-		"encryptionKey": map[string][]byte{
-			"privateKeyEncryption":   encryptionPrivateKey,
-			"publicKeyEncryption":    encryptionPublicKey,
-			"publicKeyEncryptionDER": encryptionPublicKeyDER,
-		},
-		"signingKey": map[string][]byte{
-			"signingKeySet":    signingKeyset,
-			"publicKeySigning": signingPublicKey,
-		},
-	}
-	payloadJSON, err := json.Marshal(payload)
+	payloadJSON, err := keyclient.SecretPayload(encryptionPrivateKey, encryptionPublicKey, encryptionPublicKeyDER, signingKeyset, signingPublicKey)
 	if err != nil {
-		log.Errorf("Marshal keyset payload failed: %s", err)
+		slog.ErrorContext(ctx, "Marshal keyset payload failed", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	if err := s.keyClient.AddKey(ctx, event.Message.Attributes.SecretID, payloadJSON); err != nil {
-		log.Errorf("Add key to secret manager failed: %s", err)
+		slog.ErrorContext(ctx, "Add key to secret manager failed", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -254,12 +268,12 @@ func (s *server) rotationHandler(w http.ResponseWriter, r *http.Request) {
 	subID := s.conf.SubscriberID
 	period := s.conf.RotationPeriod
 	if err := s.registryClient.RotateKeys(encryptionPublicKeyB64, signingPublicKeyB64, reqID, subID, period); err != nil {
-		log.Errorf("Rotate keys in ONDC registry failed: %s", err)
+		slog.ErrorContext(ctx, "Rotate keys in ONDC registry failed", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	completeMsg := "Key rotation is completed"
-	log.Info(completeMsg)
+	slog.InfoContext(ctx, completeMsg)
 	w.Write([]byte(completeMsg))
 }
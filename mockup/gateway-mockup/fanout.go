@@ -0,0 +1,217 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+// maxAckResponseSize bounds the response body read from a target.
+const maxAckResponseSize = 1 << 20
+
+// maxFanOutRecords is the number of the latest fan-outs kept for the /fanouts endpoint.
+const maxFanOutRecords = 100
+
+// deliveryResult is the outcome of forwarding a request to a target.
+type deliveryResult struct {
+	URL        string
+	StatusCode int
+	Latency    time.Duration
+
+	// AckStatus is ACK or NACK, empty if the target did not respond with an ACK response.
+	AckStatus string
+
+	// NackError is the error in the ACK response of the target.
+	NackError *model.Error
+
+	// Err is set if the request failed or the response was not an ACK response.
+	Err error
+}
+
+func (r deliveryResult) ok() bool {
+	return r.Err == nil && r.StatusCode == http.StatusOK && r.AckStatus == "ACK"
+}
+
+func (r deliveryResult) String() string {
+	s := fmt.Sprintf("%s: status code %d, latency %v", r.URL, r.StatusCode, r.Latency)
+	if r.AckStatus != "" {
+		s += ", " + r.AckStatus
+	}
+	if r.NackError != nil {
+		code := ""
+		if r.NackError.Code != nil {
+			code = *r.NackError.Code
+		}
+		s += fmt.Sprintf(", error %s %s %q", r.NackError.Type, code, r.NackError.Message)
+	}
+	if r.Err != nil {
+		s += fmt.Sprintf(", %v", r.Err)
+	}
+	return s
+}
+
+// MarshalJSON reports the error as a string, since errors do not marshal to JSON.
+func (r deliveryResult) MarshalJSON() ([]byte, error) {
+	var errMsg string
+	if r.Err != nil {
+		errMsg = r.Err.Error()
+	}
+	return json.Marshal(struct {
+		URL        string       `json:"url"`
+		StatusCode int          `json:"status_code,omitempty"`
+		LatencyMS  int64        `json:"latency_ms"`
+		AckStatus  string       `json:"ack_status,omitempty"`
+		NackError  *model.Error `json:"nack_error,omitempty"`
+		Error      string       `json:"error,omitempty"`
+	}{r.URL, r.StatusCode, r.Latency.Milliseconds(), r.AckStatus, r.NackError, errMsg})
+}
+
+// fanOutRecord is the outcome of a fan-out, served by the /fanouts endpoint.
+type fanOutRecord struct {
+	Action        string           `json:"action"`
+	TransactionID string           `json:"transaction_id"`
+	MessageID     string           `json:"message_id"`
+	Completed     time.Time        `json:"completed"`
+	Results       []deliveryResult `json:"results"`
+}
+
+// fanOutAsync delivers the requests in the background and records the results.
+//
+// The caller is ACKed before the delivery completes, so the deliveries are not bound to the incoming request context.
+func (s *server) fanOutAsync(action string, reqContext model.Context, requests []*http.Request) {
+	s.deliveries.Add(1)
+	go func() {
+		defer s.deliveries.Done()
+
+		results := s.fanOut(requests)
+		failed := 0
+		for _, result := range results {
+			if result.ok() {
+				slog.Info("Delivered", "action", action, "result", result.String())
+				continue
+			}
+			failed++
+			slog.Warn("Delivering failed", "action", action, "result", result.String())
+		}
+		slog.Info("Fan-out completed", "action", action, "targets", len(results), "failed", failed)
+
+		record := fanOutRecord{Action: action, Completed: s.clk.Now(), Results: results}
+		if reqContext.TransactionID != nil {
+			record.TransactionID = *reqContext.TransactionID
+		}
+		if reqContext.MessageID != nil {
+			record.MessageID = *reqContext.MessageID
+		}
+		s.recordFanOut(record)
+	}()
+}
+
+// recordFanOut keeps the record, dropping the oldest one beyond maxFanOutRecords.
+func (s *server) recordFanOut(record fanOutRecord) {
+	s.fanOutsMu.Lock()
+	defer s.fanOutsMu.Unlock()
+	if len(s.fanOuts) == maxFanOutRecords {
+		s.fanOuts = s.fanOuts[1:]
+	}
+	s.fanOuts = append(s.fanOuts, record)
+}
+
+// fanOutsHandler responds with the latest fan-outs, oldest first, optionally filtered by the message_id query parameter.
+func (s *server) fanOutsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	messageID := r.URL.Query().Get("message_id")
+
+	s.fanOutsMu.Lock()
+	records := make([]fanOutRecord, 0, len(s.fanOuts))
+	for _, record := range s.fanOuts {
+		if messageID == "" || record.MessageID == messageID {
+			records = append(records, record)
+		}
+	}
+	s.fanOutsMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(records); err != nil {
+		slog.ErrorContext(r.Context(), "Encode fan-outs failed", "error", err)
+	}
+}
+
+// fanOut sends the requests concurrently, with at most maxParallelDeliveries in flight, and returns a result per request.
+func (s *server) fanOut(requests []*http.Request) []deliveryResult {
+	results := make([]deliveryResult, len(requests))
+	sem := make(chan struct{}, s.maxParallelDeliveries)
+
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, request *http.Request) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = s.deliver(request)
+		}(i, request)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// deliver sends the request within deliveryTimeout and parses the ACK response of the target.
+func (s *server) deliver(request *http.Request) deliveryResult {
+	ctx, cancel := context.WithTimeout(context.Background(), s.deliveryTimeout)
+	defer cancel()
+
+	result := deliveryResult{URL: request.URL.String()}
+	start := s.clk.Now()
+	res, err := s.httpClient.Do(request.WithContext(ctx))
+	result.Latency = s.clk.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer res.Body.Close()
+	result.StatusCode = res.StatusCode
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxAckResponseSize))
+	result.Latency = s.clk.Since(start)
+	if err != nil {
+		result.Err = fmt.Errorf("read response body: %v", err)
+		return result
+	}
+
+	var ack model.AckResponse
+	if err := json.Unmarshal(body, &ack); err != nil {
+		result.Err = fmt.Errorf("invalid ACK response: %v", err)
+		return result
+	}
+	if ack.Message != nil && ack.Message.Ack != nil {
+		result.AckStatus = ack.Message.Ack.Status
+	}
+	result.NackError = ack.Error
+	return result
+}
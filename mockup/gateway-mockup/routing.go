@@ -0,0 +1,98 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registryclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+// rejectError is returned by a route function when the request must be NACKed instead of forwarded.
+type rejectError struct {
+	// errType is the ONDC error type of the NACK response.
+	errType string
+	msg     string
+}
+
+func (e *rejectError) Error() string {
+	return e.msg
+}
+
+// searchTransaction is a search forwarded by the gateway, waiting for on_search from BPPs.
+type searchTransaction struct {
+	bapID   string
+	expires time.Time
+}
+
+// recordSearch remembers the BAP of the search transaction, so that on_search can be routed back to it.
+func (s *server) recordSearch(reqContext *model.Context) {
+	now := s.clk.Now()
+
+	s.transactionsMu.Lock()
+	defer s.transactionsMu.Unlock()
+
+	for id, t := range s.transactions {
+		if !now.Before(t.expires) {
+			delete(s.transactions, id)
+		}
+	}
+	s.transactions[*reqContext.TransactionID] = searchTransaction{
+		bapID:   *reqContext.BapID,
+		expires: now.Add(s.transactionTTL),
+	}
+}
+
+// routeOnSearch returns the URI of the BAP that originated the search transaction of the on_search.
+//
+// The on_search is rejected if the transaction was not forwarded by the gateway, if the BAP ID differs
+// from the search, or if the BAP URI is not registered for the BAP in the registry.
+func (s *server) routeOnSearch(ctx context.Context, reqContext *model.Context) ([]string, error) {
+	transactionID := *reqContext.TransactionID
+	bapID, bapURI := *reqContext.BapID, *reqContext.BapURI
+
+	s.transactionsMu.Lock()
+	t, ok := s.transactions[transactionID]
+	s.transactionsMu.Unlock()
+	if !ok || !s.clk.Now().Before(t.expires) {
+		return nil, &rejectError{errType: "CONTEXT-ERROR", msg: fmt.Sprintf("unknown transaction %q", transactionID)}
+	}
+	if t.bapID != bapID {
+		return nil, &rejectError{errType: "CONTEXT-ERROR", msg: fmt.Sprintf("BAP %q does not own transaction %q", bapID, transactionID)}
+	}
+
+	keyset, err := s.keyClient.ServiceSigningPrivateKeyset(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := registryclient.ParticipantQuery{
+		SubscriberID: bapID,
+		Type:         registryclient.TypeBuyerApp,
+	}
+	participants, err := s.registryClient.VLookupParticipants(query, s.conf.SubscriberID, keyset)
+	if err != nil {
+		return nil, fmt.Errorf("lookup BAP: %v", err)
+	}
+	for _, p := range participants {
+		if p.SubscriberURL == bapURI {
+			return []string{bapURI}, nil
+		}
+	}
+	return nil, &rejectError{errType: "POLICY-ERROR", msg: fmt.Sprintf("BAP URI %q is not registered for %q", bapURI, bapID)}
+}
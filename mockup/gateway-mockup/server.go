@@ -20,136 +20,255 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/benbjohnson/clock"
-	log "github.com/golang/glog"
+	"golang.org/x/exp/slog"
 
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/keyclient"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registryclient"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/errorcode"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/health"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/logging"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/middleware"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/signing-authentication/authentication"
 )
 
+const (
+	defaultBPPCacheTTL           = 5 * time.Minute
+	defaultMaxParallelDeliveries = 10
+	defaultDeliveryTimeout       = 10 * time.Second
+	defaultTransactionTTL        = 30 * time.Minute
+)
+
 var validate = model.Validator()
 
 type server struct {
-	conf      config.MockGatewayConfig
-	mux       http.Handler
-	clk       clock.Clock
-	keyClient keyClient
+	conf           config.MockGatewayConfig
+	mux            http.Handler
+	clk            clock.Clock
+	keyClient      keyClient
+	registryClient registryClient
+
+	bppCacheTTL time.Duration
+	bppCacheMu  sync.Mutex
+	bppCache    map[bppCacheKey]bppCacheEntry
+
+	httpClient            *http.Client
+	maxParallelDeliveries int
+	deliveryTimeout       time.Duration
+
+	// deliveries tracks the fan-outs in the background.
+	deliveries sync.WaitGroup
+	fanOutsMu  sync.Mutex
+	fanOuts    []fanOutRecord
+
+	transactionTTL time.Duration
+	transactionsMu sync.Mutex
+	transactions   map[string]searchTransaction
+
+	health          *health.Checker
+	shutdownTimeout time.Duration
 }
 
 type keyClient interface {
 	ServiceSigningPrivateKeyset(context.Context) ([]byte, error)
 }
 
+type registryClient interface {
+	middleware.RegistryClient
+	VLookupParticipants(query registryclient.ParticipantQuery, senderSubscriberID string, signingKeyset []byte) ([]registryclient.Participant, error)
+}
+
+// bppCacheKey identifies the BPPs serving a domain in a city.
+type bppCacheKey struct {
+	domain string
+	city   string
+}
+
+type bppCacheEntry struct {
+	urls    []string
+	expires time.Time
+}
+
 type request interface {
 	model.SearchRequest | model.OnSearchRequest
+	GetContext() model.Context
 }
 
 func main() {
-	flag.Set("alsologtostderr", "true")
+	logging.Init()
 	ctx := context.Background()
 
 	configPath, ok := os.LookupEnv("CONFIG")
 	if !ok {
-		log.Exit("CONFIG env is not set")
+		logging.Exit("CONFIG env is not set")
 	}
 
 	conf, err := config.Read[config.MockGatewayConfig](configPath)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Read config failed", "error", err)
 	}
 
 	registryClient, err := registryclient.New(conf.RegistryURL, conf.ONDCEnvironment)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create registry client failed", "error", err)
 	}
 
 	keyClient, err := keyclient.New(ctx, conf.ProjectID, conf.SecretID)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create key client failed", "error", err)
 	}
 
-	srv := initServer(conf, keyClient, registryClient, clock.New())
-	log.Info("Server initialization successs")
+	srv, err := initServer(conf, keyClient, registryClient, clock.New())
+	if err != nil {
+		logging.Exit("Init server failed", "error", err)
+	}
+	slog.Info("Server initialization successs")
+
+	serveCtx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	err = srv.serve()
-	if errors.Is(err, http.ErrServerClosed) {
-		log.Info("Server is closed")
-	} else if err != nil {
-		log.Exitf("Serving failed: %v", err)
+	if err := srv.serve(serveCtx); err != nil {
+		logging.Exit("Serving failed", "error", err)
 	}
+	slog.Info("Server is closed")
 }
 
-func initServer(conf config.MockGatewayConfig, keyClient keyClient, registryClient middleware.RegistryClient, clk clock.Clock) *server {
-	srv := &server{conf: conf, clk: clk, keyClient: keyClient}
+func initServer(conf config.MockGatewayConfig, keyClient keyClient, registryClient registryClient, clk clock.Clock) (*server, error) {
+	bppCacheTTL := defaultBPPCacheTTL
+	if conf.BPPCacheTTL != "" {
+		d, err := time.ParseDuration(conf.BPPCacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BPP cache TTL: %v", err)
+		}
+		bppCacheTTL = d
+	}
+
+	deliveryTimeout := defaultDeliveryTimeout
+	if conf.DeliveryTimeout != "" {
+		d, err := time.ParseDuration(conf.DeliveryTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid delivery timeout: %v", err)
+		}
+		deliveryTimeout = d
+	}
+
+	transactionTTL := defaultTransactionTTL
+	if conf.TransactionTTL != "" {
+		d, err := time.ParseDuration(conf.TransactionTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction TTL: %v", err)
+		}
+		transactionTTL = d
+	}
+
+	maxParallelDeliveries := defaultMaxParallelDeliveries
+	if conf.MaxParallelDeliveries > 0 {
+		maxParallelDeliveries = conf.MaxParallelDeliveries
+	}
+
+	shutdownTimeout, err := health.ParseShutdownTimeout(conf.ShutdownTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &server{
+		conf:                  conf,
+		clk:                   clk,
+		keyClient:             keyClient,
+		registryClient:        registryClient,
+		bppCacheTTL:           bppCacheTTL,
+		bppCache:              make(map[bppCacheKey]bppCacheEntry),
+		httpClient:            &http.Client{},
+		maxParallelDeliveries: maxParallelDeliveries,
+		deliveryTimeout:       deliveryTimeout,
+		transactionTTL:        transactionTTL,
+		transactions:          make(map[string]searchTransaction),
+		health:                health.NewChecker(),
+		shutdownTimeout:       shutdownTimeout,
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/search", srv.searchHandler)
 	mux.HandleFunc("/on_search", srv.onSearchHandler)
-	srv.mux = middleware.Adapt(
+
+	// The fan-outs are inspected by the testers, not called by the network participants, so they are not authenticated.
+	root := http.NewServeMux()
+	root.HandleFunc("/fanouts", srv.fanOutsHandler)
+	root.Handle("/", middleware.Adapt(
 		mux,
 		middleware.NPAuthentication(registryClient, clk, errorcode.RoleSellerApp, conf.SubscriberID),
 		middleware.OnlyPostMethod(),
 		middleware.Logging(),
-	)
+	))
+	srv.mux = srv.health.WithEndpoints(root)
 
-	return srv
+	return srv, nil
 }
 
-func (s *server) serve() error {
+// serve serves the requests until ctx is done, then waits for the fan-outs of the ACKed requests to complete.
+func (s *server) serve(ctx context.Context) error {
 	addr := fmt.Sprintf(":%d", s.conf.Port)
-	log.Info("Server is serving")
-	return http.ListenAndServe(addr, s.mux)
+	slog.Info("Server is serving")
+	err := health.ListenAndServe(ctx, &http.Server{Addr: addr, Handler: s.mux}, s.health, s.shutdownTimeout)
+	s.deliveries.Wait()
+	return err
 }
 
-func genericHandler[R request](s *server, action string, urls []string, w http.ResponseWriter, r *http.Request) {
+// genericHandler forwards the request to the URLs returned by route for the validated payload.
+//
+// The request is NACKed if route returns a rejectError.
+func genericHandler[R request](s *server, action string, route func(context.Context, *R) ([]string, error), w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Errorf("Read request body: %v", err)
+		slog.ErrorContext(ctx, "Read request body", "error", err)
 		return
 	}
 
 	var payload R
 	if err := decodeAndValidate(body, &payload); err != nil {
-		nackResponse(w)
-		log.Errorf("Request body is invalid: %v", err)
+		nackResponse(w, "JSON-SCHEMA-ERROR")
+		slog.ErrorContext(ctx, "Request body is invalid", "error", err)
 		return
 	}
 
-	authHeader := r.Header.Get("Authorization")
-	requests, err := s.createONDCRequests(ctx, action, authHeader, urls, body)
+	urls, err := route(ctx, &payload)
+	var rejectErr *rejectError
+	if errors.As(err, &rejectErr) {
+		nackResponse(w, rejectErr.errType)
+		slog.ErrorContext(ctx, "Request is rejected", "error", err)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Errorf("Create requests failed: %v", err)
+		slog.ErrorContext(ctx, "Resolve target URLs failed", "error", err)
 		return
 	}
 
-	for _, request := range requests {
-		res, err := http.DefaultClient.Do(request)
-		if err != nil {
-			log.Errorf("Sending request to %s failed: %v", request.URL, err)
-			continue
-		}
-		resRaw, _ := io.ReadAll(res.Body)
-		log.Infof("Sending request to %s: status code %d, body %s", request.URL, res.StatusCode, resRaw)
+	authHeader := r.Header.Get("Authorization")
+	requests, err := s.createONDCRequests(ctx, action, authHeader, urls, body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Create requests failed", "error", err)
+		return
 	}
 
 	ackResponse(w)
+	s.fanOutAsync(action, payload.GetContext(), requests)
 }
 
 // createONDCRequests create a HTTP request for ONDC network with a Authorization header.
@@ -183,11 +302,68 @@ func (s *server) createONDCRequests(ctx context.Context, action, authHeader stri
 }
 
 func (s *server) searchHandler(w http.ResponseWriter, r *http.Request) {
-	genericHandler[model.SearchRequest](s, "/search", s.conf.BPPURLs, w, r)
+	genericHandler(s, "/search", func(ctx context.Context, payload *model.SearchRequest) ([]string, error) {
+		urls, err := s.lookupBPPs(ctx, payload.Context)
+		if err != nil {
+			return nil, err
+		}
+		s.recordSearch(payload.Context)
+		return urls, nil
+	}, w, r)
 }
 
 func (s *server) onSearchHandler(w http.ResponseWriter, r *http.Request) {
-	genericHandler[model.OnSearchRequest](s, "/on_search", s.conf.BAPURLs, w, r)
+	genericHandler(s, "/on_search", func(ctx context.Context, payload *model.OnSearchRequest) ([]string, error) {
+		return s.routeOnSearch(ctx, payload.Context)
+	}, w, r)
+}
+
+// lookupBPPs returns the subscriber URLs of the BPPs serving the domain and city of the request context.
+//
+// The registry results are cached for bppCacheTTL, including empty results.
+func (s *server) lookupBPPs(ctx context.Context, reqContext *model.Context) ([]string, error) {
+	key := bppCacheKey{city: *reqContext.City}
+	if reqContext.Domain != nil {
+		key.domain = reqContext.Domain.Value
+	}
+
+	s.bppCacheMu.Lock()
+	entry, ok := s.bppCache[key]
+	s.bppCacheMu.Unlock()
+	if ok && s.clk.Now().Before(entry.expires) {
+		return entry.urls, nil
+	}
+
+	keyset, err := s.keyClient.ServiceSigningPrivateKeyset(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := registryclient.ParticipantQuery{
+		Domain: key.domain,
+		City:   key.city,
+		Type:   registryclient.TypeSellerApp,
+	}
+	participants, err := s.registryClient.VLookupParticipants(query, s.conf.SubscriberID, keyset)
+	if err != nil {
+		return nil, fmt.Errorf("lookup BPPs: %v", err)
+	}
+
+	var urls []string
+	seen := make(map[string]bool)
+	for _, p := range participants {
+		if p.SubscriberURL == "" || seen[p.SubscriberURL] {
+			continue
+		}
+		seen[p.SubscriberURL] = true
+		urls = append(urls, p.SubscriberURL)
+	}
+	slog.InfoContext(ctx, "Found BPPs", "count", len(urls), "domain", key.domain, "city", key.city)
+
+	s.bppCacheMu.Lock()
+	s.bppCache[key] = bppCacheEntry{urls: urls, expires: s.clk.Now().Add(s.bppCacheTTL)}
+	s.bppCacheMu.Unlock()
+	return urls, nil
 }
 
 // decodeAndValidate decodes JSON body and validate the payload.
@@ -199,7 +375,7 @@ func decodeAndValidate(body []byte, payload any) error {
 	return validate.Struct(payload)
 }
 
-func nackResponse(w http.ResponseWriter) {
+func nackResponse(w http.ResponseWriter, errType string) {
 	errCode, ok := errorcode.Lookup(errorcode.RoleGateway, errorcode.ErrInvalidRequest)
 	if !ok {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -214,7 +390,7 @@ func nackResponse(w http.ResponseWriter) {
 			},
 		},
 		Error: &model.Error{
-			Type: "JSON-SCHEMA-ERROR",
+			Type: errType,
 			Code: &errCodeStr,
 		},
 	}
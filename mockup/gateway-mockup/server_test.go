@@ -0,0 +1,432 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registryclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/signing-authentication/authentication"
+
+	_ "embed"
+)
+
+//go:embed testdata/search_request.json
+var searchRequest []byte
+
+type fakeKeyClient struct {
+	keyset []byte
+}
+
+func (c *fakeKeyClient) ServiceSigningPrivateKeyset(context.Context) ([]byte, error) {
+	return c.keyset, nil
+}
+
+type fakeRegistryClient struct {
+	participants []registryclient.Participant
+	err          error
+	queries      []registryclient.ParticipantQuery
+}
+
+func (c *fakeRegistryClient) PublicSigningKey(string, string, model.Context) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeRegistryClient) VLookupParticipants(query registryclient.ParticipantQuery, _ string, _ []byte) ([]registryclient.Participant, error) {
+	c.queries = append(c.queries, query)
+	return c.participants, c.err
+}
+
+func initTestServer(t *testing.T, registryClient registryClient, clk clock.Clock) *server {
+	t.Helper()
+
+	keyset, err := authentication.GenerateKeysetJSON()
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	conf := config.MockGatewayConfig{
+		SubscriberID: "gateway.example.com",
+		KeyID:        "key-id",
+		BPPCacheTTL:  "1m",
+	}
+	srv, err := initServer(conf, &fakeKeyClient{keyset: keyset}, registryClient, clk)
+	if err != nil {
+		t.Fatalf("initServer() failed: %v", err)
+	}
+	return srv
+}
+
+func TestInitServerInvalidCacheTTL(t *testing.T) {
+	conf := config.MockGatewayConfig{BPPCacheTTL: "5 minutes"}
+	if _, err := initServer(conf, &fakeKeyClient{}, &fakeRegistryClient{}, clock.NewMock()); err == nil {
+		t.Errorf("initServer() succeeded unexpectedly")
+	}
+}
+
+func TestSearchHandlerFansOutToRegisteredBPPs(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		searched []string
+	)
+	bpp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		searched = append(searched, r.URL.Path)
+		mu.Unlock()
+		if r.Header.Get("X-Gateway-Authorization") == "" {
+			t.Errorf("X-Gateway-Authorization header is not set")
+		}
+		w.Write([]byte(`{"message":{"ack":{"status":"ACK"}}}`))
+	}))
+	defer bpp.Close()
+
+	registryClient := &fakeRegistryClient{
+		participants: []registryclient.Participant{
+			{SubscriberID: "grocery.example.com", SubscriberURL: bpp.URL + "/grocery"},
+			{SubscriberID: "grocery.example.com", SubscriberURL: bpp.URL + "/grocery"},
+			{SubscriberID: "no-url.example.com"},
+		},
+	}
+	srv := initTestServer(t, registryClient, clock.NewMock())
+
+	request := httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(searchRequest))
+	response := httptest.NewRecorder()
+	srv.searchHandler(response, request)
+	srv.deliveries.Wait()
+
+	if got, want := response.Code, http.StatusOK; got != want {
+		t.Fatalf("searchHandler() status code = %d, want %d", got, want)
+	}
+	if diff := cmp.Diff([]string{"/grocery/search"}, searched); diff != "" {
+		t.Errorf("searched BPP paths mismatch (-want +got):\n%s", diff)
+	}
+	wantQueries := []registryclient.ParticipantQuery{{Domain: "ONDC:RET10", City: "std:080", Type: registryclient.TypeSellerApp}}
+	if diff := cmp.Diff(wantQueries, registryClient.queries); diff != "" {
+		t.Errorf("registry queries mismatch (-want +got):\n%s", diff)
+	}
+
+	var search model.SearchRequest
+	if err := json.Unmarshal(searchRequest, &search); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	fanOuts := httptest.NewRecorder()
+	srv.mux.ServeHTTP(fanOuts, httptest.NewRequest(http.MethodGet, "/fanouts?message_id="+*search.Context.MessageID, nil))
+	var records []struct {
+		Action    string `json:"action"`
+		MessageID string `json:"message_id"`
+		Results   []struct {
+			URL       string `json:"url"`
+			AckStatus string `json:"ack_status"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(fanOuts.Body.Bytes(), &records); err != nil {
+		t.Fatalf("Decoding /fanouts response failed: %v", err)
+	}
+	if len(records) != 1 || records[0].Action != "/search" || len(records[0].Results) != 1 || records[0].Results[0].AckStatus != "ACK" {
+		t.Errorf("/fanouts = %+v, want the ACKed search fan-out", records)
+	}
+}
+
+func TestSearchHandlerLookupFailed(t *testing.T) {
+	srv := initTestServer(t, &fakeRegistryClient{err: errors.New("registry is down")}, clock.NewMock())
+
+	request := httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(searchRequest))
+	response := httptest.NewRecorder()
+	srv.searchHandler(response, request)
+
+	if got, want := response.Code, http.StatusInternalServerError; got != want {
+		t.Errorf("searchHandler() status code = %d, want %d", got, want)
+	}
+}
+
+func TestLookupBPPsCache(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewMock()
+	registryClient := &fakeRegistryClient{
+		participants: []registryclient.Participant{{SubscriberURL: "http://grocery.example.com"}},
+	}
+	srv := initTestServer(t, registryClient, clk)
+
+	city := "std:080"
+	reqContext := &model.Context{Domain: &model.Domain{Value: "ONDC:RET10"}, City: &city}
+	otherCity := "std:011"
+	otherContext := &model.Context{Domain: &model.Domain{Value: "ONDC:RET10"}, City: &otherCity}
+
+	lookups := []struct {
+		name        string
+		reqContext  *model.Context
+		advance     time.Duration
+		wantQueries int
+	}{
+		{name: "First lookup", reqContext: reqContext, wantQueries: 1},
+		{name: "Cached", reqContext: reqContext, advance: 30 * time.Second, wantQueries: 1},
+		{name: "Other city", reqContext: otherContext, wantQueries: 2},
+		{name: "Expired", reqContext: reqContext, advance: time.Minute, wantQueries: 3},
+	}
+
+	for _, l := range lookups {
+		clk.Add(l.advance)
+		urls, err := srv.lookupBPPs(ctx, l.reqContext)
+		if err != nil {
+			t.Fatalf("%s: lookupBPPs() failed: %v", l.name, err)
+		}
+		if diff := cmp.Diff([]string{"http://grocery.example.com"}, urls); diff != "" {
+			t.Errorf("%s: lookupBPPs() mismatch (-want +got):\n%s", l.name, diff)
+		}
+		if got := len(registryClient.queries); got != l.wantQueries {
+			t.Errorf("%s: registry queried %d times, want %d", l.name, got, l.wantQueries)
+		}
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	var inFlight, maxInFlight int32
+	release := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+
+		switch r.URL.Path {
+		case "/ack":
+			w.Write([]byte(`{"message":{"ack":{"status":"ACK"}}}`))
+		case "/nack":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"message":{"ack":{"status":"NACK"}},"error":{"type":"CONTEXT-ERROR","code":"30000","message":"invalid request"}}`))
+		case "/slow":
+			<-release
+		case "/invalid":
+			w.Write([]byte("not json"))
+		}
+	}))
+	defer target.Close()
+	defer close(release)
+
+	srv := initTestServer(t, &fakeRegistryClient{}, clock.New())
+	srv.maxParallelDeliveries = 2
+	srv.deliveryTimeout = 100 * time.Millisecond
+
+	paths := []string{"/ack", "/nack", "/slow", "/invalid", "/ack"}
+	var requests []*http.Request
+	for _, path := range paths {
+		request, err := http.NewRequest(http.MethodPost, target.URL+path, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		requests = append(requests, request)
+	}
+
+	results := srv.fanOut(requests)
+
+	if got, want := len(results), len(paths); got != want {
+		t.Fatalf("fanOut() returned %d results, want %d", got, want)
+	}
+	for i, path := range paths {
+		if got, want := results[i].URL, target.URL+path; got != want {
+			t.Errorf("results[%d].URL = %q, want %q", i, got, want)
+		}
+	}
+	if r := results[0]; !r.ok() {
+		t.Errorf("ACK result is not ok: %v", r)
+	}
+	if r := results[1]; r.ok() || r.StatusCode != http.StatusBadRequest || r.AckStatus != "NACK" || r.NackError == nil || *r.NackError.Code != "30000" {
+		t.Errorf("NACK result = %v, want NACK with error code 30000", r)
+	}
+	if r := results[2]; r.ok() || !errors.Is(r.Err, context.DeadlineExceeded) {
+		t.Errorf("slow result = %v, want deadline exceeded", r)
+	}
+	if r := results[3]; r.ok() || r.Err == nil {
+		t.Errorf("invalid result = %v, want error", r)
+	}
+	if got := atomic.LoadInt32(&maxInFlight); got > 2 {
+		t.Errorf("max in-flight requests = %d, want at most 2", got)
+	}
+}
+
+func TestServeWaitsForFanOuts(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+		w.Write([]byte(`{"message":{"ack":{"status":"ACK"}}}`))
+	}))
+	defer target.Close()
+
+	srv := initTestServer(t, &fakeRegistryClient{}, clock.New())
+	request, err := http.NewRequest(http.MethodPost, target.URL+"/search", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	srv.fanOutAsync("/search", model.Context{}, []*http.Request{request})
+	<-received
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.serve(ctx) }()
+	cancel()
+
+	select {
+	case err := <-served:
+		t.Fatalf("serve() returned %v before the fan-out completed", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if err := <-served; err != nil {
+		t.Errorf("serve() failed: %v", err)
+	}
+	if got := len(srv.fanOuts); got != 1 {
+		t.Errorf("recorded %d fan-outs, want 1", got)
+	}
+}
+
+func onSearchRequest(transactionID, bapID, bapURI string) []byte {
+	return []byte(fmt.Sprintf(`{
+  "context": {
+    "domain": "ONDC:RET10",
+    "country": "IND",
+    "city": "std:080",
+    "action": "on_search",
+    "core_version": "1.1.0",
+    "bap_id": %q,
+    "bap_uri": %q,
+    "bpp_id": "grocery.example.com",
+    "bpp_uri": "https://grocery.example.com/bpp",
+    "transaction_id": %q,
+    "message_id": "04a754b4-6088-4a74-aed3-18cb40b6d568",
+    "timestamp": "2023-05-05T09:10:25.102Z"
+  }
+}`, bapID, bapURI, transactionID))
+}
+
+func TestOnSearchHandler(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		onSearchBAP []string
+	)
+	bap := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		onSearchBAP = append(onSearchBAP, r.URL.Path)
+		mu.Unlock()
+		w.Write([]byte(`{"message":{"ack":{"status":"ACK"}}}`))
+	}))
+	defer bap.Close()
+	bapURI := bap.URL + "/bap"
+
+	// The transaction and BAP of testdata/search_request.json.
+	const (
+		transactionID = "9eb59fd0-5de7-4a13-aee9-58cb1d9cccfa"
+		bapID         = "buyer.example.com"
+	)
+
+	tests := []struct {
+		name          string
+		reqBody       []byte
+		advance       time.Duration
+		wantStatus    int
+		wantErrorType string
+		wantForwarded []string
+	}{
+		{
+			name:          "Routed to originating BAP",
+			reqBody:       onSearchRequest(transactionID, bapID, bapURI),
+			wantStatus:    http.StatusOK,
+			wantForwarded: []string{"/bap/on_search"},
+		},
+		{
+			name:          "Unknown transaction",
+			reqBody:       onSearchRequest("unknown-transaction", bapID, bapURI),
+			wantStatus:    http.StatusBadRequest,
+			wantErrorType: "CONTEXT-ERROR",
+		},
+		{
+			name:          "Other BAP",
+			reqBody:       onSearchRequest(transactionID, "other-buyer.example.com", bapURI),
+			wantStatus:    http.StatusBadRequest,
+			wantErrorType: "CONTEXT-ERROR",
+		},
+		{
+			name:          "Unregistered BAP URI",
+			reqBody:       onSearchRequest(transactionID, bapID, "https://attacker.example.com/bap"),
+			wantStatus:    http.StatusBadRequest,
+			wantErrorType: "POLICY-ERROR",
+		},
+		{
+			name:          "Expired transaction",
+			reqBody:       onSearchRequest(transactionID, bapID, bapURI),
+			advance:       time.Hour,
+			wantStatus:    http.StatusBadRequest,
+			wantErrorType: "CONTEXT-ERROR",
+		},
+	}
+
+	for _, test := range tests {
+		clk := clock.NewMock()
+		registryClient := &fakeRegistryClient{
+			participants: []registryclient.Participant{{SubscriberID: bapID, SubscriberURL: bapURI}},
+		}
+		srv := initTestServer(t, registryClient, clk)
+
+		search := httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(searchRequest))
+		srv.searchHandler(httptest.NewRecorder(), search)
+		srv.deliveries.Wait()
+		clk.Add(test.advance)
+		// The fake registry also returns the BAP for the search, so only on_search is recorded from here.
+		onSearchBAP = nil
+
+		request := httptest.NewRequest(http.MethodPost, "/on_search", bytes.NewReader(test.reqBody))
+		response := httptest.NewRecorder()
+		srv.onSearchHandler(response, request)
+		srv.deliveries.Wait()
+
+		if got, want := response.Code, test.wantStatus; got != want {
+			t.Errorf("%s: onSearchHandler() status code = %d, want %d", test.name, got, want)
+			continue
+		}
+		if test.wantErrorType != "" {
+			var ack model.AckResponse
+			if err := json.Unmarshal(response.Body.Bytes(), &ack); err != nil {
+				t.Fatalf("%s: decode response failed: %v", test.name, err)
+			}
+			if ack.Error == nil || ack.Error.Type != test.wantErrorType {
+				t.Errorf("%s: onSearchHandler() error = %+v, want type %s", test.name, ack.Error, test.wantErrorType)
+			}
+		}
+		if diff := cmp.Diff(test.wantForwarded, onSearchBAP); diff != "" {
+			t.Errorf("%s: forwarded on_search mismatch (-want +got):\n%s", test.name, diff)
+		}
+	}
+}
@@ -17,20 +17,22 @@ package main
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"os"
 	"time"
 
-	log "github.com/golang/glog"
+	"golang.org/x/exp/slog"
 
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registryclient"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/crypto"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/logging"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/registry"
 )
@@ -54,25 +56,25 @@ type server struct {
 }
 
 func main() {
-	flag.Set("alsologtostderr", "true")
+	logging.Init()
 	configPath, ok := os.LookupEnv("CONFIG")
 	if !ok {
-		log.Exit("CONFIG env is not set")
+		logging.Exit("CONFIG env is not set")
 	}
 
 	conf, err := config.Read[config.MockRegistryConfig](configPath)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Read config failed", "error", err)
 	}
 
 	srv := initServer(conf)
-	log.Info("Server initialization successs")
+	slog.Info("Server initialization successs")
 
 	err = srv.serve()
 	if errors.Is(err, http.ErrServerClosed) {
-		log.Info("Server is closed")
+		slog.Info("Server is closed")
 	} else if err != nil {
-		log.Exitf("Serving failed: %v", err)
+		logging.Exit("Serving failed", "error", err)
 	}
 }
 
@@ -82,6 +84,7 @@ func initServer(conf config.MockRegistryConfig) *server {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/subscribe", srv.subscribeHandler)
 	mux.HandleFunc("/lookup", srv.lookupHandler)
+	mux.HandleFunc("/vlookup", srv.vlookupHandler)
 	srv.mux = mux
 
 	keyLookups := make(map[keyLookup]registry.LookupResponseInner, len(conf.Keys))
@@ -95,7 +98,7 @@ func initServer(conf config.MockRegistryConfig) *server {
 
 func (s *server) serve() error {
 	addr := fmt.Sprintf(":%d", s.conf.Port)
-	log.Info("Server is serving")
+	slog.Info("Server is serving")
 	return http.ListenAndServe(addr, s.mux)
 }
 
@@ -105,12 +108,12 @@ func (s *server) subscribeHandler(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&request); err != nil {
 		nackResponse(w)
-		log.Errorf("Decoding request: %v", err)
+		slog.ErrorContext(r.Context(), "Decoding request", "error", err)
 		return
 	}
 	if err := validate.Struct(request); err != nil {
 		nackResponse(w)
-		log.Errorf("Request body is invalid: %v", err)
+		slog.ErrorContext(r.Context(), "Request body is invalid", "error", err)
 		return
 	}
 
@@ -122,20 +125,20 @@ func (s *server) subscribeHandler(w http.ResponseWriter, r *http.Request) {
 func (s *server) onSubscribeCallback(request registry.SubscribeRequest) error {
 	privKey, err := base64.StdEncoding.DecodeString(s.conf.RegistryKeyset.PrivateEncryptionKey)
 	if err != nil {
-		log.Errorf("Decode private encryption key failed: %s", err)
+		slog.Error("Decode private encryption key failed", "error", err)
 		return err
 	}
 
 	pubKey, err := base64.StdEncoding.DecodeString(request.Message.Entity.KeyPair.EncryptionPublicKey)
 	if err != nil {
-		log.Errorf("Decode public encryption key failed: %s", err)
+		slog.Error("Decode public encryption key failed", "error", err)
 		return err
 	}
 
 	chanllenge := randomString(16)
 	encryptedChallenge, err := crypto.EncryptMessage(chanllenge, privKey, pubKey)
 	if err != nil {
-		log.Errorf("Encrypt challenge failed: %s", err)
+		slog.Error("Encrypt challenge failed", "error", err)
 		return err
 	}
 
@@ -146,29 +149,29 @@ func (s *server) onSubscribeCallback(request registry.SubscribeRequest) error {
 	}
 	callbackBodyJSON, err := json.Marshal(callbackReq)
 	if err != nil {
-		log.Errorf("Marshall request failed: %s", err)
+		slog.Error("Marshall request failed", "error", err)
 		return err
 	}
 
 	callbackRes, err := http.Post(callbackURL, "application/json", bytes.NewReader(callbackBodyJSON))
 	if err != nil {
-		log.Errorf("Call on_subscribe error: %s", err)
+		slog.Error("Call on_subscribe error", "error", err)
 		return err
 	}
 	defer callbackRes.Body.Close()
 
 	var res registry.OnSubscribeResponse
 	if err := json.NewDecoder(callbackRes.Body).Decode(&res); err != nil {
-		log.Errorf("Decode response failed: %s", err)
+		slog.Error("Decode response failed", "error", err)
 		return err
 	}
 
 	if res.Answer != chanllenge {
 		errMsg := fmt.Sprintf("Incorrect challenge answer: got %q, want %q", res.Answer, chanllenge)
-		log.Info(errMsg)
+		slog.Info("Incorrect challenge answer", "got", res.Answer, "want", chanllenge)
 		return errors.New(errMsg)
 	}
-	log.Info("The challenge answer is correct")
+	slog.Info("The challenge answer is correct")
 	return nil
 }
 
@@ -177,12 +180,12 @@ func (s *server) lookupHandler(w http.ResponseWriter, r *http.Request) {
 
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&request); err != nil {
-		log.Errorf("Decode request failed: %s", err)
+		slog.ErrorContext(r.Context(), "Decode request failed", "error", err)
 		nackResponse(w)
 		return
 	}
 	if err := validate.Struct(request); err != nil {
-		log.Errorf("Request body is invalid: %v", err)
+		slog.ErrorContext(r.Context(), "Request body is invalid", "error", err)
 		nackResponse(w)
 		return
 	}
@@ -194,7 +197,7 @@ func (s *server) lookupHandler(w http.ResponseWriter, r *http.Request) {
 
 	responseJSON, err := json.Marshal(response)
 	if err != nil {
-		log.Errorf("Marshall response failed: %s", err)
+		slog.ErrorContext(r.Context(), "Marshall response failed", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -204,6 +207,94 @@ func (s *server) lookupHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(responseJSON)
 }
 
+func (s *server) vlookupHandler(w http.ResponseWriter, r *http.Request) {
+	var request registry.VLookupRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&request); err != nil {
+		slog.ErrorContext(r.Context(), "Decode request failed", "error", err)
+		nackResponse(w)
+		return
+	}
+	if err := validate.Struct(request); err != nil {
+		slog.ErrorContext(r.Context(), "Request body is invalid", "error", err)
+		nackResponse(w)
+		return
+	}
+
+	if err := s.verifyVLookupSignature(request); err != nil {
+		slog.ErrorContext(r.Context(), "Verify signature failed", "error", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	params := request.SearchParameters
+	response := registry.VLookupResponse{}
+	for _, key := range s.conf.Keys {
+		if !matches(params.SubscriberID, key.SubscriberID) || !matches(params.Country, key.Country) ||
+			!matches(params.City, key.City) || !matches(params.Domain, key.Domain) || !matches(params.Type, key.Type) {
+			continue
+		}
+		response = append(response, registry.VLookupResponseInner{
+			SubscriberID:     key.SubscriberID,
+			Country:          key.Country,
+			City:             key.City,
+			SigningPublicKey: key.SigningPublicKey,
+			EncrPublicKey:    key.EncrPublicKey,
+			ValidFrom:        key.ValidFrom,
+			ValidUntil:       key.ValidUntil,
+			Created:          key.Created,
+			Updated:          key.Updated,
+			UniqueKeyID:      key.UkID,
+			NetworkParticipant: []registry.VLookupNetworkParticipant{{
+				SubscriberURL: key.SubscriberURL,
+				Domain:        key.Domain,
+				Type:          key.Type,
+				CityCode:      key.City,
+			}},
+		})
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Marshall response failed", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+// verifyVLookupSignature verifies the signature with any signing key of the sender.
+func (s *server) verifyVLookupSignature(request registry.VLookupRequest) error {
+	signature, err := base64.StdEncoding.DecodeString(*request.Signature)
+	if err != nil {
+		return fmt.Errorf("decode signature: %v", err)
+	}
+	signingString := []byte(registryclient.VLookupSigningString(*request.SearchParameters))
+
+	for _, key := range s.conf.Keys {
+		if key.SubscriberID != *request.SenderSubscriberID {
+			continue
+		}
+		publicKey, err := base64.StdEncoding.DecodeString(key.SigningPublicKey)
+		if err != nil || len(publicKey) != ed25519.PublicKeySize {
+			continue
+		}
+		if ed25519.Verify(publicKey, signingString, signature) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no signing key of %q matches the signature", *request.SenderSubscriberID)
+}
+
+// matches reports whether the value matches the search parameter. An empty parameter matches any value.
+func matches(param, value string) bool {
+	return param == "" || param == value
+}
+
 func ackResponse(w http.ResponseWriter) {
 	res := registry.SubscribeResponse{
 		Message: &registry.SubscribeResponseMessage{
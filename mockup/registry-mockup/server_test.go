@@ -22,12 +22,16 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
 
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registryclient"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/crypto"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/registry"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/signing-authentication/authentication"
 
 	_ "embed"
 )
@@ -115,6 +119,127 @@ func TestLookupHandler(t *testing.T) {
 	}
 }
 
+func TestVLookupHandler(t *testing.T) {
+	publicKey, keyset := generateKeyset(t)
+
+	conf := config.MockRegistryConfig{
+		Keys: registry.LookupResponse{
+			{
+				SubscriberID:     "buyer.example.com",
+				UkID:             "buyer-key",
+				Type:             "buyerApp",
+				SigningPublicKey: base64.StdEncoding.EncodeToString(publicKey),
+			},
+			{
+				SubscriberID:  "grocery.example.com",
+				UkID:          "grocery-key",
+				Country:       "IND",
+				City:          "std:080",
+				Domain:        "ONDC:RET10",
+				Type:          "sellerApp",
+				SubscriberURL: "https://grocery.example.com/bpp",
+			},
+			{
+				SubscriberID:  "food.example.com",
+				UkID:          "food-key",
+				Country:       "IND",
+				City:          "std:080",
+				Domain:        "ONDC:RET11",
+				Type:          "sellerApp",
+				SubscriberURL: "https://food.example.com/bpp",
+			},
+		},
+	}
+	srv := initServer(conf)
+
+	_, otherKeyset := generateKeyset(t)
+	tests := []struct {
+		name              string
+		keyset            []byte
+		params            registry.VLookupSearchParameters
+		wantStatusCode    int
+		wantSubscriberIDs []string
+	}{
+		{
+			name:              "BPPs by domain and city",
+			keyset:            keyset,
+			params:            registry.VLookupSearchParameters{Country: "IND", Domain: "ONDC:RET10", Type: "sellerApp", City: "std:080"},
+			wantStatusCode:    http.StatusOK,
+			wantSubscriberIDs: []string{"grocery.example.com"},
+		},
+		{
+			name:              "BPPs by city",
+			keyset:            keyset,
+			params:            registry.VLookupSearchParameters{City: "std:080", Type: "sellerApp"},
+			wantStatusCode:    http.StatusOK,
+			wantSubscriberIDs: []string{"grocery.example.com", "food.example.com"},
+		},
+		{
+			name:              "No BPP in the city",
+			keyset:            keyset,
+			params:            registry.VLookupSearchParameters{City: "std:011", Type: "sellerApp"},
+			wantStatusCode:    http.StatusOK,
+			wantSubscriberIDs: nil,
+		},
+		{
+			name:           "Invalid signature",
+			keyset:         otherKeyset,
+			params:         registry.VLookupSearchParameters{City: "std:080"},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		vlookupRequest, err := registryclient.NewVLookupRequest("buyer.example.com", test.params, test.keyset, time.Now())
+		if err != nil {
+			t.Fatalf("%s: setup failed: %v", test.name, err)
+		}
+		reqBody, err := json.Marshal(vlookupRequest)
+		if err != nil {
+			t.Fatalf("%s: setup failed: %v", test.name, err)
+		}
+
+		request := httptest.NewRequest(http.MethodPost, "/vlookup", bytes.NewReader(reqBody))
+		response := httptest.NewRecorder()
+
+		srv.vlookupHandler(response, request)
+
+		if got, want := response.Code, test.wantStatusCode; got != want {
+			t.Errorf("%s: status code got %d, want %d", test.name, got, want)
+			continue
+		}
+		if response.Code != http.StatusOK {
+			continue
+		}
+
+		var vlookupResponse registry.VLookupResponse
+		if err := json.NewDecoder(response.Body).Decode(&vlookupResponse); err != nil {
+			t.Fatalf("%s: decode response failed: %v", test.name, err)
+		}
+		var gotSubscriberIDs []string
+		for _, r := range vlookupResponse {
+			gotSubscriberIDs = append(gotSubscriberIDs, r.SubscriberID)
+		}
+		if diff := cmp.Diff(test.wantSubscriberIDs, gotSubscriberIDs); diff != "" {
+			t.Errorf("%s: subscriber IDs mismatch (-want +got):\n%s", test.name, diff)
+		}
+	}
+}
+
+func generateKeyset(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+
+	keyset, err := authentication.GenerateKeysetJSON()
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	publicKey, err := authentication.ExtractRawPublicKey(keyset)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	return publicKey, keyset
+}
+
 func TestOnSubscribeCallbackFail(t *testing.T) {
 	mockSubscriberSrv := initMockSubscriberServer(t)
 
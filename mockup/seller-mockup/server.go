@@ -16,9 +16,9 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
 	"io"
 	"net/http"
@@ -26,9 +26,11 @@ import (
 	"text/template"
 	"time"
 
-	log "github.com/golang/glog"
+	"golang.org/x/exp/slog"
 
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/catalog"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/logging"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
 
 	_ "embed"
@@ -65,29 +67,29 @@ type server struct {
 }
 
 func main() {
-	flag.Set("alsologtostderr", "true")
+	logging.Init()
 
 	configPath, ok := os.LookupEnv("CONFIG")
 	if !ok {
-		log.Exit("CONFIG env is not set")
+		logging.Exit("CONFIG env is not set")
 	}
 
 	conf, err := config.Read[config.MockSellerSystemConfig](configPath)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Read config failed", "error", err)
 	}
 
 	srv, err := initServer(conf)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Init server failed", "error", err)
 	}
-	log.Info("Server initialization successs")
+	slog.Info("Server initialization successs")
 
 	err = srv.serve()
 	if errors.Is(err, http.ErrServerClosed) {
-		log.Info("Server is closed")
+		slog.Info("Server is closed")
 	} else if err != nil {
-		log.Exitf("Serving failed: %v", err)
+		logging.Exit("Serving failed", "error", err)
 	}
 }
 
@@ -98,17 +100,18 @@ func initServer(conf config.MockSellerSystemConfig) (*server, error) {
 	for _, e := range []struct {
 		path     string
 		response string
+		filter   responseFilter
 	}{
-		{"/search", onSearchPayload},
-		{"/select", onSelectPayload},
-		{"/init", onInitPayload},
-		{"/confirm", onConfirmPayload},
-		{"/status", onStatusPayload},
-		{"/track", onTrackPayload},
-		{"/cancel", onCancelPayload},
-		{"/update", onUpdatePayload},
-		{"/rating", onRatingPayload},
-		{"/support", onSupportPayload},
+		{"/search", onSearchPayload, matchCatalog},
+		{"/select", onSelectPayload, nil},
+		{"/init", onInitPayload, nil},
+		{"/confirm", onConfirmPayload, nil},
+		{"/status", onStatusPayload, nil},
+		{"/track", onTrackPayload, nil},
+		{"/cancel", onCancelPayload, nil},
+		{"/update", onUpdatePayload, nil},
+		{"/rating", onRatingPayload, nil},
+		{"/support", onSupportPayload, nil},
 	} {
 		if !json.Valid([]byte(e.response)) {
 			return nil, fmt.Errorf("init server: response body of %q is not a valid JSON", e.path)
@@ -119,7 +122,7 @@ func initServer(conf config.MockSellerSystemConfig) (*server, error) {
 			return nil, fmt.Errorf("init server: %s", err)
 		}
 
-		mux.Handle(e.path, mockHandler(template))
+		mux.Handle(e.path, mockHandler(template, e.filter))
 	}
 	srv.mux = mux
 
@@ -128,15 +131,37 @@ func initServer(conf config.MockSellerSystemConfig) (*server, error) {
 
 func (s *server) serve() error {
 	addr := fmt.Sprintf(":%d", s.conf.Port)
-	log.Info("Server is serving")
+	slog.Info("Server is serving")
 	return http.ListenAndServe(addr, s.mux)
 }
 
-func mockHandler(resTemplate *template.Template) http.Handler {
+// responseFilter rewrites the mock response for the request.
+type responseFilter func(request, response []byte) ([]byte, error)
+
+// matchCatalog prunes the mock catalog down to the intent of the search, as a seller system would.
+func matchCatalog(request, response []byte) ([]byte, error) {
+	var search model.SearchRequest
+	if err := json.Unmarshal(request, &search); err != nil {
+		return nil, err
+	}
+	var onSearch model.OnSearchRequest
+	if err := json.Unmarshal(response, &onSearch); err != nil {
+		return nil, err
+	}
+	if search.Message == nil || onSearch.Message == nil || onSearch.Message.Catalog == nil {
+		return response, nil
+	}
+
+	c := catalog.Match(search.Message.Intent, *onSearch.Message.Catalog)
+	onSearch.Message.Catalog = &c
+	return json.Marshal(onSearch)
+}
+
+func mockHandler(resTemplate *template.Template, filter responseFilter) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			log.Errorf("Reading request body failed: %s", err)
+			slog.ErrorContext(r.Context(), "Reading request body failed", "error", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -145,13 +170,12 @@ func mockHandler(resTemplate *template.Template) http.Handler {
 			Context *model.Context `json:"context" validate:"required"`
 		}
 		if err := json.Unmarshal(body, &ondcCtx); err != nil {
-			log.Errorf("Unmarshal request body failed: %s", err)
-			log.Errorf("Request body:\n%s", body)
+			slog.ErrorContext(r.Context(), "Unmarshal request body failed", "error", err, "body", string(body))
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 		if err := validate.Struct(&ondcCtx); err != nil {
-			log.Errorf("Invalid request context: %s", err)
+			slog.ErrorContext(r.Context(), "Invalid request context", "error", err)
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
@@ -163,8 +187,20 @@ func mockHandler(resTemplate *template.Template) http.Handler {
 			"message_id":     *ondcCtx.Context.MessageID,
 			"timestamp":      time.Now().Format(time.RFC3339),
 		}
-		if err := resTemplate.Execute(w, templateVal); err != nil {
-			log.Errorf("Response failed: %s", err)
+		var response bytes.Buffer
+		if err := resTemplate.Execute(&response, templateVal); err != nil {
+			slog.ErrorContext(r.Context(), "Response failed", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		responseBody := response.Bytes()
+		if filter != nil {
+			if responseBody, err = filter(body, responseBody); err != nil {
+				slog.ErrorContext(r.Context(), "Filtering response failed", "error", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
 		}
+		w.Write(responseBody)
 	})
 }
@@ -16,12 +16,15 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"text/template"
 
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
 
 	_ "embed"
 )
@@ -43,7 +46,7 @@ func TestInitServer(t *testing.T) {
 
 func TestHandler(t *testing.T) {
 	template := template.Must(template.New("test").Parse(onSearchPayload))
-	handler := mockHandler(template)
+	handler := mockHandler(template, matchCatalog)
 
 	tests := []struct {
 		payload    []byte
@@ -74,3 +77,55 @@ func TestHandler(t *testing.T) {
 		}
 	}
 }
+
+func TestMatchCatalog(t *testing.T) {
+	response := []byte(strings.NewReplacer("{{.timestamp}}", "2023-06-03T08:00:00Z").Replace(onSearchPayload))
+	tests := []struct {
+		name      string
+		intent    string
+		wantItems int
+	}{
+		{
+			name:      "item name",
+			intent:    `{"item": {"descriptor": {"name": "atta"}}}`,
+			wantItems: 1,
+		},
+		{
+			name:      "GPS within the circle",
+			intent:    `{"fulfillment": {"type": "Delivery", "end": {"location": {"gps": "12.967555,77.749666"}}}}`,
+			wantItems: 1,
+		},
+		{
+			name:      "unknown item",
+			intent:    `{"item": {"descriptor": {"name": "rice"}}}`,
+			wantItems: 0,
+		},
+		{
+			name:      "GPS outside of the circle",
+			intent:    `{"fulfillment": {"type": "Delivery", "end": {"location": {"gps": "28.459497,77.026634"}}}}`,
+			wantItems: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := []byte(`{"message": {"intent": ` + test.intent + `}}`)
+			got, err := matchCatalog(request, response)
+			if err != nil {
+				t.Fatalf("matchCatalog() failed: %v", err)
+			}
+
+			var onSearch model.OnSearchRequest
+			if err := json.Unmarshal(got, &onSearch); err != nil {
+				t.Fatalf("Unmarshal on_search failed: %v", err)
+			}
+			items := 0
+			for _, p := range onSearch.Message.Catalog.BppProviders {
+				items += len(p.Items)
+			}
+			if items != test.wantItems {
+				t.Errorf("matchCatalog() returned %d items, want %d", items, test.wantItems)
+			}
+		})
+	}
+}
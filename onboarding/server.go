@@ -17,21 +17,29 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"text/template"
+	"time"
 
-	log "github.com/golang/glog"
+	"golang.org/x/exp/slog"
 
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/keyclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registrationclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registryclient"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/crypto"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/health"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/logging"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/registry"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/signing-authentication/authentication"
 )
@@ -54,17 +62,27 @@ type keyClient interface {
 	ServiceEncryptionPrivateKey(context.Context) ([]byte, error)
 }
 
+type registrationClient interface {
+	Registration(ctx context.Context, id string) (registrationclient.Registration, error)
+	CreateRegistration(ctx context.Context, r registrationclient.Registration) error
+	UpdateRegistration(ctx context.Context, r registrationclient.Registration) error
+}
+
 // server servs HTTP requests for onboarding and subscription flow
 type server struct {
-	mux       *http.ServeMux
-	keyClient keyClient
-	conf      config.OnboardingConfig
+	mux                *http.ServeMux
+	keyClient          keyClient
+	registrationClient registrationClient
+	conf               config.OnboardingConfig
 
 	registryEncryptPubKey []byte
+
+	health          *health.Checker
+	shutdownTimeout time.Duration
 }
 
 func main() {
-	flag.Set("alsologtostderr", "true")
+	logging.Init()
 	ctx := context.Background()
 
 	portNumber := os.Getenv("PORT")
@@ -73,85 +91,144 @@ func main() {
 	}
 	port, err := strconv.Atoi(portNumber)
 	if err != nil {
-		log.Exitf("Config errer %v", err)
+		logging.Exit("PORT is invalid", "error", err)
+	}
+
+	var metricsPort int
+	if metricsPortNumber := os.Getenv("METRICS_PORT"); metricsPortNumber != "" {
+		if metricsPort, err = strconv.Atoi(metricsPortNumber); err != nil {
+			logging.Exit("METRICS_PORT is invalid", "error", err)
+		}
 	}
 
 	projectID, ok := os.LookupEnv("PROJECT_ID")
 	if !ok {
-		log.Exit("PROJECT_ID env is not set")
+		logging.Exit("PROJECT_ID env is not set")
 	}
 
 	secretID, ok := os.LookupEnv("SECRET_ID")
 	if !ok {
-		log.Exit("SECRET_ID env is not set")
+		logging.Exit("SECRET_ID env is not set")
 	}
 
-	requestID, ok := os.LookupEnv("REQUEST_ID")
+	instanceID, ok := os.LookupEnv("INSTANCE_ID")
 	if !ok {
-		log.Exit("REQUEST_ID env is not set")
+		logging.Exit("INSTANCE_ID env is not set")
 	}
 
-	registryEncryptPubKey, ok := os.LookupEnv("REGISTRY_ENCRYPT_PUB_KEY")
+	databaseID, ok := os.LookupEnv("DATABASE_ID")
 	if !ok {
-		log.Exit("REGISTRY_ENCRYPT_PUB_KEY env is not set")
+		logging.Exit("DATABASE_ID env is not set")
+	}
+
+	registrationID, ok := os.LookupEnv("REGISTRATION_ID")
+	if !ok {
+		logging.Exit("REGISTRATION_ID env is not set")
 	}
 
 	conf := config.OnboardingConfig{
 		ProjectID:             projectID,
 		Port:                  port,
-		RequestID:             requestID,
 		SecretID:              secretID,
-		RegistryEncryptPubKey: registryEncryptPubKey,
+		InstanceID:            instanceID,
+		DatabaseID:            databaseID,
+		RegistrationID:        registrationID,
+		ONDCEnvironment:       os.Getenv("ONDC_ENVIRONMENT"),
+		RegistryEncryptPubKey: os.Getenv("REGISTRY_ENCRYPT_PUB_KEY"),
+		// Admin endpoints are disabled if the key is not set.
+		AdminAPIKey:     os.Getenv("ADMIN_API_KEY"),
+		MetricsPort:     metricsPort,
+		ShutdownTimeout: os.Getenv("SHUTDOWN_TIMEOUT"),
 	}
 
 	keyClient, err := keyclient.New(ctx, conf.ProjectID, conf.SecretID)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create key client failed", "error", err)
 	}
 	defer keyClient.Close()
 
-	srv, err := initServer(keyClient, conf)
+	registrationClient, err := registrationclient.New(ctx, conf.ProjectID, conf.InstanceID, conf.DatabaseID)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create registration client failed", "error", err)
 	}
-	log.Info("Server initialization successs")
+	defer registrationClient.Close()
 
-	err = srv.serve()
-	if errors.Is(err, http.ErrServerClosed) {
-		log.Info("Server is closed")
-	} else if err != nil {
-		log.Exitf("Serving failed: %v", err)
+	srv, err := initServer(keyClient, registrationClient, conf)
+	if err != nil {
+		logging.Exit("Init server failed", "error", err)
 	}
+	slog.Info("Server initialization successs")
+
+	// Cloud Run sends SIGTERM for stopping the instance.
+	serveCtx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	health.ServeInBackground(serveCtx, conf.MetricsPort, srv.health)
+
+	if err := srv.serve(serveCtx); err != nil {
+		logging.Exit("Serving failed", "error", err)
+	}
+	slog.Info("Server is closed")
 }
 
-func initServer(keyClient keyClient, conf config.OnboardingConfig) (*server, error) {
+func initServer(keyClient keyClient, registrationClient registrationClient, conf config.OnboardingConfig) (*server, error) {
 	if keyClient == nil {
 		return nil, errors.New("init server: key client is nil")
 	}
+	if registrationClient == nil {
+		return nil, errors.New("init server: registration client is nil")
+	}
+
+	registryEncryptPubKey := conf.RegistryEncryptPubKey
+	if registryEncryptPubKey == "" {
+		env, err := registryclient.LookupEnvironment(conf.ONDCEnvironment)
+		if err != nil {
+			return nil, fmt.Errorf("init server: %v", err)
+		}
+		registryEncryptPubKey = env.RegistryEncryptPubKey
+	}
 
-	pubKeyByte, err := crypto.ExtractRawPubKeyFromDER(conf.RegistryEncryptPubKey)
+	pubKeyByte, err := crypto.ExtractRawPubKeyFromDER(registryEncryptPubKey)
 	if err != nil {
 		return nil, fmt.Errorf("init server: invalid registry encryption public key: %v", err)
 	}
+	shutdownTimeout, err := health.ParseShutdownTimeout(conf.ShutdownTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
 
 	server := &server{
 		keyClient:             keyClient,
+		registrationClient:    registrationClient,
 		conf:                  conf,
 		registryEncryptPubKey: pubKeyByte,
+
+		health: health.NewChecker(health.Check{
+			Name: "signing key",
+			Check: func(ctx context.Context) error {
+				_, err := keyClient.ServiceSigningPrivateKeyset(ctx)
+				return err
+			},
+		}),
+		shutdownTimeout: shutdownTimeout,
 	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/on_subscribe", server.onSubscribeHandler)
 	mux.HandleFunc("/ondc-site-verification.html", server.siteVerificationHandler)
+	if conf.AdminAPIKey != "" {
+		mux.HandleFunc("/admin/registration", server.registrationHandler)
+	}
 	server.mux = mux
 
 	return server, nil
 }
 
-func (s *server) serve() error {
+// serve serves the requests until ctx is done, then shuts down gracefully.
+func (s *server) serve(ctx context.Context) error {
 	addr := fmt.Sprintf(":%d", s.conf.Port)
-	log.Info("Server is serving")
-	return http.ListenAndServe(addr, s.mux)
+	slog.Info("Server is serving")
+	return health.ListenAndServe(ctx, &http.Server{Addr: addr, Handler: s.mux}, s.health, s.shutdownTimeout)
 }
 
 func (s *server) onSubscribeHandler(w http.ResponseWriter, r *http.Request) {
@@ -171,7 +248,7 @@ func (s *server) onSubscribeHandler(w http.ResponseWriter, r *http.Request) {
 
 	decryptedMessage, err := s.decryptChallenge(ctx, request.Challenge)
 	if err != nil {
-		log.Errorf("Decrypt challenge failed: %s", err)
+		slog.ErrorContext(ctx, "Decrypt challenge failed", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -213,22 +290,117 @@ func (s *server) siteVerificationHandler(w http.ResponseWriter, r *http.Request)
 
 	signingKeyset, err := s.keyClient.ServiceSigningPrivateKeyset(ctx)
 	if err != nil {
-		log.Errorf("Failed to fetch signing private key: %s", err)
+		slog.ErrorContext(ctx, "Failed to fetch signing private key", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	signedRequestID, err := authentication.Sign([]byte(s.conf.RequestID), signingKeyset)
+	// The registration ID is used as the request ID of /subscribe API.
+	registration, err := s.registrationClient.Registration(ctx, s.conf.RegistrationID)
 	if err != nil {
-		log.Errorf("Failed to sign request ID: %s", err)
+		slog.ErrorContext(ctx, "Failed to read registration", "registration_id", s.conf.RegistrationID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	signedRequestID, err := authentication.Sign([]byte(registration.ID), signingKeyset)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to sign request ID", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	signedRequestIDB64 := base64.StdEncoding.EncodeToString(signedRequestID)
 	if err = siteVerificationTemplate.Execute(w, signedRequestIDB64); err != nil {
-		log.Errorf("Failed to execute template: %s", err)
+		slog.ErrorContext(ctx, "Failed to execute template", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
+
+// registrationHandler creates, reads and updates the registration details of the network participant.
+//
+// GET returns the registration, POST creates it and PUT replaces it.
+func (s *server) registrationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if !s.isAdmin(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		registration, err := s.registrationClient.Registration(ctx, s.conf.RegistrationID)
+		if errors.Is(err, registrationclient.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to read registration", "registration_id", s.conf.RegistrationID, "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, registration)
+		return
+	}
+
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var registration registrationclient.Registration
+	if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	registration.ID = s.conf.RegistrationID
+	if err := registration.Validate(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	var err error
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		err = s.registrationClient.CreateRegistration(ctx, registration)
+		status = http.StatusCreated
+	} else {
+		err = s.registrationClient.UpdateRegistration(ctx, registration)
+	}
+	switch {
+	case errors.Is(err, registrationclient.ErrAlreadyExists):
+		w.WriteHeader(http.StatusConflict)
+		return
+	case errors.Is(err, registrationclient.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case err != nil:
+		slog.ErrorContext(ctx, "Failed to store registration", "registration_id", s.conf.RegistrationID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, status, registration)
+}
+
+// isAdmin checks the bearer token of the request against the admin API key.
+func (s *server) isAdmin(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.conf.AdminAPIKey)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(bodyJSON)
+}
@@ -15,6 +15,8 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -22,6 +24,7 @@ import (
 	"testing"
 
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/keyclienttest"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registrationclienttest"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/cryptotest"
 )
@@ -32,7 +35,7 @@ func TestOnSubscribeHandler(t *testing.T) {
 	conf := config.OnboardingConfig{
 		RegistryEncryptPubKey: cryptotest.ExamplePublicKeyDERB64,
 	}
-	srv, err := initServer(keyClient, conf)
+	srv, err := initServer(keyClient, registrationclienttest.NewStub(), conf)
 	if err != nil {
 		t.Fatalf("setup failed: %v", err)
 	}
@@ -74,9 +77,11 @@ func TestOnSubscribeHandler(t *testing.T) {
 
 func TestSiteVerificationHandler(t *testing.T) {
 	conf := config.OnboardingConfig{
+		RegistrationID:        "registration-id",
 		RegistryEncryptPubKey: cryptotest.ExamplePublicKeyDERB64,
 	}
-	srv, err := initServer(keyclienttest.NewStub(t), conf)
+	registrationClient := registrationclienttest.NewStub(registrationclienttest.Example(conf.RegistrationID))
+	srv, err := initServer(keyclienttest.NewStub(t), registrationClient, conf)
 	if err != nil {
 		t.Fatalf("setup failed: %v", err)
 	}
@@ -93,3 +98,170 @@ func TestSiteVerificationHandler(t *testing.T) {
 		t.Errorf("Content-Type got %v, want %v", got, want)
 	}
 }
+
+func TestSiteVerificationHandlerNoRegistration(t *testing.T) {
+	conf := config.OnboardingConfig{
+		RegistrationID:        "registration-id",
+		RegistryEncryptPubKey: cryptotest.ExamplePublicKeyDERB64,
+	}
+	srv, err := initServer(keyclienttest.NewStub(t), registrationclienttest.NewStub(), conf)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/ondc-site-verification.html", nil)
+	response := httptest.NewRecorder()
+
+	srv.siteVerificationHandler(response, request)
+
+	if got, want := response.Code, http.StatusInternalServerError; got != want {
+		t.Errorf("Status Code got %v, want %v", got, want)
+	}
+}
+
+func TestRegistrationHandler(t *testing.T) {
+	conf := config.OnboardingConfig{
+		RegistrationID:        "registration-id",
+		RegistryEncryptPubKey: cryptotest.ExamplePublicKeyDERB64,
+		AdminAPIKey:           "admin-key",
+	}
+	srv, err := initServer(keyclienttest.NewStub(t), registrationclienttest.NewStub(), conf)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	registration := registrationclienttest.Example("ignored-id")
+	registrationJSON, err := json.Marshal(registration)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	tests := []struct {
+		name               string
+		requestMethod      string
+		requestBody        string
+		apiKey             string
+		responseStatusCode int
+	}{
+		{
+			name:               "no API key",
+			requestMethod:      http.MethodGet,
+			responseStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "wrong API key",
+			requestMethod:      http.MethodGet,
+			apiKey:             "wrong-key",
+			responseStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "read before create",
+			requestMethod:      http.MethodGet,
+			apiKey:             conf.AdminAPIKey,
+			responseStatusCode: http.StatusNotFound,
+		},
+		{
+			name:               "update before create",
+			requestMethod:      http.MethodPut,
+			requestBody:        string(registrationJSON),
+			apiKey:             conf.AdminAPIKey,
+			responseStatusCode: http.StatusNotFound,
+		},
+		{
+			name:               "invalid registration",
+			requestMethod:      http.MethodPost,
+			requestBody:        `{"entityName":"Open Commerce Ltd"}`,
+			apiKey:             conf.AdminAPIKey,
+			responseStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "create",
+			requestMethod:      http.MethodPost,
+			requestBody:        string(registrationJSON),
+			apiKey:             conf.AdminAPIKey,
+			responseStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "create twice",
+			requestMethod:      http.MethodPost,
+			requestBody:        string(registrationJSON),
+			apiKey:             conf.AdminAPIKey,
+			responseStatusCode: http.StatusConflict,
+		},
+		{
+			name:               "update",
+			requestMethod:      http.MethodPut,
+			requestBody:        string(registrationJSON),
+			apiKey:             conf.AdminAPIKey,
+			responseStatusCode: http.StatusOK,
+		},
+		{
+			name:               "read",
+			requestMethod:      http.MethodGet,
+			apiKey:             conf.AdminAPIKey,
+			responseStatusCode: http.StatusOK,
+		},
+		{
+			name:               "unsupported method",
+			requestMethod:      http.MethodDelete,
+			apiKey:             conf.AdminAPIKey,
+			responseStatusCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	// The test cases run in order since they share the stored registration.
+	for _, test := range tests {
+		request := httptest.NewRequest(test.requestMethod, "/admin/registration", strings.NewReader(test.requestBody))
+		if test.apiKey != "" {
+			request.Header.Set("Authorization", "Bearer "+test.apiKey)
+		}
+		response := httptest.NewRecorder()
+
+		srv.mux.ServeHTTP(response, request)
+
+		if got, want := response.Code, test.responseStatusCode; got != want {
+			t.Errorf("%s: Status Code got %v, want %v", test.name, got, want)
+		}
+	}
+
+	stored, err := srv.registrationClient.Registration(context.Background(), conf.RegistrationID)
+	if err != nil {
+		t.Fatalf("Registration(%q) failed: %v", conf.RegistrationID, err)
+	}
+	if got, want := stored.SubscriberID, registration.SubscriberID; got != want {
+		t.Errorf("Stored subscriber ID got %q, want %q", got, want)
+	}
+}
+
+func TestRegistrationHandlerDisabled(t *testing.T) {
+	conf := config.OnboardingConfig{
+		RegistrationID:        "registration-id",
+		RegistryEncryptPubKey: cryptotest.ExamplePublicKeyDERB64,
+	}
+	srv, err := initServer(keyclienttest.NewStub(t), registrationclienttest.NewStub(), conf)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/admin/registration", nil)
+	request.Header.Set("Authorization", "Bearer ")
+	response := httptest.NewRecorder()
+
+	srv.mux.ServeHTTP(response, request)
+
+	if got, want := response.Code, http.StatusNotFound; got != want {
+		t.Errorf("Status Code got %v, want %v", got, want)
+	}
+}
+
+func TestInitServerEnvironmentKey(t *testing.T) {
+	conf := config.OnboardingConfig{ONDCEnvironment: "staging"}
+	if _, err := initServer(keyclienttest.NewStub(t), registrationclienttest.NewStub(), conf); err != nil {
+		t.Errorf("initServer() failed: %v", err)
+	}
+
+	conf = config.OnboardingConfig{ONDCEnvironment: "dev"}
+	if _, err := initServer(keyclienttest.NewStub(t), registrationclienttest.NewStub(), conf); err == nil {
+		t.Errorf("initServer() with an unknown environment succeeded unexpectedly")
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Subscribe registers a network participant in the ONDC registry.
+//
+// It reads the registration details stored by the onboarding service, generates a new signing key
+// and encryption key, stores them in the pending secret of the Secret Manager, calls the registry
+// /subscribe API and waits until the participant can be found via /lookup API. The keys are then
+// stored in the secret of the services, so a rejected subscription leaves their keys unchanged.
+// The onboarding service must be serving `/on_subscribe` and `/ondc-site-verification.html`
+// with the pending secret and the same registration before running this command.
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/keyclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registrationclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registryclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/crypto"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/logging"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/registry"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/signing-authentication/authentication"
+)
+
+const defaultKeyValidity = 365 * 24 * time.Hour
+
+var (
+	configPath   = flag.String("config", "", "Path to the subscribe config file")
+	pollInterval = flag.Duration("poll_interval", 10*time.Second, "Interval between registry lookups")
+	timeout      = flag.Duration("timeout", 10*time.Minute, "Maximum time to wait for the subscription to complete")
+)
+
+type keyClient interface {
+	AddKey(ctx context.Context, secretID string, payload []byte) error
+}
+
+type registryClient interface {
+	Subscribe(request registry.SubscribeRequest) error
+	Lookup(request registry.LookupRequest) (registry.LookupResponse, error)
+}
+
+// subscriber runs the subscription flow of a network participant.
+type subscriber struct {
+	keyClient      keyClient
+	registryClient registryClient
+	clk            clock.Clock
+	conf           config.SubscribeConfig
+	registration   registrationclient.Registration
+
+	keyValidity  time.Duration
+	pollInterval time.Duration
+}
+
+func main() {
+	logging.Init()
+	flag.Parse()
+	ctx := context.Background()
+
+	if *configPath == "" {
+		logging.Exit("-config flag is not set")
+	}
+
+	conf, err := config.Read[config.SubscribeConfig](*configPath)
+	if err != nil {
+		logging.Exit("Read config failed", "error", err)
+	}
+
+	registrationClient, err := registrationclient.New(ctx, conf.ProjectID, conf.InstanceID, conf.DatabaseID)
+	if err != nil {
+		logging.Exit("Create registration client failed", "error", err)
+	}
+	defer registrationClient.Close()
+
+	registration, err := registrationClient.Registration(ctx, conf.RegistrationID)
+	if err != nil {
+		logging.Exit("Read registration failed", "registration_id", conf.RegistrationID, "error", err)
+	}
+
+	registryClient, err := registryclient.New(registration.ONDCRegistryURL, registration.ONDCEnvironment)
+	if err != nil {
+		logging.Exit("Create registry client failed", "error", err)
+	}
+
+	keyClient, err := keyclient.New(ctx, conf.ProjectID, conf.SecretID)
+	if err != nil {
+		logging.Exit("Create key client failed", "error", err)
+	}
+	defer keyClient.Close()
+
+	sub, err := newSubscriber(keyClient, registryClient, clock.New(), conf, registration, *pollInterval)
+	if err != nil {
+		logging.Exit("Create subscriber failed", "error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	uniqueKeyID, err := sub.run(ctx)
+	if err != nil {
+		logging.Exit("Subscription failed", "error", err)
+	}
+	slog.Info("Subscriber is registered, use the unique key ID as the key ID of the services", "subscriber_id", registration.SubscriberID, "unique_key_id", uniqueKeyID)
+}
+
+func newSubscriber(keyClient keyClient, registryClient registryClient, clk clock.Clock, conf config.SubscribeConfig, registration registrationclient.Registration, pollInterval time.Duration) (*subscriber, error) {
+	if keyClient == nil {
+		return nil, errors.New("new subscriber: key client is nil")
+	}
+	if registryClient == nil {
+		return nil, errors.New("new subscriber: registry client is nil")
+	}
+	if err := registration.Validate(); err != nil {
+		return nil, fmt.Errorf("new subscriber: invalid registration: %v", err)
+	}
+
+	keyValidity := defaultKeyValidity
+	if conf.KeyValidity != "" {
+		d, err := time.ParseDuration(conf.KeyValidity)
+		if err != nil {
+			return nil, fmt.Errorf("new subscriber: invalid key validity: %v", err)
+		}
+		keyValidity = d
+	}
+
+	return &subscriber{
+		keyClient:      keyClient,
+		registryClient: registryClient,
+		clk:            clk,
+		conf:           conf,
+		registration:   registration,
+		keyValidity:    keyValidity,
+		pollInterval:   pollInterval,
+	}, nil
+}
+
+// run generates new keys, subscribes to the registry with them and stores them once the subscription completes.
+//
+// It returns the unique key ID of the registered key pair.
+func (s *subscriber) run(ctx context.Context) (string, error) {
+	keyPair, payload, err := s.generateKeys()
+	if err != nil {
+		return "", err
+	}
+	// The onboarding service answers the challenge of the registry with the pending keys.
+	if err := s.addKey(ctx, s.conf.PendingSecretID, payload); err != nil {
+		return "", err
+	}
+
+	params := s.registration.SubscribeParams(keyPair, uuid.NewString())
+	request, err := registryclient.NewSubscribeRequest(params, s.clk.Now().UTC())
+	if err != nil {
+		return "", err
+	}
+	entity := params.Entity
+
+	if err := s.registryClient.Subscribe(request); err != nil {
+		return "", err
+	}
+	slog.InfoContext(ctx, "Subscribe request is acknowledged, waiting for the subscriber to be subscribed", "subscriber_id", entity.SubscriberID)
+
+	if err := s.waitForSubscriber(ctx, entity.SubscriberID, entity.UniqueKeyID); err != nil {
+		return "", err
+	}
+	if err := s.addKey(ctx, s.conf.SecretID, payload); err != nil {
+		return "", err
+	}
+	return entity.UniqueKeyID, nil
+}
+
+// generateKeys generates a new key pair, and returns its public keys and the secret payload of its private keys.
+func (s *subscriber) generateKeys() (*registry.KeyPair, []byte, error) {
+	encryptionPrivateKey, encryptionPublicKey, encryptionPublicKeyDER, err := crypto.GenerateEncryptionKeyPair()
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate encryption key pair: %v", err)
+	}
+
+	signingKeyset, err := authentication.GenerateKeysetJSON()
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate signing keyset: %v", err)
+	}
+
+	signingPublicKey, err := authentication.ExtractRawPublicKey(signingKeyset)
+	if err != nil {
+		return nil, nil, fmt.Errorf("extract raw public signing key: %v", err)
+	}
+
+	payload, err := keyclient.SecretPayload(encryptionPrivateKey, encryptionPublicKey, encryptionPublicKeyDER, signingKeyset, signingPublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal keyset payload: %v", err)
+	}
+
+	validFrom := s.clk.Now().UTC()
+	return &registry.KeyPair{
+		SigningPublicKey:    base64.StdEncoding.EncodeToString(signingPublicKey),
+		EncryptionPublicKey: base64.StdEncoding.EncodeToString(encryptionPublicKeyDER),
+		ValidFrom:           registry.CustomTime(validFrom),
+		ValidUntil:          registry.CustomTime(validFrom.Add(s.keyValidity)),
+	}, payload, nil
+}
+
+// addKey adds the payload as a new version of the secret.
+func (s *subscriber) addKey(ctx context.Context, secretID string, payload []byte) error {
+	secretName := fmt.Sprintf("projects/%s/secrets/%s", s.conf.ProjectID, secretID)
+	if err := s.keyClient.AddKey(ctx, secretName, payload); err != nil {
+		return fmt.Errorf("add key to secret %q: %v", secretID, err)
+	}
+	return nil
+}
+
+// waitForSubscriber polls the registry /lookup API until the subscriber appears.
+func (s *subscriber) waitForSubscriber(ctx context.Context, subscriberID, uniqueKeyID string) error {
+	ticker := s.clk.Ticker(s.pollInterval)
+	defer ticker.Stop()
+
+	request := registry.LookupRequest{
+		SubscriberID: &subscriberID,
+		UkID:         uniqueKeyID,
+	}
+	for {
+		response, err := s.registryClient.Lookup(request)
+		if err != nil {
+			slog.WarnContext(ctx, "Lookup subscriber failed", "subscriber_id", subscriberID, "error", err)
+		} else if len(response) > 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait for subscriber %q: %v", subscriberID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registrationclienttest"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/registry"
+)
+
+type fakeKeyClient struct {
+	// secretNames are the secrets in the order of the added versions.
+	secretNames []string
+	payloads    map[string][]byte
+}
+
+func (c *fakeKeyClient) AddKey(_ context.Context, secretName string, payload []byte) error {
+	c.secretNames = append(c.secretNames, secretName)
+	if c.payloads == nil {
+		c.payloads = make(map[string][]byte)
+	}
+	c.payloads[secretName] = payload
+	return nil
+}
+
+type fakeRegistryClient struct {
+	subscribeRequest registry.SubscribeRequest
+	subscribeErr     error
+	lookupResponse   registry.LookupResponse
+}
+
+func (c *fakeRegistryClient) Subscribe(request registry.SubscribeRequest) error {
+	c.subscribeRequest = request
+	return c.subscribeErr
+}
+
+func (c *fakeRegistryClient) Lookup(registry.LookupRequest) (registry.LookupResponse, error) {
+	return c.lookupResponse, nil
+}
+
+func testConfig() config.SubscribeConfig {
+	return config.SubscribeConfig{
+		ProjectID:       "project",
+		SecretID:        "secret",
+		PendingSecretID: "pending-secret",
+		InstanceID:      "instance",
+		DatabaseID:      "database",
+		RegistrationID:  "registration-id",
+		KeyValidity:     "24h",
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewMock()
+	clk.Set(time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC))
+	keyClient := &fakeKeyClient{}
+	registryClient := &fakeRegistryClient{
+		lookupResponse: registry.LookupResponse{{SubscriberID: "example.com"}},
+	}
+
+	conf := testConfig()
+	s, err := newSubscriber(keyClient, registryClient, clk, conf, registrationclienttest.Example(conf.RegistrationID), time.Second)
+	if err != nil {
+		t.Fatalf("newSubscriber() failed: %v", err)
+	}
+
+	uniqueKeyID, err := s.run(ctx)
+	if err != nil {
+		t.Fatalf("run() failed: %v", err)
+	}
+
+	wantSecrets := []string{"projects/project/secrets/pending-secret", "projects/project/secrets/secret"}
+	if diff := cmp.Diff(wantSecrets, keyClient.secretNames); diff != "" {
+		t.Errorf("AddKey() secrets diff (-want +got):\n%s", diff)
+	}
+	added := keyClient.payloads["projects/project/secrets/secret"]
+	if !bytes.Equal(added, keyClient.payloads["projects/project/secrets/pending-secret"]) {
+		t.Errorf("AddKey() payloads of the secret and the pending secret differ")
+	}
+	var payload map[string]map[string][]byte
+	if err := json.Unmarshal(added, &payload); err != nil {
+		t.Fatalf("AddKey() payload is not valid JSON: %v", err)
+	}
+	if len(payload["signingKey"]["signingKeySet"]) == 0 || len(payload["encryptionKey"]["privateKeyEncryption"]) == 0 {
+		t.Errorf("AddKey() payload = %s, want signing and encryption keys", added)
+	}
+
+	entity := registryClient.subscribeRequest.Message.Entity
+	if entity.UniqueKeyID != uniqueKeyID {
+		t.Errorf("Subscribe() unique_key_id = %q, want %q", entity.UniqueKeyID, uniqueKeyID)
+	}
+	if got, want := time.Time(entity.KeyPair.ValidUntil), clk.Now().Add(24*time.Hour); !got.Equal(want) {
+		t.Errorf("Subscribe() valid_until = %v, want %v", got, want)
+	}
+	if got, want := registryClient.subscribeRequest.Context.Operation.OpsNo, int32(2); got != want {
+		t.Errorf("Subscribe() ops_no = %d, want %d", got, want)
+	}
+	if got, want := registryClient.subscribeRequest.Message.RequestID, conf.RegistrationID; got != want {
+		t.Errorf("Subscribe() request_id = %q, want %q", got, want)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	conf := testConfig()
+	keyClient := &fakeKeyClient{}
+	s, err := newSubscriber(keyClient, &fakeRegistryClient{}, clock.NewMock(), conf, registrationclienttest.Example(conf.RegistrationID), time.Second)
+	if err != nil {
+		t.Fatalf("newSubscriber() failed: %v", err)
+	}
+
+	if _, err := s.run(ctx); err == nil {
+		t.Errorf("run() succeeded unexpectedly")
+	}
+	if _, ok := keyClient.payloads["projects/project/secrets/secret"]; ok {
+		t.Errorf("AddKey() stored the keys of the incomplete subscription in the secret")
+	}
+}
+
+func TestRunSubscribeFailed(t *testing.T) {
+	conf := testConfig()
+	keyClient := &fakeKeyClient{}
+	registryClient := &fakeRegistryClient{subscribeErr: errors.New("subscribe failed")}
+	s, err := newSubscriber(keyClient, registryClient, clock.NewMock(), conf, registrationclienttest.Example(conf.RegistrationID), time.Second)
+	if err != nil {
+		t.Fatalf("newSubscriber() failed: %v", err)
+	}
+
+	if _, err := s.run(context.Background()); err == nil {
+		t.Fatal("run() succeeded unexpectedly")
+	}
+	if diff := cmp.Diff([]string{"projects/project/secrets/pending-secret"}, keyClient.secretNames); diff != "" {
+		t.Errorf("AddKey() secrets diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewSubscriberFailed(t *testing.T) {
+	conf := testConfig()
+	registration := registrationclienttest.Example(conf.RegistrationID)
+
+	invalidKeyValidity := testConfig()
+	invalidKeyValidity.KeyValidity = "1 year"
+	if _, err := newSubscriber(&fakeKeyClient{}, &fakeRegistryClient{}, clock.NewMock(), invalidKeyValidity, registration, time.Second); err == nil {
+		t.Errorf("newSubscriber() with invalid key validity succeeded unexpectedly")
+	}
+
+	invalidRegistration := registrationclienttest.Example(conf.RegistrationID)
+	invalidRegistration.DomainsEnabled = nil
+	if _, err := newSubscriber(&fakeKeyClient{}, &fakeRegistryClient{}, clock.NewMock(), conf, invalidRegistration, time.Second); err == nil {
+		t.Errorf("newSubscriber() with invalid registration succeeded unexpectedly")
+	}
+}
@@ -19,28 +19,38 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/pubsub"
 	"github.com/benbjohnson/clock"
-	log "github.com/golang/glog"
+	"golang.org/x/exp/slog"
 
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/claimcheck"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registryclient"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/transactionclient"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/errorcode"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/health"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/logging"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/middleware"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/ordering"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/policy"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/ratelimit"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/tracing"
 )
 
 const psMsgIDHeader = "Pubsub-Message-ID"
 
+// inFlightRetryAfter is the Retry-After in seconds of the retries received while the original is being published.
+const inFlightRetryAfter = "1"
+
 var validate = model.Validator()
 
 type server struct {
@@ -49,53 +59,67 @@ type server struct {
 	topic             *pubsub.Topic
 	mux               http.Handler
 	conf              config.BPPAPIConfig
+	claimCheck        *claimcheck.ClaimCheck
+
+	health          *health.Checker
+	shutdownTimeout time.Duration
 }
 
 func main() {
-	flag.Set("alsologtostderr", "true")
+	logging.Init()
 	ctx := context.Background()
 
 	configPath, ok := os.LookupEnv("CONFIG")
 	if !ok {
-		log.Exit("CONFIG env is not set")
+		logging.Exit("CONFIG env is not set")
 	}
 
 	conf, err := config.Read[config.BPPAPIConfig](configPath)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Read config failed", "error", err)
+	}
+
+	shutdownTracing, err := tracing.Init(ctx, "bpp-api")
+	if err != nil {
+		logging.Exit("Init tracing failed", "error", err)
 	}
+	defer shutdownTracing(ctx)
 
 	registryClient, err := registryclient.New(conf.RegistryURL, conf.ONDCEnvironment)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create registry client failed", "error", err)
 	}
 
 	pubsubClient, err := pubsub.NewClient(ctx, conf.ProjectID)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create Pub/Sub client failed", "error", err)
 	}
 
 	transactionClient, err := transactionclient.New(ctx, conf.ProjectID, conf.InstanceID, conf.DatabaseID)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create transaction client failed", "error", err)
 	}
 
 	srv, err := initServer(ctx, conf, registryClient, pubsubClient, transactionClient, clock.New())
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Init server failed", "error", err)
 	}
-	log.Info("Server initialization successs")
+	slog.Info("Server initialization successs")
+
+	// Kubernetes sends SIGTERM for stopping the pod.
+	serveCtx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	err = srv.serve()
-	if errors.Is(err, http.ErrServerClosed) {
-		log.Info("Server is closed")
-	} else if err != nil {
-		log.Exitf("Serving failed: %v", err)
+	health.ServeInBackground(serveCtx, conf.MetricsPort, srv.health)
+
+	if err := srv.serve(serveCtx); err != nil {
+		logging.Exit("Serving failed", "error", err)
 	}
+	slog.Info("Server is closed")
 }
 
 func initServer(ctx context.Context, conf config.BPPAPIConfig, registryClient middleware.RegistryClient, pubsubClient *pubsub.Client, transactionClient *transactionclient.Client, clk clock.Clock) (*server, error) {
-	topic := pubsubClient.Topic(conf.TopicID)
+	topic := ordering.Topic(pubsubClient, conf.TopicID)
 	exist, err := topic.Exists(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("init server: %v", err)
@@ -104,11 +128,37 @@ func initServer(ctx context.Context, conf config.BPPAPIConfig, registryClient mi
 		return nil, fmt.Errorf("init server: topic %q does not exist", conf.TopicID)
 	}
 
+	shutdownTimeout, err := health.ParseShutdownTimeout(conf.ShutdownTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	claimCheck, err := claimcheck.Open(ctx, conf.ClaimCheck.StoreURL, conf.ClaimCheck.Threshold)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	limiter, err := ratelimit.New(conf.RateLimit, clk)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	pol := policy.New(config.PolicyConfig{})
+	if conf.PolicyPath != "" {
+		if pol, err = policy.Load(conf.PolicyPath); err != nil {
+			return nil, fmt.Errorf("init server: %v", err)
+		}
+		go pol.Watch(ctx, conf.PolicyPath, policy.ReloadInterval)
+	}
+	checks := []health.Check{health.TopicCheck(topic)}
+	checks = append(checks, health.Check{Name: "spanner", Check: transactionClient.Ping})
+
 	srv := &server{
 		pubsubClient:      pubsubClient,
 		transactionClient: transactionClient,
 		topic:             topic,
 		conf:              conf,
+		claimCheck:        claimCheck,
+
+		health:          health.NewChecker(checks...),
+		shutdownTimeout: shutdownTimeout,
 	}
 
 	mux := http.NewServeMux()
@@ -139,14 +189,35 @@ func initServer(ctx context.Context, conf config.BPPAPIConfig, registryClient mi
 
 	srv.mux = middleware.Adapt(
 		mux,
+		middleware.RateLimit(mux, limiter, errorcode.RoleSellerApp),
+		middleware.Policy(pol, errorcode.RoleSellerApp),
 		middleware.NPAuthentication(registryClient, clk, errorcode.RoleSellerApp, conf.SubscriberID),
 		middleware.OnlyPostMethod(),
 		middleware.Logging(),
+		middleware.ReadBody(conf.MaxBodySize, errorcode.RoleSellerApp),
+		middleware.Metrics(mux),
+		middleware.Tracing(),
 	)
 
 	return srv, nil
 }
 
+// messageKey returns the key detecting the retries of the request.
+//
+// The sender is the authenticated subscriber, or the BAP of the context if the request is not authenticated.
+func messageKey(ctx context.Context, action string, msgContext model.Context) transactionclient.MessageKey {
+	subscriberID, ok := middleware.AuthenticatedSubscriber(ctx)
+	if !ok {
+		subscriberID = *msgContext.BapID
+	}
+	return transactionclient.MessageKey{
+		SubscriberID:  subscriberID,
+		TransactionID: *msgContext.TransactionID,
+		MessageID:     *msgContext.MessageID,
+		Action:        action,
+	}
+}
+
 // decodeAndValidate decodes JSON body and validate the payload.
 func decodeAndValidate(body []byte, payload any) error {
 	if err := json.Unmarshal(body, &payload); err != nil {
@@ -203,39 +274,45 @@ func ackResponse(w http.ResponseWriter) {
 	w.Write(resJSON)
 }
 
-func (s *server) serve() error {
+// serve serves the requests until ctx is done, then shuts down gracefully.
+func (s *server) serve(ctx context.Context) error {
 	addr := fmt.Sprintf(":%d", s.conf.Port)
-	log.Info("Server is serving")
-	return http.ListenAndServe(addr, s.mux)
+	slog.Info("Server is serving")
+	return health.ListenAndServe(ctx, &http.Server{Addr: addr, Handler: s.mux}, s.health, s.shutdownTimeout)
 }
 
 // publishMessage publishes incoming request to the topic and return the publishing result.
-func (s *server) publishMessage(ctx context.Context, body []byte, action string) (msgID string, err error) {
+//
+// The messages of a transaction are published in order. Large bodies are offloaded to the claim check store.
+func (s *server) publishMessage(ctx context.Context, body []byte, action, transactionID string) (msgID string, err error) {
 	msg := &pubsub.Message{
-		Data: body,
 		Attributes: map[string]string{
 			"action": action,
 		},
+		OrderingKey: transactionID,
+	}
+	if err := s.claimCheck.SetData(ctx, msg, body); err != nil {
+		return "", err
 	}
-	result := s.topic.Publish(ctx, msg)
-	return result.Get(ctx)
+	tracing.InjectPubSub(ctx, msg)
+	return ordering.Publish(ctx, s.topic, msg)
 }
 
 // genericHandler can handles all kind of ONDC request.
 func genericHandler[R model.BPPRequest](s *server, action string, w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	body, err := io.ReadAll(r.Body)
+	body, err := middleware.RequestBody(r)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
-		log.Errorf("Read request body: %v", err)
+		slog.ErrorContext(ctx, "Read request body", "error", err)
 		return
 	}
 
 	var payload R
 	if err := decodeAndValidate(body, &payload); err != nil {
-		log.Errorf("Request body is invalid: %v", err)
+		slog.ErrorContext(ctx, "Request body is invalid", "error", err)
 		msgContext := payload.GetContext()
 		errType := "JSON-SCHEMA-ERROR"
 		errCode, ok := errorcode.Lookup(errorcode.RoleSellerApp, errorcode.ErrInvalidRequest)
@@ -248,7 +325,7 @@ func genericHandler[R model.BPPRequest](s *server, action string, w http.Respons
 		if err := s.storeInvalidTransaction(ctx, action, payload, msgContext, errType, errCodeStr, err.Error()); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(err.Error()))
-			log.Errorf("Store transaction failed: %v", err)
+			slog.ErrorContext(ctx, "Store transaction failed", "error", err)
 			return
 		}
 
@@ -256,21 +333,57 @@ func genericHandler[R model.BPPRequest](s *server, action string, w http.Respons
 		return
 	}
 
-	msgID, err := s.publishMessage(ctx, body, action)
+	key := messageKey(ctx, action, payload.GetContext())
+	originalMsgID, err := s.transactionClient.ClaimMessage(ctx, key)
+	if errors.Is(err, transactionclient.ErrDuplicate) {
+		slog.InfoContext(ctx, "Duplicate request is acknowledged without publishing", "original_pubsub_message_id", originalMsgID)
+		if err := s.storeDuplicateTransaction(ctx, action, payload, payload.GetContext()); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			slog.ErrorContext(ctx, "Store transaction failed", "error", err)
+			return
+		}
+		w.Header().Set(psMsgIDHeader, originalMsgID)
+		ackResponse(w)
+		return
+	}
+	if errors.Is(err, transactionclient.ErrInFlight) {
+		// The retry is not acknowledged, as it is lost if the original fails to be published.
+		slog.InfoContext(ctx, "Retry of the request being published is rejected")
+		w.Header().Set("Retry-After", inFlightRetryAfter)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
-		log.Errorf("Publish Pub/Sub message failed: %v", err)
+		slog.ErrorContext(ctx, "Claim message failed", "error", err)
 		return
 	}
-	w.Header().Set(psMsgIDHeader, msgID)
 
 	if err := s.storeValidTransaction(ctx, action, payload, payload.GetContext()); err != nil {
+		s.releaseMessage(ctx, key)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		slog.ErrorContext(ctx, "Store transaction failed", "error", err)
+		return
+	}
+
+	msgID, err := s.publishMessage(ctx, body, action, *payload.GetContext().TransactionID)
+	if err != nil {
+		s.releaseMessage(ctx, key)
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
-		log.Errorf("Store transaction failed: %v", err)
+		slog.ErrorContext(ctx, "Publish Pub/Sub message failed", "error", err)
 		return
 	}
+	w.Header().Set(psMsgIDHeader, msgID)
+	ctx = logging.With(ctx, slog.String(logging.PubSubMessageIDKey, msgID))
+
+	if err := s.transactionClient.CompleteMessage(ctx, key, msgID); err != nil {
+		// The message is published, so the request is acknowledged. Its retries are published again after the claim times out.
+		slog.ErrorContext(ctx, "Complete message failed", "error", err)
+	}
 	ackResponse(w)
 }
 
@@ -288,6 +401,29 @@ func (s *server) storeValidTransaction(ctx context.Context, action string, paylo
 	return s.transactionClient.StoreTransaction(ctx, transactionData)
 }
 
+// storeDuplicateTransaction records a retry of a received request, which is acknowledged without publishing.
+func (s *server) storeDuplicateTransaction(ctx context.Context, action string, payload any, msgContext model.Context) error {
+	transactionData := transactionclient.TransactionData{
+		ID:              *msgContext.TransactionID,
+		Type:            "REQUEST-ACTION",
+		API:             action,
+		MessageID:       *msgContext.MessageID,
+		Payload:         payload,
+		ProviderID:      *msgContext.BapID,
+		MessageStatus:   "ACK",
+		ReqReceivedTime: time.Now(),
+		Duplicate:       true,
+	}
+	return s.transactionClient.StoreTransaction(ctx, transactionData)
+}
+
+// releaseMessage releases the claim of a request failed to be published, so its retry is published.
+func (s *server) releaseMessage(ctx context.Context, key transactionclient.MessageKey) {
+	if err := s.transactionClient.ReleaseMessage(ctx, key); err != nil {
+		slog.ErrorContext(ctx, "Release message failed", "error", err)
+	}
+}
+
 func (s *server) storeInvalidTransaction(ctx context.Context, action string, payload any, msgContext model.Context, errorType, errorCode, errMsg string) error {
 	transactionData := transactionclient.TransactionData{
 		ID:              *msgContext.TransactionID,
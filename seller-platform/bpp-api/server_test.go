@@ -243,6 +243,55 @@ func TestHandlersSuccess(t *testing.T) {
 	}
 }
 
+func TestHandlersDuplicateRequest(t *testing.T) {
+	hash := uuid.New().String()[:8]
+	projectID := fmt.Sprintf("test-project-%s", hash)
+	topicID := fmt.Sprintf("bpp-topic-%s", hash)
+	instanceID := fmt.Sprintf("test-instance-%s", hash)
+	databaseID := fmt.Sprintf("test-database-%s", hash)
+
+	ctx := context.Background()
+	psSrv, opt := pubsubtest.InitServer(t, projectID, []pubsubtest.PubsubSetup{{TopicID: topicID}})
+	pubsubClient, err := pubsub.NewClient(ctx, projectID, opt)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	conf := config.BPPAPIConfig{
+		ProjectID: projectID,
+		TopicID:   topicID,
+	}
+	opts := transactiontest.NewDatabase(ctx, t, projectID, instanceID, databaseID)
+	transactionClient, err := transactionclient.New(ctx, projectID, instanceID, databaseID, opts...)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	srv, err := initServer(ctx, conf, registryclienttest.NewStub(), pubsubClient, transactionClient, clock.New())
+	if err != nil {
+		t.Fatalf("initServer() failed: %v", err)
+	}
+
+	var msgIDs []string
+	for i := 0; i < 2; i++ {
+		request := httptest.NewRequest(http.MethodPost, "/select", bytes.NewReader(selectRequestPayload))
+		response := httptest.NewRecorder()
+
+		srv.selectHandler(response, request)
+
+		if got, want := response.Code, http.StatusOK; got != want {
+			t.Fatalf("selectHandler() #%d got status %d, want %d", i, got, want)
+		}
+		msgIDs = append(msgIDs, response.Header().Get(psMsgIDHeader))
+	}
+
+	if msgIDs[0] == "" || msgIDs[1] != msgIDs[0] {
+		t.Errorf("selectHandler() Pub/Sub message IDs = %q, want the ID of the original message", msgIDs)
+	}
+	if got, want := len(psSrv.Messages()), 1; got != want {
+		t.Errorf("selectHandler() published %d messages, want %d", got, want)
+	}
+}
+
 func TestHandlersInvalidPayload(t *testing.T) {
 	hash := uuid.New().String()[:8]
 	projectID := fmt.Sprintf("test-project-%s", hash)
@@ -0,0 +1,248 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/pendingclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/errorcode"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+const (
+	// defaultAsyncTTL is the time for the seller system to post the callback if the config has none.
+	defaultAsyncTTL = 10 * time.Minute
+	// defaultExpiryInterval is the interval of checking for the expired requests if the config has none.
+	defaultExpiryInterval = 30 * time.Second
+	// expiryBatchSize is the maximum number of the expired requests taken at once.
+	expiryBatchSize = 100
+)
+
+type pendingClient interface {
+	Ping(context.Context) error
+	Add(context.Context, pendingclient.Request) error
+	Take(ctx context.Context, messageID, action string) (pendingclient.Request, error)
+	TakeExpired(ctx context.Context, now time.Time, limit int) ([]pendingclient.Request, error)
+}
+
+// messageContext is the context of a request or a callback of any action.
+type messageContext struct {
+	Context *model.Context `json:"context"`
+}
+
+// parseDuration parses the duration, or returns the default if it is empty.
+func parseDuration(s string, defaultDuration time.Duration) (time.Duration, error) {
+	if s == "" {
+		return defaultDuration, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// addPending stores the request as pending in the seller system until the TTL.
+func (s *server) addPending(ctx context.Context, action string, data []byte) (pendingclient.Request, error) {
+	var msg messageContext
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return pendingclient.Request{}, fmt.Errorf("unmarshal request: %v", err)
+	}
+	if msg.Context == nil || msg.Context.MessageID == nil || msg.Context.TransactionID == nil {
+		return pendingclient.Request{}, errors.New("request without message ID or transaction ID")
+	}
+
+	req := pendingclient.Request{
+		MessageID:     *msg.Context.MessageID,
+		Action:        action,
+		TransactionID: *msg.Context.TransactionID,
+		Payload:       data,
+		ExpireTime:    time.Now().Add(s.asyncTTL),
+	}
+	if err := s.pending.Add(ctx, req); err != nil {
+		return pendingclient.Request{}, err
+	}
+	return req, nil
+}
+
+// removePending removes the request which the seller system did not accept asynchronously.
+//
+// The request expires with an error callback if it cannot be removed.
+func (s *server) removePending(ctx context.Context, req pendingclient.Request) {
+	_, err := s.pending.Take(ctx, req.MessageID, req.Action)
+	if err != nil && !errors.Is(err, pendingclient.ErrNotFound) {
+		slog.WarnContext(ctx, "Removing pending request failed", "error", err)
+	}
+}
+
+// receiveCallback publishes the callback posted by the seller system for the pending request of the message ID.
+//
+// The callback is rejected with 404 Not Found if its request is not pending, and with 410 Gone if its request
+// expired, as the error callback is sent instead.
+func (s *server) receiveCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	messageID, _ := strings.CutPrefix(r.URL.Path, "/callbacks/")
+	if messageID == "" || strings.Contains(messageID, "/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.ErrorContext(ctx, "Reading callback failed", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var msg messageContext
+	if err := json.Unmarshal(body, &msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg.Context == nil || msg.Context.MessageID == nil || *msg.Context.MessageID != messageID {
+		http.Error(w, "context.message_id does not match the path", http.StatusBadRequest)
+		return
+	}
+	action, ok := strings.CutPrefix(msg.Context.Action, "on_")
+	if !ok {
+		http.Error(w, "context.action is not a callback", http.StatusBadRequest)
+		return
+	}
+
+	req, err := s.pending.Take(ctx, messageID, action)
+	if errors.Is(err, pendingclient.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Taking pending request failed", "message_id", messageID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if req.ExpireTime.Before(time.Now()) {
+		// The request is taken before the expiry check, so the error callback is sent here.
+		if err := s.expire(ctx, req); err != nil {
+			slog.ErrorContext(ctx, "Expiring pending request failed", "message_id", messageID, "error", err)
+		}
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	if err := s.publishCallback(ctx, msg.Context.Action, body); err != nil {
+		slog.ErrorContext(ctx, "Publishing callback failed", "message_id", messageID, "error", err)
+		// The request is pending again, so the seller system can retry the callback.
+		if err := s.pending.Add(ctx, req); err != nil {
+			slog.ErrorContext(ctx, "Restoring pending request failed", "message_id", messageID, "error", err)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(ctx, "Callback of the pending request is published", "message_id", messageID, "action", msg.Context.Action)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// expirePendingRequests sends the error callbacks of the expired requests every expiry interval until ctx is done.
+func (s *server) expirePendingRequests(ctx context.Context) error {
+	ticker := time.NewTicker(s.expiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			if err := s.expireBefore(ctx, now); err != nil {
+				slog.ErrorContext(ctx, "Expiring pending requests failed", "error", err)
+			}
+		}
+	}
+}
+
+// expireBefore sends the error callbacks of the requests expired at now.
+func (s *server) expireBefore(ctx context.Context, now time.Time) error {
+	var errs []error
+	for {
+		reqs, err := s.pending.TakeExpired(ctx, now, expiryBatchSize)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		for _, req := range reqs {
+			if err := s.expire(ctx, req); err != nil {
+				errs = append(errs, fmt.Errorf("message %s: %v", req.MessageID, err))
+			}
+		}
+		if len(reqs) < expiryBatchSize {
+			return errors.Join(errs...)
+		}
+	}
+}
+
+// expire publishes the error callback of the request which the seller system did not answer in time.
+//
+// The request is pending again if the publishing fails, so the next expiry check retries the error callback.
+func (s *server) expire(ctx context.Context, req pendingclient.Request) error {
+	payload, err := errorCallback(req, "seller system did not respond in time")
+	if err != nil {
+		return err
+	}
+	slog.WarnContext(ctx, "Pending request expired", "message_id", req.MessageID, "action", req.Action)
+	if err := s.publishCallback(ctx, "on_"+req.Action, payload); err != nil {
+		req.ExpireTime = time.Now()
+		if addErr := s.pending.Add(ctx, req); addErr != nil {
+			return fmt.Errorf("publish error callback: %v, restore pending request: %v", err, addErr)
+		}
+		return fmt.Errorf("publish error callback: %v", err)
+	}
+	return nil
+}
+
+// errorCallback returns the callback payload of the internal error answering the request.
+func errorCallback(req pendingclient.Request, message string) ([]byte, error) {
+	var msg messageContext
+	if err := json.Unmarshal(req.Payload, &msg); err != nil {
+		return nil, fmt.Errorf("unmarshal request: %v", err)
+	}
+	if msg.Context == nil {
+		return nil, errors.New("request without context")
+	}
+	errCode, ok := errorcode.Lookup(errorcode.RoleSellerApp, errorcode.ErrInternal)
+	if !ok {
+		return nil, errors.New("no error code of the internal error")
+	}
+	code := strconv.Itoa(errCode)
+
+	msgContext := *msg.Context
+	now := time.Now().UTC()
+	msgContext.Action = "on_" + req.Action
+	msgContext.Timestamp = &now
+	return json.Marshal(struct {
+		Context *model.Context `json:"context"`
+		Error   *model.Error   `json:"error"`
+	}{
+		Context: &msgContext,
+		Error: &model.Error{
+			Type:    "CORE-ERROR",
+			Code:    &code,
+			Message: message,
+		},
+	})
+}
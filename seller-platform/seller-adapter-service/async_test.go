@@ -0,0 +1,294 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/pendingclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/pendingclienttest"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/pubsubtest"
+)
+
+// testMessage returns a payload of the action with the context of the test search.
+func testMessage(action string) []byte {
+	msgContext := strings.Replace(testSearchContext, `"action": "search"`, fmt.Sprintf(`"action": %q`, action), 1)
+	return []byte(fmt.Sprintf(`{"context": %s, "message": {}}`, msgContext))
+}
+
+// initAsyncServer initializes a server sending the requests to the seller system responding with the status code.
+func initAsyncServer(t *testing.T, pending *pendingclienttest.Stub, statusCode int) (*server, *pstest.Server) {
+	t.Helper()
+	const projectID = "test-project"
+	ctx := context.Background()
+	psSrv, opt := pubsubtest.InitServer(t, projectID, []pubsubtest.PubsubSetup{
+		{
+			TopicID:   "bpp-topic",
+			SubSetups: []pubsubtest.SubSetup{{SubID: "bpp-subscription"}},
+		},
+		{
+			TopicID: "callback-topic",
+		},
+	})
+	pubsubClient, err := pubsub.NewClient(ctx, projectID, opt)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	sellerSystem := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+		if statusCode == http.StatusOK {
+			w.Write(testMessage("on_select"))
+		}
+	}))
+	t.Cleanup(sellerSystem.Close)
+
+	conf := config.SellerAdapterConfig{
+		ProjectID:       projectID,
+		SellerSystemURL: sellerSystem.URL,
+		CallbackTopicID: "callback-topic",
+		SubscriptionID:  []string{"bpp-subscription"},
+		Async:           &config.AsyncConfig{InstanceID: "instance", DatabaseID: "database"},
+	}
+	srv, err := initializeServer(ctx, sellerSystem.Client(), pubsubClient, nil, pending, nil, conf)
+	if err != nil {
+		t.Fatalf("initializeServer failed: %v", err)
+	}
+	return srv, psSrv
+}
+
+// publishedErrorCodes returns the error codes of the published callbacks of the action, or "" for no error.
+func publishedErrorCodes(t *testing.T, psSrv *pstest.Server, action string) []string {
+	t.Helper()
+	var codes []string
+	for _, m := range psSrv.Messages() {
+		if m.Attributes["action"] != action {
+			t.Errorf("Published action = %q, want %q", m.Attributes["action"], action)
+			continue
+		}
+		var callback struct {
+			Context struct {
+				Action string `json:"action"`
+			} `json:"context"`
+			Error *struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(m.Data, &callback); err != nil {
+			t.Fatalf("Unmarshal callback failed: %v", err)
+		}
+		if callback.Context.Action != action {
+			t.Errorf("Callback context action = %q, want %q", callback.Context.Action, action)
+		}
+		if callback.Error == nil {
+			codes = append(codes, "")
+		} else {
+			codes = append(codes, callback.Error.Code)
+		}
+	}
+	return codes
+}
+
+func TestSendToSellerSystemAsync(t *testing.T) {
+	pending := pendingclienttest.NewStub()
+	srv, psSrv := initAsyncServer(t, pending, http.StatusAccepted)
+	handler := srv.apiHandler()
+
+	if !srv.sendToSellerSystem(context.Background(), "select", testMessage("select")) {
+		t.Fatal("sendToSellerSystem() = false, want true")
+	}
+	if got := len(psSrv.Messages()); got != 0 {
+		t.Errorf("Accepted request published %d messages, want 0", got)
+	}
+	reqs := pending.Requests()
+	if len(reqs) != 1 || reqs[0].MessageID != "message-id" || reqs[0].Action != "select" {
+		t.Fatalf("Pending requests = %+v, want the select of message-id", reqs)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/callbacks/message-id", strings.NewReader(string(testMessage("on_select")))))
+	if got, want := rec.Code, http.StatusNoContent; got != want {
+		t.Fatalf("POST /callbacks/message-id status = %d, want %d", got, want)
+	}
+	if got := publishedErrorCodes(t, psSrv, "on_select"); len(got) != 1 || got[0] != "" {
+		t.Errorf("Published callback error codes = %q, want one callback without error", got)
+	}
+	if got := pending.Requests(); len(got) != 0 {
+		t.Errorf("Pending requests = %+v, want none after the callback", got)
+	}
+
+	// The callback is published once.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/callbacks/message-id", strings.NewReader(string(testMessage("on_select")))))
+	if got, want := rec.Code, http.StatusNotFound; got != want {
+		t.Errorf("Repeated POST /callbacks/message-id status = %d, want %d", got, want)
+	}
+}
+
+func TestSendToSellerSystemAsyncNotAccepted(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		want       bool
+	}{
+		{statusCode: http.StatusOK, want: true},
+		{statusCode: http.StatusInternalServerError, want: false},
+	}
+	for _, test := range tests {
+		pending := pendingclienttest.NewStub()
+		srv, psSrv := initAsyncServer(t, pending, test.statusCode)
+
+		if got := srv.sendToSellerSystem(context.Background(), "select", testMessage("select")); got != test.want {
+			t.Errorf("sendToSellerSystem() with status %d = %t, want %t", test.statusCode, got, test.want)
+		}
+		if got := pending.Requests(); len(got) != 0 {
+			t.Errorf("Pending requests with status %d = %+v, want none", test.statusCode, got)
+		}
+		wantMessages := 0
+		if test.want {
+			wantMessages = 1
+		}
+		if got := len(psSrv.Messages()); got != wantMessages {
+			t.Errorf("Status %d published %d messages, want %d", test.statusCode, got, wantMessages)
+		}
+	}
+}
+
+func TestCallbackHandler(t *testing.T) {
+	pending := pendingclienttest.NewStub()
+	srv, psSrv := initAsyncServer(t, pending, http.StatusAccepted)
+	handler := srv.apiHandler()
+	if !srv.sendToSellerSystem(context.Background(), "select", testMessage("select")) {
+		t.Fatal("sendToSellerSystem() = false, want true")
+	}
+
+	tests := []struct {
+		name, method, path, body string
+		wantStatus               int
+	}{
+		{name: "wrong method", method: http.MethodGet, path: "/callbacks/message-id", wantStatus: http.StatusMethodNotAllowed},
+		{name: "not JSON", method: http.MethodPost, path: "/callbacks/message-id", body: "not JSON", wantStatus: http.StatusBadRequest},
+		{name: "other message ID", method: http.MethodPost, path: "/callbacks/other-id", body: string(testMessage("on_select")), wantStatus: http.StatusBadRequest},
+		{name: "not callback", method: http.MethodPost, path: "/callbacks/message-id", body: string(testMessage("select")), wantStatus: http.StatusBadRequest},
+		{name: "other action", method: http.MethodPost, path: "/callbacks/message-id", body: string(testMessage("on_init")), wantStatus: http.StatusNotFound},
+		{name: "no message ID", method: http.MethodPost, path: "/callbacks/", body: string(testMessage("on_select")), wantStatus: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(test.method, test.path, strings.NewReader(test.body)))
+		if rec.Code != test.wantStatus {
+			t.Errorf("%s: %s %s status = %d, want %d", test.name, test.method, test.path, rec.Code, test.wantStatus)
+		}
+	}
+
+	if got := len(psSrv.Messages()); got != 0 {
+		t.Errorf("Rejected callbacks published %d messages, want 0", got)
+	}
+	if got := len(pending.Requests()); got != 1 {
+		t.Errorf("Got %d pending requests, want the request still pending", got)
+	}
+}
+
+func TestExpirePendingRequests(t *testing.T) {
+	ctx := context.Background()
+	pending := pendingclienttest.NewStub()
+	srv, psSrv := initAsyncServer(t, pending, http.StatusAccepted)
+	now := time.Now()
+	for _, req := range []pendingclient.Request{
+		{MessageID: "message-id", Action: "select", TransactionID: "transaction-id", Payload: testMessage("select"), ExpireTime: now.Add(-time.Second)},
+		{MessageID: "later-id", Action: "select", TransactionID: "transaction-id", Payload: testMessage("select"), ExpireTime: now.Add(time.Minute)},
+	} {
+		if err := pending.Add(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := srv.expireBefore(ctx, now); err != nil {
+		t.Fatalf("expireBefore() failed: %v", err)
+	}
+	if got := publishedErrorCodes(t, psSrv, "on_select"); len(got) != 1 || got[0] != "31001" {
+		t.Errorf("Published callback error codes = %q, want one 31001", got)
+	}
+	reqs := pending.Requests()
+	if len(reqs) != 1 || reqs[0].MessageID != "later-id" {
+		t.Errorf("Pending requests = %+v, want the request expiring later", reqs)
+	}
+}
+
+func TestCallbackHandlerExpired(t *testing.T) {
+	ctx := context.Background()
+	pending := pendingclienttest.NewStub()
+	srv, psSrv := initAsyncServer(t, pending, http.StatusAccepted)
+	req := pendingclient.Request{MessageID: "message-id", Action: "select", TransactionID: "transaction-id", Payload: testMessage("select"), ExpireTime: time.Now().Add(-time.Second)}
+	if err := pending.Add(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.apiHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/callbacks/message-id", strings.NewReader(string(testMessage("on_select")))))
+	if got, want := rec.Code, http.StatusGone; got != want {
+		t.Errorf("POST /callbacks/message-id status = %d, want %d", got, want)
+	}
+	// The error callback is sent in place of the late callback.
+	if got := publishedErrorCodes(t, psSrv, "on_select"); len(got) != 1 || got[0] != "31001" {
+		t.Errorf("Published callback error codes = %q, want one 31001", got)
+	}
+}
+
+func TestExpirePendingRequestsPublishFail(t *testing.T) {
+	pending := pendingclienttest.NewStub()
+	srv, psSrv := initAsyncServer(t, pending, http.StatusAccepted)
+	now := time.Now()
+	req := pendingclient.Request{MessageID: "message-id", Action: "select", TransactionID: "transaction-id", Payload: testMessage("select"), ExpireTime: now.Add(-time.Second)}
+	if err := pending.Add(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	psSrv.SetAutoPublishResponse(false)
+	psSrv.AddPublishResponse(nil, status.Error(codes.InvalidArgument, "publish failed"))
+	if err := srv.expireBefore(context.Background(), now); err == nil {
+		t.Fatal("expireBefore() succeeded unexpectedly")
+	}
+	psSrv.SetAutoPublishResponse(true)
+	if got := len(psSrv.Messages()); got != 0 {
+		t.Fatalf("Failed expiry published %d messages, want 0", got)
+	}
+	if reqs := pending.Requests(); len(reqs) != 1 || reqs[0].MessageID != "message-id" {
+		t.Fatalf("Pending requests = %+v, want the request pending again", reqs)
+	}
+
+	// The next expiry check retries the error callback.
+	if err := srv.expireBefore(context.Background(), time.Now()); err != nil {
+		t.Fatalf("expireBefore() failed: %v", err)
+	}
+	if got := publishedErrorCodes(t, psSrv, "on_select"); len(got) != 1 || got[0] != "31001" {
+		t.Errorf("Published callback error codes = %q, want one 31001", got)
+	}
+	if got := pending.Requests(); len(got) != 0 {
+		t.Errorf("Pending requests = %+v, want none", got)
+	}
+}
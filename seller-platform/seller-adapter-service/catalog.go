@@ -0,0 +1,255 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/catalog"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/catalogclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+// pushTimeout limits pushing a catalog update to the buyer apps, which continues after the update is answered.
+const pushTimeout = time.Minute
+
+// validate validates the catalogs updated by the seller system.
+var validate = model.Validator()
+
+type catalogClient interface {
+	Ping(context.Context) error
+	UpdateCatalog(context.Context, model.Catalog) (time.Time, error)
+	DeleteProvider(ctx context.Context, providerID string) error
+	Catalog(ctx context.Context, since, until time.Time) (model.Catalog, error)
+	Subscribe(context.Context, catalogclient.Subscription) error
+	Unsubscribe(context.Context, catalogclient.SubscriptionKey) error
+	Subscriptions(context.Context) ([]catalogclient.Subscription, error)
+}
+
+func (s *server) updateCatalog(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var c model.Catalog
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.catalogMaxBodySize)).Decode(&c); err != nil {
+		slog.ErrorContext(ctx, "Decoding catalog failed", "error", err)
+		statusCode := http.StatusBadRequest
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			statusCode = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	if err := validateCatalog(c); err != nil {
+		slog.ErrorContext(ctx, "Catalog is invalid", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updateTime, err := s.catalog.UpdateCatalog(ctx, c)
+	if err != nil {
+		slog.ErrorContext(ctx, "Updating catalog failed", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(ctx, "Catalog is updated", "providers", len(c.BppProviders))
+	w.WriteHeader(http.StatusNoContent)
+
+	// The seller system is not failed on the push mode errors, as the catalog is stored.
+	// The push outlives the request, so it keeps only the values of the request context.
+	s.pushes.Add(1)
+	go func() {
+		defer s.pushes.Done()
+		ctx, cancel := context.WithTimeout(detachedContext{ctx}, pushTimeout)
+		defer cancel()
+		if err := s.pushCatalog(ctx, updateTime); err != nil {
+			slog.ErrorContext(ctx, "Pushing catalog failed", "error", err)
+		}
+	}()
+}
+
+// validateCatalog validates the catalog with its providers and their items, which the slices do not validate.
+func validateCatalog(c model.Catalog) error {
+	if err := validate.Struct(c); err != nil {
+		return err
+	}
+	for _, p := range c.BppProviders {
+		if p.ID == "" {
+			return errors.New("provider without ID")
+		}
+		if err := validate.Struct(p); err != nil {
+			return fmt.Errorf("provider %q: %v", p.ID, err)
+		}
+		for _, item := range p.Items {
+			if err := validate.Struct(item); err != nil {
+				return fmt.Errorf("provider %q: item %q: %v", p.ID, item.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// detachedContext carries the values of the context, such as the log fields and the trace, without its cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (s *server) deleteProvider(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	providerID, _ := strings.CutPrefix(r.URL.Path, "/catalog/providers/")
+	if providerID == "" || strings.Contains(providerID, "/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err := s.catalog.DeleteProvider(ctx, providerID)
+	if errors.Is(err, catalogclient.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Deleting provider failed", "provider_id", providerID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(ctx, "Provider is deleted", "provider_id", providerID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pushCatalog publishes the on_search with the providers updated at the time to the buyer apps in the push mode.
+func (s *server) pushCatalog(ctx context.Context, updateTime time.Time) error {
+	subs, err := s.catalog.Subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+
+	updated, err := s.catalog.Catalog(ctx, updateTime, updateTime)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, sub := range subs {
+		var req model.SearchRequest
+		if err := json.Unmarshal(sub.Request, &req); err != nil || req.Context == nil || req.Message == nil {
+			errs = append(errs, fmt.Errorf("subscription of %s: invalid search", sub.SubscriberID))
+			continue
+		}
+
+		c := catalog.Match(req.Message.Intent, updated)
+		if len(c.BppProviders) == 0 {
+			continue
+		}
+
+		// Every push is a new message of the transaction of the search.
+		msgContext := *req.Context
+		msgID := uuid.NewString()
+		msgContext.MessageID = &msgID
+		payload, err := onSearch(msgContext, c)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := s.publishCallback(ctx, "on_search", payload); err != nil {
+			errs = append(errs, fmt.Errorf("subscription of %s: %v", sub.SubscriberID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// searchCatalog answers the search from the catalog store in place of the seller system.
+//
+// The search either requests the catalog matching its intent, starts or stops pushing the catalog updates,
+// or requests the catalog updated in a time range.
+func (s *server) searchCatalog(ctx context.Context, data []byte) error {
+	var req model.SearchRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("unmarshal search: %v", err)
+	}
+	if req.Context == nil || req.Message == nil {
+		return errors.New("search without context or message")
+	}
+
+	refresh, err := catalog.ParseRefresh(req.Message.Intent, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var since, until time.Time
+	switch {
+	case refresh == nil:
+	case refresh.Mode == catalog.ModeStart:
+		slog.InfoContext(ctx, "Starting to push catalog updates")
+		return s.catalog.Subscribe(ctx, catalogclient.Subscription{SubscriptionKey: subscriptionKey(*req.Context), Request: data})
+	case refresh.Mode == catalog.ModeStop:
+		slog.InfoContext(ctx, "Stopping to push catalog updates")
+		return s.catalog.Unsubscribe(ctx, subscriptionKey(*req.Context))
+	default:
+		since, until = refresh.Start, refresh.End
+	}
+
+	c, err := s.catalog.Catalog(ctx, since, until)
+	if err != nil {
+		return err
+	}
+	c = catalog.Match(req.Message.Intent, c)
+	if len(c.BppProviders) == 0 {
+		slog.InfoContext(ctx, "No provider matches the search")
+		return nil
+	}
+
+	payload, err := onSearch(*req.Context, c)
+	if err != nil {
+		return err
+	}
+	return s.publishCallback(ctx, "on_search", payload)
+}
+
+// subscriptionKey returns the key of the push mode subscription of the search.
+func subscriptionKey(msgContext model.Context) catalogclient.SubscriptionKey {
+	return catalogclient.SubscriptionKey{
+		SubscriberID: *msgContext.BapID,
+		Domain:       msgContext.Domain.Value,
+		City:         *msgContext.City,
+	}
+}
+
+// onSearch returns the on_search payload of the catalog answering the search of the context.
+func onSearch(msgContext model.Context, c model.Catalog) ([]byte, error) {
+	now := time.Now().UTC()
+	msgContext.Action = "on_search"
+	msgContext.Timestamp = &now
+	return json.Marshal(model.OnSearchRequest{
+		Context: &msgContext,
+		Message: &model.OnSearchMessage{Catalog: &c},
+	})
+}
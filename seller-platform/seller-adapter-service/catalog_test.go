@@ -0,0 +1,304 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/google/go-cmp/cmp"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/catalogclienttest"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/keyclienttest"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/httpauth"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/pubsubtest"
+)
+
+const (
+	testCatalog = `{
+  "bpp/descriptor": {"name": "Seller App"},
+  "bpp/providers": [
+    {
+      "id": "grocery",
+      "descriptor": {"name": "Fresh Grocery"},
+      "items": [
+        {"id": "apple", "descriptor": {"name": "Red Apple"}, "category_id": "Fruits and Vegetables"},
+        {"id": "milk", "descriptor": {"name": "Milk"}, "category_id": "Dairy"}
+      ]
+    }
+  ]
+}`
+
+	testSearchContext = `{
+  "domain": "ONDC:RET10",
+  "country": "IND",
+  "city": "std:080",
+  "action": "search",
+  "core_version": "1.2.0",
+  "bap_id": "buyer.example.com",
+  "bap_uri": "https://buyer.example.com/ondc",
+  "transaction_id": "transaction-id",
+  "message_id": "message-id",
+  "timestamp": "2023-06-03T08:00:00Z"
+}`
+)
+
+// testSearch returns a search request of the intent.
+func testSearch(intent string) []byte {
+	return []byte(fmt.Sprintf(`{"context": %s, "message": {"intent": %s}}`, testSearchContext, intent))
+}
+
+// initCatalogServer initializes a server answering searches from the catalog stub.
+func initCatalogServer(t *testing.T, catalog *catalogclienttest.Stub) (*server, *pstest.Server) {
+	t.Helper()
+	const projectID = "test-project"
+	ctx := context.Background()
+	psSrv, opt := pubsubtest.InitServer(t, projectID, []pubsubtest.PubsubSetup{
+		{
+			TopicID:   "bpp-topic",
+			SubSetups: []pubsubtest.SubSetup{{SubID: "bpp-subscription"}},
+		},
+		{
+			TopicID: "callback-topic",
+		},
+	})
+	pubsubClient, err := pubsub.NewClient(ctx, projectID, opt)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	conf := config.SellerAdapterConfig{
+		ProjectID:       projectID,
+		SellerSystemURL: "http://seller-system.invalid",
+		CallbackTopicID: "callback-topic",
+		SubscriptionID:  []string{"bpp-subscription"},
+		Catalog:         &config.CatalogConfig{InstanceID: "instance", DatabaseID: "database"},
+	}
+	srv, err := initializeServer(ctx, http.DefaultClient, pubsubClient, catalog, nil, nil, conf)
+	if err != nil {
+		t.Fatalf("initializeServer failed: %v", err)
+	}
+	return srv, psSrv
+}
+
+func decodeCatalog(t *testing.T, catalog string) model.Catalog {
+	t.Helper()
+	var c model.Catalog
+	if err := json.Unmarshal([]byte(catalog), &c); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	return c
+}
+
+// publishedItems returns the item IDs of the published on_search callbacks by provider.
+func publishedItems(t *testing.T, psSrv *pstest.Server) map[string][]string {
+	t.Helper()
+	items := make(map[string][]string)
+	for _, m := range psSrv.Messages() {
+		if m.Attributes["action"] != "on_search" {
+			continue
+		}
+		var onSearch model.OnSearchRequest
+		if err := json.Unmarshal(m.Data, &onSearch); err != nil {
+			t.Fatalf("Unmarshal on_search failed: %v", err)
+		}
+		if got, want := onSearch.Context.Action, "on_search"; got != want {
+			t.Errorf("on_search action = %q, want %q", got, want)
+		}
+		if got, want := m.OrderingKey, "transaction-id"; got != want {
+			t.Errorf("on_search ordering key = %q, want %q", got, want)
+		}
+		for _, p := range onSearch.Message.Catalog.BppProviders {
+			for _, item := range p.Items {
+				items[p.ID] = append(items[p.ID], item.ID)
+			}
+		}
+	}
+	return items
+}
+
+func TestHandleSubscriptionSearchCatalog(t *testing.T) {
+	srv, psSrv := initCatalogServer(t, catalogclienttest.NewStub(decodeCatalog(t, testCatalog)))
+
+	mID := psSrv.Publish("projects/test-project/topics/bpp-topic", testSearch(`{"item": {"descriptor": {"name": "apple"}}}`), map[string]string{"action": "search"})
+
+	// 1 second should be more than enough to handle some messages before canceling the operation.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := srv.handleSubscription(ctx, srv.subs[0]); err != nil {
+		t.Errorf("handleSubscription() failed: %v", err)
+	}
+
+	if psSrv.Message(mID).Acks == 0 {
+		t.Errorf("Message %q: got no ack", mID)
+	}
+	want := map[string][]string{"grocery": {"apple"}}
+	if diff := cmp.Diff(want, publishedItems(t, psSrv)); diff != "" {
+		t.Errorf("on_search items diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestSearchCatalogPull(t *testing.T) {
+	ctx := context.Background()
+	catalog := catalogclienttest.NewStub(decodeCatalog(t, testCatalog))
+	srv, psSrv := initCatalogServer(t, catalog)
+
+	start := time.Now()
+	if _, err := catalog.UpdateCatalog(ctx, decodeCatalog(t, `{"bpp/providers": [{"id": "bakery", "items": [{"id": "bread"}]}]}`)); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	// Only the providers updated since the start time are returned.
+	search := testSearch(fmt.Sprintf(`{"tags": {"code": "catalog_inc", "list": [{"code": "start_time", "value": %q}]}}`, start.Format(time.RFC3339Nano)))
+	if err := srv.searchCatalog(ctx, search); err != nil {
+		t.Fatalf("searchCatalog() failed: %v", err)
+	}
+
+	want := map[string][]string{"bakery": {"bread"}}
+	if diff := cmp.Diff(want, publishedItems(t, psSrv)); diff != "" {
+		t.Errorf("on_search items diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestCatalogHandlerPush(t *testing.T) {
+	ctx := context.Background()
+	catalog := catalogclienttest.NewStub(model.Catalog{})
+	srv, psSrv := initCatalogServer(t, catalog)
+	handler := srv.apiHandler()
+
+	// The buyer app starts the push mode for dairy.
+	start := testSearch(`{"category": {"id": "Dairy"}, "tags": {"code": "catalog_inc", "list": [{"code": "mode", "value": "start"}]}}`)
+	if err := srv.searchCatalog(ctx, start); err != nil {
+		t.Fatalf("searchCatalog() failed: %v", err)
+	}
+	if got := len(psSrv.Messages()); got != 0 {
+		t.Errorf("Starting push mode published %d messages, want 0", got)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/catalog", strings.NewReader(testCatalog)))
+	if got, want := rec.Code, http.StatusNoContent; got != want {
+		t.Fatalf("PUT /catalog status = %d, want %d", got, want)
+	}
+	srv.pushes.Wait()
+
+	want := map[string][]string{"grocery": {"milk"}}
+	if diff := cmp.Diff(want, publishedItems(t, psSrv)); diff != "" {
+		t.Errorf("Pushed on_search items diff (-want +got):\n%s", diff)
+	}
+
+	// The buyer app stops the push mode.
+	stop := testSearch(`{"tags": {"code": "catalog_inc", "list": [{"code": "mode", "value": "stop"}]}}`)
+	if err := srv.searchCatalog(ctx, stop); err != nil {
+		t.Fatalf("searchCatalog() failed: %v", err)
+	}
+	subs, err := catalog.Subscriptions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 0 {
+		t.Errorf("Subscriptions() = %v, want none after stopping", subs)
+	}
+}
+
+func TestCatalogHandler(t *testing.T) {
+	ctx := context.Background()
+	catalog := catalogclienttest.NewStub(model.Catalog{})
+	srv, _ := initCatalogServer(t, catalog)
+	handler := srv.apiHandler()
+
+	tests := []struct {
+		method, path, body string
+		wantStatus         int
+	}{
+		{method: http.MethodPut, path: "/catalog", body: testCatalog, wantStatus: http.StatusNoContent},
+		{method: http.MethodPut, path: "/catalog", body: `{"bpp/providers": [{"items": []}]}`, wantStatus: http.StatusBadRequest},
+		{method: http.MethodPut, path: "/catalog", body: `not JSON`, wantStatus: http.StatusBadRequest},
+		{method: http.MethodPut, path: "/catalog", body: `{"bpp/providers": [{"id": "grocery", "items": [{"id": "milk", "price": {"value": "free"}}]}]}`, wantStatus: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/catalog", wantStatus: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, path: "/catalog/providers/grocery", wantStatus: http.StatusNoContent},
+		{method: http.MethodDelete, path: "/catalog/providers/grocery", wantStatus: http.StatusNotFound},
+		{method: http.MethodDelete, path: "/catalog/providers/", wantStatus: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(test.method, test.path, strings.NewReader(test.body)))
+		if rec.Code != test.wantStatus {
+			t.Errorf("%s %s status = %d, want %d", test.method, test.path, rec.Code, test.wantStatus)
+		}
+	}
+
+	c, err := catalog.Catalog(ctx, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.BppDescriptor == nil || len(c.BppProviders) != 0 {
+		t.Errorf("Catalog() = %+v, want the descriptor without providers", c)
+	}
+}
+
+func TestCatalogHandlerTooLarge(t *testing.T) {
+	srv, _ := initCatalogServer(t, catalogclienttest.NewStub(model.Catalog{}))
+	srv.catalogMaxBodySize = int64(len(testCatalog) - 1)
+
+	rec := httptest.NewRecorder()
+	srv.apiHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/catalog", strings.NewReader(testCatalog)))
+	if got, want := rec.Code, http.StatusRequestEntityTooLarge; got != want {
+		t.Errorf("PUT /catalog status = %d, want %d", got, want)
+	}
+}
+
+func TestCatalogHandlerInboundAuth(t *testing.T) {
+	ctx := context.Background()
+	keyClient := keyclienttest.NewStub(t)
+	keyClient.SetSecret("seller-token", []byte("token"))
+	inbound, err := httpauth.NewInbound(ctx, config.HTTPAuthConfig{Type: httpauth.TypeBearer, SecretID: "seller-token"}, keyClient)
+	if err != nil {
+		t.Fatalf("NewInbound() failed: %v", err)
+	}
+	srv, _ := initCatalogServer(t, catalogclienttest.NewStub(model.Catalog{}))
+	srv.inbound = inbound
+	handler := srv.apiHandler()
+
+	tests := []struct {
+		authorization string
+		wantStatus    int
+	}{
+		{authorization: "", wantStatus: http.StatusUnauthorized},
+		{authorization: "Bearer wrong", wantStatus: http.StatusUnauthorized},
+		{authorization: "Bearer token", wantStatus: http.StatusNoContent},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/catalog", strings.NewReader(testCatalog))
+		req.Header.Set("Authorization", test.authorization)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.wantStatus {
+			t.Errorf("PUT /catalog with authorization %q status = %d, want %d", test.authorization, rec.Code, test.wantStatus)
+		}
+	}
+}
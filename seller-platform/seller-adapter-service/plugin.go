@@ -0,0 +1,108 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Plugins of the seller systems.
+const (
+	// pluginONDC forwards the ONDC requests to the seller system as they are.
+	pluginONDC = "ondc"
+	// pluginREST translates the ONDC requests into the calls of a generic REST product and order API.
+	pluginREST = "rest"
+)
+
+// errAccepted is returned by the plugins when the seller system accepted the request and posts the callback later.
+var errAccepted = errors.New("accepted by seller system")
+
+// plugin translates the ONDC requests into the calls of a seller system and maps its responses back.
+type plugin interface {
+	// Send sends the request of the action to the seller system and returns the payload of its callback.
+	Send(ctx context.Context, action string, request []byte) ([]byte, error)
+}
+
+// plugins creates the plugin of the name for the seller system of the URL. Adding a seller system is adding its
+// plugin here and to the plugin config validation.
+var plugins = map[string]func(sellerSystemURL string, httpClient *http.Client) plugin{
+	pluginONDC: func(url string, httpClient *http.Client) plugin { return &ondcPlugin{url: url, httpClient: httpClient} },
+	pluginREST: func(url string, httpClient *http.Client) plugin { return &restPlugin{url: url, httpClient: httpClient} },
+}
+
+// newPlugin creates the plugin of the name, which is the ONDC plugin if empty.
+func newPlugin(name, sellerSystemURL string, httpClient *http.Client) (plugin, error) {
+	if name == "" {
+		name = pluginONDC
+	}
+	newFunc, ok := plugins[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown seller system plugin %q", name)
+	}
+	return newFunc(sellerSystemURL, httpClient), nil
+}
+
+// statusError is returned when the seller system responds with an unexpected status code.
+type statusError struct {
+	url        string
+	statusCode int
+	body       []byte
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s responded with status code %d", e.url, e.statusCode)
+}
+
+// ondcPlugin posts the ONDC requests to the seller system, which responds with the ONDC callbacks.
+//
+// The request of an action is posted to the seller system URL suffixed with the action. The seller system responds
+// with 200 OK and the callback, or with 202 Accepted if it posts the callback later.
+type ondcPlugin struct {
+	url        string
+	httpClient *http.Client
+}
+
+func (p *ondcPlugin) Send(ctx context.Context, action string, request []byte) ([]byte, error) {
+	url := p.url + "/" + action
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(request))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response body: %v", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusAccepted:
+		return nil, errAccepted
+	default:
+		return nil, &statusError{url: url, statusCode: resp.StatusCode, body: body}
+	}
+}
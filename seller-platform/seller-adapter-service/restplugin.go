@@ -0,0 +1,420 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+// orderStates maps the order statuses of the REST API to the ONDC order states.
+var orderStates = map[string]string{
+	"created":     "Created",
+	"accepted":    "Accepted",
+	"in_progress": "In-progress",
+	"completed":   "Completed",
+	"cancelled":   "Cancelled",
+}
+
+// restProduct is a product of the REST API.
+type restProduct struct {
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	Description  string  `json:"description,omitempty"`
+	Category     string  `json:"category,omitempty"`
+	ImageURL     string  `json:"image_url,omitempty"`
+	Price        float64 `json:"price"`
+	Currency     string  `json:"currency"`
+	Stock        *int32  `json:"stock,omitempty"`
+	ProviderID   string  `json:"provider_id"`
+	ProviderName string  `json:"provider_name,omitempty"`
+}
+
+// restLine is an order line of the REST API.
+type restLine struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name,omitempty"`
+	Quantity  int32   `json:"quantity"`
+	UnitPrice float64 `json:"unit_price,omitempty"`
+}
+
+// restCustomer is the customer of an order of the REST API.
+type restCustomer struct {
+	Name    string         `json:"name,omitempty"`
+	Phone   string         `json:"phone,omitempty"`
+	Email   string         `json:"email,omitempty"`
+	Address *model.Address `json:"address,omitempty"`
+}
+
+// restOrderRequest is the body of the quote and order creation calls of the REST API.
+type restOrderRequest struct {
+	// Reference is the ONDC transaction ID of the order.
+	Reference  string        `json:"reference"`
+	ProviderID string        `json:"provider_id"`
+	Items      []restLine    `json:"items"`
+	Customer   *restCustomer `json:"customer,omitempty"`
+}
+
+// restOrder is a quote or an order of the REST API. Quotes have no ID and status.
+type restOrder struct {
+	ID         string     `json:"id,omitempty"`
+	Status     string     `json:"status,omitempty"`
+	ProviderID string     `json:"provider_id"`
+	Items      []restLine `json:"items"`
+	Currency   string     `json:"currency"`
+	Total      float64    `json:"total"`
+	CreatedAt  time.Time  `json:"created_at,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at,omitempty"`
+}
+
+// ondcOrder is the order of the ONDC callbacks. It is declared here as the model order has unexported item types.
+type ondcOrder struct {
+	ID        string          `json:"id,omitempty"`
+	State     string          `json:"state,omitempty"`
+	Provider  ondcOrderEntity `json:"provider"`
+	Items     []ondcOrderItem `json:"items"`
+	Billing   *model.Billing  `json:"billing,omitempty"`
+	Quote     ondcQuote       `json:"quote"`
+	CreatedAt *time.Time      `json:"created_at,omitempty"`
+	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
+}
+
+type ondcOrderEntity struct {
+	ID string `json:"id"`
+}
+
+type ondcOrderItem struct {
+	ID       string        `json:"id"`
+	Quantity ondcItemCount `json:"quantity"`
+}
+
+type ondcItemCount struct {
+	Count int32 `json:"count"`
+}
+
+type ondcQuote struct {
+	Price   *model.Price           `json:"price"`
+	Breakup []ondcQuoteBreakupItem `json:"breakup"`
+}
+
+type ondcQuoteBreakupItem struct {
+	ItemID       string        `json:"@ondc/org/item_id"`
+	ItemQuantity ondcItemCount `json:"@ondc/org/item_quantity"`
+	TitleType    string        `json:"@ondc/org/title_type"`
+	Title        string        `json:"title"`
+	Price        *model.Price  `json:"price"`
+}
+
+// restPlugin translates the ONDC requests into the calls of a generic REST product and order API:
+//
+//	search: GET /products?query=&category=&provider_id= returns {"products": [product]}.
+//	select and init: POST /quotes with an order request returns a quote.
+//	confirm: POST /orders with an order request returns the created order.
+//	status: GET /orders/{id} returns the order.
+//	cancel: POST /orders/{id}/cancel with {"reason_id"} returns the cancelled order.
+//
+// The other actions are not supported.
+type restPlugin struct {
+	url        string
+	httpClient *http.Client
+}
+
+func (p *restPlugin) Send(ctx context.Context, action string, request []byte) ([]byte, error) {
+	switch action {
+	case "search":
+		return p.search(ctx, request)
+	case "select", "init":
+		return p.quote(ctx, action, request)
+	case "confirm":
+		return p.confirm(ctx, request)
+	case "status":
+		return p.status(ctx, request)
+	case "cancel":
+		return p.cancel(ctx, request)
+	default:
+		return nil, fmt.Errorf("action %q is not supported by the REST plugin", action)
+	}
+}
+
+// search answers the search with the products matching its intent.
+func (p *restPlugin) search(ctx context.Context, request []byte) ([]byte, error) {
+	var req model.SearchRequest
+	if err := unmarshalRequest(request, &req, func() bool { return req.Context != nil && req.Message != nil }); err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	if intent := req.Message.Intent; intent != nil {
+		switch {
+		case intent.Item != nil && intent.Item.Descriptor != nil && intent.Item.Descriptor.Name != "":
+			query.Set("query", intent.Item.Descriptor.Name)
+		case intent.Descriptor != nil && intent.Descriptor.Name != "":
+			query.Set("query", intent.Descriptor.Name)
+		}
+		if intent.Category != nil && intent.Category.ID != "" {
+			query.Set("category", intent.Category.ID)
+		}
+		if intent.Provider != nil && intent.Provider.ID != "" {
+			query.Set("provider_id", intent.Provider.ID)
+		}
+	}
+
+	var resp struct {
+		Products []restProduct `json:"products"`
+	}
+	if err := p.call(ctx, http.MethodGet, "/products?"+query.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return callback(*req.Context, "on_search", model.OnSearchMessage{Catalog: productCatalog(resp.Products)})
+}
+
+// quote answers the select or init with the quote of the selected items.
+func (p *restPlugin) quote(ctx context.Context, action string, request []byte) ([]byte, error) {
+	var req model.SelectRequest
+	if err := unmarshalRequest(request, &req, func() bool { return req.Context != nil && req.Message != nil && req.Message.Order != nil }); err != nil {
+		return nil, err
+	}
+
+	var quote restOrder
+	if err := p.call(ctx, http.MethodPost, "/quotes", orderRequest(*req.Context, req.Message.Order), &quote); err != nil {
+		return nil, err
+	}
+	order := ondcOrderOf(quote)
+	if action == "init" {
+		order.Billing = req.Message.Order.Billing
+	}
+	return callback(*req.Context, "on_"+action, map[string]ondcOrder{"order": order})
+}
+
+// confirm creates the order.
+func (p *restPlugin) confirm(ctx context.Context, request []byte) ([]byte, error) {
+	var req model.ConfirmRequest
+	if err := unmarshalRequest(request, &req, func() bool { return req.Context != nil && req.Message != nil && req.Message.Order != nil }); err != nil {
+		return nil, err
+	}
+
+	var created restOrder
+	if err := p.call(ctx, http.MethodPost, "/orders", orderRequest(*req.Context, req.Message.Order), &created); err != nil {
+		return nil, err
+	}
+	order := ondcOrderOf(created)
+	order.Billing = req.Message.Order.Billing
+	return callback(*req.Context, "on_confirm", map[string]ondcOrder{"order": order})
+}
+
+// status answers with the order of the ID.
+func (p *restPlugin) status(ctx context.Context, request []byte) ([]byte, error) {
+	var req model.StatusRequest
+	if err := unmarshalRequest(request, &req, func() bool {
+		return req.Context != nil && req.Message != nil && req.Message.OrderID != nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var order restOrder
+	if err := p.call(ctx, http.MethodGet, "/orders/"+url.PathEscape(*req.Message.OrderID), nil, &order); err != nil {
+		return nil, err
+	}
+	return callback(*req.Context, "on_status", map[string]ondcOrder{"order": ondcOrderOf(order)})
+}
+
+// cancel cancels the order of the ID.
+func (p *restPlugin) cancel(ctx context.Context, request []byte) ([]byte, error) {
+	var req model.CancelRequest
+	if err := unmarshalRequest(request, &req, func() bool {
+		return req.Context != nil && req.Message != nil && req.Message.OrderID != nil
+	}); err != nil {
+		return nil, err
+	}
+
+	body := map[string]string{"reason_id": req.Message.CancellationReasonID}
+	var order restOrder
+	if err := p.call(ctx, http.MethodPost, "/orders/"+url.PathEscape(*req.Message.OrderID)+"/cancel", body, &order); err != nil {
+		return nil, err
+	}
+	return callback(*req.Context, "on_cancel", map[string]ondcOrder{"order": ondcOrderOf(order)})
+}
+
+// call calls the REST API with the JSON body, if any, and decodes the JSON response into resp.
+func (p *restPlugin) call(ctx context.Context, method, path string, body, resp any) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request: %v", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	url := p.url + path
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return fmt.Errorf("create request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	response, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	respBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("read response body: %v", err)
+	}
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusCreated {
+		return &statusError{url: url, statusCode: response.StatusCode, body: respBody}
+	}
+	if err := json.Unmarshal(respBody, resp); err != nil {
+		return fmt.Errorf("unmarshal response of %s: %v", url, err)
+	}
+	return nil
+}
+
+// unmarshalRequest unmarshals the ONDC request into req, and checks it with valid.
+func unmarshalRequest(request []byte, req any, valid func() bool) error {
+	if err := json.Unmarshal(request, req); err != nil {
+		return fmt.Errorf("unmarshal request: %v", err)
+	}
+	if !valid() {
+		return errors.New("request without required fields")
+	}
+	return nil
+}
+
+// callback returns the callback payload of the action with the message, answering the request of the context.
+func callback(msgContext model.Context, action string, message any) ([]byte, error) {
+	now := time.Now().UTC()
+	msgContext.Action = action
+	msgContext.Timestamp = &now
+	return json.Marshal(struct {
+		Context *model.Context `json:"context"`
+		Message any            `json:"message"`
+	}{
+		Context: &msgContext,
+		Message: message,
+	})
+}
+
+// productCatalog returns the catalog of the products in stock, grouped by their providers in order.
+func productCatalog(products []restProduct) *model.Catalog {
+	c := &model.Catalog{}
+	providers := make(map[string]int)
+	for _, product := range products {
+		if product.Stock != nil && *product.Stock <= 0 {
+			continue
+		}
+		i, ok := providers[product.ProviderID]
+		if !ok {
+			i = len(c.BppProviders)
+			providers[product.ProviderID] = i
+			c.BppProviders = append(c.BppProviders, model.Provider{
+				ID:         product.ProviderID,
+				Descriptor: &model.Descriptor{Name: product.ProviderName},
+			})
+		}
+		item := model.Item{
+			ID: product.ID,
+			Descriptor: &model.Descriptor{
+				Name:      product.Name,
+				ShortDesc: product.Description,
+			},
+			Price:      price(product.Currency, product.Price),
+			CategoryID: product.Category,
+		}
+		if product.ImageURL != "" {
+			item.Descriptor.Images = []model.Image{{Value: product.ImageURL}}
+		}
+		c.BppProviders[i].Items = append(c.BppProviders[i].Items, item)
+	}
+	return c
+}
+
+// orderRequest returns the REST order request of the ONDC order in the transaction of the context.
+func orderRequest(msgContext model.Context, order *model.Order) restOrderRequest {
+	req := restOrderRequest{Items: make([]restLine, 0, len(order.Items))}
+	if msgContext.TransactionID != nil {
+		req.Reference = *msgContext.TransactionID
+	}
+	if order.Provider != nil {
+		req.ProviderID = order.Provider.ID
+	}
+	for _, item := range order.Items {
+		line := restLine{ID: item.ID, Quantity: 1}
+		if item.Quantity != nil && item.Quantity.Count > 0 {
+			line.Quantity = item.Quantity.Count
+		}
+		req.Items = append(req.Items, line)
+	}
+	if b := order.Billing; b != nil {
+		req.Customer = &restCustomer{Name: b.Name, Phone: b.Phone, Email: b.Email, Address: b.Address}
+	}
+	return req
+}
+
+// ondcOrderOf returns the ONDC order of the REST quote or order.
+func ondcOrderOf(o restOrder) ondcOrder {
+	order := ondcOrder{
+		ID:       o.ID,
+		State:    o.Status,
+		Provider: ondcOrderEntity{ID: o.ProviderID},
+		Items:    make([]ondcOrderItem, 0, len(o.Items)),
+		Quote: ondcQuote{
+			Price:   price(o.Currency, o.Total),
+			Breakup: make([]ondcQuoteBreakupItem, 0, len(o.Items)),
+		},
+	}
+	if state, ok := orderStates[o.Status]; ok {
+		order.State = state
+	}
+	if !o.CreatedAt.IsZero() {
+		order.CreatedAt = &o.CreatedAt
+	}
+	if !o.UpdatedAt.IsZero() {
+		order.UpdatedAt = &o.UpdatedAt
+	}
+	for _, line := range o.Items {
+		order.Items = append(order.Items, ondcOrderItem{ID: line.ID, Quantity: ondcItemCount{Count: line.Quantity}})
+		order.Quote.Breakup = append(order.Quote.Breakup, ondcQuoteBreakupItem{
+			ItemID:       line.ID,
+			ItemQuantity: ondcItemCount{Count: line.Quantity},
+			TitleType:    "item",
+			Title:        line.Name,
+			Price:        price(o.Currency, line.UnitPrice*float64(line.Quantity)),
+		})
+	}
+	return order
+}
+
+// price returns the ONDC price of the value in the currency.
+func price(currency string, value float64) *model.Price {
+	return &model.Price{
+		Currency: currency,
+		Value:    &model.DecimalValue{Value: strconv.FormatFloat(value, 'f', 2, 64)},
+	}
+}
@@ -0,0 +1,340 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/catalogclienttest"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+// restStub is an in-memory REST product and order API.
+type restStub struct {
+	mu       sync.Mutex
+	products []restProduct
+	orders   map[string]restOrder
+	// queries are the queries of the product searches.
+	queries []string
+}
+
+func newRESTStub(t *testing.T) (*restStub, *httptest.Server) {
+	t.Helper()
+	outOfStock := int32(0)
+	stub := &restStub{
+		products: []restProduct{
+			{ID: "apple", Name: "Red Apple", Category: "Fruits and Vegetables", Price: 120, Currency: "INR", ProviderID: "grocery", ProviderName: "Fresh Grocery"},
+			{ID: "milk", Name: "Milk", Category: "Dairy", Price: 30.5, Currency: "INR", ProviderID: "grocery", ProviderName: "Fresh Grocery"},
+			{ID: "cheese", Name: "Cheese", Category: "Dairy", Price: 250, Currency: "INR", Stock: &outOfStock, ProviderID: "grocery", ProviderName: "Fresh Grocery"},
+			{ID: "bread", Name: "Bread", Category: "Bakery", Price: 45, Currency: "INR", ProviderID: "bakery", ProviderName: "Corner Bakery"},
+		},
+		orders: make(map[string]restOrder),
+	}
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+	return stub, srv
+}
+
+func (s *restStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/products":
+		s.queries = append(s.queries, r.URL.RawQuery)
+		writeJSON(w, http.StatusOK, map[string][]restProduct{"products": s.products})
+	case r.Method == http.MethodPost && (r.URL.Path == "/quotes" || r.URL.Path == "/orders"):
+		var req restOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		order := s.quote(req)
+		if r.URL.Path == "/quotes" {
+			writeJSON(w, http.StatusOK, order)
+			return
+		}
+		order.ID = fmt.Sprintf("order-%d", len(s.orders)+1)
+		order.Status = "created"
+		s.orders[order.ID] = order
+		writeJSON(w, http.StatusCreated, order)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/orders/"):
+		order, ok := s.orders[strings.TrimPrefix(r.URL.Path, "/orders/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, order)
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/orders/") && strings.HasSuffix(r.URL.Path, "/cancel"):
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/orders/"), "/cancel")
+		order, ok := s.orders[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		order.Status = "cancelled"
+		s.orders[id] = order
+		writeJSON(w, http.StatusOK, order)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// quote returns the quote of the order request priced from the products.
+func (s *restStub) quote(req restOrderRequest) restOrder {
+	order := restOrder{ProviderID: req.ProviderID, Currency: "INR"}
+	for _, line := range req.Items {
+		for _, p := range s.products {
+			if p.ID == line.ID {
+				line.Name, line.UnitPrice = p.Name, p.Price
+			}
+		}
+		order.Items = append(order.Items, line)
+		order.Total += line.UnitPrice * float64(line.Quantity)
+	}
+	return order
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
+
+// testRequest returns a request of the action with the message and the context of the test search.
+func testRequest(action, message string) []byte {
+	msgContext := strings.Replace(testSearchContext, `"action": "search"`, fmt.Sprintf(`"action": %q`, action), 1)
+	return []byte(fmt.Sprintf(`{"context": %s, "message": %s}`, msgContext, message))
+}
+
+// testCallback is the part of the callbacks checked by the tests.
+type testCallback struct {
+	Context struct {
+		Action        string `json:"action"`
+		TransactionID string `json:"transaction_id"`
+		MessageID     string `json:"message_id"`
+	} `json:"context"`
+	Message struct {
+		Catalog *model.Catalog `json:"catalog"`
+		Order   *struct {
+			ID       string `json:"id"`
+			State    string `json:"state"`
+			Provider struct {
+				ID string `json:"id"`
+			} `json:"provider"`
+			Items []struct {
+				ID       string `json:"id"`
+				Quantity struct {
+					Count int32 `json:"count"`
+				} `json:"quantity"`
+			} `json:"items"`
+			Billing *model.Billing `json:"billing"`
+			Quote   struct {
+				Price struct {
+					Currency string `json:"currency"`
+					Value    string `json:"value"`
+				} `json:"price"`
+				Breakup []struct {
+					ItemID string `json:"@ondc/org/item_id"`
+					Title  string `json:"title"`
+				} `json:"breakup"`
+			} `json:"quote"`
+		} `json:"order"`
+	} `json:"message"`
+}
+
+func decodeCallback(t *testing.T, payload []byte) testCallback {
+	t.Helper()
+	var callback testCallback
+	if err := json.Unmarshal(payload, &callback); err != nil {
+		t.Fatalf("Unmarshal callback failed: %v", err)
+	}
+	return callback
+}
+
+func TestRESTPluginSearch(t *testing.T) {
+	stub, srv := newRESTStub(t)
+	p, err := newPlugin(pluginREST, srv.URL, srv.Client())
+	if err != nil {
+		t.Fatalf("newPlugin() failed: %v", err)
+	}
+
+	payload, err := p.Send(context.Background(), "search", testSearch(`{"item": {"descriptor": {"name": "milk"}}, "category": {"id": "Dairy"}}`))
+	if err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+
+	if got, want := stub.queries, []string{"category=Dairy&query=milk"}; !cmp.Equal(got, want) {
+		t.Errorf("Product queries = %q, want %q", got, want)
+	}
+	callback := decodeCallback(t, payload)
+	if got, want := callback.Context.Action, "on_search"; got != want {
+		t.Errorf("Callback action = %q, want %q", got, want)
+	}
+	if got, want := callback.Context.MessageID, "message-id"; got != want {
+		t.Errorf("Callback message ID = %q, want %q", got, want)
+	}
+	if callback.Message.Catalog == nil {
+		t.Fatal("on_search without catalog")
+	}
+	got := make(map[string][]string)
+	for _, provider := range callback.Message.Catalog.BppProviders {
+		for _, item := range provider.Items {
+			got[provider.ID] = append(got[provider.ID], item.ID+" "+item.Price.Value.Value)
+		}
+	}
+	// The out of stock cheese is not listed.
+	want := map[string][]string{
+		"grocery": {"apple 120.00", "milk 30.50"},
+		"bakery":  {"bread 45.00"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("on_search items diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRESTPluginOrder(t *testing.T) {
+	ctx := context.Background()
+	_, srv := newRESTStub(t)
+	p, err := newPlugin(pluginREST, srv.URL, srv.Client())
+	if err != nil {
+		t.Fatalf("newPlugin() failed: %v", err)
+	}
+	const order = `{"order": {"provider": {"id": "grocery"}, "items": [{"id": "apple", "quantity": {"count": 2}}, {"id": "milk"}],
+	  "billing": {"name": "Buyer", "phone": "9999999999"}}}`
+
+	tests := []struct {
+		action, message      string
+		wantID, wantState    string
+		wantTotal            string
+		wantBilling          bool
+		wantBreakupItemNames []string
+	}{
+		{action: "select", message: order, wantTotal: "270.50", wantBreakupItemNames: []string{"Red Apple", "Milk"}},
+		{action: "init", message: order, wantTotal: "270.50", wantBilling: true, wantBreakupItemNames: []string{"Red Apple", "Milk"}},
+		{action: "confirm", message: order, wantID: "order-1", wantState: "Created", wantTotal: "270.50", wantBilling: true, wantBreakupItemNames: []string{"Red Apple", "Milk"}},
+		{action: "status", message: `{"order_id": "order-1"}`, wantID: "order-1", wantState: "Created", wantTotal: "270.50", wantBreakupItemNames: []string{"Red Apple", "Milk"}},
+		{action: "cancel", message: `{"order_id": "order-1", "cancellation_reason_id": "001"}`, wantID: "order-1", wantState: "Cancelled", wantTotal: "270.50", wantBreakupItemNames: []string{"Red Apple", "Milk"}},
+	}
+	for _, test := range tests {
+		payload, err := p.Send(ctx, test.action, testRequest(test.action, test.message))
+		if err != nil {
+			t.Fatalf("Send(%q) failed: %v", test.action, err)
+		}
+
+		callback := decodeCallback(t, payload)
+		if got, want := callback.Context.Action, "on_"+test.action; got != want {
+			t.Errorf("%s: callback action = %q, want %q", test.action, got, want)
+		}
+		o := callback.Message.Order
+		if o == nil {
+			t.Fatalf("%s: callback without order", test.action)
+		}
+		if o.ID != test.wantID || o.State != test.wantState {
+			t.Errorf("%s: order ID and state = %q %q, want %q %q", test.action, o.ID, o.State, test.wantID, test.wantState)
+		}
+		if o.Provider.ID != "grocery" || len(o.Items) != 2 || o.Items[0].Quantity.Count != 2 || o.Items[1].Quantity.Count != 1 {
+			t.Errorf("%s: order provider and items = %+v %+v, want grocery with 2 apples and 1 milk", test.action, o.Provider, o.Items)
+		}
+		if got := o.Quote.Price; got.Value != test.wantTotal || got.Currency != "INR" {
+			t.Errorf("%s: quote price = %+v, want %s INR", test.action, got, test.wantTotal)
+		}
+		var names []string
+		for _, b := range o.Quote.Breakup {
+			names = append(names, b.Title)
+		}
+		if !cmp.Equal(names, test.wantBreakupItemNames) {
+			t.Errorf("%s: quote breakup titles = %q, want %q", test.action, names, test.wantBreakupItemNames)
+		}
+		if gotBilling := o.Billing != nil; gotBilling != test.wantBilling {
+			t.Errorf("%s: order has billing = %t, want %t", test.action, gotBilling, test.wantBilling)
+		}
+	}
+}
+
+func TestRESTPluginFail(t *testing.T) {
+	ctx := context.Background()
+	_, srv := newRESTStub(t)
+	p, err := newPlugin(pluginREST, srv.URL, srv.Client())
+	if err != nil {
+		t.Fatalf("newPlugin() failed: %v", err)
+	}
+
+	tests := []struct {
+		name, action string
+		request      []byte
+	}{
+		{name: "unsupported action", action: "track", request: testRequest("track", `{"order_id": "order-1"}`)},
+		{name: "unknown order", action: "status", request: testRequest("status", `{"order_id": "unknown"}`)},
+		{name: "no order ID", action: "status", request: testRequest("status", `{}`)},
+		{name: "not JSON", action: "search", request: []byte("not JSON")},
+	}
+	for _, test := range tests {
+		if _, err := p.Send(ctx, test.action, test.request); err == nil {
+			t.Errorf("%s: Send(%q) succeeded unexpectedly", test.name, test.action)
+		}
+	}
+
+	var statusErr *statusError
+	_, err = p.Send(ctx, "status", testRequest("status", `{"order_id": "unknown"}`))
+	if !errors.As(err, &statusErr) || statusErr.statusCode != http.StatusNotFound {
+		t.Errorf("Send() of unknown order error = %v, want status code 404", err)
+	}
+}
+
+func TestSendToSellerSystemREST(t *testing.T) {
+	_, restSrv := newRESTStub(t)
+	p, err := newPlugin(pluginREST, restSrv.URL, restSrv.Client())
+	if err != nil {
+		t.Fatalf("newPlugin() failed: %v", err)
+	}
+	srv, psSrv := initCatalogServer(t, catalogclienttest.NewStub(model.Catalog{}))
+	srv.plugin = p
+
+	request := testRequest("confirm", `{"order": {"provider": {"id": "bakery"}, "items": [{"id": "bread", "quantity": {"count": 1}}]}}`)
+	if !srv.sendToSellerSystem(context.Background(), "confirm", request) {
+		t.Fatal("sendToSellerSystem() = false, want true")
+	}
+
+	msgs := psSrv.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("Published %d messages, want 1", len(msgs))
+	}
+	if got, want := msgs[0].Attributes["action"], "on_confirm"; got != want {
+		t.Errorf("Published action = %q, want %q", got, want)
+	}
+	if got, want := msgs[0].OrderingKey, "transaction-id"; got != want {
+		t.Errorf("Published ordering key = %q, want %q", got, want)
+	}
+	if o := decodeCallback(t, msgs[0].Data).Message.Order; o == nil || o.ID != "order-1" {
+		t.Errorf("Published order = %+v, want order-1", o)
+	}
+}
+
+func TestNewPluginUnknown(t *testing.T) {
+	if _, err := newPlugin("erp", "http://seller-system.invalid", http.DefaultClient); err == nil {
+		t.Error("newPlugin() of unknown plugin succeeded unexpectedly")
+	}
+}
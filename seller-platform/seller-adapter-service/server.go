@@ -16,69 +16,173 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"flag"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"cloud.google.com/go/pubsub"
-	log "github.com/golang/glog"
+	"golang.org/x/exp/slog"
 	"golang.org/x/sync/errgroup"
 
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/claimcheck"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/catalogclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/keyclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/pendingclient"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/health"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/httpauth"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/logging"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/metrics"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/middleware"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/ordering"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/tracing"
 )
 
+// defaultAPIPort is the port serving the catalog and callback APIs if the config has none.
+const defaultAPIPort = 8080
+
 type server struct {
 	pubsubClient *pubsub.Client
-	httpClient   *http.Client
 	config       config.SellerAdapterConfig
+	// plugin sends the requests to the seller system.
+	plugin plugin
 
 	subs          []*pubsub.Subscription
 	callbackTopic *pubsub.Topic
+	claimCheck    *claimcheck.ClaimCheck
+
+	// catalog answers the searches in place of the seller system if set.
+	catalog            catalogClient
+	catalogMaxBodySize int64
+	// pushes tracks the catalog updates being pushed to the buyer apps.
+	pushes sync.WaitGroup
+	// pending stores the requests accepted asynchronously by the seller system if set.
+	pending        pendingClient
+	asyncTTL       time.Duration
+	expiryInterval time.Duration
+	// inbound authenticates the calls from the seller system if set.
+	inbound *httpauth.Inbound
+
+	health          *health.Checker
+	shutdownTimeout time.Duration
 }
 
 func main() {
-	flag.Set("alsologtostderr", "true")
+	logging.Init()
 	ctx := context.Background()
 
 	configPath, ok := os.LookupEnv("CONFIG")
 	if !ok {
-		log.Exit("CONFIG env is not set")
+		logging.Exit("CONFIG env is not set")
 	}
 
 	conf, err := config.Read[config.SellerAdapterConfig](configPath)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Read config failed", "error", err)
 	}
 
+	shutdownTracing, err := tracing.Init(ctx, "seller-adapter-service")
+	if err != nil {
+		logging.Exit("Init tracing failed", "error", err)
+	}
+	defer shutdownTracing(ctx)
+
 	pubsubClient, err := pubsub.NewClient(ctx, conf.ProjectID)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Create Pub/Sub client failed", "error", err)
 	}
 
-	srv, err := initializeServer(ctx, http.DefaultClient, pubsubClient, conf)
+	var catalog catalogClient
+	if conf.Catalog != nil {
+		catalogClient, err := catalogclient.New(ctx, conf.ProjectID, conf.Catalog.InstanceID, conf.Catalog.DatabaseID)
+		if err != nil {
+			logging.Exit("Create catalog client failed", "error", err)
+		}
+		defer catalogClient.Close()
+		catalog = catalogClient
+	}
+
+	var pending pendingClient
+	if conf.Async != nil {
+		pendingClient, err := pendingclient.New(ctx, conf.ProjectID, conf.Async.InstanceID, conf.Async.DatabaseID)
+		if err != nil {
+			logging.Exit("Create pending request client failed", "error", err)
+		}
+		defer pendingClient.Close()
+		pending = pendingClient
+	}
+
+	var secrets httpauth.SecretReader
+	if conf.SellerSystemAuth.Outbound.Type != "" || conf.SellerSystemAuth.Inbound.Type != "" {
+		// The credentials of the seller system are read by their secret IDs.
+		keyClient, err := keyclient.New(ctx, conf.ProjectID, "")
+		if err != nil {
+			logging.Exit("Create key client failed", "error", err)
+		}
+		defer keyClient.Close()
+		secrets = keyClient
+	}
+
+	transport, err := httpauth.Transport(ctx, conf.SellerSystemAuth.Outbound, secrets)
+	if err != nil {
+		logging.Exit("Create seller system authentication failed", "error", err)
+	}
+	httpClient := tracing.InstrumentClient(metrics.InstrumentClient(&http.Client{Transport: transport}))
+
+	inbound, err := httpauth.NewInbound(ctx, conf.SellerSystemAuth.Inbound, secrets)
+	if err != nil {
+		logging.Exit("Create seller system authentication failed", "error", err)
+	}
+
+	srv, err := initializeServer(ctx, httpClient, pubsubClient, catalog, pending, inbound, conf)
 	if err != nil {
-		log.Exit(err)
+		logging.Exit("Init server failed", "error", err)
 	}
 	defer srv.close()
-	log.Info("Server initialization successs")
+	slog.Info("Server initialization successs")
+
+	// Kubernetes sends SIGTERM for stopping the pod.
+	serveCtx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	if err := srv.serve(ctx); err != nil {
-		log.Exitf("Serving failed: %v", err)
+	health.ServeInBackground(serveCtx, conf.MetricsPort, srv.health)
+
+	if err := srv.serve(serveCtx); err != nil {
+		logging.Exit("Serving failed", "error", err)
 	}
+	slog.Info("Server is closed")
 }
 
-func initializeServer(ctx context.Context, httpClient *http.Client, pubsubClient *pubsub.Client, conf config.SellerAdapterConfig) (*server, error) {
+func initializeServer(ctx context.Context, httpClient *http.Client, pubsubClient *pubsub.Client, catalog catalogClient, pending pendingClient, inbound *httpauth.Inbound, conf config.SellerAdapterConfig) (*server, error) {
 	// validate the HTTP client.
 	if httpClient == nil {
 		return nil, fmt.Errorf("HTTP client is nil")
 	}
+	if conf.Catalog != nil && catalog == nil {
+		return nil, fmt.Errorf("catalog client is nil")
+	}
+	if conf.Async != nil && pending == nil {
+		return nil, fmt.Errorf("pending request client is nil")
+	}
+	plugin, err := newPlugin(conf.SellerSystemPlugin, conf.SellerSystemURL, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := plugin.(*ondcPlugin); conf.Async != nil && !ok {
+		return nil, fmt.Errorf("async requires the %q seller system plugin", pluginONDC)
+	}
+	if conf.SellerSystemAuth.Inbound.Type != "" && inbound == nil {
+		return nil, fmt.Errorf("inbound authentication is nil")
+	}
 
 	// validate the callback topic
-	callbackTopic := pubsubClient.Topic(conf.CallbackTopicID)
+	callbackTopic := ordering.Topic(pubsubClient, conf.CallbackTopicID)
 	ok, err := callbackTopic.Exists(ctx)
 	if err != nil {
 		return nil, err
@@ -103,12 +207,60 @@ func initializeServer(ctx context.Context, httpClient *http.Client, pubsubClient
 		subs = append(subs, sub)
 	}
 
+	shutdownTimeout, err := health.ParseShutdownTimeout(conf.ShutdownTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	claimCheck, err := claimcheck.Open(ctx, conf.ClaimCheck.StoreURL, conf.ClaimCheck.Threshold)
+	if err != nil {
+		return nil, fmt.Errorf("init server: %v", err)
+	}
+	var asyncTTL, expiryInterval time.Duration
+	if conf.Async != nil {
+		if asyncTTL, err = parseDuration(conf.Async.TTL, defaultAsyncTTL); err != nil {
+			return nil, fmt.Errorf("init server: parse async TTL: %v", err)
+		}
+		if expiryInterval, err = parseDuration(conf.Async.ExpiryInterval, defaultExpiryInterval); err != nil {
+			return nil, fmt.Errorf("init server: parse async expiry interval: %v", err)
+		}
+		if asyncTTL <= 0 || expiryInterval <= 0 {
+			return nil, fmt.Errorf("init server: async TTL and expiry interval must be positive")
+		}
+	}
+	checks := make([]health.Check, 0, len(subs)+2)
+	for _, sub := range subs {
+		checks = append(checks, health.SubscriptionCheck(sub))
+	}
+	checks = append(checks, health.TopicCheck(callbackTopic))
+	if catalog != nil {
+		checks = append(checks, health.Check{Name: "spanner", Check: catalog.Ping})
+	}
+	catalogMaxBodySize := int64(middleware.DefaultMaxBodySize)
+	if conf.Catalog != nil && conf.Catalog.MaxBodySize > 0 {
+		catalogMaxBodySize = conf.Catalog.MaxBodySize
+	}
+	if pending != nil {
+		checks = append(checks, health.Check{Name: "pending-requests", Check: pending.Ping})
+	}
+
 	server := &server{
 		pubsubClient:  pubsubClient,
-		httpClient:    httpClient,
+		plugin:        plugin,
 		config:        conf,
 		subs:          subs,
 		callbackTopic: callbackTopic,
+		claimCheck:    claimCheck,
+		catalog:       catalog,
+		inbound:       inbound,
+
+		catalogMaxBodySize: catalogMaxBodySize,
+
+		pending:        pending,
+		asyncTTL:       asyncTTL,
+		expiryInterval: expiryInterval,
+
+		health:          health.NewChecker(checks...),
+		shutdownTimeout: shutdownTimeout,
 	}
 	return server, nil
 }
@@ -116,6 +268,7 @@ func initializeServer(ctx context.Context, httpClient *http.Client, pubsubClient
 // close closed underlying connections.
 func (s *server) close() {
 	s.pubsubClient.Close()
+	s.claimCheck.Close()
 }
 
 // serve handles multiple Pub/Sub subscriptions in parallel.
@@ -131,60 +284,194 @@ func (s *server) serve(ctx context.Context) error {
 		})
 	}
 
-	log.Info("Ready to receive messages")
+	if s.catalog != nil || s.pending != nil {
+		g.Go(func() error {
+			return s.serveAPI(ctx)
+		})
+	}
+	if s.pending != nil {
+		g.Go(func() error {
+			return s.expirePendingRequests(ctx)
+		})
+	}
+
+	slog.Info("Ready to receive messages")
 	return g.Wait()
 }
 
+// serveAPI serves the catalog and callback APIs for the seller system until ctx is done.
+func (s *server) serveAPI(ctx context.Context) error {
+	port := s.config.APIPort
+	if port == 0 {
+		port = defaultAPIPort
+	}
+	slog.Info("API is serving", "port", port)
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: s.apiHandler()}
+	if s.inbound != nil {
+		srv.TLSConfig = s.inbound.TLSConfig()
+	}
+	err := health.ListenAndServe(ctx, srv, s.health, s.shutdownTimeout)
+	s.pushes.Wait()
+	return err
+}
+
+// apiHandler returns the handler of the APIs for the seller system.
+//
+//	PUT /catalog stores the providers of the catalog in the body and pushes them to the subscribed buyer apps.
+//	DELETE /catalog/providers/{id} deletes the provider from the catalog.
+//	POST /callbacks/{message_id} publishes the callback of the request accepted asynchronously.
+//
+// The catalog routes are registered if the catalog is set, and the callback route if the async is set.
+// The calls are authenticated as the calls from the seller system if the inbound authentication is set.
+func (s *server) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	if s.catalog != nil {
+		mux.HandleFunc("/catalog", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPut {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			s.updateCatalog(w, r)
+		})
+		mux.HandleFunc("/catalog/providers/", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodDelete {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			s.deleteProvider(w, r)
+		})
+	}
+	if s.pending != nil {
+		mux.HandleFunc("/callbacks/", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			s.receiveCallback(w, r)
+		})
+	}
+	if s.inbound == nil {
+		return mux
+	}
+	return s.inbound.Adapter()(mux)
+}
+
 // handleSubscription receives and handles messages from the Pub/Sub subscription.
 func (s *server) handleSubscription(ctx context.Context, sub *pubsub.Subscription) error {
 	err := sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		// The context is canceled as soon as the shutdown starts, but the in-flight message can be finished.
+		ctx, cancel := health.DelayCancel(ctx, s.shutdownTimeout)
+		defer cancel()
+		ctx, span := tracing.StartPubSubSpan(ctx, sub.ID(), msg)
+		defer span.End()
+		ctx = logging.With(ctx, slog.String(logging.PubSubMessageIDKey, msg.ID), slog.String(logging.ActionKey, msg.Attributes["action"]))
+		start := time.Now()
+		action, outcome := msg.Attributes["action"], metrics.OutcomeFailure
 		defer func() {
 			// Ack the msg irrespective of whether the message was successfully processed or not
 			// since we do not want the msg to be retried.
 			msg.Ack()
-			log.Infof("Handling of message %q ends", msg.ID)
+			metrics.ObservePubSubMessage(sub.ID(), action, outcome, time.Since(start))
+			slog.InfoContext(ctx, "Handling of message ends")
 		}()
 
-		log.Infof("Receiving a message from %q, message ID: %q", sub.ID(), msg.ID)
-		action, ok := msg.Attributes["action"]
+		slog.InfoContext(ctx, "Receiving a message", "subscription", sub.ID())
+		_, ok := msg.Attributes["action"]
 		if !ok {
-			log.Error(`"action" attribute is not present in the message`)
+			slog.ErrorContext(ctx, `"action" attribute is not present in the message`)
 			return
 		}
 
-		sellerEndpoint := s.config.SellerSystemURL + "/" + action
-		response, err := s.httpClient.Post(sellerEndpoint, "application/json", bytes.NewReader(msg.Data))
+		// Large payloads are offloaded to the claim check store by the publisher.
+		data, err := s.claimCheck.Data(ctx, msg)
 		if err != nil {
-			log.Errorf("Sending request to %s failed: %v", sellerEndpoint, err)
+			slog.ErrorContext(ctx, "Resolving payload failed", "error", err)
 			return
 		}
-		defer response.Body.Close()
 
-		responseBody, err := io.ReadAll(response.Body)
-		if err != nil {
-			log.Errorf("Reading response body failed: %v", err)
+		tracing.SetPayloadAttributes(ctx, data)
+		ctx = logging.WithPayloadContext(ctx, data)
+		if action == "search" && s.catalog != nil {
+			if err := s.searchCatalog(ctx, data); err != nil {
+				slog.ErrorContext(ctx, "Searching catalog failed", "error", err)
+				return
+			}
+		} else if !s.sendToSellerSystem(ctx, action, data) {
 			return
 		}
 
-		if response.StatusCode != http.StatusOK {
-			log.Infof("Sending request to %s got an error: status code %d, body %s", sellerEndpoint, response.StatusCode, responseBody)
-			return
+		if err := s.claimCheck.Release(ctx, msg); err != nil {
+			slog.WarnContext(ctx, "Releasing payload failed", "error", err)
 		}
 
-		publishResult := s.callbackTopic.Publish(ctx, &pubsub.Message{
-			Attributes: map[string]string{
-				"action": fmt.Sprintf("on_%s", action),
-			},
-			Data: responseBody,
-		})
-		if _, err := publishResult.Get(ctx); err != nil {
-			log.Errorf("Publishing message failed: %v", err)
-			return
-		}
-
-		log.Info("Handle the message successfully")
+		slog.InfoContext(ctx, "Handle the message successfully")
+		outcome = metrics.OutcomeSuccess
 		msg.Ack()
 	})
 
 	return err
 }
+
+// sendToSellerSystem sends the request to the seller system with the plugin and publishes its response as the callback.
+//
+// If the async is set and the seller system responds with 202 Accepted, the request is pending until the seller system
+// posts the callback to the callback API, or until it expires.
+//
+// It reports whether the callback is published or pending. The failures are logged.
+func (s *server) sendToSellerSystem(ctx context.Context, action string, data []byte) bool {
+	accepted := false
+	if s.pending != nil {
+		// The request is pending before it is sent, as the seller system may post the callback before responding.
+		pending, err := s.addPending(ctx, action, data)
+		if err != nil {
+			slog.ErrorContext(ctx, "Storing pending request failed", "error", err)
+			return false
+		}
+		defer func() {
+			if !accepted {
+				s.removePending(ctx, pending)
+			}
+		}()
+	}
+
+	payload, err := s.plugin.Send(ctx, action, data)
+	if errors.Is(err, errAccepted) && s.pending != nil {
+		accepted = true
+		slog.InfoContext(ctx, "Seller system accepted the request asynchronously", "ttl", s.asyncTTL)
+		return true
+	}
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		slog.ErrorContext(ctx, "Sending request to seller system got an error", "url", statusErr.url, "status_code", statusErr.statusCode, logging.Payload(statusErr.body))
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Sending request to seller system failed", "error", err)
+		return false
+	}
+
+	if err := s.publishCallback(ctx, fmt.Sprintf("on_%s", action), payload); err != nil {
+		slog.ErrorContext(ctx, "Publishing message failed", "error", err)
+		return false
+	}
+	return true
+}
+
+// publishCallback publishes the callback payload to the callback topic.
+//
+// The callback belongs to the transaction of its context, so it is published in order. Large payloads are offloaded
+// to the claim check store.
+func (s *server) publishCallback(ctx context.Context, action string, payload []byte) error {
+	msg := &pubsub.Message{
+		Attributes: map[string]string{
+			"action": action,
+		},
+		OrderingKey: ordering.Key(payload),
+	}
+	if err := s.claimCheck.SetData(ctx, msg, payload); err != nil {
+		return fmt.Errorf("offload callback payload: %v", err)
+	}
+	tracing.InjectPubSub(ctx, msg)
+	_, err := ordering.Publish(ctx, s.callbackTopic, msg)
+	return err
+}
@@ -15,15 +15,19 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/pubsub"
 
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/claimcheck"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/pubsubtest"
 )
@@ -76,10 +80,30 @@ func TestInitializeServerFail(t *testing.T) {
 				SubscriptionID:  []string{bppSubID},
 			},
 		},
+		{
+			httpClient: http.DefaultClient,
+			conf: config.SellerAdapterConfig{
+				ProjectID:       projectID,
+				SellerSystemURL: "fakeseller.com/api",
+				CallbackTopicID: callbackTopicID,
+				SubscriptionID:  []string{bppSubID},
+				Async:           &config.AsyncConfig{InstanceID: "instance", DatabaseID: "database"},
+			},
+		},
+		{
+			httpClient: http.DefaultClient,
+			conf: config.SellerAdapterConfig{
+				ProjectID:          projectID,
+				SellerSystemURL:    "fakeseller.com/api",
+				SellerSystemPlugin: "erp",
+				CallbackTopicID:    callbackTopicID,
+				SubscriptionID:     []string{bppSubID},
+			},
+		},
 	}
 
 	for _, test := range tests {
-		_, err := initializeServer(ctx, test.httpClient, pubsubClient, test.conf)
+		_, err := initializeServer(ctx, test.httpClient, pubsubClient, nil, nil, nil, test.conf)
 
 		if err == nil { // If NO error
 			t.Errorf("initializeServer() success unexpectedly.")
@@ -131,7 +155,7 @@ func TestInitializeServerSuccess(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		_, err := initializeServer(ctx, httpClient, pubsubClient, test.conf)
+		_, err := initializeServer(ctx, httpClient, pubsubClient, nil, nil, nil, test.conf)
 		if err != nil {
 			t.Errorf("initializeServer() failed: %v", err)
 		}
@@ -176,7 +200,7 @@ func TestHandleSubscriptionCallSellerFail(t *testing.T) {
 		CallbackTopicID: callbackTopicID,
 		SubscriptionID:  []string{bppSubID},
 	}
-	srv, err := initializeServer(ctx, httpClient, pubsubClient, conf)
+	srv, err := initializeServer(ctx, httpClient, pubsubClient, nil, nil, nil, conf)
 	if err != nil {
 		t.Fatalf("initializeServer failed: %v", err)
 	}
@@ -231,7 +255,7 @@ func TestHandleSubscriptionReceivingFail(t *testing.T) {
 		CallbackTopicID: callbackTopicID,
 		SubscriptionID:  []string{bppSubID},
 	}
-	srv, err := initializeServer(ctx, httpClient, pubsubClient, conf)
+	srv, err := initializeServer(ctx, httpClient, pubsubClient, nil, nil, nil, conf)
 	if err != nil {
 		t.Fatalf("initializeServer failed: %v", err)
 	}
@@ -286,7 +310,7 @@ func TestHandleSubscriptionSuccess(t *testing.T) {
 		CallbackTopicID: callbackTopicID,
 		SubscriptionID:  []string{bppSubID},
 	}
-	srv, err := initializeServer(ctx, httpClient, pubsubClient, conf)
+	srv, err := initializeServer(ctx, httpClient, pubsubClient, nil, nil, nil, conf)
 	if err != nil {
 		t.Fatalf("initializeServer failed: %v", err)
 	}
@@ -310,6 +334,113 @@ func TestHandleSubscriptionSuccess(t *testing.T) {
 	}
 }
 
+func TestHandleSubscriptionClaimCheck(t *testing.T) {
+	const (
+		projectID       = "test-project"
+		bppTopicID      = "bpp-topic"
+		callbackTopicID = "callback-topic"
+		bppSubID        = "bpp-subscription"
+		action          = "search"
+	)
+	ctx := context.Background()
+	psSetup := []pubsubtest.PubsubSetup{
+		{
+			TopicID: bppTopicID,
+			SubSetups: []pubsubtest.SubSetup{
+				{
+					SubID:  bppSubID,
+					Filter: fmt.Sprintf("attributes.action=%s", action),
+				},
+			},
+		},
+		{
+			TopicID: callbackTopicID,
+		},
+	}
+	psSrv, opt := pubsubtest.InitServer(t, projectID, psSetup)
+	pubsubClient, err := pubsub.NewClient(ctx, projectID, opt)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	payload := []byte(`{"context":{"transaction_id":"transaction-id"}}`)
+	callbackPayload := []byte(`{"message":{"catalog":{}}}`)
+	var gotPayload []byte
+	mockSellerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPayload, _ = io.ReadAll(r.Body)
+		w.Write(callbackPayload)
+	}))
+	t.Cleanup(mockSellerServer.Close)
+
+	storeDir := t.TempDir()
+	conf := config.SellerAdapterConfig{
+		ProjectID:       projectID,
+		SellerSystemURL: mockSellerServer.URL,
+		CallbackTopicID: callbackTopicID,
+		SubscriptionID:  []string{bppSubID},
+		ClaimCheck: config.ClaimCheckConfig{
+			StoreURL:  "file://" + storeDir,
+			Threshold: 10,
+		},
+	}
+	srv, err := initializeServer(ctx, mockSellerServer.Client(), pubsubClient, nil, nil, nil, conf)
+	if err != nil {
+		t.Fatalf("initializeServer failed: %v", err)
+	}
+
+	// The payload is offloaded by the publisher.
+	msg := &pubsub.Message{Attributes: map[string]string{"action": action}}
+	if err := srv.claimCheck.SetData(ctx, msg, payload); err != nil {
+		t.Fatalf("SetData() failed: %v", err)
+	}
+	fullTopicID := fmt.Sprintf("projects/%s/topics/%s", projectID, bppTopicID)
+	mID := psSrv.Publish(fullTopicID, msg.Data, msg.Attributes)
+
+	// 1 second should be more than enough to handle some messages before canceling the operation.
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	if err := srv.handleSubscription(ctx, srv.subs[0]); err != nil {
+		t.Errorf("handleSubscription() failed: %v", err)
+	}
+
+	if psSrv.Message(mID).Acks == 0 {
+		t.Errorf("Message %q: got no ack", mID)
+	}
+	if !bytes.Equal(gotPayload, payload) {
+		t.Errorf("Seller system got payload %q, want %q", gotPayload, payload)
+	}
+
+	var callbackMsg *pubsub.Message
+	for _, m := range psSrv.Messages() {
+		if m.Attributes["action"] == "on_"+action {
+			callbackMsg = &pubsub.Message{Data: m.Data, Attributes: m.Attributes}
+		}
+	}
+	if callbackMsg == nil {
+		t.Fatalf("Callback message is not published")
+	}
+	if _, ok := callbackMsg.Attributes[claimcheck.ReferenceAttribute]; !ok {
+		t.Errorf("Callback message has no %q attribute", claimcheck.ReferenceAttribute)
+	}
+	gotCallback, err := srv.claimCheck.Data(context.Background(), callbackMsg)
+	if err != nil {
+		t.Fatalf("Data() of the callback failed: %v", err)
+	}
+	if !bytes.Equal(gotCallback, callbackPayload) {
+		t.Errorf("Callback payload = %q, want %q", gotCallback, callbackPayload)
+	}
+
+	// Only the callback payload remains after the request payload is released.
+	entries, err := os.ReadDir(storeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Claim check store has %d payloads, want 1", len(entries))
+	}
+}
+
 func TestServeSuccess(t *testing.T) {
 	var (
 		projectID       = "test-project"
@@ -358,7 +489,7 @@ func TestServeSuccess(t *testing.T) {
 		SubscriptionID:  bppSubIDs,
 	}
 
-	srv, err := initializeServer(ctx, httpClient, pubsubClient, conf)
+	srv, err := initializeServer(ctx, httpClient, pubsubClient, nil, nil, nil, conf)
 	if err != nil {
 		t.Fatalf("initializeServer failed: %v", err)
 	}
@@ -0,0 +1,247 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+// Sort keys of Query.
+const (
+	SortByPrice    = "price"
+	SortByDistance = "distance"
+	SortByRating   = "rating"
+)
+
+// Offer is an item of a provider in an on_search catalog, flattened for comparing the offers of many BPPs.
+type Offer struct {
+	BppID        string     `json:"bpp_id"`
+	BppURI       string     `json:"bpp_uri"`
+	ProviderID   string     `json:"provider_id"`
+	ProviderName string     `json:"provider_name,omitempty"`
+	Item         model.Item `json:"item"`
+
+	// Price is the normalized price of the item, nil if the item has no valid price.
+	Price *float64 `json:"price,omitempty"`
+	// Currency is the upper case currency code of the price.
+	Currency string `json:"currency,omitempty"`
+	// Rating is the rating of the item, or of the provider if the item is not rated.
+	Rating float64 `json:"rating,omitempty"`
+	// GPS is the location of the item, or of the first provider location with a GPS.
+	GPS string `json:"gps,omitempty"`
+	// Distance is the distance in kilometers from the GPS of the query, set by Query.Apply.
+	Distance *float64 `json:"distance,omitempty"`
+}
+
+// OfferKey identifies the offer of an item. Offers with the same key are the same item.
+type OfferKey struct {
+	BppID      string
+	ProviderID string
+	ItemID     string
+}
+
+// Key returns the key of the offer.
+func (o Offer) Key() OfferKey {
+	return OfferKey{BppID: o.BppID, ProviderID: o.ProviderID, ItemID: o.Item.ID}
+}
+
+// Offers returns the offers of the items in the on_search catalog of the BPP in the context.
+//
+// Providers and items without ID cannot be de-duplicated and are skipped.
+func Offers(msgContext model.Context, c model.Catalog) []Offer {
+	var offers []Offer
+	for _, p := range c.BppProviders {
+		if p.ID == "" {
+			continue
+		}
+		var providerName string
+		if p.Descriptor != nil {
+			providerName = p.Descriptor.Name
+		}
+		locations := make(map[string]string, len(p.Locations))
+		var providerGPS string
+		for _, l := range p.Locations {
+			if _, _, ok := parseGPS(l.Gps); !ok {
+				continue
+			}
+			locations[l.ID] = l.Gps
+			if providerGPS == "" {
+				providerGPS = l.Gps
+			}
+		}
+
+		for _, item := range p.Items {
+			if item.ID == "" {
+				continue
+			}
+			o := Offer{
+				BppID:        msgContext.BppID,
+				BppURI:       msgContext.BppURI,
+				ProviderID:   p.ID,
+				ProviderName: providerName,
+				Item:         item,
+				Rating:       float64(item.Rating),
+				GPS:          providerGPS,
+			}
+			if o.Rating == 0 {
+				o.Rating = float64(p.Rating)
+			}
+			if gps, ok := locations[item.LocationID]; ok {
+				o.GPS = gps
+			}
+			o.Price, o.Currency = normalizePrice(item.Price)
+			offers = append(offers, o)
+		}
+	}
+	return Merge(offers)
+}
+
+// normalizePrice returns the value and upper case currency of the price.
+//
+// The value is the first valid one of the value, the offered value, the listed value and the estimated value.
+func normalizePrice(p *model.Price) (*float64, string) {
+	if p == nil {
+		return nil, ""
+	}
+	for _, v := range []*model.DecimalValue{p.Value, p.OfferedValue, p.ListedValue, p.EstimatedValue} {
+		if v == nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(v.Value), 64)
+		if err != nil || value < 0 {
+			continue
+		}
+		return &value, strings.ToUpper(strings.TrimSpace(p.Currency))
+	}
+	return nil, ""
+}
+
+// Merge de-duplicates the offers by their keys. The later offer of an item replaces the earlier one
+// in the position of the earlier one, as it is from the newer on_search.
+func Merge(offers []Offer) []Offer {
+	index := make(map[OfferKey]int, len(offers))
+	merged := make([]Offer, 0, len(offers))
+	for _, o := range offers {
+		if i, ok := index[o.Key()]; ok {
+			merged[i] = o
+			continue
+		}
+		index[o.Key()] = len(merged)
+		merged = append(merged, o)
+	}
+	return merged
+}
+
+// Query filters and sorts offers. Zero values of the criteria match everything.
+type Query struct {
+	MinPrice *float64
+	MaxPrice *float64
+	// Currency matches the offers priced in the currency, ignoring case.
+	Currency string
+
+	// GPS is the "latitude,longitude" the distance of the offers is measured from.
+	GPS string
+	// MaxDistance is the maximum distance in kilometers from the GPS.
+	MaxDistance float64
+
+	MinRating float64
+
+	// SortBy is one of SortByPrice, SortByDistance and SortByRating. Offers keep their order if empty.
+	SortBy     string
+	Descending bool
+
+	// Limit is the maximum number of offers. Zero is unlimited.
+	Limit int
+}
+
+// Apply returns the offers matching the query in its order.
+//
+// Offers without the value of a criterion, e.g. without a price for the price range, do not match it,
+// and offers without the value of the sort key come last in either order.
+func (q Query) Apply(offers []Offer) []Offer {
+	lat, lng, hasGPS := parseGPS(q.GPS)
+
+	var matched []Offer
+	for _, o := range offers {
+		o.Distance = nil
+		if hasGPS {
+			if offerLat, offerLng, ok := parseGPS(o.GPS); ok {
+				d := distance(lat, lng, offerLat, offerLng)
+				o.Distance = &d
+			}
+		}
+		if q.matches(o) {
+			matched = append(matched, o)
+		}
+	}
+
+	if q.SortBy != "" {
+		sort.SliceStable(matched, func(i, j int) bool {
+			a, aOK := q.sortValue(matched[i])
+			b, bOK := q.sortValue(matched[j])
+			if !aOK || !bOK {
+				return aOK && !bOK
+			}
+			if q.Descending {
+				return a > b
+			}
+			return a < b
+		})
+	}
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+	}
+	return matched
+}
+
+func (q Query) matches(o Offer) bool {
+	if q.MinPrice != nil && (o.Price == nil || *o.Price < *q.MinPrice) {
+		return false
+	}
+	if q.MaxPrice != nil && (o.Price == nil || *o.Price > *q.MaxPrice) {
+		return false
+	}
+	if q.Currency != "" && !strings.EqualFold(q.Currency, o.Currency) {
+		return false
+	}
+	if q.MaxDistance > 0 && (o.Distance == nil || *o.Distance > q.MaxDistance) {
+		return false
+	}
+	return o.Rating >= q.MinRating
+}
+
+// sortValue returns the value of the sort key of the offer and whether the offer has it.
+func (q Query) sortValue(o Offer) (float64, bool) {
+	switch q.SortBy {
+	case SortByPrice:
+		if o.Price == nil {
+			return 0, false
+		}
+		return *o.Price, true
+	case SortByDistance:
+		if o.Distance == nil {
+			return 0, false
+		}
+		return *o.Distance, true
+	case SortByRating:
+		return o.Rating, o.Rating > 0
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+func price(currency, value string) *model.Price {
+	return &model.Price{Currency: currency, Value: &model.DecimalValue{Value: value}}
+}
+
+func offerIDs(offers []Offer) []string {
+	ids := make([]string, 0, len(offers))
+	for _, o := range offers {
+		ids = append(ids, o.BppID+"/"+o.ProviderID+"/"+o.Item.ID)
+	}
+	return ids
+}
+
+func TestOffers(t *testing.T) {
+	msgContext := model.Context{BppID: "bpp.example.com", BppURI: "https://bpp.example.com"}
+	// The type of the provider locations is unexported.
+	var p model.Provider
+	locations := `{"locations": [{"id": "L1", "gps": "invalid"}, {"id": "L2", "gps": "12.9716,77.5946"}, {"id": "L3", "gps": "12.2958,76.6394"}]}`
+	if err := json.Unmarshal([]byte(locations), &p); err != nil {
+		t.Fatal(err)
+	}
+	p.ID = "P1"
+	p.Descriptor = &model.Descriptor{Name: "Store"}
+	p.Rating = 4
+	p.Items = []model.Item{
+		{ID: "I1", Price: price("inr", " 100.50"), LocationID: "L3"},
+		{ID: "I2", Price: &model.Price{Currency: "INR", OfferedValue: &model.DecimalValue{Value: "80"}}, Rating: 5},
+		{ID: "I3", Price: price("INR", "free")},
+		{Descriptor: &model.Descriptor{Name: "Item without ID"}},
+		{ID: "I1", Price: price("INR", "90"), LocationID: "L3"},
+	}
+	c := model.Catalog{BppProviders: []model.Provider{p, {Items: []model.Item{{ID: "I4"}}}}}
+
+	got := Offers(msgContext, c)
+	if diff := cmp.Diff([]string{"bpp.example.com/P1/I1", "bpp.example.com/P1/I2", "bpp.example.com/P1/I3"}, offerIDs(got)); diff != "" {
+		t.Fatalf("Offers() returned unexpected offers (-want +got):\n%s", diff)
+	}
+
+	i1, i2, i3 := got[0], got[1], got[2]
+	if i1.Price == nil || *i1.Price != 90 || i1.Currency != "INR" {
+		t.Errorf("Offers() I1 price = %v %s, want 90 INR of the later offer", i1.Price, i1.Currency)
+	}
+	if i1.GPS != "12.2958,76.6394" || i1.Rating != 4 || i1.ProviderName != "Store" || i1.BppURI != "https://bpp.example.com" {
+		t.Errorf("Offers() I1 = %+v, want the item location, the provider rating and name, and the BPP URI", i1)
+	}
+	if i2.Price == nil || *i2.Price != 80 || i2.GPS != "12.9716,77.5946" || i2.Rating != 5 {
+		t.Errorf("Offers() I2 = %+v, want the offered value, the first valid provider location and the item rating", i2)
+	}
+	if i3.Price != nil {
+		t.Errorf("Offers() I3 price = %v, want nil", *i3.Price)
+	}
+}
+
+func TestQueryApply(t *testing.T) {
+	float := func(f float64) *float64 { return &f }
+	offers := []Offer{
+		{BppID: "a", ProviderID: "P", Item: model.Item{ID: "near"}, Price: float(300), Currency: "INR", Rating: 3, GPS: "12.9716,77.5946"},
+		{BppID: "a", ProviderID: "P", Item: model.Item{ID: "far"}, Price: float(100), Currency: "INR", Rating: 5, GPS: "12.2958,76.6394"},
+		{BppID: "b", ProviderID: "P", Item: model.Item{ID: "unpriced"}, Rating: 4, GPS: "12.9500,77.6000"},
+		{BppID: "b", ProviderID: "P", Item: model.Item{ID: "usd"}, Price: float(2), Currency: "USD"},
+	}
+	const home = "12.9716,77.5946"
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{
+			name:  "everything",
+			query: Query{},
+			want:  []string{"a/P/near", "a/P/far", "b/P/unpriced", "b/P/usd"},
+		},
+		{
+			name:  "price range",
+			query: Query{MinPrice: float(50), MaxPrice: float(200)},
+			want:  []string{"a/P/far"},
+		},
+		{
+			name:  "currency",
+			query: Query{Currency: "usd"},
+			want:  []string{"b/P/usd"},
+		},
+		{
+			name:  "max distance",
+			query: Query{GPS: home, MaxDistance: 10},
+			want:  []string{"a/P/near", "b/P/unpriced"},
+		},
+		{
+			name:  "min rating",
+			query: Query{MinRating: 4},
+			want:  []string{"a/P/far", "b/P/unpriced"},
+		},
+		{
+			name:  "sort by price",
+			query: Query{SortBy: SortByPrice},
+			want:  []string{"b/P/usd", "a/P/far", "a/P/near", "b/P/unpriced"},
+		},
+		{
+			name:  "sort by price descending",
+			query: Query{SortBy: SortByPrice, Descending: true},
+			want:  []string{"a/P/near", "a/P/far", "b/P/usd", "b/P/unpriced"},
+		},
+		{
+			name:  "sort by distance",
+			query: Query{GPS: home, SortBy: SortByDistance},
+			want:  []string{"a/P/near", "b/P/unpriced", "a/P/far", "b/P/usd"},
+		},
+		{
+			name:  "sort by rating with limit",
+			query: Query{SortBy: SortByRating, Descending: true, Limit: 2},
+			want:  []string{"a/P/far", "b/P/unpriced"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.query.Apply(offers)
+			if diff := cmp.Diff(test.want, offerIDs(got)); diff != "" {
+				t.Errorf("Apply() returned unexpected offers (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestQueryApplySetsDistance(t *testing.T) {
+	offers := []Offer{{GPS: "12.2958,76.6394"}, {}}
+	got := Query{GPS: "12.9716,77.5946"}.Apply(offers)
+	if got[0].Distance == nil || *got[0].Distance < 125 || *got[0].Distance > 130 {
+		t.Errorf("Apply() distance = %v, want about 128 km", got[0].Distance)
+	}
+	if got[1].Distance != nil {
+		t.Errorf("Apply() distance of the offer without GPS = %v, want nil", *got[1].Distance)
+	}
+	if offers[0].Distance != nil {
+		t.Error("Apply() modified the given offers")
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package catalog matches ONDC search intents against a seller catalog and aggregates the catalogs of many sellers.
+//
+// Match prunes a catalog down to the providers, items and BPP level details matching an intent, and ParseRefresh
+// reads the incremental catalog refresh requested by the "catalog_inc" tags of the intent.
+//
+// On the buyer side, Offers flattens the on_search catalogs of the BPPs into comparable offers with normalized
+// prices, Merge de-duplicates them, and Query filters and sorts them by price, distance and rating.
+package catalog
+
+import (
+	"strings"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+// searchTagGroups are the intent tag groups configuring the search rather than describing the items.
+var searchTagGroups = map[string]bool{
+	RefreshTagCode: true,
+	"bap_terms":    true,
+	"bap_features": true,
+}
+
+// query is the search criteria of an intent. Empty criteria match everything.
+type query struct {
+	// phrase matches the item or the provider name.
+	phrase string
+
+	providerID   string
+	providerName string
+	itemID       string
+	itemName     string
+	categoryID   string
+
+	fulfillmentType string
+	paymentType     string
+
+	// lat and lng are the GPS of the fulfillment end, which must be within the serviceability circle
+	// of a provider location if hasGPS.
+	lat    float64
+	lng    float64
+	hasGPS bool
+
+	// tags must be present in the item or provider tags of the same group code.
+	tags *model.TagGroup
+}
+
+// newQuery returns the search criteria of the intent.
+func newQuery(intent *model.Intent) query {
+	var q query
+	if intent == nil {
+		return q
+	}
+	if d := intent.Descriptor; d != nil {
+		q.phrase = d.Name
+	}
+	if p := intent.Provider; p != nil {
+		q.providerID = p.ID
+		if p.Descriptor != nil {
+			q.providerName = p.Descriptor.Name
+		}
+	}
+	if i := intent.Item; i != nil {
+		q.itemID = i.ID
+		if i.Descriptor != nil {
+			q.itemName = i.Descriptor.Name
+		}
+	}
+	if c := intent.Category; c != nil {
+		q.categoryID = c.ID
+	}
+	if f := intent.Fulfillment; f != nil {
+		q.fulfillmentType = f.Type
+		if f.End != nil && f.End.Location != nil && f.End.Location.Gps != nil {
+			q.lat, q.lng, q.hasGPS = parseGPS(f.End.Location.Gps.Value)
+		}
+	}
+	if p := intent.Payment; p != nil && p.Type != nil {
+		q.paymentType = *p.Type
+	}
+	if t := intent.Tags; t != nil && !searchTagGroups[t.Code] {
+		q.tags = t
+	}
+	return q
+}
+
+// Match returns the catalog pruned down to the search intent.
+//
+// The providers are filtered as by Filter. The BPP fulfillments and payments are pruned to the types of the intent,
+// and the BPP categories to the ones of the remaining items. The given catalog is not modified.
+func Match(intent *model.Intent, c model.Catalog) model.Catalog {
+	q := newQuery(intent)
+	c.BppProviders = q.providers(c.BppProviders, c.BppFulfillments)
+
+	if q.fulfillmentType != "" {
+		var fulfillments []model.Fulfillment
+		for _, f := range c.BppFulfillments {
+			if matchFulfillmentType(f.Type, q.fulfillmentType) {
+				fulfillments = append(fulfillments, f)
+			}
+		}
+		c.BppFulfillments = fulfillments
+	}
+	if q.paymentType != "" {
+		var payments []model.Payment
+		for _, p := range c.BppPayments {
+			if p.Type == nil || *p.Type == q.paymentType {
+				payments = append(payments, p)
+			}
+		}
+		c.BppPayments = payments
+	}
+
+	if len(c.BppCategories) > 0 {
+		used := make(map[string]bool)
+		for _, p := range c.BppProviders {
+			used[p.CategoryID] = true
+			for _, item := range p.Items {
+				used[item.CategoryID] = true
+				for _, id := range item.CategoryIDs {
+					used[id] = true
+				}
+			}
+		}
+		var categories []model.Category
+		for _, category := range c.BppCategories {
+			if used[category.ID] {
+				categories = append(categories, category)
+			}
+		}
+		c.BppCategories = categories
+	}
+	return c
+}
+
+// Filter returns the providers with the items matching the search intent.
+//
+// The intent is matched on the provider, the item name and ID, the category, the fulfillment and payment types,
+// the tags and the GPS of the fulfillment end, which must be within the serviceability circle of a provider location.
+// The search phrase of the intent descriptor matches the item or the provider name.
+// Providers without matching items are left out. The given providers are not modified.
+func Filter(intent *model.Intent, providers []model.Provider) []model.Provider {
+	return newQuery(intent).providers(providers, nil)
+}
+
+// providers returns the providers with the items matching the query.
+//
+// The items may refer to the BPP fulfillments as well as the fulfillments of their provider.
+func (q query) providers(providers []model.Provider, bppFulfillments []model.Fulfillment) []model.Provider {
+	matched := make([]model.Provider, 0, len(providers))
+	for _, p := range providers {
+		if !q.matchProvider(p) {
+			continue
+		}
+
+		locations := q.serviceableLocations(p)
+		if locations != nil && len(locations) == 0 {
+			continue
+		}
+		if !q.fulfills(p) {
+			continue
+		}
+		fulfillments := q.fulfillmentMatches(bppFulfillments, p.Fulfillments)
+
+		var items []model.Item
+		for _, item := range p.Items {
+			if !q.matchItem(p, item) {
+				continue
+			}
+			if locations != nil && item.LocationID != "" && !locations[item.LocationID] {
+				continue
+			}
+			if item.FulfillmentID != nil {
+				if match, ok := fulfillments[*item.FulfillmentID]; ok && !match {
+					continue
+				}
+			}
+			items = append(items, item)
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		p.Items = items
+		matched = append(matched, p)
+	}
+	return matched
+}
+
+// matchProvider reports whether the provider is the one of the query and accepts its payment type.
+//
+// Providers without payments accept any payment type.
+func (q query) matchProvider(p model.Provider) bool {
+	if q.providerID != "" && q.providerID != p.ID {
+		return false
+	}
+	if !contains(p.Descriptor, q.providerName) {
+		return false
+	}
+	if q.paymentType == "" || len(p.Payments) == 0 {
+		return true
+	}
+	for _, payment := range p.Payments {
+		if payment.Type == nil || *payment.Type == q.paymentType {
+			return true
+		}
+	}
+	return false
+}
+
+// matchItem reports whether the item of the provider matches the item, category, tags and search phrase of the query.
+func (q query) matchItem(p model.Provider, item model.Item) bool {
+	if q.itemID != "" && q.itemID != item.ID {
+		return false
+	}
+	if !contains(item.Descriptor, q.itemName) {
+		return false
+	}
+	if q.categoryID != "" && !inCategory(p, item, q.categoryID) {
+		return false
+	}
+	if !contains(item.Descriptor, q.phrase) && !contains(p.Descriptor, q.phrase) {
+		return false
+	}
+	return q.tags == nil || hasTags(item.Tags, q.tags) || hasTags(p.Tags, q.tags)
+}
+
+// inCategory reports whether the item, or the provider as a whole, is listed under the category.
+func inCategory(p model.Provider, item model.Item, categoryID string) bool {
+	if item.CategoryID == categoryID || p.CategoryID == categoryID {
+		return true
+	}
+	for _, id := range item.CategoryIDs {
+		if id == categoryID {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTags reports whether the group has the code and every tag of want.
+//
+// A tag without a value only requires the tag code to be present.
+func hasTags(group, want *model.TagGroup) bool {
+	if group == nil || group.Code != want.Code {
+		return false
+	}
+	for _, w := range want.List {
+		found := false
+		for _, t := range group.List {
+			if t.Code == w.Code && (w.Value == "" || strings.EqualFold(t.Value, w.Value)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// contains reports whether the name of the descriptor contains the phrase, ignoring case.
+//
+// Every descriptor contains an empty phrase.
+func contains(d *model.Descriptor, phrase string) bool {
+	if phrase == "" {
+		return true
+	}
+	if d == nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(d.Name), strings.ToLower(phrase))
+}
+
+// serviceableLocations returns the IDs of the provider locations serving the GPS of the query.
+//
+// It returns nil if the locations are not filtered, i.e. the query has no valid GPS or the provider has no locations.
+// Locations without a serviceability circle serve any GPS.
+func (q query) serviceableLocations(p model.Provider) map[string]bool {
+	if !q.hasGPS || len(p.Locations) == 0 {
+		return nil
+	}
+
+	locations := make(map[string]bool)
+	for _, l := range p.Locations {
+		if l.Circle == nil || l.Circle.Gps == nil || l.Circle.Radius == nil {
+			locations[l.ID] = true
+			continue
+		}
+		if within(q.lat, q.lng, l.Circle) {
+			locations[l.ID] = true
+		}
+	}
+	return locations
+}
+
+// fulfills reports whether the provider offers a fulfillment of the query type.
+//
+// Providers without typed fulfillments, e.g. with only the contact details of their fulfillments, are not filtered.
+func (q query) fulfills(p model.Provider) bool {
+	if q.fulfillmentType == "" {
+		return true
+	}
+	typed := false
+	for _, f := range p.Fulfillments {
+		if f.Type == "" {
+			continue
+		}
+		if matchFulfillmentType(f.Type, q.fulfillmentType) {
+			return true
+		}
+		typed = true
+	}
+	return !typed
+}
+
+// fulfillmentMatches returns whether the typed fulfillments by ID are of the query type.
+//
+// It returns nil if the query has no fulfillment type. Items referring to other fulfillments are not filtered.
+func (q query) fulfillmentMatches(fulfillmentLists ...[]model.Fulfillment) map[string]bool {
+	if q.fulfillmentType == "" {
+		return nil
+	}
+	matches := make(map[string]bool)
+	for _, fulfillments := range fulfillmentLists {
+		for _, f := range fulfillments {
+			if f.ID != "" && f.Type != "" {
+				matches[f.ID] = matchFulfillmentType(f.Type, q.fulfillmentType)
+			}
+		}
+	}
+	return matches
+}
+
+// matchFulfillmentType reports whether a fulfillment of the type serves the wanted type.
+//
+// A "Delivery and Pickup" fulfillment serves both types.
+func matchFulfillmentType(fulfillmentType, want string) bool {
+	return fulfillmentType == want || fulfillmentType == "Delivery and Pickup" && (want == "Delivery" || want == "Pickup")
+}
@@ -0,0 +1,231 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+// testProviders is a grocery in Bengaluru delivering within 5 km and a bakery in Mysuru only open for pickup
+// and cash on fulfillment.
+const testProviders = `[
+  {
+    "id": "grocery",
+    "descriptor": {"name": "Fresh Grocery"},
+    "locations": [{"id": "grocery-store", "gps": "12.9716,77.5946", "circle": {"gps": "12.9716,77.5946", "radius": {"value": 5, "unit": "km"}}}],
+    "fulfillments": [{"id": "grocery-delivery", "type": "Delivery"}],
+    "payments": [{"type": "ON-ORDER"}],
+    "items": [
+      {"id": "apple", "descriptor": {"name": "Red Apple"}, "category_id": "Fruits and Vegetables", "location_id": "grocery-store", "fulfillment_id": "grocery-delivery",
+       "tags": {"code": "attributes", "list": [{"code": "organic", "value": "yes"}]}},
+      {"id": "milk", "descriptor": {"name": "Milk"}, "category_id": "Dairy", "category_ids": ["Beverages"], "location_id": "grocery-store"}
+    ]
+  },
+  {
+    "id": "bakery",
+    "descriptor": {"name": "Apple Bakery"},
+    "category_id": "Bakery",
+    "locations": [{"id": "bakery-store", "gps": "12.2958,76.6394", "circle": {"gps": "12.2958,76.6394", "radius": {"value": 500, "unit": "m"}}}],
+    "fulfillments": [{"id": "bakery-pickup", "type": "Pickup"}],
+    "payments": [{"type": "ON-FULFILLMENT"}],
+    "items": [
+      {"id": "bread", "descriptor": {"name": "Bread"}, "location_id": "bakery-store", "fulfillment_id": "bakery-pickup"}
+    ]
+  }
+]`
+
+func decodeIntent(t *testing.T, intent string) *model.Intent {
+	t.Helper()
+	var i model.Intent
+	if err := json.Unmarshal([]byte(intent), &i); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	return &i
+}
+
+func TestFilter(t *testing.T) {
+	var providers []model.Provider
+	if err := json.Unmarshal([]byte(testProviders), &providers); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		intent string
+		want   map[string][]string
+	}{
+		{
+			name:   "no intent",
+			intent: `{}`,
+			want:   map[string][]string{"grocery": {"apple", "milk"}, "bakery": {"bread"}},
+		},
+		{
+			name:   "item name",
+			intent: `{"item": {"descriptor": {"name": "apple"}}}`,
+			want:   map[string][]string{"grocery": {"apple"}},
+		},
+		{
+			name:   "search phrase matching item or provider",
+			intent: `{"descriptor": {"name": "apple"}}`,
+			want:   map[string][]string{"grocery": {"apple"}, "bakery": {"bread"}},
+		},
+		{
+			name:   "item category",
+			intent: `{"category": {"id": "Beverages"}}`,
+			want:   map[string][]string{"grocery": {"milk"}},
+		},
+		{
+			name:   "provider category",
+			intent: `{"category": {"id": "Bakery"}}`,
+			want:   map[string][]string{"bakery": {"bread"}},
+		},
+		{
+			name:   "provider",
+			intent: `{"provider": {"id": "bakery"}}`,
+			want:   map[string][]string{"bakery": {"bread"}},
+		},
+		{
+			name:   "fulfillment type",
+			intent: `{"fulfillment": {"type": "Delivery"}}`,
+			want:   map[string][]string{"grocery": {"apple", "milk"}},
+		},
+		{
+			name:   "GPS within the circle",
+			intent: `{"fulfillment": {"type": "Delivery", "end": {"location": {"gps": "12.9500,77.6000"}}}}`,
+			want:   map[string][]string{"grocery": {"apple", "milk"}},
+		},
+		{
+			name:   "payment type",
+			intent: `{"payment": {"type": "ON-FULFILLMENT"}}`,
+			want:   map[string][]string{"bakery": {"bread"}},
+		},
+		{
+			name:   "tags",
+			intent: `{"tags": {"code": "attributes", "list": [{"code": "organic", "value": "YES"}]}}`,
+			want:   map[string][]string{"grocery": {"apple"}},
+		},
+		{
+			name:   "tags configuring the search",
+			intent: `{"tags": {"code": "bap_terms", "list": [{"code": "finder_fee_type", "value": "percent"}]}}`,
+			want:   map[string][]string{"grocery": {"apple", "milk"}, "bakery": {"bread"}},
+		},
+		{
+			name:   "GPS outside of the circles",
+			intent: `{"fulfillment": {"type": "Delivery", "end": {"location": {"gps": "13.1986,77.7066"}}}}`,
+			want:   map[string][]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := make(map[string][]string)
+			for _, p := range Filter(decodeIntent(t, test.intent), providers) {
+				for _, item := range p.Items {
+					got[p.ID] = append(got[p.ID], item.ID)
+				}
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Filter() items diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// The providers are filtered by copy.
+	if got := len(providers[0].Items); got != 2 {
+		t.Errorf("Filter() modified the providers, got %d items, want 2", got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	var providers []model.Provider
+	if err := json.Unmarshal([]byte(testProviders), &providers); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	c := model.Catalog{
+		BppDescriptor: &model.Descriptor{Name: "Seller App"},
+		BppCategories: []model.Category{{ID: "Fruits and Vegetables"}, {ID: "Dairy"}, {ID: "Bakery"}},
+		BppFulfillments: []model.Fulfillment{
+			{ID: "delivery", Type: "Delivery"},
+			{ID: "pickup", Type: "Pickup"},
+			{ID: "both", Type: "Delivery and Pickup"},
+		},
+		BppProviders: providers,
+	}
+
+	got := Match(decodeIntent(t, `{"item": {"descriptor": {"name": "apple"}}, "fulfillment": {"type": "Delivery"}}`), c)
+
+	if got.BppDescriptor == nil || got.BppDescriptor.Name != "Seller App" {
+		t.Errorf("Match() descriptor = %v, want it kept", got.BppDescriptor)
+	}
+	var gotProviders []string
+	for _, p := range got.BppProviders {
+		gotProviders = append(gotProviders, p.ID)
+	}
+	if diff := cmp.Diff([]string{"grocery"}, gotProviders); diff != "" {
+		t.Errorf("Match() providers diff (-want +got):\n%s", diff)
+	}
+	var gotCategories []string
+	for _, category := range got.BppCategories {
+		gotCategories = append(gotCategories, category.ID)
+	}
+	if diff := cmp.Diff([]string{"Fruits and Vegetables"}, gotCategories); diff != "" {
+		t.Errorf("Match() categories diff (-want +got):\n%s", diff)
+	}
+	var gotFulfillments []string
+	for _, f := range got.BppFulfillments {
+		gotFulfillments = append(gotFulfillments, f.ID)
+	}
+	if diff := cmp.Diff([]string{"delivery", "both"}, gotFulfillments); diff != "" {
+		t.Errorf("Match() fulfillments diff (-want +got):\n%s", diff)
+	}
+
+	// The catalog is pruned by copy.
+	if got := len(c.BppFulfillments); got != 3 {
+		t.Errorf("Match() modified the catalog, got %d fulfillments, want 3", got)
+	}
+}
+
+func TestMatchBPPFulfillments(t *testing.T) {
+	// The items refer to the BPP fulfillments, and the provider fulfillments only have contact details.
+	var c model.Catalog
+	if err := json.Unmarshal([]byte(`{
+  "bpp/fulfillments": [{"id": "1", "type": "Delivery"}, {"id": "2", "type": "Pickup"}],
+  "bpp/providers": [
+    {
+      "id": "store",
+      "fulfillments": [{"contact": {"phone": "9886098860"}}],
+      "items": [{"id": "atta", "fulfillment_id": "1"}, {"id": "rice", "fulfillment_id": "2"}, {"id": "dal"}]
+    }
+  ]
+}`), &c); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	got := make(map[string][]string)
+	for _, p := range Match(decodeIntent(t, `{"fulfillment": {"type": "Delivery"}}`), c).BppProviders {
+		for _, item := range p.Items {
+			got[p.ID] = append(got[p.ID], item.ID)
+		}
+	}
+	want := map[string][]string{"store": {"atta", "dal"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Match() items diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+// earthRadius is the mean radius of the Earth in kilometers.
+const earthRadius = 6371.0
+
+// within reports whether the coordinates are within the circle.
+//
+// Circles with an invalid center or radius contain nothing.
+func within(lat, lng float64, c *model.Circle) bool {
+	centerLat, centerLng, ok := parseGPS(c.Gps.Value)
+	if !ok {
+		return false
+	}
+	radius, ok := kilometers(c.Radius)
+	if !ok {
+		return false
+	}
+	return distance(lat, lng, centerLat, centerLng) <= radius
+}
+
+// parseGPS parses the "latitude,longitude" coordinates of the GPS, as validated by "custom_gps".
+func parseGPS(gps string) (lat, lng float64, ok bool) {
+	latStr, lngStr, ok := strings.Cut(gps, ",")
+	if !ok {
+		return 0, 0, false
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, false
+	}
+	lng, err = strconv.ParseFloat(strings.TrimSpace(lngStr), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
+
+// kilometers returns the length of the scalar in kilometers. The unit is either "km" or "m".
+func kilometers(s *model.Scalar) (float64, bool) {
+	if s.Value == nil || s.Unit == nil {
+		return 0, false
+	}
+	switch strings.ToLower(*s.Unit) {
+	case "km":
+		return float64(*s.Value), true
+	case "m":
+		return float64(*s.Value) / 1000, true
+	default:
+		return 0, false
+	}
+}
+
+// distance returns the great-circle distance in kilometers between the coordinates using the haversine formula.
+func distance(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLng := toRad(lat2-lat1), toRad(lng2-lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import "testing"
+
+func TestDistance(t *testing.T) {
+	// Bengaluru to Mysuru is about 128 km.
+	if got := distance(12.9716, 77.5946, 12.2958, 76.6394); got < 125 || got > 130 {
+		t.Errorf("distance() = %v km, want about 128 km", got)
+	}
+}
+
+func TestParseGPS(t *testing.T) {
+	tests := []struct {
+		gps    string
+		wantOK bool
+	}{
+		{gps: "12.9716,77.5946", wantOK: true},
+		{gps: "-33.8688, 151.2093", wantOK: true},
+		{gps: "12.9716", wantOK: false},
+		{gps: "north,east", wantOK: false},
+		{gps: "91.0,77.5946", wantOK: false},
+		{gps: "12.9716,181.0", wantOK: false},
+	}
+	for _, test := range tests {
+		if _, _, ok := parseGPS(test.gps); ok != test.wantOK {
+			t.Errorf("parseGPS(%q) ok = %v, want %v", test.gps, ok, test.wantOK)
+		}
+	}
+}
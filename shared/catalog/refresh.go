@@ -0,0 +1,93 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import (
+	"fmt"
+	"time"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+const (
+	// RefreshTagCode is the code of the intent tags requesting an incremental catalog refresh.
+	RefreshTagCode = "catalog_inc"
+
+	// ModeStart starts pushing the catalog updates to the buyer app.
+	ModeStart = "start"
+	// ModeStop stops pushing the catalog updates to the buyer app.
+	ModeStop = "stop"
+)
+
+// Refresh is an incremental catalog refresh requested by a search.
+//
+// In the push mode, Mode is either ModeStart or ModeStop and the buyer app receives the catalog updates as they are pushed.
+// In the pull mode, Mode is empty and the buyer app receives the catalog updated between Start and End.
+type Refresh struct {
+	Mode  string
+	Start time.Time
+	End   time.Time
+}
+
+// ParseRefresh returns the incremental catalog refresh requested by the intent tags, or nil if the full catalog is requested.
+//
+// The end time of the pull mode is optional and defaults to now.
+func ParseRefresh(intent *model.Intent, now time.Time) (*Refresh, error) {
+	if intent == nil || intent.Tags == nil || intent.Tags.Code != RefreshTagCode {
+		return nil, nil
+	}
+
+	var r Refresh
+	var start, end string
+	for _, tag := range intent.Tags.List {
+		switch tag.Code {
+		case "mode":
+			r.Mode = tag.Value
+		case "start_time":
+			start = tag.Value
+		case "end_time":
+			end = tag.Value
+		}
+	}
+
+	switch r.Mode {
+	case ModeStart, ModeStop:
+		if start != "" || end != "" {
+			return nil, fmt.Errorf("parse catalog refresh: mode %q with a time range", r.Mode)
+		}
+		return &r, nil
+	case "":
+	default:
+		return nil, fmt.Errorf("parse catalog refresh: unknown mode %q", r.Mode)
+	}
+
+	if start == "" {
+		return nil, fmt.Errorf("parse catalog refresh: no mode or start time")
+	}
+	var err error
+	if r.Start, err = time.Parse(time.RFC3339, start); err != nil {
+		return nil, fmt.Errorf("parse catalog refresh: start time: %v", err)
+	}
+	r.End = now
+	if end != "" {
+		if r.End, err = time.Parse(time.RFC3339, end); err != nil {
+			return nil, fmt.Errorf("parse catalog refresh: end time: %v", err)
+		}
+	}
+	if r.End.Before(r.Start) {
+		return nil, fmt.Errorf("parse catalog refresh: end time %v is before start time %v", r.End, r.Start)
+	}
+	return &r, nil
+}
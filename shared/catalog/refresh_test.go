@@ -0,0 +1,111 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRefresh(t *testing.T) {
+	now := time.Date(2023, 6, 3, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		intent string
+		want   *Refresh
+	}{
+		{
+			name:   "full catalog",
+			intent: `{"item": {"descriptor": {"name": "apple"}}}`,
+			want:   nil,
+		},
+		{
+			name:   "other tags",
+			intent: `{"tags": {"code": "bap_terms", "list": [{"code": "finder_fee_type", "value": "percent"}]}}`,
+			want:   nil,
+		},
+		{
+			name:   "push mode start",
+			intent: `{"tags": {"code": "catalog_inc", "list": [{"code": "mode", "value": "start"}]}}`,
+			want:   &Refresh{Mode: ModeStart},
+		},
+		{
+			name:   "push mode stop",
+			intent: `{"tags": {"code": "catalog_inc", "list": [{"code": "mode", "value": "stop"}]}}`,
+			want:   &Refresh{Mode: ModeStop},
+		},
+		{
+			name:   "pull mode",
+			intent: `{"tags": {"code": "catalog_inc", "list": [{"code": "start_time", "value": "2023-06-03T08:00:00Z"}, {"code": "end_time", "value": "2023-06-03T09:00:00Z"}]}}`,
+			want:   &Refresh{Start: time.Date(2023, 6, 3, 8, 0, 0, 0, time.UTC), End: time.Date(2023, 6, 3, 9, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:   "pull mode without end time",
+			intent: `{"tags": {"code": "catalog_inc", "list": [{"code": "start_time", "value": "2023-06-03T08:00:00Z"}]}}`,
+			want:   &Refresh{Start: time.Date(2023, 6, 3, 8, 0, 0, 0, time.UTC), End: now},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseRefresh(decodeIntent(t, test.intent), now)
+			if err != nil {
+				t.Fatalf("ParseRefresh() failed: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("ParseRefresh() diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseRefreshFailed(t *testing.T) {
+	now := time.Date(2023, 6, 3, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		intent string
+	}{
+		{
+			name:   "unknown mode",
+			intent: `{"tags": {"code": "catalog_inc", "list": [{"code": "mode", "value": "pause"}]}}`,
+		},
+		{
+			name:   "mode with a time range",
+			intent: `{"tags": {"code": "catalog_inc", "list": [{"code": "mode", "value": "start"}, {"code": "start_time", "value": "2023-06-03T08:00:00Z"}]}}`,
+		},
+		{
+			name:   "no start time",
+			intent: `{"tags": {"code": "catalog_inc", "list": [{"code": "end_time", "value": "2023-06-03T09:00:00Z"}]}}`,
+		},
+		{
+			name:   "invalid start time",
+			intent: `{"tags": {"code": "catalog_inc", "list": [{"code": "start_time", "value": "yesterday"}]}}`,
+		},
+		{
+			name:   "end before start",
+			intent: `{"tags": {"code": "catalog_inc", "list": [{"code": "start_time", "value": "2023-06-03T09:00:00Z"}, {"code": "end_time", "value": "2023-06-03T08:00:00Z"}]}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseRefresh(decodeIntent(t, test.intent), now); err == nil {
+				t.Errorf("ParseRefresh() succeeded unexpectedly")
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package claimcheck offloads large payloads of Pub/Sub messages to an object store.
+//
+// Pub/Sub messages are limited to 10 MB, which full on_search catalogs of large sellers can exceed.
+// A payload above the threshold is stored in the object store and the message carries a reference to it
+// in the ReferenceAttribute, which the subscribers resolve to the payload.
+package claimcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/google/uuid"
+)
+
+// ReferenceAttribute is the message attribute of the reference to an offloaded payload.
+const ReferenceAttribute = "claim_check"
+
+// DefaultThreshold is the default size in bytes above which payloads are offloaded.
+//
+// It leaves room for the attributes within the 10 MB limit of Pub/Sub messages.
+const DefaultThreshold = 8 << 20
+
+// Store stores offloaded payloads by name.
+type Store interface {
+	Put(ctx context.Context, name string, payload []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+	Delete(ctx context.Context, name string) error
+	Close() error
+}
+
+// ClaimCheck offloads payloads above the threshold to the store.
+//
+// A nil ClaimCheck offloads no payloads, and fails to resolve offloaded payloads.
+type ClaimCheck struct {
+	store     Store
+	threshold int
+}
+
+// New creates a claim check storing payloads above the threshold in the store.
+func New(store Store, threshold int) *ClaimCheck {
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	return &ClaimCheck{store: store, threshold: threshold}
+}
+
+// Open creates a claim check of the store at the URL, either "gs://bucket/prefix" or "file:///directory".
+//
+// An empty URL disables offloading and returns nil.
+func Open(ctx context.Context, storeURL string, threshold int) (*ClaimCheck, error) {
+	if storeURL == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(storeURL)
+	if err != nil {
+		return nil, fmt.Errorf("open claim check store: %v", err)
+	}
+	var store Store
+	switch u.Scheme {
+	case "gs":
+		store, err = NewGCSStore(ctx, u.Host, u.Path)
+	case "file":
+		store, err = NewFileStore(u.Path)
+	default:
+		err = fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open claim check store %q: %v", storeURL, err)
+	}
+	return New(store, threshold), nil
+}
+
+// Close closes the store.
+func (c *ClaimCheck) Close() error {
+	if c == nil {
+		return nil
+	}
+	return c.store.Close()
+}
+
+// SetData sets the payload as the data of the message, or offloads it if it is above the threshold.
+func (c *ClaimCheck) SetData(ctx context.Context, msg *pubsub.Message, payload []byte) error {
+	if c == nil || len(payload) <= c.threshold {
+		msg.Data = payload
+		return nil
+	}
+
+	name := uuid.NewString()
+	if err := c.store.Put(ctx, name, payload); err != nil {
+		return fmt.Errorf("offload payload: %v", err)
+	}
+	if msg.Attributes == nil {
+		msg.Attributes = make(map[string]string)
+	}
+	msg.Attributes[ReferenceAttribute] = name
+	msg.Data = nil
+	return nil
+}
+
+// Data returns the payload of the message, which is read from the store if it is offloaded.
+func (c *ClaimCheck) Data(ctx context.Context, msg *pubsub.Message) ([]byte, error) {
+	name, ok := msg.Attributes[ReferenceAttribute]
+	if !ok {
+		return msg.Data, nil
+	}
+	if c == nil {
+		return nil, errors.New("resolve payload: the payload is offloaded, but no claim check store is configured")
+	}
+
+	payload, err := c.store.Get(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("resolve payload %q: %v", name, err)
+	}
+	return payload, nil
+}
+
+// Release deletes the offloaded payload of the message after the message is processed.
+func (c *ClaimCheck) Release(ctx context.Context, msg *pubsub.Message) error {
+	name, ok := msg.Attributes[ReferenceAttribute]
+	if !ok || c == nil {
+		return nil
+	}
+	if err := c.store.Delete(ctx, name); err != nil {
+		return fmt.Errorf("release payload %q: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package claimcheck
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+)
+
+func newTestClaimCheck(t *testing.T) (*ClaimCheck, string) {
+	t.Helper()
+	dir := t.TempDir()
+	c, err := Open(context.Background(), "file://"+dir, 10)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	return c, dir
+}
+
+func TestSmallPayload(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClaimCheck(t)
+
+	msg := &pubsub.Message{}
+	payload := []byte("small")
+	if err := c.SetData(ctx, msg, payload); err != nil {
+		t.Fatalf("SetData() failed: %v", err)
+	}
+	if _, ok := msg.Attributes[ReferenceAttribute]; ok {
+		t.Errorf("SetData() set %q attribute for a payload below the threshold", ReferenceAttribute)
+	}
+
+	got, err := c.Data(ctx, msg)
+	if err != nil {
+		t.Fatalf("Data() failed: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("Data() = %q, want %q", got, payload)
+	}
+}
+
+func TestLargePayload(t *testing.T) {
+	ctx := context.Background()
+	c, dir := newTestClaimCheck(t)
+
+	msg := &pubsub.Message{Attributes: map[string]string{"action": "on_search"}}
+	payload := []byte("a payload above the threshold")
+	if err := c.SetData(ctx, msg, payload); err != nil {
+		t.Fatalf("SetData() failed: %v", err)
+	}
+	if len(msg.Data) != 0 {
+		t.Errorf("SetData() message data = %q, want empty", msg.Data)
+	}
+	if msg.Attributes[ReferenceAttribute] == "" {
+		t.Fatalf("SetData() did not set %q attribute", ReferenceAttribute)
+	}
+	if got, want := msg.Attributes["action"], "on_search"; got != want {
+		t.Errorf("SetData() action attribute = %q, want %q", got, want)
+	}
+
+	got, err := c.Data(ctx, msg)
+	if err != nil {
+		t.Fatalf("Data() failed: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("Data() = %q, want %q", got, payload)
+	}
+
+	if err := c.Release(ctx, msg); err != nil {
+		t.Fatalf("Release() failed: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Release() left %d payloads in the store", len(entries))
+	}
+	if _, err := c.Data(ctx, msg); err == nil {
+		t.Errorf("Data() of a released payload succeeded unexpectedly")
+	}
+}
+
+func TestNilClaimCheck(t *testing.T) {
+	ctx := context.Background()
+	var c *ClaimCheck
+
+	msg := &pubsub.Message{}
+	payload := bytes.Repeat([]byte("a"), DefaultThreshold+1)
+	if err := c.SetData(ctx, msg, payload); err != nil {
+		t.Fatalf("SetData() failed: %v", err)
+	}
+	if !bytes.Equal(msg.Data, payload) {
+		t.Errorf("SetData() of nil claim check offloaded the payload")
+	}
+	if err := c.Release(ctx, msg); err != nil {
+		t.Errorf("Release() failed: %v", err)
+	}
+
+	offloaded := &pubsub.Message{Attributes: map[string]string{ReferenceAttribute: "name"}}
+	if _, err := c.Data(ctx, offloaded); err == nil {
+		t.Errorf("Data() of an offloaded payload with nil claim check succeeded unexpectedly")
+	}
+}
+
+func TestOpenFailed(t *testing.T) {
+	if _, err := Open(context.Background(), "s3://bucket", 0); err == nil {
+		t.Errorf("Open() with unsupported scheme succeeded unexpectedly")
+	}
+}
+
+func TestFileStoreInvalidName(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+	if _, err := s.Get(context.Background(), "../secret"); err == nil {
+		t.Errorf("Get() of a name outside the directory succeeded unexpectedly")
+	}
+}
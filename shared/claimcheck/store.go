@@ -0,0 +1,136 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package claimcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// GCSStore stores payloads as objects in a Cloud Storage bucket.
+type GCSStore struct {
+	client *storage.Client
+	bucket *storage.BucketHandle
+	prefix string
+}
+
+// NewGCSStore creates a store of the objects under the prefix in the bucket.
+func NewGCSStore(ctx context.Context, bucket, prefix string) (*GCSStore, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &GCSStore{
+		client: client,
+		bucket: client.Bucket(bucket),
+		prefix: strings.Trim(prefix, "/"),
+	}, nil
+}
+
+func (s *GCSStore) object(name string) *storage.ObjectHandle {
+	return s.bucket.Object(path.Join(s.prefix, name))
+}
+
+// Put writes the payload to the object of the name.
+func (s *GCSStore) Put(ctx context.Context, name string, payload []byte) error {
+	w := s.object(name).NewWriter(ctx)
+	w.ContentType = "application/json"
+	if _, err := w.Write(payload); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// Get reads the payload of the object of the name.
+func (s *GCSStore) Get(ctx context.Context, name string) ([]byte, error) {
+	r, err := s.object(name).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// Delete deletes the object of the name.
+func (s *GCSStore) Delete(ctx context.Context, name string) error {
+	return s.object(name).Delete(ctx)
+}
+
+// Close closes the Cloud Storage client.
+func (s *GCSStore) Close() error {
+	return s.client.Close()
+}
+
+// FileStore stores payloads as files in a directory of the local filesystem.
+//
+// It is meant for tests and local development, as the directory is not shared by the services.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a store of the files in the directory, creating the directory if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) {
+		return "", fmt.Errorf("invalid payload name %q", name)
+	}
+	return filepath.Join(s.dir, name), nil
+}
+
+// Put writes the payload to the file of the name.
+func (s *FileStore) Put(_ context.Context, name string, payload []byte) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, payload, 0o600)
+}
+
+// Get reads the payload of the file of the name.
+func (s *FileStore) Get(_ context.Context, name string) ([]byte, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+// Delete deletes the file of the name.
+func (s *FileStore) Delete(_ context.Context, name string) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+// Close does nothing.
+func (s *FileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,260 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package catalogclient provide a client for storing the seller catalog on Cloud Spanner.
+//
+// The catalog is pushed by the seller system and read for answering the searches of the buyer apps.
+// The providers are stored with their commit time, so the catalog updated in a time range can be read
+// for the incremental catalog refresh.
+package catalogclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+const (
+	catalogTable      = "Catalog"
+	providerTable     = "CatalogProvider"
+	subscriptionTable = "CatalogSubscription"
+
+	// catalogID is the key of the single row holding the BPP level details of the catalog.
+	catalogID = "bpp"
+)
+
+// ErrNotFound is returned when deleting a provider that does not exist.
+var ErrNotFound = errors.New("provider not found")
+
+// Client is a wrapper of Spanner Client for storing the seller catalog.
+type Client struct {
+	spannerClient *spanner.Client
+}
+
+// SubscriptionKey identifies the push mode subscription of a buyer app to the catalog updates of a domain and city.
+type SubscriptionKey struct {
+	SubscriberID string
+	Domain       string
+	City         string
+}
+
+func (k SubscriptionKey) spannerKey() spanner.Key {
+	return spanner.Key{k.SubscriberID, k.Domain, k.City}
+}
+
+// Subscription is a push mode subscription of a buyer app to the catalog updates.
+//
+// Request is the search starting the subscription. Its context and intent are used for the pushed on_search.
+type Subscription struct {
+	SubscriptionKey
+	Request json.RawMessage
+}
+
+// New creates a new catalog client.
+func New(ctx context.Context, projectID, instanceID, databaseID string, opts ...option.ClientOption) (*Client, error) {
+	database := fmt.Sprintf("projects/%s/instances/%s/databases/%s", projectID, instanceID, databaseID)
+	spannerClient, err := spanner.NewClient(ctx, database, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{spannerClient: spannerClient}, nil
+}
+
+// Close closes the underlying Spanner client.
+func (c *Client) Close() {
+	c.spannerClient.Close()
+}
+
+// Ping checks that the Spanner database is available.
+func (c *Client) Ping(ctx context.Context) error {
+	iter := c.spannerClient.Single().Query(ctx, spanner.Statement{SQL: "SELECT 1"})
+	defer iter.Stop()
+	if _, err := iter.Next(); err != nil {
+		return fmt.Errorf("ping spanner: %v", err)
+	}
+	return nil
+}
+
+// UpdateCatalog stores the catalog and returns the commit time.
+//
+// The providers replace the stored providers with the same IDs, and the others are kept.
+// The BPP level details replace the stored ones if the catalog has a BPP descriptor.
+func (c *Client) UpdateCatalog(ctx context.Context, catalog model.Catalog) (time.Time, error) {
+	mutations := make([]*spanner.Mutation, 0, len(catalog.BppProviders)+1)
+	for _, p := range catalog.BppProviders {
+		if p.ID == "" {
+			return time.Time{}, errors.New("update catalog: provider without ID")
+		}
+		mutations = append(mutations, spanner.InsertOrUpdateMap(providerTable, map[string]any{
+			"ProviderID": p.ID,
+			"Payload":    spanner.NullJSON{Value: p, Valid: true},
+			"UpdateTime": spanner.CommitTimestamp,
+		}))
+	}
+	if catalog.BppDescriptor != nil {
+		details := catalog
+		details.BppProviders = nil
+		mutations = append(mutations, spanner.InsertOrUpdateMap(catalogTable, map[string]any{
+			"CatalogID":  catalogID,
+			"Payload":    spanner.NullJSON{Value: details, Valid: true},
+			"UpdateTime": spanner.CommitTimestamp,
+		}))
+	}
+
+	commitTime, err := c.spannerClient.Apply(ctx, mutations)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("update catalog: %v", err)
+	}
+	return commitTime, nil
+}
+
+// DeleteProvider deletes the provider and its items from the catalog.
+func (c *Client) DeleteProvider(ctx context.Context, providerID string) error {
+	_, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		if _, err := txn.ReadRow(ctx, providerTable, spanner.Key{providerID}, []string{"ProviderID"}); err != nil {
+			return err
+		}
+		return txn.BufferWrite([]*spanner.Mutation{spanner.Delete(providerTable, spanner.Key{providerID})})
+	})
+	if spanner.ErrCode(err) == codes.NotFound {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("delete provider: %v", err)
+	}
+	return nil
+}
+
+// Catalog reads the catalog with the providers updated between since and until.
+//
+// A zero since or until leaves the range open on that side, so zero values of both read the full catalog.
+func (c *Client) Catalog(ctx context.Context, since, until time.Time) (model.Catalog, error) {
+	txn := c.spannerClient.ReadOnlyTransaction()
+	defer txn.Close()
+
+	var catalog model.Catalog
+	row, err := txn.ReadRow(ctx, catalogTable, spanner.Key{catalogID}, []string{"Payload"})
+	switch {
+	case spanner.ErrCode(err) == codes.NotFound:
+	case err != nil:
+		return model.Catalog{}, fmt.Errorf("read catalog: %v", err)
+	default:
+		if err := decodeJSON(row, &catalog); err != nil {
+			return model.Catalog{}, fmt.Errorf("read catalog: %v", err)
+		}
+	}
+
+	stmt := spanner.Statement{
+		SQL:    "SELECT Payload FROM CatalogProvider WHERE UpdateTime >= @since",
+		Params: map[string]any{"since": since},
+	}
+	if !until.IsZero() {
+		stmt.SQL += " AND UpdateTime <= @until"
+		stmt.Params["until"] = until
+	}
+	stmt.SQL += " ORDER BY ProviderID"
+
+	catalog.BppProviders = nil
+	iter := txn.Query(ctx, stmt)
+	defer iter.Stop()
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return model.Catalog{}, fmt.Errorf("read catalog: %v", err)
+		}
+		var p model.Provider
+		if err := decodeJSON(row, &p); err != nil {
+			return model.Catalog{}, fmt.Errorf("read catalog: %v", err)
+		}
+		catalog.BppProviders = append(catalog.BppProviders, p)
+	}
+	return catalog, nil
+}
+
+// Subscribe stores the push mode subscription, replacing the existing one with the same key.
+func (c *Client) Subscribe(ctx context.Context, sub Subscription) error {
+	_, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{spanner.InsertOrUpdateMap(subscriptionTable, map[string]any{
+		"SubscriberID": sub.SubscriberID,
+		"Domain":       sub.Domain,
+		"City":         sub.City,
+		"Request":      spanner.NullJSON{Value: sub.Request, Valid: true},
+		"CreateTime":   spanner.CommitTimestamp,
+	})})
+	if err != nil {
+		return fmt.Errorf("subscribe: %v", err)
+	}
+	return nil
+}
+
+// Unsubscribe deletes the push mode subscription. Deleting a missing subscription is not an error.
+func (c *Client) Unsubscribe(ctx context.Context, key SubscriptionKey) error {
+	if _, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{spanner.Delete(subscriptionTable, key.spannerKey())}); err != nil {
+		return fmt.Errorf("unsubscribe: %v", err)
+	}
+	return nil
+}
+
+// Subscriptions reads all the push mode subscriptions.
+func (c *Client) Subscriptions(ctx context.Context) ([]Subscription, error) {
+	iter := c.spannerClient.Single().Read(ctx, subscriptionTable, spanner.AllKeys(), []string{"SubscriberID", "Domain", "City", "Request"})
+	defer iter.Stop()
+
+	var subs []Subscription
+	err := iter.Do(func(row *spanner.Row) error {
+		var (
+			sub     Subscription
+			request spanner.NullJSON
+		)
+		if err := row.Columns(&sub.SubscriberID, &sub.Domain, &sub.City, &request); err != nil {
+			return err
+		}
+		// The JSON column is decoded into a generic value, so it is converted via JSON encoding.
+		var err error
+		if sub.Request, err = json.Marshal(request.Value); err != nil {
+			return err
+		}
+		subs = append(subs, sub)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read subscriptions: %v", err)
+	}
+	return subs, nil
+}
+
+// decodeJSON decodes the Payload column of the row into v.
+func decodeJSON(row *spanner.Row, v any) error {
+	var payload spanner.NullJSON
+	if err := row.Columns(&payload); err != nil {
+		return err
+	}
+	// The JSON column is decoded into a generic value, so it is converted via JSON encoding.
+	payloadJSON, err := json.Marshal(payload.Value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payloadJSON, v)
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package catalogclienttest provide a stub for catalogclient.Client
+package catalogclienttest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/catalogclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+type provider struct {
+	provider   model.Provider
+	updateTime time.Time
+}
+
+// Stub stubs catalogclient.Client with in-memory maps.
+//
+// The update time of the providers is the wall-clock time of UpdateCatalog.
+type Stub struct {
+	mu            sync.Mutex
+	details       model.Catalog
+	providers     map[string]provider
+	subscriptions map[catalogclient.SubscriptionKey]catalogclient.Subscription
+}
+
+// NewStub creates a new stub with the given catalog.
+func NewStub(catalog model.Catalog) *Stub {
+	s := &Stub{
+		providers:     make(map[string]provider),
+		subscriptions: make(map[catalogclient.SubscriptionKey]catalogclient.Subscription),
+	}
+	s.UpdateCatalog(context.Background(), catalog)
+	return s
+}
+
+// UpdateCatalog stores the providers and the BPP level details of the catalog.
+func (s *Stub) UpdateCatalog(_ context.Context, catalog model.Catalog) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, p := range catalog.BppProviders {
+		s.providers[p.ID] = provider{provider: p, updateTime: now}
+	}
+	if catalog.BppDescriptor != nil {
+		s.details = catalog
+		s.details.BppProviders = nil
+	}
+	return now, nil
+}
+
+// DeleteProvider deletes the stored provider or returns catalogclient.ErrNotFound.
+func (s *Stub) DeleteProvider(_ context.Context, providerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.providers[providerID]; !ok {
+		return catalogclient.ErrNotFound
+	}
+	delete(s.providers, providerID)
+	return nil
+}
+
+// Catalog returns the catalog with the providers updated between since and until.
+func (s *Stub) Catalog(_ context.Context, since, until time.Time) (model.Catalog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	catalog := s.details
+	for _, p := range s.providers {
+		if p.updateTime.Before(since) || !until.IsZero() && p.updateTime.After(until) {
+			continue
+		}
+		catalog.BppProviders = append(catalog.BppProviders, p.provider)
+	}
+	sort.Slice(catalog.BppProviders, func(i, j int) bool { return catalog.BppProviders[i].ID < catalog.BppProviders[j].ID })
+	return catalog, nil
+}
+
+// Subscribe stores the subscription.
+func (s *Stub) Subscribe(_ context.Context, sub catalogclient.Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscriptions[sub.SubscriptionKey] = sub
+	return nil
+}
+
+// Unsubscribe deletes the subscription.
+func (s *Stub) Unsubscribe(_ context.Context, key catalogclient.SubscriptionKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.subscriptions, key)
+	return nil
+}
+
+// Subscriptions returns the stored subscriptions.
+func (s *Stub) Subscriptions(context.Context) ([]catalogclient.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := make([]catalogclient.Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// Ping always succeeds.
+func (s *Stub) Ping(context.Context) error {
+	return nil
+}
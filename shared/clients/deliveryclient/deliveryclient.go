@@ -0,0 +1,117 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package deliveryclient provide a client for the log of the callback deliveries to the buyer app on Cloud Spanner.
+//
+// The buyer app reconciles the callbacks it received with the log, e.g. for the callbacks failing after all retries.
+// The deliveries are deleted 7 days after their last attempt.
+package deliveryclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/option"
+)
+
+const deliveryTable = "WebhookDelivery"
+
+// columns are the columns of the delivery table in the order of the fields of Delivery.
+var columns = []string{"TransactionID", "DeliveryID", "MessageID", "Action", "URL", "Attempts", "StatusCode", "Error", "Delivered", "UpdateTime"}
+
+// Delivery is the outcome of the delivery of a callback.
+type Delivery struct {
+	TransactionID string `json:"transaction_id"`
+	// DeliveryID is the ID of the Pub/Sub message of the callback, which is sent in the delivery ID header.
+	DeliveryID string `json:"delivery_id"`
+	MessageID  string `json:"message_id"`
+	Action     string `json:"action"`
+	URL        string `json:"url"`
+	Attempts   int64  `json:"attempts"`
+	// StatusCode is the status of the last response, zero if no response was received.
+	StatusCode int64 `json:"status_code,omitempty"`
+	// Error is the error of the last attempt of a failed delivery.
+	Error     string `json:"error,omitempty"`
+	Delivered bool   `json:"delivered"`
+	// UpdateTime is the commit time of the delivery, set by the client.
+	UpdateTime time.Time `json:"update_time"`
+}
+
+// Client is a wrapper of Spanner Client for storing the deliveries.
+type Client struct {
+	spannerClient *spanner.Client
+}
+
+// New creates a new delivery client.
+func New(ctx context.Context, projectID, instanceID, databaseID string, opts ...option.ClientOption) (*Client, error) {
+	database := fmt.Sprintf("projects/%s/instances/%s/databases/%s", projectID, instanceID, databaseID)
+	spannerClient, err := spanner.NewClient(ctx, database, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{spannerClient: spannerClient}, nil
+}
+
+// Close closes the underlying Spanner client.
+func (c *Client) Close() {
+	c.spannerClient.Close()
+}
+
+// Ping checks that the Spanner database is available.
+func (c *Client) Ping(ctx context.Context) error {
+	iter := c.spannerClient.Single().Query(ctx, spanner.Statement{SQL: "SELECT 1"})
+	defer iter.Stop()
+	if _, err := iter.Next(); err != nil {
+		return fmt.Errorf("ping spanner: %v", err)
+	}
+	return nil
+}
+
+// RecordDelivery stores the delivery, replacing the stored one of the same callback.
+func (c *Client) RecordDelivery(ctx context.Context, d Delivery) error {
+	_, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{spanner.InsertOrUpdate(deliveryTable, columns, []any{
+		d.TransactionID, d.DeliveryID, d.MessageID, d.Action, d.URL, d.Attempts, d.StatusCode, d.Error, d.Delivered, spanner.CommitTimestamp,
+	})})
+	if err != nil {
+		return fmt.Errorf("record delivery: %v", err)
+	}
+	return nil
+}
+
+// Deliveries reads the deliveries of the callbacks of the transaction in the order of their update time.
+func (c *Client) Deliveries(ctx context.Context, transactionID string) ([]Delivery, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT TransactionID, DeliveryID, MessageID, Action, URL, Attempts, StatusCode, Error, Delivered, UpdateTime
+		      FROM WebhookDelivery WHERE TransactionID = @transactionID ORDER BY UpdateTime`,
+		Params: map[string]any{"transactionID": transactionID},
+	}
+	iter := c.spannerClient.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var deliveries []Delivery
+	err := iter.Do(func(row *spanner.Row) error {
+		var d Delivery
+		if err := row.Columns(&d.TransactionID, &d.DeliveryID, &d.MessageID, &d.Action, &d.URL, &d.Attempts, &d.StatusCode, &d.Error, &d.Delivered, &d.UpdateTime); err != nil {
+			return err
+		}
+		deliveries = append(deliveries, d)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read deliveries: %v", err)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package deliveryclienttest provide a stub for deliveryclient.Client
+package deliveryclienttest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/deliveryclient"
+)
+
+// Stub stubs deliveryclient.Client with an in-memory slice.
+//
+// The update time of the deliveries is the wall-clock time of RecordDelivery.
+type Stub struct {
+	mu         sync.Mutex
+	deliveries []deliveryclient.Delivery
+}
+
+// NewStub creates a new stub without deliveries.
+func NewStub() *Stub {
+	return &Stub{}
+}
+
+// RecordDelivery stores the delivery, replacing the stored one with the same delivery ID.
+func (s *Stub) RecordDelivery(_ context.Context, d deliveryclient.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d.UpdateTime = time.Now()
+	for i, stored := range s.deliveries {
+		if stored.TransactionID == d.TransactionID && stored.DeliveryID == d.DeliveryID {
+			s.deliveries = append(s.deliveries[:i], s.deliveries[i+1:]...)
+			break
+		}
+	}
+	s.deliveries = append(s.deliveries, d)
+	return nil
+}
+
+// Deliveries returns the deliveries of the transaction in the order they were recorded.
+func (s *Stub) Deliveries(_ context.Context, transactionID string) ([]deliveryclient.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deliveries []deliveryclient.Delivery
+	for _, d := range s.deliveries {
+		if d.TransactionID == transactionID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+// Ping always succeeds.
+func (s *Stub) Ping(context.Context) error {
+	return nil
+}
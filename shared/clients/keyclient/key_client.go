@@ -71,6 +71,26 @@ func (c *SecretManagerKeyClient) ServiceEncryptionPrivateKey(ctx context.Context
 	return result["encryptionKey"]["privateKeyEncryption"], nil
 }
 
+// WebhookSigningKey provides the HMAC key signing the callbacks to the buyer app.
+//
+// Unlike the service keys, the whole secret payload is the key.
+func (c *SecretManagerKeyClient) WebhookSigningKey(ctx context.Context) ([]byte, error) {
+	return c.Secret(ctx, c.secretID)
+}
+
+// Secret provides the payload of the latest version of another secret of the project,
+// e.g. the credentials of an external system.
+func (c *SecretManagerKeyClient) Secret(ctx context.Context, secretID string) ([]byte, error) {
+	req := &smpb.AccessSecretVersionRequest{
+		Name: fmt.Sprintf("projects/%s/secrets/%s/versions/latest", c.projectID, secretID),
+	}
+	data, err := c.secretClient.AccessSecretVersion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return data.Payload.Data, nil
+}
+
 // AddKey adds a new secret version to a given secret ID with a given payload.
 func (c *SecretManagerKeyClient) AddKey(ctx context.Context, secretID string, payload []byte) error {
 	request := &smpb.AddSecretVersionRequest{
@@ -83,6 +103,22 @@ func (c *SecretManagerKeyClient) AddKey(ctx context.Context, secretID string, pa
 	return err
 }
 
+// SecretPayload creates a secret payload in the format read by SecretManagerKeyClient.
+func SecretPayload(encryptionPrivateKey, encryptionPublicKey, encryptionPublicKeyDER, signingKeyset, signingPublicKey []byte) ([]byte, error) {
+	payload := map[string]map[string][]byte{
+		"encryptionKey": {
+			"privateKeyEncryption":   encryptionPrivateKey,
+			"publicKeyEncryption":    encryptionPublicKey,
+			"publicKeyEncryptionDER": encryptionPublicKeyDER,
+		},
+		"signingKey": {
+			"signingKeySet":    signingKeyset,
+			"publicKeySigning": signingPublicKey,
+		},
+	}
+	return json.Marshal(payload)
+}
+
 func (c *SecretManagerKeyClient) readSecret(ctx context.Context) (map[string]map[string][]byte, error) {
 	req := &smpb.AccessSecretVersionRequest{
 		Name: fmt.Sprintf("projects/%s/secrets/%s/versions/latest", c.projectID, c.secretID),
@@ -17,6 +17,7 @@ package keyclienttest
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/crypto"
@@ -28,6 +29,8 @@ type Stub struct {
 	serviceSigningPrivateKeyset []byte
 	serviceEncryptionPrivateKey []byte
 	registryEncryptionPublicKey []byte
+	webhookSigningKey           []byte
+	secrets                     map[string][]byte
 }
 
 // NewStub creates a new Stub with newly generated keys.
@@ -53,6 +56,8 @@ func NewStub(t *testing.T) *Stub {
 		serviceSigningPrivateKeyset: keyset,
 		serviceEncryptionPrivateKey: privateKey,
 		registryEncryptionPublicKey: publicKey,
+		webhookSigningKey:           []byte("webhook-signing-key"),
+		secrets:                     make(map[string][]byte),
 	}
 }
 
@@ -88,5 +93,24 @@ func (s *Stub) RegistryEncryptionPublicKey(context.Context) ([]byte, error) {
 	return s.registryEncryptionPublicKey, nil
 }
 
+// WebhookSigningKey returns the key stored in the stub.
+func (s *Stub) WebhookSigningKey(context.Context) ([]byte, error) {
+	return s.webhookSigningKey, nil
+}
+
+// SetSecret stores the payload of the secret.
+func (s *Stub) SetSecret(secretID string, payload []byte) {
+	s.secrets[secretID] = payload
+}
+
+// Secret returns the payload stored by SetSecret, or an error if there is none.
+func (s *Stub) Secret(_ context.Context, secretID string) ([]byte, error) {
+	payload, ok := s.secrets[secretID]
+	if !ok {
+		return nil, fmt.Errorf("secret %q not found", secretID)
+	}
+	return payload, nil
+}
+
 // AddKey does nothing and return no error.
 func (s *Stub) AddKey(context.Context, string, []byte) error { return nil }
@@ -0,0 +1,165 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pendingclient provide a client for storing the requests pending in the seller system on Cloud Spanner.
+//
+// The seller system may accept a request with 202 Accepted and post its callback later. The request is pending until
+// the callback is posted, or until it expires and an error callback is sent in place of the seller system.
+package pendingclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+)
+
+const pendingRequestTable = "PendingRequest"
+
+// ErrNotFound is returned when taking a request that is not pending.
+var ErrNotFound = errors.New("pending request not found")
+
+// Request is a request pending in the seller system.
+type Request struct {
+	MessageID     string
+	Action        string
+	TransactionID string
+	// Payload is the request sent to the seller system.
+	Payload    json.RawMessage
+	ExpireTime time.Time
+}
+
+// Client is a wrapper of Spanner Client for storing the pending requests.
+type Client struct {
+	spannerClient *spanner.Client
+}
+
+// New creates a new pending request client.
+func New(ctx context.Context, projectID, instanceID, databaseID string, opts ...option.ClientOption) (*Client, error) {
+	database := fmt.Sprintf("projects/%s/instances/%s/databases/%s", projectID, instanceID, databaseID)
+	spannerClient, err := spanner.NewClient(ctx, database, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{spannerClient: spannerClient}, nil
+}
+
+// Close closes the underlying Spanner client.
+func (c *Client) Close() {
+	c.spannerClient.Close()
+}
+
+// Ping checks that the Spanner database is available.
+func (c *Client) Ping(ctx context.Context) error {
+	iter := c.spannerClient.Single().Query(ctx, spanner.Statement{SQL: "SELECT 1"})
+	defer iter.Stop()
+	if _, err := iter.Next(); err != nil {
+		return fmt.Errorf("ping spanner: %v", err)
+	}
+	return nil
+}
+
+// Add stores the pending request, replacing the one with the same message ID and action.
+func (c *Client) Add(ctx context.Context, req Request) error {
+	_, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{spanner.InsertOrUpdateMap(pendingRequestTable, map[string]any{
+		"MessageID":     req.MessageID,
+		"Action":        req.Action,
+		"TransactionID": req.TransactionID,
+		"Payload":       spanner.NullJSON{Value: req.Payload, Valid: true},
+		"ExpireTime":    req.ExpireTime,
+		"CreateTime":    spanner.CommitTimestamp,
+	})})
+	if err != nil {
+		return fmt.Errorf("add pending request: %v", err)
+	}
+	return nil
+}
+
+// Take deletes and returns the pending request, or returns ErrNotFound.
+//
+// Only one of the concurrent calls takes the request, so its callback is published once.
+func (c *Client) Take(ctx context.Context, messageID, action string) (Request, error) {
+	var req Request
+	_, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		row, err := txn.ReadRow(ctx, pendingRequestTable, spanner.Key{messageID, action}, []string{"MessageID", "Action", "TransactionID", "Payload", "ExpireTime"})
+		if err != nil {
+			return err
+		}
+		if req, err = decodeRequest(row); err != nil {
+			return err
+		}
+		return txn.BufferWrite([]*spanner.Mutation{spanner.Delete(pendingRequestTable, spanner.Key{messageID, action})})
+	})
+	if spanner.ErrCode(err) == codes.NotFound {
+		return Request{}, ErrNotFound
+	}
+	if err != nil {
+		return Request{}, fmt.Errorf("take pending request: %v", err)
+	}
+	return req, nil
+}
+
+// TakeExpired deletes and returns up to limit requests which expired at now.
+func (c *Client) TakeExpired(ctx context.Context, now time.Time, limit int) ([]Request, error) {
+	var reqs []Request
+	_, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		// The transaction may be retried, so the requests of a previous attempt are dropped.
+		reqs = nil
+		stmt := spanner.Statement{
+			SQL: `SELECT MessageID, Action, TransactionID, Payload, ExpireTime FROM PendingRequest@{FORCE_INDEX=PendingRequestByExpireTime}
+			      WHERE ExpireTime <= @now ORDER BY ExpireTime LIMIT @limit`,
+			Params: map[string]any{"now": now, "limit": limit},
+		}
+		mutations := make([]*spanner.Mutation, 0, limit)
+		err := txn.Query(ctx, stmt).Do(func(row *spanner.Row) error {
+			req, err := decodeRequest(row)
+			if err != nil {
+				return err
+			}
+			reqs = append(reqs, req)
+			mutations = append(mutations, spanner.Delete(pendingRequestTable, spanner.Key{req.MessageID, req.Action}))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return txn.BufferWrite(mutations)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("take expired requests: %v", err)
+	}
+	return reqs, nil
+}
+
+// decodeRequest decodes the MessageID, Action, TransactionID, Payload and ExpireTime columns of the row.
+func decodeRequest(row *spanner.Row) (Request, error) {
+	var (
+		req     Request
+		payload spanner.NullJSON
+	)
+	if err := row.Columns(&req.MessageID, &req.Action, &req.TransactionID, &payload, &req.ExpireTime); err != nil {
+		return Request{}, err
+	}
+	// The JSON column is decoded into a generic value, so it is converted via JSON encoding.
+	var err error
+	if req.Payload, err = json.Marshal(payload.Value); err != nil {
+		return Request{}, err
+	}
+	return req, nil
+}
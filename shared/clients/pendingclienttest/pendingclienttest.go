@@ -0,0 +1,101 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pendingclienttest provide a stub for pendingclient.Client
+package pendingclienttest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/pendingclient"
+)
+
+type key struct {
+	messageID, action string
+}
+
+// Stub stubs pendingclient.Client with an in-memory map.
+type Stub struct {
+	mu       sync.Mutex
+	requests map[key]pendingclient.Request
+}
+
+// NewStub creates a new stub without pending requests.
+func NewStub() *Stub {
+	return &Stub{requests: make(map[key]pendingclient.Request)}
+}
+
+// Add stores the pending request, replacing the one with the same message ID and action.
+func (s *Stub) Add(_ context.Context, req pendingclient.Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests[key{req.MessageID, req.Action}] = req
+	return nil
+}
+
+// Take deletes and returns the pending request, or returns pendingclient.ErrNotFound.
+func (s *Stub) Take(_ context.Context, messageID, action string) (pendingclient.Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, ok := s.requests[key{messageID, action}]
+	if !ok {
+		return pendingclient.Request{}, pendingclient.ErrNotFound
+	}
+	delete(s.requests, key{messageID, action})
+	return req, nil
+}
+
+// TakeExpired deletes and returns up to limit requests which expired at now, in the order of their expiry.
+func (s *Stub) TakeExpired(_ context.Context, now time.Time, limit int) ([]pendingclient.Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reqs []pendingclient.Request
+	for _, req := range s.requests {
+		if !req.ExpireTime.After(now) {
+			reqs = append(reqs, req)
+		}
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].ExpireTime.Before(reqs[j].ExpireTime) })
+	if len(reqs) > limit {
+		reqs = reqs[:limit]
+	}
+	for _, req := range reqs {
+		delete(s.requests, key{req.MessageID, req.Action})
+	}
+	return reqs, nil
+}
+
+// Requests returns the pending requests in the order of their message IDs.
+func (s *Stub) Requests() []pendingclient.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reqs := make([]pendingclient.Request, 0, len(s.requests))
+	for _, req := range s.requests {
+		reqs = append(reqs, req)
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].MessageID < reqs[j].MessageID })
+	return reqs
+}
+
+// Ping always succeeds.
+func (s *Stub) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,272 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package registrationclient provide a client for storing ONDC registration details on Cloud Spanner.
+package registrationclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registryclient"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/registry"
+)
+
+const tableName = "Registration"
+
+var (
+	// ErrNotFound is returned when the registration does not exist.
+	ErrNotFound = errors.New("registration not found")
+
+	// ErrAlreadyExists is returned when creating a registration with an existing ID.
+	ErrAlreadyExists = errors.New("registration already exists")
+
+	validate = model.Validator()
+
+	columns = []string{
+		"RegistrationID",
+		"ONDCEnvironment",
+		"ONDCRegistryURL",
+		"EntityName",
+		"BusinessAddress",
+		"GSTDetails",
+		"PANNo",
+		"AddressSignatory",
+		"EmailID",
+		"MobileNumber",
+		"DomainsEnabled",
+		"AppType",
+		"SubscriberID",
+		"SubscriberURL",
+		"CreationTime",
+		"LastModifiedTime",
+		"CreationBy",
+		"LastModifiedBy",
+		"AdditionalData",
+	}
+)
+
+// Client is a wrapper of Spanner Client for storing ONDC registration details.
+type Client struct {
+	spannerClient *spanner.Client
+}
+
+// Registration represents a row of the Registration table.
+type Registration struct {
+	// ID is also used as the request ID of the /subscribe API and the site verification page.
+	ID              string `json:"registrationID" validate:"required,max=35"`
+	ONDCEnvironment string `json:"ONDCEnvironment" validate:"required,oneof=staging pre-production production"`
+	ONDCRegistryURL string `json:"ONDCRegistryURL" validate:"required,url"`
+
+	EntityName       string   `json:"entityName" validate:"required"`
+	BusinessAddress  string   `json:"businessAddress" validate:"required"`
+	GSTDetails       string   `json:"GSTDetails" validate:"required"`
+	PANNo            string   `json:"PANNo" validate:"required"`
+	AddressSignatory string   `json:"addressSignatory" validate:"required"`
+	EmailID          string   `json:"emailID" validate:"required,email"`
+	MobileNumber     string   `json:"mobileNumber" validate:"required,max=15"`
+	DomainsEnabled   []string `json:"domainsEnabled" validate:"required,min=1"`
+
+	// AppType is one of buyer, seller, msn and logistics.
+	AppType       string `json:"appType" validate:"required,oneof=buyer seller msn logistics"`
+	SubscriberID  string `json:"subscriberID" validate:"required"`
+	SubscriberURL string `json:"subscriberURL" validate:"required"`
+
+	AdditionalData AdditionalData `json:"additionalData"`
+
+	// Output only.
+	CreationTime     time.Time `json:"creationTime"`
+	LastModifiedTime time.Time `json:"lastModifiedTime"`
+
+	CreationBy     string `json:"creationBy"`
+	LastModifiedBy string `json:"lastModifiedBy"`
+}
+
+// AdditionalData contains details required by the /subscribe API that have no column in the Registration table.
+type AdditionalData struct {
+	NameOfAuthorisedSignatory string `json:"nameOfAuthorisedSignatory" validate:"required"`
+	NameAsPerPAN              string `json:"nameAsPerPAN" validate:"required"`
+
+	// DD/MM/YYYY format
+	DateOfIncorporation string `json:"dateOfIncorporation" validate:"required"`
+
+	// Country code as per ISO 3166-1 and ISO 3166-2 format
+	Country string `json:"country" validate:"required"`
+
+	// CallbackURL is the path of /on_subscribe API relative to the subscriber ID.
+	CallbackURL string   `json:"callbackURL" validate:"required"`
+	CityCodes   []string `json:"cityCodes" validate:"required,min=1"`
+}
+
+// Validate validates the registration details.
+func (r Registration) Validate() error {
+	return validate.Struct(r)
+}
+
+// SubscribeParams returns the parameters of /subscribe API for registering the given key pair.
+func (r Registration) SubscribeParams(keyPair *registry.KeyPair, uniqueKeyID string) registryclient.SubscribeParams {
+	return registryclient.SubscribeParams{
+		Role:      r.AppType,
+		RequestID: r.ID,
+		Entity: registry.Entity{
+			GST: &registry.EntityGst{
+				LegalEntityName: r.EntityName,
+				BusinessAddress: r.BusinessAddress,
+				CityCode:        r.AdditionalData.CityCodes,
+				GSTNo:           r.GSTDetails,
+			},
+			PAN: &registry.EntityPAN{
+				NameAsPerPAN:        r.AdditionalData.NameAsPerPAN,
+				PANNo:               r.PANNo,
+				DateOfIncorporation: r.AdditionalData.DateOfIncorporation,
+			},
+			NameOfAuthorisedSignatory:    r.AdditionalData.NameOfAuthorisedSignatory,
+			AddressOfAuthorisedSignatory: r.AddressSignatory,
+			EmailID:                      r.EmailID,
+			MobileNo:                     r.MobileNumber,
+			Country:                      r.AdditionalData.Country,
+			SubscriberID:                 r.SubscriberID,
+			UniqueKeyID:                  uniqueKeyID,
+			CallbackURL:                  r.AdditionalData.CallbackURL,
+			KeyPair:                      keyPair,
+		},
+		SubscriberURL: r.SubscriberURL,
+		Domains:       r.DomainsEnabled,
+		CityCodes:     r.AdditionalData.CityCodes,
+	}
+}
+
+// New creates a new registration client.
+func New(ctx context.Context, projectID, instanceID, databaseID string, opts ...option.ClientOption) (*Client, error) {
+	database := fmt.Sprintf("projects/%s/instances/%s/databases/%s", projectID, instanceID, databaseID)
+	spannerClient, err := spanner.NewClient(ctx, database, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{spannerClient: spannerClient}, nil
+}
+
+// Close closes the underlying Spanner client.
+func (c *Client) Close() {
+	c.spannerClient.Close()
+}
+
+// Registration reads the registration with the given ID.
+func (c *Client) Registration(ctx context.Context, id string) (Registration, error) {
+	row, err := c.spannerClient.Single().ReadRow(ctx, tableName, spanner.Key{id}, columns)
+	if spanner.ErrCode(err) == codes.NotFound {
+		return Registration{}, ErrNotFound
+	}
+	if err != nil {
+		return Registration{}, fmt.Errorf("read registration: %v", err)
+	}
+
+	var (
+		r                          Registration
+		domains                    string
+		creationTime, modifiedTime spanner.NullTime
+		creationBy, modifiedBy     spanner.NullString
+		additionalData             spanner.NullJSON
+	)
+	if err := row.Columns(&r.ID, &r.ONDCEnvironment, &r.ONDCRegistryURL, &r.EntityName, &r.BusinessAddress,
+		&r.GSTDetails, &r.PANNo, &r.AddressSignatory, &r.EmailID, &r.MobileNumber, &domains, &r.AppType,
+		&r.SubscriberID, &r.SubscriberURL, &creationTime, &modifiedTime, &creationBy, &modifiedBy, &additionalData); err != nil {
+		return Registration{}, fmt.Errorf("read registration: %v", err)
+	}
+
+	r.DomainsEnabled = strings.Split(domains, ",")
+	r.CreationTime = creationTime.Time
+	r.LastModifiedTime = modifiedTime.Time
+	r.CreationBy = creationBy.StringVal
+	r.LastModifiedBy = modifiedBy.StringVal
+	if additionalData.Valid {
+		// The JSON column is decoded into a generic value, so it is converted via JSON encoding.
+		additionalDataJSON, err := json.Marshal(additionalData.Value)
+		if err != nil {
+			return Registration{}, fmt.Errorf("read registration: %v", err)
+		}
+		if err := json.Unmarshal(additionalDataJSON, &r.AdditionalData); err != nil {
+			return Registration{}, fmt.Errorf("read registration: invalid additional data: %v", err)
+		}
+	}
+	return r, nil
+}
+
+// CreateRegistration inserts a new registration in the Spanner table.
+func (c *Client) CreateRegistration(ctx context.Context, r Registration) error {
+	if err := r.Validate(); err != nil {
+		return fmt.Errorf("create registration: %v", err)
+	}
+
+	values := r.values()
+	values["CreationBy"] = r.CreationBy
+	values["LastModifiedBy"] = r.CreationBy
+	_, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{spanner.InsertMap(tableName, values)})
+	if spanner.ErrCode(err) == codes.AlreadyExists {
+		return ErrAlreadyExists
+	}
+	if err != nil {
+		return fmt.Errorf("create registration: %v", err)
+	}
+	return nil
+}
+
+// UpdateRegistration updates an existing registration in the Spanner table.
+func (c *Client) UpdateRegistration(ctx context.Context, r Registration) error {
+	if err := r.Validate(); err != nil {
+		return fmt.Errorf("update registration: %v", err)
+	}
+
+	values := r.values()
+	values["LastModifiedBy"] = r.LastModifiedBy
+	_, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{spanner.UpdateMap(tableName, values)})
+	if spanner.ErrCode(err) == codes.NotFound {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("update registration: %v", err)
+	}
+	return nil
+}
+
+// values returns the column values of the registration, except the creation details.
+func (r Registration) values() map[string]any {
+	return map[string]any{
+		"RegistrationID":   r.ID,
+		"ONDCEnvironment":  r.ONDCEnvironment,
+		"ONDCRegistryURL":  r.ONDCRegistryURL,
+		"EntityName":       r.EntityName,
+		"BusinessAddress":  r.BusinessAddress,
+		"GSTDetails":       r.GSTDetails,
+		"PANNo":            r.PANNo,
+		"AddressSignatory": r.AddressSignatory,
+		"EmailID":          r.EmailID,
+		"MobileNumber":     r.MobileNumber,
+		"DomainsEnabled":   strings.Join(r.DomainsEnabled, ","),
+		"AppType":          r.AppType,
+		"SubscriberID":     r.SubscriberID,
+		"SubscriberURL":    r.SubscriberURL,
+		"LastModifiedTime": spanner.CommitTimestamp,
+		"AdditionalData":   spanner.NullJSON{Value: r.AdditionalData, Valid: true},
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registrationclient
+
+import (
+	"testing"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/registry"
+)
+
+func exampleRegistration() Registration {
+	return Registration{
+		ID:               "registration-id",
+		ONDCEnvironment:  "staging",
+		ONDCRegistryURL:  "https://staging.registry.ondc.org",
+		EntityName:       "Open Commerce Ltd",
+		BusinessAddress:  "Bengaluru, Karnataka",
+		GSTDetails:       "29AAAAA0000A1Z5",
+		PANNo:            "AAAAA0000A",
+		AddressSignatory: "Bengaluru, Karnataka",
+		EmailID:          "ondc@example.com",
+		MobileNumber:     "9999999999",
+		DomainsEnabled:   []string{"ONDC:RET10", "ONDC:RET11"},
+		AppType:          "buyer",
+		SubscriberID:     "example.com",
+		SubscriberURL:    "/buyer/bap",
+		AdditionalData: AdditionalData{
+			NameOfAuthorisedSignatory: "Jane Doe",
+			NameAsPerPAN:              "Open Commerce Ltd",
+			DateOfIncorporation:       "01/01/2020",
+			Country:                   "IND",
+			CallbackURL:               "/onboarding",
+			CityCodes:                 []string{"std:080"},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := exampleRegistration().Validate(); err != nil {
+		t.Errorf("Validate() failed: %v", err)
+	}
+}
+
+func TestValidateFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Registration)
+	}{
+		{
+			name:   "ID longer than the column",
+			modify: func(r *Registration) { r.ID = "123e4567-e89b-12d3-a456-426614174000" },
+		},
+		{
+			name:   "unknown app type",
+			modify: func(r *Registration) { r.AppType = "gateway" },
+		},
+		{
+			name:   "no domain",
+			modify: func(r *Registration) { r.DomainsEnabled = nil },
+		},
+		{
+			name:   "no city code",
+			modify: func(r *Registration) { r.AdditionalData.CityCodes = nil },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := exampleRegistration()
+			test.modify(&r)
+			if err := r.Validate(); err == nil {
+				t.Errorf("Validate() succeeded unexpectedly")
+			}
+		})
+	}
+}
+
+func TestSubscribeParams(t *testing.T) {
+	r := exampleRegistration()
+	keyPair := &registry.KeyPair{SigningPublicKey: "signing-key"}
+
+	params := r.SubscribeParams(keyPair, "unique-key-id")
+
+	if got, want := params.RequestID, r.ID; got != want {
+		t.Errorf("SubscribeParams() request ID = %q, want %q", got, want)
+	}
+	if got, want := params.Role, r.AppType; got != want {
+		t.Errorf("SubscribeParams() role = %q, want %q", got, want)
+	}
+	if got, want := params.Entity.GST.GSTNo, r.GSTDetails; got != want {
+		t.Errorf("SubscribeParams() GST no = %q, want %q", got, want)
+	}
+	if got, want := params.Entity.PAN.PANNo, r.PANNo; got != want {
+		t.Errorf("SubscribeParams() PAN no = %q, want %q", got, want)
+	}
+	if got, want := params.Entity.UniqueKeyID, "unique-key-id"; got != want {
+		t.Errorf("SubscribeParams() unique key ID = %q, want %q", got, want)
+	}
+	if params.Entity.KeyPair != keyPair {
+		t.Errorf("SubscribeParams() key pair = %v, want %v", params.Entity.KeyPair, keyPair)
+	}
+	if got, want := len(params.Domains), len(r.DomainsEnabled); got != want {
+		t.Errorf("SubscribeParams() has %d domains, want %d", got, want)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package registrationclienttest provide a stub for registrationclient.Client
+package registrationclienttest
+
+import (
+	"context"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registrationclient"
+)
+
+// Stub stubs registrationclient.Client with an in-memory map.
+type Stub struct {
+	registrations map[string]registrationclient.Registration
+}
+
+// NewStub creates a new stub with the given registrations.
+func NewStub(registrations ...registrationclient.Registration) *Stub {
+	s := &Stub{registrations: make(map[string]registrationclient.Registration)}
+	for _, r := range registrations {
+		s.registrations[r.ID] = r
+	}
+	return s
+}
+
+// Registration returns the stored registration or registrationclient.ErrNotFound.
+func (s *Stub) Registration(_ context.Context, id string) (registrationclient.Registration, error) {
+	r, ok := s.registrations[id]
+	if !ok {
+		return registrationclient.Registration{}, registrationclient.ErrNotFound
+	}
+	return r, nil
+}
+
+// CreateRegistration stores the registration or returns registrationclient.ErrAlreadyExists.
+func (s *Stub) CreateRegistration(_ context.Context, r registrationclient.Registration) error {
+	if _, ok := s.registrations[r.ID]; ok {
+		return registrationclient.ErrAlreadyExists
+	}
+	s.registrations[r.ID] = r
+	return nil
+}
+
+// UpdateRegistration replaces the stored registration or returns registrationclient.ErrNotFound.
+func (s *Stub) UpdateRegistration(_ context.Context, r registrationclient.Registration) error {
+	if _, ok := s.registrations[r.ID]; !ok {
+		return registrationclient.ErrNotFound
+	}
+	s.registrations[r.ID] = r
+	return nil
+}
+
+// Example returns a valid registration with the given ID.
+func Example(id string) registrationclient.Registration {
+	return registrationclient.Registration{
+		ID:               id,
+		ONDCEnvironment:  "staging",
+		ONDCRegistryURL:  "https://staging.registry.ondc.org",
+		EntityName:       "Open Commerce Ltd",
+		BusinessAddress:  "Bengaluru, Karnataka",
+		GSTDetails:       "29AAAAA0000A1Z5",
+		PANNo:            "AAAAA0000A",
+		AddressSignatory: "Bengaluru, Karnataka",
+		EmailID:          "ondc@example.com",
+		MobileNumber:     "9999999999",
+		DomainsEnabled:   []string{"ONDC:RET10"},
+		AppType:          "seller",
+		SubscriberID:     "example.com",
+		SubscriberURL:    "/seller/bpp",
+		AdditionalData: registrationclient.AdditionalData{
+			NameOfAuthorisedSignatory: "Jane Doe",
+			NameAsPerPAN:              "Open Commerce Ltd",
+			DateOfIncorporation:       "01/01/2020",
+			Country:                   "IND",
+			CallbackURL:               "/onboarding",
+			CityCodes:                 []string{"std:080"},
+		},
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registryclient
+
+import "fmt"
+
+// Names of the ONDC environments.
+const (
+	EnvironmentStaging       = "staging"
+	EnvironmentPreProduction = "pre-production"
+	EnvironmentProduction    = "production"
+)
+
+// Environment is a profile of the ONDC registry in an environment.
+//
+// The registries of each environment do not behave exactly the same,
+// so the differences are modeled here instead of being special-cased in the client.
+type Environment struct {
+	Name string
+
+	// RegistryURL is the base URL of the registry APIs.
+	RegistryURL string
+
+	// RegistryEncryptPubKey is the base64 encoded X25519 public key (ASN.1 DER) of the registry.
+	// It is used for decrypting the /on_subscribe challenge.
+	RegistryEncryptPubKey string
+
+	// UniqueKeyIDField is the JSON field name of the unique key ID in /lookup requests.
+	UniqueKeyIDField string
+}
+
+var environments = map[string]Environment{
+	EnvironmentStaging: {
+		Name:                  EnvironmentStaging,
+		RegistryURL:           "https://staging.registry.ondc.org",
+		RegistryEncryptPubKey: "MCowBQYDK2VuAyEAduMuZgmtpjdCuxv+Nc49K0cB6tL/Dj3HZetvVN7ZekM=",
+		UniqueKeyIDField:      "unique_key_id",
+	},
+	EnvironmentPreProduction: {
+		Name:                  EnvironmentPreProduction,
+		RegistryURL:           "https://preprod.registry.ondc.org/ondc",
+		RegistryEncryptPubKey: "MCowBQYDK2VuAyEAa9Wbpvd9SsrpOZFcynyt/TO3x0Yrqyys4NUGIvyxX2Q=",
+		UniqueKeyIDField:      "ukId",
+	},
+	EnvironmentProduction: {
+		Name:                  EnvironmentProduction,
+		RegistryURL:           "https://prod.registry.ondc.org",
+		RegistryEncryptPubKey: "MCowBQYDK2VuAyEAvVEyZY91O2yV8w8/CAwVDAnqIZDJJUPdLUUKwLo3K0M=",
+		UniqueKeyIDField:      "ukId",
+	},
+}
+
+// LookupEnvironment returns the profile of the given ONDC environment.
+//
+// An empty name returns the pre-production profile, which was the only behavior before environments were modeled.
+func LookupEnvironment(name string) (Environment, error) {
+	if name == "" {
+		name = EnvironmentPreProduction
+	}
+	env, ok := environments[name]
+	if !ok {
+		return Environment{}, fmt.Errorf("unknown ONDC environment %q", name)
+	}
+	return env, nil
+}
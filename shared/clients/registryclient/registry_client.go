@@ -26,8 +26,9 @@ import (
 	"net/url"
 	"time"
 
-	log "github.com/golang/glog"
+	"golang.org/x/exp/slog"
 
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/metrics"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/registry"
 )
@@ -38,27 +39,126 @@ type RegistryClient struct {
 	baseURL    *url.URL
 
 	lookupURL    string
+	vlookupURL   string
 	subscribeURL string
 
-	ondcEnvironment string
+	env Environment
 }
 
 // New create a new RegistryClient.
+//
+// If registryURL is empty, the registry URL of the ONDC environment is used.
 func New(registryURL, ondcEnvironment string) (*RegistryClient, error) {
+	env, err := LookupEnvironment(ondcEnvironment)
+	if err != nil {
+		return nil, err
+	}
+	if registryURL == "" {
+		registryURL = env.RegistryURL
+	}
+
 	baseURL, err := url.Parse(registryURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse registry URL: %v", err)
 	}
 
 	lookupURL := baseURL.JoinPath("lookup").String()
+	vlookupURL := baseURL.JoinPath("vlookup").String()
 	subscribeURL := baseURL.JoinPath("subscribe").String()
 
 	return &RegistryClient{
-		httpClient:      &http.Client{},
-		baseURL:         baseURL,
-		lookupURL:       lookupURL,
-		subscribeURL:    subscribeURL,
-		ondcEnvironment: ondcEnvironment,
+		httpClient:   &http.Client{},
+		baseURL:      baseURL,
+		lookupURL:    lookupURL,
+		vlookupURL:   vlookupURL,
+		subscribeURL: subscribeURL,
+		env:          env,
+	}, nil
+}
+
+// Roles of network participants that can be registered with NewSubscribeRequest.
+const (
+	RoleBuyer     = "buyer"
+	RoleSeller    = "seller"
+	RoleMSNSeller = "msn"
+	RoleLogistics = "logistics"
+)
+
+// SubscribeParams contains details of a network participant for registering via /subscribe API.
+type SubscribeParams struct {
+	// Role is one of RoleBuyer, RoleSeller, RoleMSNSeller and RoleLogistics.
+	Role      string
+	RequestID string
+
+	// Entity contains the GST/PAN details, the authorised signatory, the subscriber ID,
+	// the callback URL and the key pair of the participant.
+	Entity registry.Entity
+
+	// SubscriberURL is the URL of the participant relative to the subscriber ID.
+	SubscriberURL string
+	Domains       []string
+	CityCodes     []string
+}
+
+// Types of network participants in the registry.
+const (
+	TypeBuyerApp  = "buyerApp"
+	TypeSellerApp = "sellerApp"
+	TypeGateway   = "gateway"
+)
+
+// participantOps maps a role to its /subscribe operation number and network participant type.
+var participantOps = map[string]struct {
+	opsNo           int32
+	participantType string
+	msn             bool
+}{
+	RoleBuyer:     {opsNo: 1, participantType: TypeBuyerApp},
+	RoleSeller:    {opsNo: 2, participantType: TypeSellerApp},
+	RoleMSNSeller: {opsNo: 3, participantType: TypeSellerApp, msn: true},
+	// Logistics service providers are registered as non-MSN seller apps in logistics domains.
+	RoleLogistics: {opsNo: 2, participantType: TypeSellerApp},
+}
+
+// NewSubscribeRequest builds a /subscribe request for registering a new network participant.
+func NewSubscribeRequest(params SubscribeParams, timestamp time.Time) (registry.SubscribeRequest, error) {
+	ops, ok := participantOps[params.Role]
+	if !ok {
+		return registry.SubscribeRequest{}, fmt.Errorf("new subscribe request: unknown role %q", params.Role)
+	}
+	if params.Entity.SubscriberID == "" {
+		return registry.SubscribeRequest{}, errors.New("new subscribe request: subscriber ID is empty")
+	}
+	if params.Entity.KeyPair == nil {
+		return registry.SubscribeRequest{}, errors.New("new subscribe request: key pair is empty")
+	}
+	if len(params.Domains) == 0 {
+		return registry.SubscribeRequest{}, errors.New("new subscribe request: no domain is enabled")
+	}
+
+	participantType := ops.participantType
+	participants := make([]registry.NetworkParticipant, 0, len(params.Domains))
+	for _, domain := range params.Domains {
+		participants = append(participants, registry.NetworkParticipant{
+			SubscriberURL: params.SubscriberURL,
+			Domain:        domain,
+			Type:          &participantType,
+			MSN:           ops.msn,
+			CityCode:      params.CityCodes,
+		})
+	}
+
+	entity := params.Entity
+	return registry.SubscribeRequest{
+		Context: &registry.SubscribeContext{
+			Operation: &registry.Context{OpsNo: ops.opsNo},
+		},
+		Message: &registry.SubscribeMessage{
+			RequestID:          params.RequestID,
+			Timestamp:          registry.CustomTime(timestamp),
+			Entity:             &entity,
+			NetworkParticipant: participants,
+		},
 	}, nil
 }
 
@@ -72,13 +172,25 @@ func (c *RegistryClient) PublicSigningKey(subscriberID, uniqueKeyID string, ondc
 		// City:         ondcCtx.City,
 	}
 
-	requestBodyJSON, err := json.Marshal(requestBody)
+	responseBody, err := c.Lookup(requestBody)
 	if err != nil {
 		return nil, err
 	}
-	if c.ondcEnvironment == "staging" {
-		// rename the key in JSON
-		requestBodyJSON = bytes.Replace(requestBodyJSON, []byte("ukId"), []byte("unique_key_id"), 1)
+	if len(responseBody) == 0 {
+		slog.Error("Public signing key is not found", "subscriber_id", subscriberID, "unique_key_id", uniqueKeyID)
+		return nil, errors.New("Public Signing Keys are not found")
+	}
+
+	return base64.StdEncoding.DecodeString(responseBody[0].SigningPublicKey)
+}
+
+// Lookup looks up network participants matching the request from the ONDC registry.
+func (c *RegistryClient) Lookup(request registry.LookupRequest) (_ registry.LookupResponse, err error) {
+	defer func(start time.Time) { metrics.ObserveRegistryCall("lookup", err, time.Since(start)) }(time.Now())
+
+	requestBodyJSON, err := json.Marshal(c.lookupRequestBody(request))
+	if err != nil {
+		return nil, err
 	}
 
 	response, err := c.httpClient.Post(c.lookupURL, "application/json", bytes.NewReader(requestBodyJSON))
@@ -90,22 +202,39 @@ func (c *RegistryClient) PublicSigningKey(subscriberID, uniqueKeyID string, ondc
 	responseBodyRaw, _ := io.ReadAll(response.Body)
 
 	if response.StatusCode != http.StatusOK {
-		log.Infof("Lookup keys: body %s", responseBodyRaw)
-		log.Infof("Lookup keys: status code %d", response.StatusCode)
-		return nil, errors.New("Error fetching a signing public key")
+		slog.Info("Lookup failed", "status_code", response.StatusCode, "body", string(responseBodyRaw))
+		return nil, fmt.Errorf("lookup: registry returned status code %d", response.StatusCode)
 	}
 
 	var responseBody registry.LookupResponse
 	if err := json.Unmarshal(responseBodyRaw, &responseBody); err != nil {
 		return nil, err
 	}
-	if len(responseBody) == 0 {
-		log.Errorf("DEBUG: lookup_request: %v", requestBody)
-		log.Errorf("DEBUG: lookup_request_json: %q", requestBodyJSON)
-		return nil, errors.New("Public Signing Keys are not found")
-	}
+	return responseBody, nil
+}
 
-	return base64.StdEncoding.DecodeString(responseBody[0].SigningPublicKey)
+// lookupRequestBody returns the /lookup request in the shape expected by the registry of the environment.
+func (c *RegistryClient) lookupRequestBody(request registry.LookupRequest) map[string]any {
+	body := make(map[string]any)
+	if request.SubscriberID != nil {
+		body["subscriber_id"] = *request.SubscriberID
+	}
+	if request.Country != nil {
+		body["country"] = *request.Country
+	}
+	if request.UkID != "" {
+		body[c.env.UniqueKeyIDField] = request.UkID
+	}
+	if request.City != nil {
+		body["city"] = *request.City
+	}
+	if request.Domain != nil {
+		body["domain"] = *request.Domain
+	}
+	if request.Type != nil {
+		body["type"] = *request.Type
+	}
+	return body
 }
 
 // RotateKeys do the keys rotation via Registry /subscribe API.
@@ -131,11 +260,21 @@ func (c *RegistryClient) RotateKeys(encryptionPublicKey, signingPublicKey, reque
 		},
 	}
 
+	if err := c.Subscribe(requestBody); err != nil {
+		return fmt.Errorf("Key rotation error: %v", err)
+	}
+	return nil
+}
+
+// Subscribe sends a request to Registry /subscribe API.
+func (c *RegistryClient) Subscribe(requestBody registry.SubscribeRequest) (err error) {
+	defer func(start time.Time) { metrics.ObserveRegistryCall("subscribe", err, time.Since(start)) }(time.Now())
+
 	requestJSON, err := json.Marshal(requestBody)
 	if err != nil {
 		return err
 	}
-	log.Infof("rotatekeys: Request JSON: %q", requestJSON)
+	slog.Debug("Subscribe request", "body", string(requestJSON))
 
 	request, err := http.NewRequest(http.MethodPost, c.subscribeURL, bytes.NewReader(requestJSON))
 	if err != nil {
@@ -160,8 +299,8 @@ func (c *RegistryClient) RotateKeys(encryptionPublicKey, signingPublicKey, reque
 		return err
 	}
 
-	if response.StatusCode != http.StatusOK || subscribeRes.Message.Ack.Status != "ACK" {
-		return fmt.Errorf("Key rotation error: %v", subscribeRes.Error)
+	if response.StatusCode != http.StatusOK || subscribeRes.Message == nil || subscribeRes.Message.Ack == nil || subscribeRes.Message.Ack.Status != "ACK" {
+		return fmt.Errorf("subscribe: registry responded with status code %d, error %v", response.StatusCode, subscribeRes.Error)
 	}
 	return nil
 }
@@ -83,6 +83,210 @@ func TestRotateKeys(t *testing.T) {
 	}
 }
 
+func TestNewSubscribeRequest(t *testing.T) {
+	timestamp := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	params := SubscribeParams{
+		Role:      RoleMSNSeller,
+		RequestID: "request-id",
+		Entity: registry.Entity{
+			SubscriberID: "example.com",
+			KeyPair:      &registry.KeyPair{SigningPublicKey: publicSigningKey},
+		},
+		SubscriberURL: "/ondc",
+		Domains:       []string{"ONDC:RET10", "ONDC:RET11"},
+		CityCodes:     []string{"std:080"},
+	}
+
+	got, err := NewSubscribeRequest(params, timestamp)
+	if err != nil {
+		t.Fatalf("NewSubscribeRequest() failed: %v", err)
+	}
+
+	if got, want := got.Context.Operation.OpsNo, int32(3); got != want {
+		t.Errorf("NewSubscribeRequest() ops_no = %d, want %d", got, want)
+	}
+	if got, want := got.Message.RequestID, params.RequestID; got != want {
+		t.Errorf("NewSubscribeRequest() request_id = %q, want %q", got, want)
+	}
+	if got, want := len(got.Message.NetworkParticipant), len(params.Domains); got != want {
+		t.Fatalf("NewSubscribeRequest() has %d network participants, want %d", got, want)
+	}
+	for i, np := range got.Message.NetworkParticipant {
+		if np.Domain != params.Domains[i] || *np.Type != "sellerApp" || !np.MSN {
+			t.Errorf("NewSubscribeRequest() network_participant[%d] = %+v, want an MSN sellerApp in %q", i, np, params.Domains[i])
+		}
+	}
+}
+
+func TestNewSubscribeRequestOmitsMSN(t *testing.T) {
+	params := SubscribeParams{
+		Role:          RoleBuyer,
+		RequestID:     "request-id",
+		Entity:        registry.Entity{SubscriberID: "example.com", KeyPair: &registry.KeyPair{SigningPublicKey: publicSigningKey}},
+		SubscriberURL: "/ondc",
+		Domains:       []string{"ONDC:RET10"},
+		CityCodes:     []string{"std:080"},
+	}
+
+	request, err := NewSubscribeRequest(params, time.Now())
+	if err != nil {
+		t.Fatalf("NewSubscribeRequest() failed: %v", err)
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	if bytes.Contains(body, []byte(`"msn"`)) {
+		t.Errorf("Subscribe request of a buyer = %s, want no msn field", body)
+	}
+}
+
+func TestNewSubscribeRequestFailed(t *testing.T) {
+	valid := SubscribeParams{
+		Role:      RoleBuyer,
+		RequestID: "request-id",
+		Entity: registry.Entity{
+			SubscriberID: "example.com",
+			KeyPair:      &registry.KeyPair{},
+		},
+		Domains: []string{"ONDC:RET10"},
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*SubscribeParams)
+	}{
+		{
+			name:   "unknown role",
+			modify: func(p *SubscribeParams) { p.Role = "gateway" },
+		},
+		{
+			name:   "empty subscriber ID",
+			modify: func(p *SubscribeParams) { p.Entity.SubscriberID = "" },
+		},
+		{
+			name:   "no key pair",
+			modify: func(p *SubscribeParams) { p.Entity.KeyPair = nil },
+		},
+		{
+			name:   "no domain",
+			modify: func(p *SubscribeParams) { p.Domains = nil },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params := valid
+			test.modify(&params)
+			if _, err := NewSubscribeRequest(params, time.Now()); err == nil {
+				t.Errorf("NewSubscribeRequest() succeeded unexpectedly")
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	mockRegistrySrv := initMockRegistryServer(t)
+	c, err := New(mockRegistrySrv.URL, "")
+	if err != nil {
+		t.Fatalf("New(%q) failed: %v", mockRegistrySrv.URL, err)
+	}
+
+	subscriberID := "example.com"
+	got, err := c.Lookup(registry.LookupRequest{SubscriberID: &subscriberID})
+	if err != nil {
+		t.Fatalf("Lookup() failed: %v", err)
+	}
+	if len(got) != 1 || got[0].SigningPublicKey != publicSigningKey {
+		t.Errorf("Lookup() = %+v, want one participant with signing key %q", got, publicSigningKey)
+	}
+}
+
+func TestSubscribeNack(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/subscribe", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"message":{"ack":{"status":"NACK"}},"error":{"code":"1050"}}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	c, err := New(srv.URL, "")
+	if err != nil {
+		t.Fatalf("New(%q) failed: %v", srv.URL, err)
+	}
+	if err := c.Subscribe(registry.SubscribeRequest{}); err == nil {
+		t.Errorf("Subscribe() succeeded unexpectedly")
+	}
+}
+
+func TestNewUnknownEnvironment(t *testing.T) {
+	if _, err := New("", "dev"); err == nil {
+		t.Errorf("New() with an unknown environment succeeded unexpectedly")
+	}
+}
+
+func TestNewDefaultRegistryURL(t *testing.T) {
+	for _, name := range []string{EnvironmentStaging, EnvironmentPreProduction, EnvironmentProduction} {
+		c, err := New("", name)
+		if err != nil {
+			t.Fatalf("New(%q) failed: %v", name, err)
+		}
+		env, err := LookupEnvironment(name)
+		if err != nil {
+			t.Fatalf("LookupEnvironment(%q) failed: %v", name, err)
+		}
+		if got, want := c.baseURL.String(), env.RegistryURL; got != want {
+			t.Errorf("New(%q) registry URL = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestLookupRequestShape(t *testing.T) {
+	tests := []struct {
+		env       string
+		wantField string
+	}{
+		{env: EnvironmentStaging, wantField: "unique_key_id"},
+		{env: EnvironmentPreProduction, wantField: "ukId"},
+		{env: EnvironmentProduction, wantField: "ukId"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.env, func(t *testing.T) {
+			var body map[string]any
+			mux := http.NewServeMux()
+			mux.HandleFunc("/lookup", func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				// The staging registry returns br_id as a number.
+				w.Write([]byte(`[{"subscriber_id":"example.com","br_id":123}]`))
+			})
+			srv := httptest.NewServer(mux)
+			t.Cleanup(srv.Close)
+
+			c, err := New(srv.URL, test.env)
+			if err != nil {
+				t.Fatalf("New(%q) failed: %v", test.env, err)
+			}
+
+			subscriberID := "example.com"
+			response, err := c.Lookup(registry.LookupRequest{SubscriberID: &subscriberID, UkID: "key-id"})
+			if err != nil {
+				t.Fatalf("Lookup() failed: %v", err)
+			}
+			if got, want := body[test.wantField], "key-id"; got != want {
+				t.Errorf("Lookup() request %s = %v, want %q (body %v)", test.wantField, got, want, body)
+			}
+			if got, want := response[0].BrID, registry.FlexibleString("123"); got != want {
+				t.Errorf("Lookup() br_id = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
 func initMockRegistryServer(t *testing.T) *httptest.Server {
 	t.Helper()
 
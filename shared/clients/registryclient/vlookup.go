@@ -0,0 +1,219 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registryclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/metrics"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/registry"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/signing-authentication/authentication"
+)
+
+// ParticipantQuery filters network participants. Empty fields match any value.
+type ParticipantQuery struct {
+	SubscriberID string
+	Country      string
+	Domain       string
+	City         string
+
+	// Type is one of TypeBuyerApp, TypeSellerApp and TypeGateway.
+	Type string
+}
+
+// Participant is a network participant record of a subscriber in a domain.
+type Participant struct {
+	SubscriberID  string
+	SubscriberURL string
+	UniqueKeyID   string
+	Country       string
+	City          string
+	Domain        string
+	Type          string
+
+	// Base64 encoded public keys.
+	SigningPublicKey    string
+	EncryptionPublicKey string
+
+	ValidFrom  string
+	ValidUntil string
+}
+
+// VLookupSigningString returns the string signed by the sender of a /vlookup request.
+func VLookupSigningString(params registry.VLookupSearchParameters) string {
+	return strings.Join([]string{params.Country, params.Domain, params.Type, params.City, params.SubscriberID}, "|")
+}
+
+// NewVLookupRequest builds a /vlookup request signed with the signing keyset of the sender.
+func NewVLookupRequest(senderSubscriberID string, params registry.VLookupSearchParameters, signingKeyset []byte, timestamp time.Time) (registry.VLookupRequest, error) {
+	if senderSubscriberID == "" {
+		return registry.VLookupRequest{}, errors.New("new vlookup request: sender subscriber ID is empty")
+	}
+
+	signature, err := authentication.Sign([]byte(VLookupSigningString(params)), signingKeyset)
+	if err != nil {
+		return registry.VLookupRequest{}, fmt.Errorf("new vlookup request: %v", err)
+	}
+	signatureB64 := base64.StdEncoding.EncodeToString(signature)
+	requestID := uuid.NewString()
+
+	return registry.VLookupRequest{
+		SenderSubscriberID: &senderSubscriberID,
+		RequestID:          &requestID,
+		Timestamp:          &timestamp,
+		SearchParameters:   &params,
+		Signature:          &signatureB64,
+	}, nil
+}
+
+// VLookup looks up network participants via the signed /vlookup API.
+func (c *RegistryClient) VLookup(request registry.VLookupRequest) (_ registry.VLookupResponse, err error) {
+	defer func(start time.Time) { metrics.ObserveRegistryCall("vlookup", err, time.Since(start)) }(time.Now())
+
+	requestBodyJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.httpClient.Post(c.vlookupURL, "application/json", bytes.NewReader(requestBodyJSON))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	responseBodyRaw, _ := io.ReadAll(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		slog.Info("VLookup failed", "status_code", response.StatusCode, "body", string(responseBodyRaw))
+		return nil, fmt.Errorf("vlookup: registry returned status code %d", response.StatusCode)
+	}
+
+	var responseBody registry.VLookupResponse
+	if err := json.Unmarshal(responseBodyRaw, &responseBody); err != nil {
+		return nil, err
+	}
+	return responseBody, nil
+}
+
+// LookupParticipants looks up network participants matching the query via /lookup API.
+func (c *RegistryClient) LookupParticipants(query ParticipantQuery) ([]Participant, error) {
+	request := registry.LookupRequest{
+		SubscriberID: optional(query.SubscriberID),
+		Country:      optional(query.Country),
+		City:         optional(query.City),
+		Domain:       optional(query.Domain),
+		Type:         optional(query.Type),
+	}
+
+	response, err := c.Lookup(request)
+	if err != nil {
+		return nil, err
+	}
+
+	participants := make([]Participant, 0, len(response))
+	for _, r := range response {
+		participants = append(participants, Participant{
+			SubscriberID:        r.SubscriberID,
+			SubscriberURL:       r.SubscriberURL,
+			UniqueKeyID:         r.UkID,
+			Country:             r.Country,
+			City:                r.City,
+			Domain:              r.Domain,
+			Type:                r.Type,
+			SigningPublicKey:    r.SigningPublicKey,
+			EncryptionPublicKey: r.EncrPublicKey,
+			ValidFrom:           r.ValidFrom,
+			ValidUntil:          r.ValidUntil,
+		})
+	}
+	return participants, nil
+}
+
+// VLookupParticipants looks up network participants matching the query via /vlookup API
+// on behalf of the sender.
+//
+// A subscriber registered in several domains is returned once per matching domain.
+func (c *RegistryClient) VLookupParticipants(query ParticipantQuery, senderSubscriberID string, signingKeyset []byte) ([]Participant, error) {
+	params := registry.VLookupSearchParameters{
+		Country:      query.Country,
+		Domain:       query.Domain,
+		Type:         query.Type,
+		City:         query.City,
+		SubscriberID: query.SubscriberID,
+	}
+	request, err := NewVLookupRequest(senderSubscriberID, params, signingKeyset, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.VLookup(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var participants []Participant
+	for _, r := range response {
+		participant := Participant{
+			SubscriberID:        r.SubscriberID,
+			UniqueKeyID:         r.UniqueKeyID,
+			Country:             r.Country,
+			City:                r.City,
+			SigningPublicKey:    r.SigningPublicKey,
+			EncryptionPublicKey: r.EncrPublicKey,
+			ValidFrom:           r.ValidFrom,
+			ValidUntil:          r.ValidUntil,
+		}
+		if len(r.NetworkParticipant) == 0 {
+			participants = append(participants, participant)
+			continue
+		}
+
+		for _, np := range r.NetworkParticipant {
+			if query.Domain != "" && np.Domain != query.Domain {
+				continue
+			}
+			if query.Type != "" && np.Type != query.Type {
+				continue
+			}
+			p := participant
+			p.SubscriberURL = np.SubscriberURL
+			p.Domain = np.Domain
+			p.Type = np.Type
+			if np.CityCode != "" {
+				p.City = np.CityCode
+			}
+			participants = append(participants, p)
+		}
+	}
+	return participants, nil
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registryclient
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/registry"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/signing-authentication/authentication"
+)
+
+func TestNewVLookupRequest(t *testing.T) {
+	keyset, err := authentication.GenerateKeysetJSON()
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	publicKey, err := authentication.ExtractRawPublicKey(keyset)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	params := registry.VLookupSearchParameters{Country: "IND", Domain: "ONDC:RET10", Type: "sellerApp", City: "std:080"}
+	request, err := NewVLookupRequest("buyer.example.com", params, keyset, time.Now())
+	if err != nil {
+		t.Fatalf("NewVLookupRequest() failed: %v", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(*request.Signature)
+	if err != nil {
+		t.Fatalf("NewVLookupRequest() signature is not base64: %v", err)
+	}
+	if !ed25519.Verify(publicKey, []byte("IND|ONDC:RET10|sellerApp|std:080|"), signature) {
+		t.Errorf("NewVLookupRequest() signature = %q, cannot be verified", *request.Signature)
+	}
+	if *request.RequestID == "" {
+		t.Errorf("NewVLookupRequest() request ID is empty")
+	}
+}
+
+func TestNewVLookupRequestFailed(t *testing.T) {
+	keyset, err := authentication.GenerateKeysetJSON()
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if _, err := NewVLookupRequest("", registry.VLookupSearchParameters{}, keyset, time.Now()); err == nil {
+		t.Errorf("NewVLookupRequest() without a sender succeeded unexpectedly")
+	}
+	if _, err := NewVLookupRequest("buyer.example.com", registry.VLookupSearchParameters{}, []byte("invalid"), time.Now()); err == nil {
+		t.Errorf("NewVLookupRequest() with an invalid keyset succeeded unexpectedly")
+	}
+}
+
+func TestVLookupParticipants(t *testing.T) {
+	keyset, err := authentication.GenerateKeysetJSON()
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	var request registry.VLookupRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vlookup", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`[{
+			"subscriber_id": "seller.example.com",
+			"unique_key_id": "key-id",
+			"signing_public_key": "signing-key",
+			"network_participant": [
+				{"subscriber_url": "/bpp/grocery", "domain": "ONDC:RET10", "type": "sellerApp", "city_code": "std:080"},
+				{"subscriber_url": "/bpp/food", "domain": "ONDC:RET11", "type": "sellerApp", "city_code": "std:080"}
+			]
+		}]`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	c, err := New(srv.URL, "")
+	if err != nil {
+		t.Fatalf("New(%q) failed: %v", srv.URL, err)
+	}
+
+	query := ParticipantQuery{Domain: "ONDC:RET10", City: "std:080", Type: "sellerApp"}
+	got, err := c.VLookupParticipants(query, "buyer.example.com", keyset)
+	if err != nil {
+		t.Fatalf("VLookupParticipants() failed: %v", err)
+	}
+
+	want := []Participant{{
+		SubscriberID:     "seller.example.com",
+		SubscriberURL:    "/bpp/grocery",
+		UniqueKeyID:      "key-id",
+		City:             "std:080",
+		Domain:           "ONDC:RET10",
+		Type:             "sellerApp",
+		SigningPublicKey: "signing-key",
+	}}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("VLookupParticipants() = %+v, want %+v", got, want)
+	}
+	if got, want := *request.SenderSubscriberID, "buyer.example.com"; got != want {
+		t.Errorf("VLookupParticipants() sender_subscriber_id = %q, want %q", got, want)
+	}
+	if got, want := request.SearchParameters.Domain, query.Domain; got != want {
+		t.Errorf("VLookupParticipants() search_parameters.domain = %q, want %q", got, want)
+	}
+}
+
+func TestLookupParticipants(t *testing.T) {
+	var body map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lookup", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`[{"subscriber_id":"seller.example.com","subscriber_url":"/bpp","type":"sellerApp","domain":"ONDC:RET10","city":"std:080"}]`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	c, err := New(srv.URL, "")
+	if err != nil {
+		t.Fatalf("New(%q) failed: %v", srv.URL, err)
+	}
+
+	got, err := c.LookupParticipants(ParticipantQuery{Domain: "ONDC:RET10", City: "std:080"})
+	if err != nil {
+		t.Fatalf("LookupParticipants() failed: %v", err)
+	}
+	if len(got) != 1 || got[0].SubscriberURL != "/bpp" || got[0].Type != "sellerApp" {
+		t.Errorf("LookupParticipants() = %+v, want one sellerApp with subscriber URL /bpp", got)
+	}
+	if _, ok := body["type"]; ok {
+		t.Errorf("LookupParticipants() request = %v, want no type", body)
+	}
+	if got, want := body["domain"], "ONDC:RET10"; got != want {
+		t.Errorf("LookupParticipants() request domain = %v, want %q", got, want)
+	}
+}
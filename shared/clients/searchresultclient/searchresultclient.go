@@ -0,0 +1,113 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package searchresultclient provide a client for storing the on_search results of the buyer platform on Cloud Spanner.
+//
+// The on_search responses of the BPPs are stored as offers of their transactions, keyed by the BPP, provider and item,
+// so the offers of a transaction are merged across the responses. The offers are deleted a day after they are received.
+package searchresultclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/option"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/catalog"
+)
+
+const searchResultTable = "SearchResult"
+
+// Client is a wrapper of Spanner Client for storing the search results.
+type Client struct {
+	spannerClient *spanner.Client
+}
+
+// New creates a new search result client.
+func New(ctx context.Context, projectID, instanceID, databaseID string, opts ...option.ClientOption) (*Client, error) {
+	database := fmt.Sprintf("projects/%s/instances/%s/databases/%s", projectID, instanceID, databaseID)
+	spannerClient, err := spanner.NewClient(ctx, database, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{spannerClient: spannerClient}, nil
+}
+
+// Close closes the underlying Spanner client.
+func (c *Client) Close() {
+	c.spannerClient.Close()
+}
+
+// Ping checks that the Spanner database is available.
+func (c *Client) Ping(ctx context.Context) error {
+	iter := c.spannerClient.Single().Query(ctx, spanner.Statement{SQL: "SELECT 1"})
+	defer iter.Stop()
+	if _, err := iter.Next(); err != nil {
+		return fmt.Errorf("ping spanner: %v", err)
+	}
+	return nil
+}
+
+// StoreOffers stores the offers of the transaction, replacing the stored offers with the same keys.
+func (c *Client) StoreOffers(ctx context.Context, transactionID string, offers []catalog.Offer) error {
+	if len(offers) == 0 {
+		return nil
+	}
+	mutations := make([]*spanner.Mutation, 0, len(offers))
+	for _, o := range offers {
+		mutations = append(mutations, spanner.InsertOrUpdateMap(searchResultTable, map[string]any{
+			"TransactionID": transactionID,
+			"BppID":         o.BppID,
+			"ProviderID":    o.ProviderID,
+			"ItemID":        o.Item.ID,
+			"Payload":       spanner.NullJSON{Value: o, Valid: true},
+			"ReceivedTime":  spanner.CommitTimestamp,
+		}))
+	}
+	if _, err := c.spannerClient.Apply(ctx, mutations); err != nil {
+		return fmt.Errorf("store offers: %v", err)
+	}
+	return nil
+}
+
+// Offers reads the offers of the transaction in the order of their keys.
+func (c *Client) Offers(ctx context.Context, transactionID string) ([]catalog.Offer, error) {
+	iter := c.spannerClient.Single().Read(ctx, searchResultTable, spanner.Key{transactionID}.AsPrefix(), []string{"Payload"})
+	defer iter.Stop()
+
+	var offers []catalog.Offer
+	err := iter.Do(func(row *spanner.Row) error {
+		var payload spanner.NullJSON
+		if err := row.Columns(&payload); err != nil {
+			return err
+		}
+		// The JSON column is decoded into a generic value, so it is converted via JSON encoding.
+		payloadJSON, err := json.Marshal(payload.Value)
+		if err != nil {
+			return err
+		}
+		var o catalog.Offer
+		if err := json.Unmarshal(payloadJSON, &o); err != nil {
+			return err
+		}
+		offers = append(offers, o)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read offers: %v", err)
+	}
+	return offers, nil
+}
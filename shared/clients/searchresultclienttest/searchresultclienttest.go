@@ -0,0 +1,76 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package searchresultclienttest provide a stub for searchresultclient.Client
+package searchresultclienttest
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/catalog"
+)
+
+// Stub stubs searchresultclient.Client with in-memory maps.
+type Stub struct {
+	mu     sync.Mutex
+	offers map[string]map[catalog.OfferKey]catalog.Offer
+}
+
+// NewStub creates a new stub without offers.
+func NewStub() *Stub {
+	return &Stub{offers: make(map[string]map[catalog.OfferKey]catalog.Offer)}
+}
+
+// StoreOffers stores the offers of the transaction.
+func (s *Stub) StoreOffers(_ context.Context, transactionID string, offers []catalog.Offer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.offers[transactionID] == nil {
+		s.offers[transactionID] = make(map[catalog.OfferKey]catalog.Offer)
+	}
+	for _, o := range offers {
+		s.offers[transactionID][o.Key()] = o
+	}
+	return nil
+}
+
+// Offers returns the offers of the transaction in the order of their keys.
+func (s *Stub) Offers(_ context.Context, transactionID string) ([]catalog.Offer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offers := make([]catalog.Offer, 0, len(s.offers[transactionID]))
+	for _, o := range s.offers[transactionID] {
+		offers = append(offers, o)
+	}
+	sort.Slice(offers, func(i, j int) bool {
+		a, b := offers[i].Key(), offers[j].Key()
+		if a.BppID != b.BppID {
+			return a.BppID < b.BppID
+		}
+		if a.ProviderID != b.ProviderID {
+			return a.ProviderID < b.ProviderID
+		}
+		return a.ItemID < b.ItemID
+	})
+	return offers, nil
+}
+
+// Ping always succeeds.
+func (s *Stub) Ping(context.Context) error {
+	return nil
+}
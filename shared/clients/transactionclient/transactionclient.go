@@ -25,9 +25,22 @@ import (
 	"github.com/google/uuid"
 	"github.com/googleapis/gax-go/v2/apierror"
 	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	inboundMessageTable = "InboundMessage"
+
+	// claimTimeout is the time after which a claim of an inbound message that is not completed is taken over.
+	claimTimeout = time.Minute
 )
 
 var (
+	// ErrDuplicate is returned when claiming an inbound message that has already been received.
+	ErrDuplicate = errors.New("duplicate message")
+	// ErrInFlight is returned when claiming an inbound message whose original is still being published.
+	ErrInFlight = errors.New("message in flight")
+
 	transactionTypeMap = map[string]int{
 		"REQUEST-ACTION":  1,
 		"CALLBACK-ACTION": 2,
@@ -76,6 +89,21 @@ type TransactionData struct {
 	ErrorPath       string
 	ErrorMessage    string
 	ReqReceivedTime time.Time
+
+	// Duplicate marks a retry of a received request, which is acknowledged without processing.
+	Duplicate bool
+}
+
+// MessageKey identifies an inbound request for detecting its retries.
+type MessageKey struct {
+	SubscriberID  string
+	TransactionID string
+	MessageID     string
+	Action        string
+}
+
+func (k MessageKey) spannerKey() spanner.Key {
+	return spanner.Key{k.SubscriberID, k.TransactionID, k.MessageID, k.Action}
 }
 
 // New creates a new transaction client.
@@ -89,6 +117,16 @@ func New(ctx context.Context, projectID, instanceID, databaseID string, opts ...
 	return client, nil
 }
 
+// Ping checks that the Spanner database is available.
+func (c *Client) Ping(ctx context.Context) error {
+	iter := c.spannerClient.Single().Query(ctx, spanner.Statement{SQL: "SELECT 1"})
+	defer iter.Stop()
+	if _, err := iter.Next(); err != nil {
+		return fmt.Errorf("ping spanner: %v", err)
+	}
+	return nil
+}
+
 // StoreTransaction inserts the ONDC transaction details in the Spanner table.
 func (c *Client) StoreTransaction(ctx context.Context, transaction TransactionData) error {
 	typeCode, ok := transactionTypeMap[transaction.Type]
@@ -117,7 +155,8 @@ func (c *Client) StoreTransaction(ctx context.Context, transaction TransactionDa
 				ErrorCode,
 				ErrorPath,
 				ErrorMessage,
-				ReqReceivedTime
+				ReqReceivedTime,
+				AdditionalData
 			)
 			VALUES (
 				@transactionID,
@@ -132,7 +171,8 @@ func (c *Client) StoreTransaction(ctx context.Context, transaction TransactionDa
 				@errorCode,
 				@errorPath,
 				@errorMessage,
-				@reqReceivedTime
+				@reqReceivedTime,
+				@additionalData
 			)`,
 			Params: map[string]any{
 				"transactionID":   transaction.ID,
@@ -148,6 +188,7 @@ func (c *Client) StoreTransaction(ctx context.Context, transaction TransactionDa
 				"errorPath":       transaction.ErrorPath,
 				"errorMessage":    transaction.ErrorMessage,
 				"reqReceivedTime": transaction.ReqReceivedTime,
+				"additionalData":  additionalData(transaction),
 			},
 		}
 		_, err := txn.Update(ctx, stmt)
@@ -161,3 +202,86 @@ func (c *Client) StoreTransaction(ctx context.Context, transaction TransactionDa
 	}
 	return err
 }
+
+// additionalData returns the details of the transaction that have no column in the Transaction table.
+func additionalData(transaction TransactionData) spanner.NullJSON {
+	if !transaction.Duplicate {
+		return spanner.NullJSON{}
+	}
+	return spanner.NullJSON{Value: map[string]any{"duplicate": true}, Valid: true}
+}
+
+// ClaimMessage records an inbound message before it is published, so its retries can be detected.
+//
+// If the message has already been published, it returns ErrDuplicate and the Pub/Sub message ID of the original.
+// While the original is being published, it returns ErrInFlight, as the original may still fail.
+// A claim that is not completed within a minute is taken over, as the original failed without releasing it.
+func (c *Client) ClaimMessage(ctx context.Context, key MessageKey) (string, error) {
+	var pubsubMessageID string
+	_, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		pubsubMessageID = ""
+		row, err := txn.ReadRow(ctx, inboundMessageTable, key.spannerKey(), []string{"PubSubMessageID", "ReceivedTime"})
+		switch {
+		case spanner.ErrCode(err) == codes.NotFound:
+		case err != nil:
+			return err
+		default:
+			var (
+				msgID        spanner.NullString
+				receivedTime time.Time
+			)
+			if err := row.Columns(&msgID, &receivedTime); err != nil {
+				return err
+			}
+			if msgID.Valid {
+				pubsubMessageID = msgID.StringVal
+				return ErrDuplicate
+			}
+			if time.Since(receivedTime) < claimTimeout {
+				return ErrInFlight
+			}
+		}
+
+		return txn.BufferWrite([]*spanner.Mutation{spanner.InsertOrUpdateMap(inboundMessageTable, map[string]any{
+			"SubscriberID":    key.SubscriberID,
+			"TransactionID":   key.TransactionID,
+			"MessageID":       key.MessageID,
+			"Action":          key.Action,
+			"PubSubMessageID": spanner.NullString{},
+			"ReceivedTime":    spanner.CommitTimestamp,
+		})})
+	})
+	if errors.Is(err, ErrDuplicate) {
+		return pubsubMessageID, ErrDuplicate
+	}
+	if errors.Is(err, ErrInFlight) {
+		return "", ErrInFlight
+	}
+	if err != nil {
+		return "", fmt.Errorf("claim message: %v", err)
+	}
+	return "", nil
+}
+
+// CompleteMessage records the Pub/Sub message ID of a claimed inbound message after it is published.
+func (c *Client) CompleteMessage(ctx context.Context, key MessageKey, pubsubMessageID string) error {
+	_, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{spanner.UpdateMap(inboundMessageTable, map[string]any{
+		"SubscriberID":    key.SubscriberID,
+		"TransactionID":   key.TransactionID,
+		"MessageID":       key.MessageID,
+		"Action":          key.Action,
+		"PubSubMessageID": pubsubMessageID,
+	})})
+	if err != nil {
+		return fmt.Errorf("complete message: %v", err)
+	}
+	return nil
+}
+
+// ReleaseMessage deletes the claim of an inbound message that failed to be published, so its retries are processed.
+func (c *Client) ReleaseMessage(ctx context.Context, key MessageKey) error {
+	if _, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{spanner.Delete(inboundMessageTable, key.spannerKey())}); err != nil {
+		return fmt.Errorf("release message: %v", err)
+	}
+	return nil
+}
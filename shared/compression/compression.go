@@ -0,0 +1,214 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package compression supports gzip Content-Encoding of the bodies of ONDC requests.
+//
+// ONDC signatures are computed over the uncompressed body, so requests are signed before they are compressed
+// by the client, and decompressed before their signatures are verified by the server.
+//
+// There is no standard way for a server to advertise the encodings it accepts in requests,
+// so the services advertise gzip in the Accept-Encoding header of their responses,
+// and the client compresses the requests to a host only after its responses advertised gzip.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Gzip is the supported content encoding.
+const Gzip = "gzip"
+
+// MinSize is the body size in bytes below which requests are not compressed, as the gain is negligible.
+const MinSize = 1 << 10
+
+// ErrTooLarge is returned when the body, or the decompressed body, exceeds the maximum size.
+var ErrTooLarge = errors.New("request body is too large")
+
+// AcceptsGzip reports whether the Accept-Encoding header value includes gzip.
+func AcceptsGzip(acceptEncoding string) bool {
+	for _, encoding := range strings.Split(acceptEncoding, ",") {
+		encoding, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if !strings.EqualFold(strings.TrimSpace(encoding), Gzip) {
+			continue
+		}
+		// "gzip;q=0" explicitly refuses gzip.
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// ReadBody reads the request body into a single buffer, decompressing it if it is gzip encoded.
+//
+// Both the received and the decompressed bodies are limited to maxSize bytes, protecting the servers from gzip bombs.
+// Requests without Content-Encoding are read as is. Other encodings are not supported.
+func ReadBody(r *http.Request, maxSize int64) ([]byte, error) {
+	encoding := strings.TrimSpace(r.Header.Get("Content-Encoding"))
+	gzipped := strings.EqualFold(encoding, Gzip)
+	if encoding != "" && !gzipped && !strings.EqualFold(encoding, "identity") {
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	if r.ContentLength > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	var body io.Reader = &limitedReader{r: r.Body, n: maxSize}
+	sizeHint := r.ContentLength
+	if gzipped {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("decompress body: %v", err)
+		}
+		defer zr.Close()
+		body = &limitedReader{r: zr, n: maxSize}
+		// The decompressed size is unknown, JSON typically compresses about 5 times.
+		sizeHint = 5 * r.ContentLength
+		if sizeHint > maxSize {
+			sizeHint = maxSize
+		}
+	}
+	if sizeHint < 0 {
+		sizeHint = 0
+	}
+
+	// The buffer is allocated once for the expected size, instead of growing by copying.
+	buf := bytes.NewBuffer(make([]byte, 0, sizeHint+bytes.MinRead))
+	if _, err := buf.ReadFrom(body); err != nil {
+		if errors.Is(err, ErrTooLarge) {
+			return nil, err
+		}
+		if gzipped {
+			return nil, fmt.Errorf("decompress body: %v", err)
+		}
+		return nil, fmt.Errorf("read body: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// limitedReader reads at most n bytes from r, and fails with ErrTooLarge if r has more.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+// compress returns the gzip encoded body.
+func compress(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Transport compresses the request bodies sent to the hosts advertising gzip support.
+type Transport struct {
+	base http.RoundTripper
+
+	// hosts records the hosts whose last response advertised gzip support.
+	hosts sync.Map
+}
+
+// NewTransport creates a transport compressing the requests sent through the base transport.
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{base: base}
+}
+
+// RoundTrip sends the request, compressing its body if the host is known to accept gzip.
+//
+// Responses are decompressed by the base transport, which requests gzip responses by default.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	host := r.URL.Host
+	if _, ok := t.hosts.Load(host); ok && r.Body != nil && r.Header.Get("Content-Encoding") == "" {
+		compressed, err := compressRequest(r)
+		if err != nil {
+			return nil, err
+		}
+		r = compressed
+	}
+
+	response, err := t.base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	if AcceptsGzip(response.Header.Get("Accept-Encoding")) {
+		t.hosts.Store(host, struct{}{})
+	} else {
+		t.hosts.Delete(host)
+	}
+	return response, nil
+}
+
+// compressRequest returns a copy of the request with its body compressed unless the body is smaller than MinSize.
+func compressRequest(r *http.Request) (*http.Request, error) {
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("compress request: %v", err)
+	}
+
+	clone := r.Clone(r.Context())
+	if len(body) >= MinSize {
+		if body, err = compress(body); err != nil {
+			return nil, fmt.Errorf("compress request: %v", err)
+		}
+		clone.Header.Set("Content-Encoding", Gzip)
+	}
+	clone.Body = io.NopCloser(bytes.NewReader(body))
+	clone.ContentLength = int64(len(body))
+	clone.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return clone, nil
+}
+
+// InstrumentClient returns a copy of the HTTP client compressing its requests to the hosts advertising gzip support.
+func InstrumentClient(client *http.Client) *http.Client {
+	instrumented := *client
+	instrumented.Transport = NewTransport(client.Transport)
+	return &instrumented
+}
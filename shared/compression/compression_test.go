@@ -0,0 +1,240 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipBody(t *testing.T, body []byte) []byte {
+	t.Helper()
+	compressed, err := compress(body)
+	if err != nil {
+		t.Fatalf("compress() failed: %v", err)
+	}
+	return compressed
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, GZIP", true},
+		{"br;q=1.0, gzip;q=0.8", true},
+		{"gzip;q=0", false},
+		{"deflate", false},
+		{"x-gzip", false},
+	}
+
+	for _, test := range tests {
+		if got := AcceptsGzip(test.acceptEncoding); got != test.want {
+			t.Errorf("AcceptsGzip(%q) = %t, want %t", test.acceptEncoding, got, test.want)
+		}
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	body := []byte(`{"context":{"action":"on_search"}}`)
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{
+			name: "no encoding",
+			body: body,
+		},
+		{
+			name:     "identity",
+			encoding: "identity",
+			body:     body,
+		},
+		{
+			name:     "gzip",
+			encoding: "gzip",
+			body:     gzipBody(t, body),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/on_search", bytes.NewReader(test.body))
+			if test.encoding != "" {
+				r.Header.Set("Content-Encoding", test.encoding)
+			}
+
+			got, err := ReadBody(r, 1<<10)
+			if err != nil {
+				t.Fatalf("ReadBody() failed: %v", err)
+			}
+			if !bytes.Equal(got, body) {
+				t.Errorf("ReadBody() = %q, want %q", got, body)
+			}
+		})
+	}
+}
+
+func TestReadBodyFailed(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{
+			name:     "unsupported encoding",
+			encoding: "br",
+			body:     []byte("{}"),
+		},
+		{
+			name:     "invalid gzip",
+			encoding: "gzip",
+			body:     []byte("{}"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(test.body))
+			r.Header.Set("Content-Encoding", test.encoding)
+
+			if _, err := ReadBody(r, 1<<10); err == nil {
+				t.Errorf("ReadBody() succeeded unexpectedly")
+			}
+		})
+	}
+}
+
+func TestReadBodyTooLarge(t *testing.T) {
+	const maxSize = 1 << 10
+	large := bytes.Repeat([]byte("a"), maxSize+1)
+	tests := []struct {
+		name          string
+		encoding      string
+		body          []byte
+		contentLength int64
+	}{
+		{
+			name:          "content length",
+			body:          large,
+			contentLength: int64(len(large)),
+		},
+		{
+			name:          "unknown content length",
+			body:          large,
+			contentLength: -1,
+		},
+		{
+			// The compressed body is below the limit, but the decompressed body is above it.
+			name:          "gzip bomb",
+			encoding:      "gzip",
+			body:          gzipBody(t, large),
+			contentLength: -1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/on_search", bytes.NewReader(test.body))
+			r.ContentLength = test.contentLength
+			if test.encoding != "" {
+				r.Header.Set("Content-Encoding", test.encoding)
+			}
+
+			if _, err := ReadBody(r, maxSize); !errors.Is(err, ErrTooLarge) {
+				t.Errorf("ReadBody() error = %v, want %v", err, ErrTooLarge)
+			}
+		})
+	}
+
+	// A body of exactly the maximum size is accepted.
+	r := httptest.NewRequest(http.MethodPost, "/on_search", bytes.NewReader(large[:maxSize]))
+	if _, err := ReadBody(r, maxSize); err != nil {
+		t.Errorf("ReadBody() of the maximum size failed: %v", err)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var (
+		gotEncoding string
+		gotBody     []byte
+		advertise   = true
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEncoding = r.Header.Get("Content-Encoding")
+		var err error
+		if gotBody, err = ReadBody(r, 1<<20); err != nil {
+			t.Errorf("ReadBody() failed: %v", err)
+		}
+		if advertise {
+			w.Header().Set("Accept-Encoding", Gzip)
+		}
+	}))
+	defer srv.Close()
+	client := InstrumentClient(srv.Client())
+
+	large := []byte(`{"message":"` + strings.Repeat("a", MinSize) + `"}`)
+	small := []byte(`{}`)
+	tests := []struct {
+		name         string
+		body         []byte
+		advertise    bool
+		wantEncoding string
+	}{
+		{
+			name:      "host support is unknown",
+			body:      large,
+			advertise: true,
+		},
+		{
+			name:         "host advertised gzip",
+			body:         large,
+			advertise:    false,
+			wantEncoding: Gzip,
+		},
+		{
+			name:      "host stopped advertising gzip",
+			body:      large,
+			advertise: true,
+		},
+		{
+			name: "small body",
+			body: small,
+		},
+	}
+
+	for _, test := range tests {
+		advertise = test.advertise
+		response, err := client.Post(srv.URL, "application/json", bytes.NewReader(test.body))
+		if err != nil {
+			t.Fatalf("%s: Post() failed: %v", test.name, err)
+		}
+		response.Body.Close()
+
+		if gotEncoding != test.wantEncoding {
+			t.Errorf("%s: Content-Encoding = %q, want %q", test.name, gotEncoding, test.wantEncoding)
+		}
+		if !bytes.Equal(gotBody, test.body) {
+			t.Errorf("%s: server got body %q, want %q", test.name, gotBody, test.body)
+		}
+	}
+}
@@ -28,12 +28,42 @@ var validate = model.Validator()
 
 // OnboardingConfig is a config for onboarding service.
 type OnboardingConfig struct {
-	ProjectID             string `json:"projectID" validate:"required"`
-	Port                  int    `json:"port" validate:"required"`
-	RequestID             string `json:"requestID" validate:"required"`
-	SecretID              string `json:"secretID" validate:"required"`
-	RegistryEncryptPubKey string `json:"registryEncryptPubKey" validate:"required"`
-	ONDCEnvironment       string `json:"ONDCEnvironment"`
+	ProjectID       string `json:"projectID" validate:"required"`
+	Port            int    `json:"port" validate:"required"`
+	SecretID        string `json:"secretID" validate:"required"`
+	InstanceID      string `json:"instanceID" validate:"required"`
+	DatabaseID      string `json:"databaseID" validate:"required"`
+	RegistrationID  string `json:"registrationID" validate:"required"`
+	AdminAPIKey     string `json:"adminAPIKey"`
+	ONDCEnvironment string `json:"ONDCEnvironment" validate:"omitempty,oneof=staging pre-production production"`
+
+	// RegistryEncryptPubKey overrides the registry encryption public key of ONDCEnvironment.
+	RegistryEncryptPubKey string `json:"registryEncryptPubKey"`
+
+	// MetricsPort is the port serving the /metrics, /healthz and /readyz endpoints. The default is 9090.
+	MetricsPort int `json:"metricsPort"`
+
+	// ShutdownTimeout is the time for finishing the in-flight requests on SIGTERM. The default is 25s.
+	ShutdownTimeout string `json:"shutdownTimeout"`
+}
+
+// SubscribeConfig is a config for the subscribe command of onboarding.
+type SubscribeConfig struct {
+	ProjectID  string `json:"projectID" validate:"required"`
+	InstanceID string `json:"instanceID" validate:"required"`
+	DatabaseID string `json:"databaseID" validate:"required"`
+
+	// SecretID is the secret of the keys used by the services once the registry accepts them.
+	SecretID string `json:"secretID" validate:"required"`
+	// PendingSecretID is the secret of the keys until the registry accepts them.
+	// It must be the secret of the onboarding service, which answers the challenge of the registry with them.
+	PendingSecretID string `json:"pendingSecretID" validate:"required"`
+
+	// RegistrationID must be the same ID as the one served by the onboarding service.
+	RegistrationID string `json:"registrationID" validate:"required"`
+
+	// KeyValidity is a duration string e.g. "8760h". The default is 1 year.
+	KeyValidity string `json:"keyValidity"`
 }
 
 // BPPAPIConfig is a config for BPP API service.
@@ -42,11 +72,30 @@ type BPPAPIConfig struct {
 	ProjectID       string `json:"projectID" validate:"required"`
 	TopicID         string `json:"topicID" validate:"required"`
 	Port            int    `json:"port" validate:"required"`
-	RegistryURL     string `json:"registryURL" validate:"required,url"`
+	RegistryURL     string `json:"registryURL" validate:"omitempty,url"`
 	GatewayURL      string `json:"gatewayURL" validate:"required,url"`
 	InstanceID      string `json:"instanceID" validate:"required"`
 	DatabaseID      string `json:"databaseID" validate:"required"`
-	ONDCEnvironment string `json:"ONDCEnvironment"`
+	ONDCEnvironment string `json:"ONDCEnvironment" validate:"omitempty,oneof=staging pre-production production"`
+
+	// MetricsPort is the port serving the /metrics, /healthz and /readyz endpoints. The default is 9090.
+	MetricsPort int `json:"metricsPort"`
+
+	// ShutdownTimeout is the time for finishing the in-flight requests on SIGTERM. The default is 25s.
+	ShutdownTimeout string `json:"shutdownTimeout"`
+
+	// RateLimit limits the requests of each network participant. No limit is applied by default.
+	RateLimit RateLimitConfig `json:"rateLimit"`
+
+	// PolicyPath is the path of the PolicyConfig file allowing or denying network participants.
+	// The file is reloaded when it changes. No policy is applied if unset.
+	PolicyPath string `json:"policyPath"`
+
+	// MaxBodySize is the maximum size in bytes of request bodies, after decompression. The default is 64 MiB.
+	MaxBodySize int64 `json:"maxBodySize" validate:"gte=0"`
+
+	// ClaimCheck offloads large payloads of the Pub/Sub messages to an object store.
+	ClaimCheck ClaimCheckConfig `json:"claimCheck"`
 }
 
 // SellerAdapterConfig is a config for seller adapter service.
@@ -55,7 +104,88 @@ type SellerAdapterConfig struct {
 	SellerSystemURL string   `json:"sellerSystemURL" validate:"required,url"`
 	CallbackTopicID string   `json:"callbackTopicID" validate:"required"`
 	SubscriptionID  []string `json:"subscriptionID" validate:"required"`
-	ONDCEnvironment string   `json:"ONDCEnvironment"`
+	ONDCEnvironment string   `json:"ONDCEnvironment" validate:"omitempty,oneof=staging pre-production production"`
+
+	// SellerSystemPlugin translates the ONDC requests into the calls of the seller system at SellerSystemURL.
+	// "ondc" forwards the ONDC requests as they are, and "rest" calls a generic REST product and order API.
+	// The default is "ondc".
+	SellerSystemPlugin string `json:"sellerSystemPlugin" validate:"omitempty,oneof=ondc rest"`
+
+	// MetricsPort is the port serving the /metrics, /healthz and /readyz endpoints. The default is 9090.
+	MetricsPort int `json:"metricsPort"`
+
+	// ShutdownTimeout is the time for finishing the in-flight messages on SIGTERM. The default is 25s.
+	ShutdownTimeout string `json:"shutdownTimeout"`
+
+	// ClaimCheck offloads large payloads of the Pub/Sub messages to an object store.
+	ClaimCheck ClaimCheckConfig `json:"claimCheck"`
+
+	// Catalog answers the searches from the catalog pushed by the seller system. Searches are sent to the seller system if unset.
+	Catalog *CatalogConfig `json:"catalog"`
+
+	// Async accepts the requests answered later by the seller system, which responds with 202 Accepted and posts the
+	// callback to the callback API. Such responses fail the requests if unset.
+	Async *AsyncConfig `json:"async"`
+
+	// APIPort is the port serving the catalog and callback APIs for the seller system. The default is 8080.
+	APIPort int `json:"apiPort"`
+
+	// SellerSystemAuth authenticates the calls to and from the seller system.
+	SellerSystemAuth SellerSystemAuthConfig `json:"sellerSystemAuth"`
+}
+
+// SellerSystemAuthConfig is a config of the authentication of the calls between the seller adapter service
+// and the seller system.
+type SellerSystemAuthConfig struct {
+	// Outbound authenticates the calls to the seller system.
+	Outbound HTTPAuthConfig `json:"outbound"`
+
+	// Inbound authenticates the calls from the seller system, e.g. to the catalog API. OAuth2 is not supported.
+	Inbound HTTPAuthConfig `json:"inbound"`
+}
+
+// HTTPAuthConfig is a config of the authentication of the HTTP calls with an external system.
+type HTTPAuthConfig struct {
+	// Type is "bearer", "oauth2", "hmac" or "mtls". The calls are not authenticated if unset.
+	Type string `json:"type" validate:"omitempty,oneof=bearer oauth2 hmac mtls"`
+
+	// SecretID is the Secret Manager secret of the bearer token, the OAuth2 client secret, the HMAC key,
+	// or the PEM certificate and private key of this side of mTLS.
+	SecretID string `json:"secretID" validate:"required_with=Type"`
+
+	// CASecretID is the Secret Manager secret of the PEM CA certificates verifying the other side of mTLS.
+	// The system roots verify the servers if unset. It is required for verifying the clients.
+	CASecretID string `json:"caSecretID"`
+
+	// TokenURL, ClientID and Scopes configure the OAuth2 client credentials flow.
+	TokenURL string   `json:"tokenURL" validate:"required_if=Type oauth2,omitempty,url"`
+	ClientID string   `json:"clientID" validate:"required_if=Type oauth2"`
+	Scopes   []string `json:"scopes"`
+
+	// MaxBodySize is the maximum size in bytes of the HMAC signed bodies of the inbound calls. The default is 64 MiB.
+	MaxBodySize int64 `json:"maxBodySize" validate:"gte=0"`
+}
+
+// CatalogConfig is a config of the catalog store of the seller adapter service.
+type CatalogConfig struct {
+	InstanceID string `json:"instanceID" validate:"required"`
+	DatabaseID string `json:"databaseID" validate:"required"`
+
+	// MaxBodySize is the maximum size in bytes of the catalog updates. The default is 64 MiB.
+	MaxBodySize int64 `json:"maxBodySize" validate:"gte=0"`
+}
+
+// AsyncConfig is a config of the requests pending in the seller system.
+type AsyncConfig struct {
+	InstanceID string `json:"instanceID" validate:"required"`
+	DatabaseID string `json:"databaseID" validate:"required"`
+
+	// TTL is the time for the seller system to post the callback, after which an error callback is sent instead.
+	// The default is 10m.
+	TTL string `json:"ttl"`
+
+	// ExpiryInterval is the interval of checking for the expired requests. The default is 30s.
+	ExpiryInterval string `json:"expiryInterval"`
 }
 
 // CallbackActionConfig is a config for Callback Action Service.
@@ -72,7 +202,16 @@ type CallbackActionConfig struct {
 	SubscriberID    string `json:"subscriberID" validate:"required"`
 	SubscriberURL   string `json:"subscriberURL" validate:"required,url"`
 	KeyID           string `json:"keyID" validate:"required"`
-	ONDCEnvironment string `json:"ONDCEnvironment"`
+	ONDCEnvironment string `json:"ONDCEnvironment" validate:"omitempty,oneof=staging pre-production production"`
+
+	// MetricsPort is the port serving the /metrics, /healthz and /readyz endpoints. The default is 9090.
+	MetricsPort int `json:"metricsPort"`
+
+	// ShutdownTimeout is the time for finishing the in-flight messages on SIGTERM. The default is 25s.
+	ShutdownTimeout string `json:"shutdownTimeout"`
+
+	// ClaimCheck offloads large payloads of the Pub/Sub messages to an object store.
+	ClaimCheck ClaimCheckConfig `json:"claimCheck"`
 }
 
 // MockRegistryConfig is a config for Mock Registry Service.
@@ -82,6 +221,54 @@ type MockRegistryConfig struct {
 	RegistryKeyset Keyset                  `json:"registryKeyset" validate:"required"`
 }
 
+// RateLimitConfig limits the requests of each network participant per action with token buckets.
+//
+// The limit of a request is looked up in Subscribers, then Actions, then Default.
+type RateLimitConfig struct {
+	Default RateLimit `json:"default"`
+
+	// Actions overrides the limit of the actions, e.g. "search".
+	Actions map[string]RateLimit `json:"actions" validate:"dive"`
+
+	// Subscribers overrides the limit of all actions of the subscriber IDs.
+	Subscribers map[string]RateLimit `json:"subscribers" validate:"dive"`
+}
+
+// RateLimit is a token bucket refilled at RequestsPerSecond up to Burst tokens.
+type RateLimit struct {
+	// RequestsPerSecond of zero means no limit.
+	RequestsPerSecond float64 `json:"requestsPerSecond" validate:"gte=0"`
+
+	// Burst is the maximum number of requests at once. The default is RequestsPerSecond rounded up.
+	Burst int `json:"burst" validate:"gte=0"`
+}
+
+// PolicyConfig is a config of the network participants allowed to send requests.
+//
+// A request is rejected if it matches any of the Deny rules,
+// or if there are Allow rules and it matches none of them.
+type PolicyConfig struct {
+	Allow []PolicyRule `json:"allow" validate:"dive"`
+	Deny  []PolicyRule `json:"deny" validate:"dive"`
+}
+
+// PolicyRule matches the requests whose subscriber ID, domain and city are in the lists.
+// An empty list matches any value.
+type PolicyRule struct {
+	SubscriberIDs []string `json:"subscriberIDs"`
+	Domains       []string `json:"domains"`
+	Cities        []string `json:"cities"`
+}
+
+// ClaimCheckConfig is a config of the object store holding the payloads too large for Pub/Sub messages.
+type ClaimCheckConfig struct {
+	// StoreURL is either "gs://bucket/prefix" or "file:///directory". Payloads are not offloaded if unset.
+	StoreURL string `json:"storeURL" validate:"omitempty,url"`
+
+	// Threshold is the size in bytes above which payloads are offloaded. The default is 8 MiB.
+	Threshold int `json:"threshold" validate:"gte=0"`
+}
+
 // Keyset is a set of singing/encryption key pairs.
 type Keyset struct {
 	PublicSigningKey     string `json:"publicSigningKey" validate:"required"`
@@ -97,16 +284,33 @@ type MockSellerSystemConfig struct {
 
 // MockGatewayConfig is a config for Mock Gateway Service.
 type MockGatewayConfig struct {
-	Port         int      `json:"port" validate:"required"`
-	SubscriberID string   `json:"subscriberID" validate:"required"`
-	ProjectID    string   `json:"projectID" validate:"required"`
-	SecretID     string   `json:"secretID" validate:"required"`
-	RegistryURL  string   `json:"registryURL" validate:"required,url"`
-	BPPURLs      []string `json:"bppURLs" validate:"required,dive,url"`
-	BAPURLs      []string `json:"bapURLs" validate:"required,dive,url"`
+	Port         int    `json:"port" validate:"required"`
+	SubscriberID string `json:"subscriberID" validate:"required"`
+	ProjectID    string `json:"projectID" validate:"required"`
+	SecretID     string `json:"secretID" validate:"required"`
+	RegistryURL  string `json:"registryURL" validate:"omitempty,url"`
+
+	// BPPCacheTTL is a duration string e.g. "5m" for caching the BPPs looked up from the registry.
+	// The default is 5 minutes.
+	BPPCacheTTL string `json:"bppCacheTTL"`
+
+	// MaxParallelDeliveries limits the concurrent requests of a fan-out. The default is 10.
+	MaxParallelDeliveries int `json:"maxParallelDeliveries" validate:"omitempty,min=1"`
+
+	// DeliveryTimeout is a duration string e.g. "10s" bounding each request of a fan-out.
+	// The default is 10 seconds.
+	DeliveryTimeout string `json:"deliveryTimeout"`
+
+	// TransactionTTL is a duration string e.g. "30m" for accepting on_search of a forwarded search.
+	// The default is 30 minutes.
+	TransactionTTL string `json:"transactionTTL"`
+
+	// ShutdownTimeout is the time for finishing the in-flight requests on SIGTERM. The default is 25s.
+	// The fan-outs of the ACKed requests are completed after it.
+	ShutdownTimeout string `json:"shutdownTimeout"`
 
 	KeyID           string `json:"keyID" validate:"required"`
-	ONDCEnvironment string `json:"ONDCEnvironment"`
+	ONDCEnvironment string `json:"ONDCEnvironment" validate:"omitempty,oneof=staging pre-production production"`
 }
 
 // BAPAPIConfig is a config for BAP API service.
@@ -115,10 +319,29 @@ type BAPAPIConfig struct {
 	ProjectID       string `json:"projectID" validate:"required"`
 	TopicID         string `json:"topicID" validate:"required"`
 	Port            int    `json:"port" validate:"required"`
-	RegistryURL     string `json:"registryURL" validate:"required,url"`
+	RegistryURL     string `json:"registryURL" validate:"omitempty,url"`
 	InstanceID      string `json:"instanceID" validate:"required"`
 	DatabaseID      string `json:"databaseID" validate:"required"`
-	ONDCEnvironment string `json:"ONDCEnvironment"`
+	ONDCEnvironment string `json:"ONDCEnvironment" validate:"omitempty,oneof=staging pre-production production"`
+
+	// MetricsPort is the port serving the /metrics, /healthz and /readyz endpoints. The default is 9090.
+	MetricsPort int `json:"metricsPort"`
+
+	// ShutdownTimeout is the time for finishing the in-flight requests on SIGTERM. The default is 25s.
+	ShutdownTimeout string `json:"shutdownTimeout"`
+
+	// RateLimit limits the requests of each network participant. No limit is applied by default.
+	RateLimit RateLimitConfig `json:"rateLimit"`
+
+	// PolicyPath is the path of the PolicyConfig file allowing or denying network participants.
+	// The file is reloaded when it changes. No policy is applied if unset.
+	PolicyPath string `json:"policyPath"`
+
+	// MaxBodySize is the maximum size in bytes of request bodies, after decompression. The default is 64 MiB.
+	MaxBodySize int64 `json:"maxBodySize" validate:"gte=0"`
+
+	// ClaimCheck offloads large payloads of the Pub/Sub messages to an object store.
+	ClaimCheck ClaimCheckConfig `json:"claimCheck"`
 }
 
 // RequestActionConfig is a config for Request Action Service.
@@ -134,7 +357,16 @@ type RequestActionConfig struct {
 	SubscriberID    string `json:"subscriberID" validate:"required"`
 	SubscriberURL   string `json:"subscriberURL" validate:"required,url"`
 	KeyID           string `json:"keyID" validate:"required"`
-	ONDCEnvironment string `json:"ONDCEnvironment"`
+	ONDCEnvironment string `json:"ONDCEnvironment" validate:"omitempty,oneof=staging pre-production production"`
+
+	// MetricsPort is the port serving the /metrics, /healthz and /readyz endpoints. The default is 9090.
+	MetricsPort int `json:"metricsPort"`
+
+	// ShutdownTimeout is the time for finishing the in-flight messages on SIGTERM. The default is 25s.
+	ShutdownTimeout string `json:"shutdownTimeout"`
+
+	// ClaimCheck offloads large payloads of the Pub/Sub messages to an object store.
+	ClaimCheck ClaimCheckConfig `json:"claimCheck"`
 }
 
 // BuyerAppConfig is a config for Buyer App Service.
@@ -142,7 +374,16 @@ type BuyerAppConfig struct {
 	ProjectID       string `json:"projectID" validate:"required"`
 	TopicID         string `json:"topicID" validate:"required"`
 	Port            int    `json:"port" validate:"required"`
-	ONDCEnvironment string `json:"ONDCEnvironment"`
+	ONDCEnvironment string `json:"ONDCEnvironment" validate:"omitempty,oneof=staging pre-production production"`
+
+	// MetricsPort is the port serving the /metrics, /healthz and /readyz endpoints. The default is 9090.
+	MetricsPort int `json:"metricsPort"`
+
+	// ShutdownTimeout is the time for finishing the in-flight requests on SIGTERM. The default is 25s.
+	ShutdownTimeout string `json:"shutdownTimeout"`
+
+	// ClaimCheck offloads large payloads of the Pub/Sub messages to an object store.
+	ClaimCheck ClaimCheckConfig `json:"claimCheck"`
 }
 
 // BuyerAdapterConfig is a config for Buyer Adapter Service.
@@ -150,13 +391,68 @@ type BuyerAdapterConfig struct {
 	ProjectID       string   `json:"projectID" validate:"required"`
 	BuyerAppURL     string   `json:"buyerAppURL" validate:"required,url"`
 	SubscriptionID  []string `json:"subscriptionID" validate:"required"`
-	ONDCEnvironment string   `json:"ONDCEnvironment"`
+	ONDCEnvironment string   `json:"ONDCEnvironment" validate:"omitempty,oneof=staging pre-production production"`
+
+	// MetricsPort is the port serving the /metrics, /healthz and /readyz endpoints. The default is 9090.
+	MetricsPort int `json:"metricsPort"`
+
+	// ShutdownTimeout is the time for finishing the in-flight messages on SIGTERM. The default is 25s.
+	ShutdownTimeout string `json:"shutdownTimeout"`
+
+	// ClaimCheck offloads large payloads of the Pub/Sub messages to an object store.
+	ClaimCheck ClaimCheckConfig `json:"claimCheck"`
+
+	// SearchResults merges the on_search responses per transaction for querying them if set.
+	SearchResults *SearchResultsConfig `json:"searchResults"`
+
+	// Webhook signs, routes and retries the deliveries of the callbacks to the buyer app.
+	Webhook WebhookConfig `json:"webhook"`
+
+	// APIPort is the port serving the search result and webhook delivery APIs for the buyer app. The default is 8080.
+	APIPort int `json:"apiPort"`
+}
+
+// SearchResultsConfig is a config of the search result store of the BAP adapter service.
+type SearchResultsConfig struct {
+	InstanceID string `json:"instanceID" validate:"required"`
+	DatabaseID string `json:"databaseID" validate:"required"`
+}
+
+// WebhookConfig is a config of the deliveries of the callbacks of the BAP adapter service to the buyer app.
+type WebhookConfig struct {
+	// SecretID is the Secret Manager secret of the HMAC key signing the deliveries. They are not signed if unset.
+	SecretID string `json:"secretID"`
+
+	// ActionURLs are the URLs receiving the callbacks of the actions, in place of buyerAppURL/<action>.
+	ActionURLs map[string]string `json:"actionURLs" validate:"dive,url"`
+
+	// TenantURLs are the base URLs of the buyer apps by their bap_id, receiving their callbacks at <url>/<action>.
+	// They take precedence over the action URLs.
+	TenantURLs map[string]string `json:"tenantURLs" validate:"dive,url"`
+
+	// MaxAttempts is the maximum number of attempts of a delivery. The default is 3.
+	MaxAttempts int `json:"maxAttempts" validate:"gte=0"`
+
+	// InitialBackoff is the wait before the first retry, doubling after every retry. The default is 1s.
+	InitialBackoff string `json:"initialBackoff"`
+
+	// MaxBackoff is the maximum wait before a retry. The default is 10s.
+	MaxBackoff string `json:"maxBackoff"`
+
+	// DeliveryLog records the deliveries for the webhook delivery API if set.
+	DeliveryLog *DeliveryLogConfig `json:"deliveryLog"`
+}
+
+// DeliveryLogConfig is a config of the webhook delivery log of the BAP adapter service.
+type DeliveryLogConfig struct {
+	InstanceID string `json:"instanceID" validate:"required"`
+	DatabaseID string `json:"databaseID" validate:"required"`
 }
 
 type config interface {
-	OnboardingConfig | BPPAPIConfig | SellerAdapterConfig | CallbackActionConfig |
+	OnboardingConfig | SubscribeConfig | BPPAPIConfig | SellerAdapterConfig | CallbackActionConfig |
 		MockRegistryConfig | MockSellerSystemConfig | MockGatewayConfig | BAPAPIConfig | RequestActionConfig |
-		BuyerAppConfig | BuyerAdapterConfig
+		BuyerAppConfig | BuyerAdapterConfig | PolicyConfig
 }
 
 // Read reads a file from filepath and parses the config file.
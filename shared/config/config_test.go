@@ -28,8 +28,10 @@ func TestReadOnboardingConfigSuccess(t *testing.T) {
 	want := OnboardingConfig{
 		ProjectID:             "bit-ondc",
 		Port:                  8080,
-		RequestID:             "340dff12-661c-40b1-8aba-e4c20046aeda",
 		SecretID:              "test-secret",
+		InstanceID:            "test-instance",
+		DatabaseID:            "test-database",
+		RegistrationID:        "340dff12661c40b18abae4c20046aeda",
 		RegistryEncryptPubKey: "MCowBQYDK2VuAyEAa9Wbpvd9SsrpOZFcynyt/TO3x0Yrqyys4NUGIvyxX2Q=",
 	}
 
@@ -42,6 +44,28 @@ func TestReadOnboardingConfigSuccess(t *testing.T) {
 	}
 }
 
+func TestReadSubscribeConfigSuccess(t *testing.T) {
+	const filename = "subscribe.json"
+	filepath := (testConfigDir + filename)
+	want := SubscribeConfig{
+		ProjectID:       "bit-ondc",
+		SecretID:        "test-secret",
+		PendingSecretID: "test-pending-secret",
+		InstanceID:      "test-instance",
+		DatabaseID:      "test-database",
+		RegistrationID:  "340dff12661c40b18abae4c20046aeda",
+		KeyValidity:     "8760h",
+	}
+
+	got, err := Read[SubscribeConfig](filepath)
+	if err != nil {
+		t.Fatalf("ReadConfig(%q) failed unexpectedly; err=%v", filename, err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ReadConfig(%q) mismatch (-want +got):\n%s", filename, diff)
+	}
+}
+
 func TestReadBPPAPIConfigSuccess(t *testing.T) {
 	const filename = "bpp_api.json"
 	filepath := (testConfigDir + filename)
@@ -54,6 +78,15 @@ func TestReadBPPAPIConfigSuccess(t *testing.T) {
 		GatewayURL:   "https://preprod.gateway.ondc.org",
 		InstanceID:   "test-instance",
 		DatabaseID:   "test-database",
+		RateLimit: RateLimitConfig{
+			Default: RateLimit{RequestsPerSecond: 10, Burst: 20},
+			Actions: map[string]RateLimit{
+				"search": {RequestsPerSecond: 50},
+			},
+			Subscribers: map[string]RateLimit{
+				"trusted-bap.com": {},
+			},
+		},
 	}
 
 	got, err := Read[BPPAPIConfig](filepath)
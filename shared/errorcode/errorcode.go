@@ -42,6 +42,8 @@ const (
 const (
 	ErrInvalidSignature ErrType = "Invalid Signature"
 	ErrInvalidRequest   ErrType = "Invalid Request"
+	ErrPolicy           ErrType = "Policy Error"
+	ErrInternal         ErrType = "Internal Error"
 )
 
 // This table does not contain all of ONDC error code
@@ -54,6 +56,11 @@ var lookupTable = map[lookupKey]int{
 
 	{role: RoleSellerApp, err: ErrInvalidRequest}:   30000,
 	{role: RoleSellerApp, err: ErrInvalidSignature}: 30016,
+	{role: RoleSellerApp, err: ErrInternal}:         31001,
+
+	// Policy errors are generic to the roles.
+	{role: RoleBuyerApp, err: ErrPolicy}:  50000,
+	{role: RoleSellerApp, err: ErrPolicy}: 50000,
 
 	{role: RoleLogistics, err: ErrInvalidSignature}: 60005,
 	{role: RoleLogistics, err: ErrInvalidRequest}:   60006,
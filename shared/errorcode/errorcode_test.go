@@ -34,6 +34,11 @@ func TestLookupSucess(t *testing.T) {
 			err:  ErrInvalidRequest,
 			want: 30000,
 		},
+		{
+			role: RoleSellerApp,
+			err:  ErrInternal,
+			want: 31001,
+		},
 		{
 			role: RoleLogistics,
 			err:  ErrInvalidRequest,
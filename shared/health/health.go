@@ -0,0 +1,270 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health provides the health and readiness endpoints and the graceful shutdown of the services.
+//
+// Kubernetes stops a pod by sending SIGTERM, so the services stop receiving new requests and messages,
+// finish the in-flight ones within the shutdown timeout, and report not ready in the meantime.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"golang.org/x/exp/slog"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/metrics"
+)
+
+// Paths of the endpoints.
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// DefaultShutdownTimeout is the default time for finishing the in-flight requests and messages.
+// It is shorter than the default termination grace period of Kubernetes pods.
+const DefaultShutdownTimeout = 25 * time.Second
+
+// checkTimeout bounds each readiness check, so a hanging dependency does not hang the probe.
+const checkTimeout = 5 * time.Second
+
+// Results of the readiness checks.
+const (
+	checkOK     = "ok"
+	checkFailed = "failed"
+)
+
+// Check reports whether a dependency of the service is available.
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Checker serves the health and readiness endpoints.
+type Checker struct {
+	checks       []Check
+	shuttingDown atomic.Bool
+}
+
+// NewChecker creates a checker running the checks for readiness.
+func NewChecker(checks ...Check) *Checker {
+	return &Checker{checks: checks}
+}
+
+// ShutDown makes the service report not ready.
+func (c *Checker) ShutDown() {
+	c.shuttingDown.Store(true)
+}
+
+// WithEndpoints serves the health and readiness endpoints and delegates other requests to the handler.
+//
+// The endpoints bypass the middleware of the handler, e.g. authentication.
+func (c *Checker) WithEndpoints(handler http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(LivenessPath, c.liveness)
+	mux.HandleFunc(ReadinessPath, c.readiness)
+	mux.Handle("/", handler)
+	return mux
+}
+
+// liveness reports that the process is serving.
+func (c *Checker) liveness(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// readiness runs the checks in parallel and reports whether each check passed.
+//
+// The errors of the failed checks are logged, not reported, since they may reveal the details of the dependencies.
+func (c *Checker) readiness(w http.ResponseWriter, r *http.Request) {
+	if c.shuttingDown.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	results := make(map[string]string, len(c.checks))
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		ready = true
+	)
+	for _, check := range c.checks {
+		check := check
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := checkOK
+			if err := check.Check(ctx); err != nil {
+				slog.WarnContext(ctx, "Readiness check failed", "check", check.Name, "error", err)
+				result = checkFailed
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[check.Name] = result
+			ready = ready && result == checkOK
+		}()
+	}
+	wg.Wait()
+
+	body, err := json.Marshal(results)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(body)
+}
+
+// TopicCheck checks that the Pub/Sub topic exists.
+func TopicCheck(topic *pubsub.Topic) Check {
+	return Check{
+		Name: "topic/" + topic.ID(),
+		Check: func(ctx context.Context) error {
+			ok, err := topic.Exists(ctx)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errors.New("topic does not exist")
+			}
+			return nil
+		},
+	}
+}
+
+// SubscriptionCheck checks that the Pub/Sub subscription exists.
+func SubscriptionCheck(sub *pubsub.Subscription) Check {
+	return Check{
+		Name: "subscription/" + sub.ID(),
+		Check: func(ctx context.Context) error {
+			ok, err := sub.Exists(ctx)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errors.New("subscription does not exist")
+			}
+			return nil
+		},
+	}
+}
+
+// ParseShutdownTimeout parses the shutdown timeout of a service config. An empty string returns DefaultShutdownTimeout.
+func ParseShutdownTimeout(s string) (time.Duration, error) {
+	if s == "" {
+		return DefaultShutdownTimeout, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid shutdown timeout: %v", err)
+	}
+	return d, nil
+}
+
+// ListenAndServe serves HTTP requests until ctx is done, then shuts the server down gracefully.
+//
+// The checker reports not ready during the shutdown. The in-flight requests are given the timeout to finish.
+// The server serves HTTPS with the certificates of its TLS config if it is set.
+func ListenAndServe(ctx context.Context, server *http.Server, checker *Checker, timeout time.Duration) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			serveErr <- server.ListenAndServeTLS("", "")
+			return
+		}
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down the HTTP server", "timeout", timeout)
+	checker.ShutDown()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shut down HTTP server: %v", err)
+	}
+	return nil
+}
+
+// ServeInBackground serves the metrics, health and readiness endpoints on the port in a new goroutine until ctx is done.
+//
+// metrics.DefaultPort is used if the port is zero. It is for services without an HTTP server, e.g. Pub/Sub workers.
+func ServeInBackground(ctx context.Context, port int, checker *Checker) {
+	if port == 0 {
+		port = metrics.DefaultPort
+	}
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: checker.WithEndpoints(metrics.WithEndpoint(http.NotFoundHandler())),
+	}
+
+	go func() {
+		// Probes and scrapes are short, so the server is given little time to finish them.
+		if err := ListenAndServe(ctx, server, checker, time.Second); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Serving metrics and health endpoints failed", "error", err)
+		}
+	}()
+}
+
+// DelayCancel returns a copy of the parent context that is canceled the delay after the parent is done.
+//
+// The context of the sub.Receive handlers is canceled as soon as the shutdown starts,
+// so the handlers use it to finish the in-flight messages within the shutdown timeout.
+func DelayCancel(parent context.Context, delay time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(withoutCancel{parent})
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-parent.Done():
+		}
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+			cancel()
+		}
+	}()
+	return ctx, cancel
+}
+
+// withoutCancel keeps the values of the context, but is never canceled.
+type withoutCancel struct {
+	context.Context
+}
+
+func (withoutCancel) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (withoutCancel) Done() <-chan struct{}       { return nil }
+func (withoutCancel) Err() error                  { return nil }
@@ -0,0 +1,176 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/pubsubtest"
+)
+
+func okCheck(name string) Check {
+	return Check{Name: name, Check: func(context.Context) error { return nil }}
+}
+
+func failedCheck(name string) Check {
+	return Check{Name: name, Check: func(context.Context) error { return errors.New("unavailable") }}
+}
+
+func TestEndpoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		checks     []Check
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "liveness",
+			checks:     []Check{failedCheck("spanner")},
+			path:       LivenessPath,
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:       "ready",
+			checks:     []Check{okCheck("spanner"), okCheck("topic/search")},
+			path:       ReadinessPath,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"spanner":"ok","topic/search":"ok"}`,
+		},
+		{
+			name:       "not ready",
+			checks:     []Check{okCheck("spanner"), failedCheck("topic/search")},
+			path:       ReadinessPath,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `{"spanner":"ok","topic/search":"failed"}`,
+		},
+		{
+			name:       "other path",
+			path:       "/search",
+			wantStatus: http.StatusTeapot,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := NewChecker(test.checks...).WithEndpoints(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			}))
+
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+			if got := response.Code; got != test.wantStatus {
+				t.Errorf("GET %s status = %d, want %d", test.path, got, test.wantStatus)
+			}
+			if got := response.Body.String(); got != test.wantBody {
+				t.Errorf("GET %s body = %q, want %q", test.path, got, test.wantBody)
+			}
+		})
+	}
+}
+
+func TestReadinessShuttingDown(t *testing.T) {
+	checker := NewChecker(okCheck("spanner"))
+	checker.ShutDown()
+
+	response := httptest.NewRecorder()
+	checker.WithEndpoints(http.NotFoundHandler()).ServeHTTP(response, httptest.NewRequest(http.MethodGet, ReadinessPath, nil))
+	if got, want := response.Code, http.StatusServiceUnavailable; got != want {
+		t.Errorf("GET %s status = %d, want %d", ReadinessPath, got, want)
+	}
+}
+
+func TestPubSubChecks(t *testing.T) {
+	ctx := context.Background()
+	_, opt := pubsubtest.InitServer(t, "project", []pubsubtest.PubsubSetup{
+		{TopicID: "search", SubSetups: []pubsubtest.SubSetup{{SubID: "search-sub"}}},
+	})
+	client, err := pubsub.NewClient(ctx, "project", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, check := range []Check{TopicCheck(client.Topic("search")), SubscriptionCheck(client.Subscription("search-sub"))} {
+		if err := check.Check(ctx); err != nil {
+			t.Errorf("%s check failed: %v", check.Name, err)
+		}
+	}
+	for _, check := range []Check{TopicCheck(client.Topic("select")), SubscriptionCheck(client.Subscription("select-sub"))} {
+		if err := check.Check(ctx); err == nil {
+			t.Errorf("%s check succeeded unexpectedly", check.Name)
+		}
+	}
+}
+
+func TestListenAndServeShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	checker := NewChecker()
+	done := make(chan error)
+	go func() {
+		done <- ListenAndServe(ctx, &http.Server{Addr: "127.0.0.1:0"}, checker, time.Second)
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ListenAndServe() failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListenAndServe() did not return after the context is done")
+	}
+	if !checker.shuttingDown.Load() {
+		t.Errorf("checker is not shutting down")
+	}
+}
+
+func TestDelayCancel(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := DelayCancel(parent, 50*time.Millisecond)
+	defer cancel()
+
+	cancelParent()
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("context is canceled with the parent: %v", err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context is not canceled after the delay")
+	}
+}
+
+func TestParseShutdownTimeout(t *testing.T) {
+	if got, err := ParseShutdownTimeout(""); err != nil || got != DefaultShutdownTimeout {
+		t.Errorf(`ParseShutdownTimeout("") = %v, %v, want %v`, got, err, DefaultShutdownTimeout)
+	}
+	if got, err := ParseShutdownTimeout("10s"); err != nil || got != 10*time.Second {
+		t.Errorf(`ParseShutdownTimeout("10s") = %v, %v, want 10s`, got, err)
+	}
+	if _, err := ParseShutdownTimeout("10"); err == nil || !strings.Contains(err.Error(), "invalid shutdown timeout") {
+		t.Errorf(`ParseShutdownTimeout("10") error = %v, want invalid shutdown timeout`, err)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpauth authenticates the HTTP calls between the services and an external system, e.g. the seller system.
+//
+// Transport authenticates the outbound calls with a static bearer token, an OAuth2 token of the client credentials
+// flow, an HMAC signature of the body as defined by package webhook, or a client certificate of mTLS.
+// Inbound verifies the same credentials of the calls from the external system, except OAuth2 tokens.
+//
+// The credentials are read from Secret Manager when the service starts, so rotating them requires a restart.
+package httpauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/middleware"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/roundtrip"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/webhook"
+)
+
+// Authentication types of config.HTTPAuthConfig.
+const (
+	TypeBearer = "bearer"
+	TypeOAuth2 = "oauth2"
+	TypeHMAC   = "hmac"
+	TypeMTLS   = "mtls"
+)
+
+// SignatureTolerance is the maximum age of the timestamp of an HMAC signed inbound call.
+const SignatureTolerance = 5 * time.Minute
+
+// SecretReader reads the payload of the latest version of a Secret Manager secret.
+type SecretReader interface {
+	Secret(ctx context.Context, secretID string) ([]byte, error)
+}
+
+// Transport returns a transport authenticating the requests as configured.
+//
+// It is based on a clone of http.DefaultTransport, so it can be instrumented like the default transport.
+func Transport(ctx context.Context, conf config.HTTPAuthConfig, secrets SecretReader) (http.RoundTripper, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if conf.Type == "" {
+		return base, nil
+	}
+	secret, err := secrets.Secret(ctx, conf.SecretID)
+	if err != nil {
+		return nil, fmt.Errorf("read secret %q: %v", conf.SecretID, err)
+	}
+
+	switch conf.Type {
+	case TypeBearer:
+		token := strings.TrimSpace(string(secret))
+		return roundtrip.Func(func(r *http.Request) (*http.Response, error) {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+token)
+			return base.RoundTrip(r)
+		}), nil
+	case TypeOAuth2:
+		cc := clientcredentials.Config{
+			ClientID:     conf.ClientID,
+			ClientSecret: strings.TrimSpace(string(secret)),
+			TokenURL:     conf.TokenURL,
+			Scopes:       conf.Scopes,
+		}
+		// The token source outlives ctx, so it fetches the tokens with a background context.
+		tokenCtx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: base})
+		return &oauth2.Transport{Source: cc.TokenSource(tokenCtx), Base: base}, nil
+	case TypeHMAC:
+		return roundtrip.Func(func(r *http.Request) (*http.Response, error) {
+			body, err := readBody(r)
+			if err != nil {
+				return nil, err
+			}
+			r = r.Clone(r.Context())
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			now := time.Now()
+			r.Header.Set(webhook.TimestampHeader, fmt.Sprint(now.Unix()))
+			r.Header.Set(webhook.SignatureHeader, webhook.Sign(secret, now, body))
+			return base.RoundTrip(r)
+		}), nil
+	case TypeMTLS:
+		cert, err := tls.X509KeyPair(secret, secret)
+		if err != nil {
+			return nil, fmt.Errorf("parse certificate of secret %q: %v", conf.SecretID, err)
+		}
+		base.TLSClientConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		if conf.CASecretID != "" {
+			if base.TLSClientConfig.RootCAs, err = certPool(ctx, conf.CASecretID, secrets); err != nil {
+				return nil, err
+			}
+		}
+		return base, nil
+	default:
+		return nil, fmt.Errorf("unsupported authentication type %q", conf.Type)
+	}
+}
+
+// Inbound verifies the credentials of the inbound calls.
+type Inbound struct {
+	authType    string
+	secret      []byte
+	maxBodySize int64
+	tlsConfig   *tls.Config
+}
+
+// NewInbound reads the credentials verifying the inbound calls as configured.
+func NewInbound(ctx context.Context, conf config.HTTPAuthConfig, secrets SecretReader) (*Inbound, error) {
+	if conf.Type == "" {
+		return &Inbound{}, nil
+	}
+	secret, err := secrets.Secret(ctx, conf.SecretID)
+	if err != nil {
+		return nil, fmt.Errorf("read secret %q: %v", conf.SecretID, err)
+	}
+
+	in := &Inbound{authType: conf.Type}
+	switch conf.Type {
+	case TypeBearer:
+		in.secret = []byte(strings.TrimSpace(string(secret)))
+	case TypeHMAC:
+		in.secret = secret
+		in.maxBodySize = conf.MaxBodySize
+		if in.maxBodySize <= 0 {
+			in.maxBodySize = middleware.DefaultMaxBodySize
+		}
+	case TypeMTLS:
+		if conf.CASecretID == "" {
+			return nil, errors.New("client certificates cannot be verified without a CA secret")
+		}
+		cert, err := tls.X509KeyPair(secret, secret)
+		if err != nil {
+			return nil, fmt.Errorf("parse certificate of secret %q: %v", conf.SecretID, err)
+		}
+		clientCAs, err := certPool(ctx, conf.CASecretID, secrets)
+		if err != nil {
+			return nil, err
+		}
+		in.tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientCAs:    clientCAs,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			MinVersion:   tls.VersionTLS12,
+		}
+	default:
+		return nil, fmt.Errorf("unsupported inbound authentication type %q", conf.Type)
+	}
+	return in, nil
+}
+
+// TLSConfig returns the TLS config of the server requiring client certificates for mTLS, or nil for plain HTTP.
+func (in *Inbound) TLSConfig() *tls.Config {
+	return in.tlsConfig
+}
+
+// Adapter returns a middleware rejecting the unauthenticated calls with 401 Unauthorized.
+//
+// HMAC signed bodies larger than the configured maximum size are rejected with 413.
+func (in *Inbound) Adapter() middleware.Adapter {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := in.verify(w, r); err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// verify checks the credentials of the request. An HMAC signed body is restored for the handler.
+func (in *Inbound) verify(w http.ResponseWriter, r *http.Request) error {
+	switch in.authType {
+	case TypeBearer:
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), in.secret) != 1 {
+			return errors.New("invalid bearer token")
+		}
+	case TypeHMAC:
+		r.Body = http.MaxBytesReader(w, r.Body, in.maxBodySize)
+		body, err := readBody(r)
+		if err != nil {
+			return err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err := webhook.Verify(in.secret, r.Header, body, time.Now(), SignatureTolerance); err != nil {
+			return fmt.Errorf("invalid signature: %v", err)
+		}
+	case TypeMTLS:
+		// The TLS handshake verifies the certificate, unless the server is not serving TLS by mistake.
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			return errors.New("client certificate is required")
+		}
+	}
+	return nil
+}
+
+// certPool returns the pool of the PEM certificates of the secret.
+func certPool(ctx context.Context, secretID string, secrets SecretReader) (*x509.CertPool, error) {
+	pem, err := secrets.Secret(ctx, secretID)
+	if err != nil {
+		return nil, fmt.Errorf("read secret %q: %v", secretID, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("secret %q has no PEM certificate", secretID)
+	}
+	return pool, nil
+}
+
+// readBody reads and closes the body of the request, which may be nil.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	return body, nil
+}
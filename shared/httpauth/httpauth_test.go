@@ -0,0 +1,270 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+)
+
+type secrets map[string][]byte
+
+func (s secrets) Secret(_ context.Context, secretID string) ([]byte, error) {
+	return s[secretID], nil
+}
+
+// echo is a handler responding with the request body.
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.Copy(w, r.Body)
+})
+
+// call posts the body through the transport to the server and returns the response status and body.
+func call(t *testing.T, transport http.RoundTripper, url, body string) (int, string) {
+	t.Helper()
+	res, err := (&http.Client{Transport: transport}).Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Post() failed: %v", err)
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Reading response failed: %v", err)
+	}
+	return res.StatusCode, string(resBody)
+}
+
+func TestBearerAndHMAC(t *testing.T) {
+	ctx := context.Background()
+	s := secrets{"credential": []byte("s3cr3t\n"), "other": []byte("other")}
+
+	for _, authType := range []string{TypeBearer, TypeHMAC} {
+		t.Run(authType, func(t *testing.T) {
+			in, err := NewInbound(ctx, config.HTTPAuthConfig{Type: authType, SecretID: "credential"}, s)
+			if err != nil {
+				t.Fatalf("NewInbound() failed: %v", err)
+			}
+			srv := httptest.NewServer(in.Adapter()(echo))
+			defer srv.Close()
+
+			transport, err := Transport(ctx, config.HTTPAuthConfig{Type: authType, SecretID: "credential"}, s)
+			if err != nil {
+				t.Fatalf("Transport() failed: %v", err)
+			}
+			if status, body := call(t, transport, srv.URL, `{"a":1}`); status != http.StatusOK || body != `{"a":1}` {
+				t.Errorf("Authenticated call = %d %q, want 200 with the body", status, body)
+			}
+
+			wrong, err := Transport(ctx, config.HTTPAuthConfig{Type: authType, SecretID: "other"}, s)
+			if err != nil {
+				t.Fatalf("Transport() failed: %v", err)
+			}
+			if status, _ := call(t, wrong, srv.URL, `{"a":1}`); status != http.StatusUnauthorized {
+				t.Errorf("Call with other credential status = %d, want %d", status, http.StatusUnauthorized)
+			}
+			if status, _ := call(t, http.DefaultTransport, srv.URL, `{"a":1}`); status != http.StatusUnauthorized {
+				t.Errorf("Unauthenticated call status = %d, want %d", status, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestHMACBodyTooLarge(t *testing.T) {
+	ctx := context.Background()
+	s := secrets{"credential": []byte("s3cr3t")}
+	conf := config.HTTPAuthConfig{Type: TypeHMAC, SecretID: "credential", MaxBodySize: 8}
+
+	in, err := NewInbound(ctx, conf, s)
+	if err != nil {
+		t.Fatalf("NewInbound() failed: %v", err)
+	}
+	srv := httptest.NewServer(in.Adapter()(echo))
+	defer srv.Close()
+
+	transport, err := Transport(ctx, conf, s)
+	if err != nil {
+		t.Fatalf("Transport() failed: %v", err)
+	}
+	if status, body := call(t, transport, srv.URL, `{"a":1}`); status != http.StatusOK || body != `{"a":1}` {
+		t.Errorf("Call with a small body = %d %q, want 200 with the body", status, body)
+	}
+	if status, _ := call(t, transport, srv.URL, `{"a":123456}`); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Call with a large body status = %d, want %d", status, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestOAuth2(t *testing.T) {
+	ctx := context.Background()
+	var tokenRequests int
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		if id, secret, _ := r.BasicAuth(); id != "adapter" || secret != "client-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token": "access-token", "token_type": "Bearer", "expires_in": 3600}`)
+	}))
+	defer tokenServer.Close()
+
+	// The seller system accepts the access token as a static bearer token.
+	in, err := NewInbound(ctx, config.HTTPAuthConfig{Type: TypeBearer, SecretID: "token"}, secrets{"token": []byte("access-token")})
+	if err != nil {
+		t.Fatalf("NewInbound() failed: %v", err)
+	}
+	srv := httptest.NewServer(in.Adapter()(echo))
+	defer srv.Close()
+
+	conf := config.HTTPAuthConfig{Type: TypeOAuth2, SecretID: "client", TokenURL: tokenServer.URL, ClientID: "adapter"}
+	transport, err := Transport(ctx, conf, secrets{"client": []byte("client-secret")})
+	if err != nil {
+		t.Fatalf("Transport() failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if status, _ := call(t, transport, srv.URL, `{}`); status != http.StatusOK {
+			t.Errorf("Call %d status = %d, want %d", i, status, http.StatusOK)
+		}
+	}
+	if tokenRequests != 1 {
+		t.Errorf("Token requests = %d, want 1 as the token is cached", tokenRequests)
+	}
+}
+
+func TestMTLS(t *testing.T) {
+	ctx := context.Background()
+	caPEM, serverPEM, clientPEM := generateCertificates(t)
+	s := secrets{"ca": caPEM, "server": serverPEM, "client": clientPEM}
+
+	in, err := NewInbound(ctx, config.HTTPAuthConfig{Type: TypeMTLS, SecretID: "server", CASecretID: "ca"}, s)
+	if err != nil {
+		t.Fatalf("NewInbound() failed: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(in.Adapter()(echo))
+	srv.TLS = in.TLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	transport, err := Transport(ctx, config.HTTPAuthConfig{Type: TypeMTLS, SecretID: "client", CASecretID: "ca"}, s)
+	if err != nil {
+		t.Fatalf("Transport() failed: %v", err)
+	}
+	if status, body := call(t, transport, srv.URL, `{"a":1}`); status != http.StatusOK || body != `{"a":1}` {
+		t.Errorf("Authenticated call = %d %q, want 200 with the body", status, body)
+	}
+
+	// A client trusting the server but without a certificate fails the handshake.
+	noCert, err := Transport(ctx, config.HTTPAuthConfig{}, s)
+	if err != nil {
+		t.Fatalf("Transport() failed: %v", err)
+	}
+	noCert.(*http.Transport).TLSClientConfig = transport.(*http.Transport).TLSClientConfig.Clone()
+	noCert.(*http.Transport).TLSClientConfig.Certificates = nil
+	if _, err := (&http.Client{Transport: noCert}).Post(srv.URL, "application/json", strings.NewReader("{}")); err == nil {
+		t.Error("Call without client certificate succeeded unexpectedly")
+	}
+}
+
+func TestNewInboundFailed(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.HTTPAuthConfig
+	}{
+		{name: "oauth2", conf: config.HTTPAuthConfig{Type: TypeOAuth2, SecretID: "secret"}},
+		{name: "mtls without CA", conf: config.HTTPAuthConfig{Type: TypeMTLS, SecretID: "secret"}},
+		{name: "mtls with invalid certificate", conf: config.HTTPAuthConfig{Type: TypeMTLS, SecretID: "secret", CASecretID: "secret"}},
+	}
+	for _, test := range tests {
+		if _, err := NewInbound(context.Background(), test.conf, secrets{"secret": []byte("not a certificate")}); err == nil {
+			t.Errorf("NewInbound() with %s succeeded unexpectedly", test.name)
+		}
+	}
+}
+
+// generateCertificates returns a PEM CA certificate, and PEM certificates with private keys of a server
+// on 127.0.0.1 and a client signed by the CA.
+func generateCertificates(t *testing.T) (caPEM, serverPEM, clientPEM []byte) {
+	t.Helper()
+
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	encode := func(der []byte, key *ecdsa.PrivateKey) []byte {
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		if key == nil {
+			return certPEM
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	}
+
+	caKey := newKey()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(serial int64, usage x509.ExtKeyUsage, ips []net.IP) []byte {
+		key := newKey()
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "test"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  ips,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encode(der, key)
+	}
+	return encode(caDER, nil), issue(2, x509.ExtKeyUsageServerAuth, []net.IP{net.ParseIP("127.0.0.1")}), issue(3, x509.ExtKeyUsageClientAuth, nil)
+}
@@ -0,0 +1,135 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging provides structured JSON logging shared by the services.
+//
+// Log lines written with a context carry the correlation fields attached to the context by With,
+// e.g. the transaction ID and message ID of the ONDC request being handled.
+package logging
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"golang.org/x/exp/slog"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+// LevelEnv is the environment variable setting the minimum level of the logs, e.g. DEBUG.
+const LevelEnv = "LOG_LEVEL"
+
+// Keys of the correlation fields.
+const (
+	TransactionIDKey   = "transaction_id"
+	MessageIDKey       = "message_id"
+	ActionKey          = "action"
+	SubscriberIDKey    = "subscriber_id"
+	PubSubMessageIDKey = "pubsub_message_id"
+)
+
+type contextKey struct{}
+
+// Init sets the default logger writing JSON logs to stderr.
+//
+// The level is read from the LevelEnv environment variable and defaults to INFO.
+func Init() {
+	var level slog.Level
+	levelText, ok := os.LookupEnv(LevelEnv)
+	err := level.UnmarshalText([]byte(levelText))
+	slog.SetDefault(slog.New(NewHandler(os.Stderr, level)))
+	if ok && err != nil {
+		slog.Warn("Invalid log level, INFO is used", "level", levelText, "error", err)
+	}
+}
+
+// NewHandler returns a handler writing JSON logs with the correlation fields of the context.
+func NewHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	return contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})}
+}
+
+// Exit logs the error and exits the program.
+func Exit(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// With returns a copy of the context carrying the correlation fields.
+//
+// A field replaces the field with the same key already in the context.
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	current, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(current)+len(attrs))
+	for _, attr := range current {
+		if !containsKey(attrs, attr.Key) {
+			merged = append(merged, attr)
+		}
+	}
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, contextKey{}, merged)
+}
+
+// WithMessageContext returns a copy of the context carrying the transaction ID, message ID and action of the ONDC message.
+func WithMessageContext(ctx context.Context, msgContext model.Context) context.Context {
+	attrs := []slog.Attr{slog.String(ActionKey, msgContext.Action)}
+	if msgContext.TransactionID != nil {
+		attrs = append(attrs, slog.String(TransactionIDKey, *msgContext.TransactionID))
+	}
+	if msgContext.MessageID != nil {
+		attrs = append(attrs, slog.String(MessageIDKey, *msgContext.MessageID))
+	}
+	return With(ctx, attrs...)
+}
+
+// WithPayloadContext is like WithMessageContext, but reads the ONDC context from the JSON payload.
+//
+// Payloads without a valid context are ignored, since logging must not fail the request.
+func WithPayloadContext(ctx context.Context, payload []byte) context.Context {
+	msgContext, ok := decodeContext(payload)
+	if !ok {
+		return ctx
+	}
+	return WithMessageContext(ctx, msgContext)
+}
+
+func containsKey(attrs []slog.Attr, key string) bool {
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// contextHandler adds the correlation fields of the context to the records.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(contextKey{}).([]slog.Attr); ok {
+		record = record.Clone()
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
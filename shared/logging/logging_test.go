@@ -0,0 +1,104 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/exp/slog"
+)
+
+func TestWith(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(NewHandler(&logs, slog.LevelInfo))
+
+	ctx := WithPayloadContext(context.Background(), []byte(`{"context":{"action":"search","transaction_id":"tx-1","message_id":"msg-1"}}`))
+	ctx = With(ctx, slog.String(PubSubMessageIDKey, "1"), slog.String(ActionKey, "on_search"))
+	logger.InfoContext(ctx, "Handle the message", "status_code", 200)
+
+	var got map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &got); err != nil {
+		t.Fatalf("Log line is not valid JSON: %v\n%s", err, logs.String())
+	}
+	delete(got, "time")
+	want := map[string]any{
+		"level":             "INFO",
+		"msg":               "Handle the message",
+		"status_code":       float64(200),
+		"transaction_id":    "tx-1",
+		"message_id":        "msg-1",
+		"action":            "on_search",
+		"pubsub_message_id": "1",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Log line diff (-want, +got):\n%s", diff)
+	}
+}
+
+func TestWithPayloadContextInvalid(t *testing.T) {
+	ctx := context.Background()
+	for _, payload := range []string{"", "not JSON", `{"message":{}}`} {
+		if got := WithPayloadContext(ctx, []byte(payload)); got != ctx {
+			t.Errorf("WithPayloadContext(%q) added fields to the context", payload)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	payload := `{
+		"context": {"transaction_id": "tx-1"},
+		"message": {"order": {
+			"billing": {"name": "Ravi", "phone": "9886098860", "email": "ravi@example.com", "address": {"city": "Bengaluru"}},
+			"fulfillments": [{"end": {"location": {"gps": "12.9,77.6"}, "contact": {"phone": "9886098860"}, "person": {"name": "Ravi"}}}],
+			"provider": {"descriptor": {"name": "Store"}}
+		}}
+	}`
+	want := `{
+		"context": {"transaction_id": "tx-1"},
+		"message": {"order": {
+			"billing": {"name": "[REDACTED]", "phone": "[REDACTED]", "email": "[REDACTED]", "address": "[REDACTED]"},
+			"fulfillments": [{"end": {"location": {"gps": "[REDACTED]"}, "contact": {"phone": "[REDACTED]"}, "person": {"name": "[REDACTED]"}}}],
+			"provider": {"descriptor": {"name": "Store"}}
+		}}
+	}`
+
+	got, err := Redact([]byte(payload))
+	if err != nil {
+		t.Fatalf("Redact() failed: %v", err)
+	}
+	var gotValue, wantValue any
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(wantValue, gotValue); diff != "" {
+		t.Errorf("Redact() diff (-want, +got):\n%s", diff)
+	}
+}
+
+func TestPayloadInvalidJSON(t *testing.T) {
+	var logs bytes.Buffer
+	slog.New(NewHandler(&logs, slog.LevelInfo)).Info("Request body", Payload([]byte(`{"phone": "9886098860"`)))
+
+	if bytes.Contains(logs.Bytes(), []byte("9886098860")) {
+		t.Errorf("Invalid payload is logged: %s", logs.String())
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/exp/slog"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+)
+
+const redacted = "[REDACTED]"
+
+// piiFields are the fields of ONDC payloads containing personal data of the customers,
+// e.g. the billing and fulfillment contacts and addresses.
+var piiFields = map[string]bool{
+	"address": true,
+	"phone":   true,
+	"email":   true,
+	"gps":     true,
+}
+
+// piiNameParents are the objects whose name field is the name of a customer.
+var piiNameParents = map[string]bool{
+	"billing": true,
+	"person":  true,
+}
+
+// Payload returns an attribute logging the JSON payload with personal data redacted.
+//
+// The payload is only parsed when the log line is written.
+func Payload(payload []byte) slog.Attr {
+	return slog.Any("payload", redactedPayload(payload))
+}
+
+type redactedPayload []byte
+
+func (p redactedPayload) LogValue() slog.Value {
+	if len(p) == 0 {
+		return slog.StringValue("")
+	}
+	redactedJSON, err := Redact(p)
+	if err != nil {
+		// The payload cannot be redacted, so it must not be logged.
+		return slog.StringValue(fmt.Sprintf("<invalid JSON payload of %d bytes>", len(p)))
+	}
+	return slog.AnyValue(json.RawMessage(redactedJSON))
+}
+
+// Redact returns the JSON payload with the values of the personal data fields replaced.
+func Redact(payload []byte) ([]byte, error) {
+	var v any
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(redactValue("", v))
+}
+
+func redactValue(parent string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if piiFields[key] || (key == "name" && piiNameParents[parent]) {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redactValue(key, value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactValue(parent, value)
+		}
+	}
+	return v
+}
+
+// decodeContext decodes only the ONDC context of the JSON payload.
+func decodeContext(payload []byte) (model.Context, bool) {
+	var body struct {
+		Context *model.Context `json:"context"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil || body.Context == nil {
+		return model.Context{}, false
+	}
+	return *body.Context, true
+}
@@ -0,0 +1,186 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics provides Prometheus metrics shared by the services.
+//
+// All metrics are registered in the default Prometheus registry and exported by Handler.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/roundtrip"
+)
+
+// Path is the path of the metrics endpoint.
+const Path = "/metrics"
+
+// DefaultPort is the port serving the metrics endpoint of services without an HTTP server.
+const DefaultPort = 9090
+
+const namespace = "ondc"
+
+// Statuses of an ONDC request.
+const (
+	StatusACK   = "ACK"
+	StatusNACK  = "NACK"
+	StatusError = "ERROR"
+)
+
+// Outcomes of an operation.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Number of incoming ONDC requests by action and ACK status.",
+	}, []string{"action", "status"})
+
+	requestLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Latency of incoming ONDC requests by action and ACK status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"action", "status"})
+
+	authFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Number of requests failing signature authentication by header and reason.",
+	}, []string{"header", "reason"})
+
+	rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Number of requests rejected by rate limiting by subscriber ID and action.",
+	}, []string{"subscriber_id", "action"})
+
+	policyRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "policy_rejected_requests_total",
+		Help:      "Number of requests rejected by the allow/deny policy by subscriber ID and reason.",
+	}, []string{"subscriber_id", "reason"})
+
+	registryCalls = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "registry_call_duration_seconds",
+		Help:      "Latency of ONDC registry API calls by API and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"api", "outcome"})
+
+	pubsubMessages = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "pubsub_message_duration_seconds",
+		Help:      "Processing time of Pub/Sub messages by subscription, action and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"subscription", "action", "outcome"})
+
+	outboundRequests = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "outbound_request_duration_seconds",
+		Help:      "Latency of outbound HTTP requests by counterparty host and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"counterparty", "status"})
+)
+
+// Handler returns the handler of the metrics endpoint.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// WithEndpoint serves the metrics endpoint at Path and delegates other requests to the handler.
+//
+// The metrics endpoint bypasses the middleware of the handler, e.g. authentication.
+func WithEndpoint(handler http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(Path, Handler())
+	mux.Handle("/", handler)
+	return mux
+}
+
+// ObserveRequest records an incoming ONDC request.
+func ObserveRequest(action, status string, latency time.Duration) {
+	requests.WithLabelValues(action, status).Inc()
+	requestLatency.WithLabelValues(action, status).Observe(latency.Seconds())
+}
+
+// AuthFailure records a request failing signature authentication.
+func AuthFailure(header, reason string) {
+	authFailures.WithLabelValues(header, reason).Inc()
+}
+
+// RateLimited records a request rejected by rate limiting.
+//
+// The subscriber ID is authenticated, so the cardinality is bounded by the network participants.
+func RateLimited(subscriberID, action string) {
+	rateLimited.WithLabelValues(subscriberID, action).Inc()
+}
+
+// PolicyRejected records a request rejected by the allow/deny policy.
+func PolicyRejected(subscriberID, reason string) {
+	policyRejections.WithLabelValues(subscriberID, reason).Inc()
+}
+
+// ObserveRegistryCall records a call to the ONDC registry API.
+func ObserveRegistryCall(api string, err error, latency time.Duration) {
+	registryCalls.WithLabelValues(api, outcome(err)).Observe(latency.Seconds())
+}
+
+// ObservePubSubMessage records the processing of a Pub/Sub message.
+func ObservePubSubMessage(subscription, action, outcome string, latency time.Duration) {
+	pubsubMessages.WithLabelValues(subscription, action, outcome).Observe(latency.Seconds())
+}
+
+// InstrumentTransport records the outbound requests sent through the transport.
+//
+// The counterparty is the host of the request URL, so the cardinality is bounded by the network participants.
+func InstrumentTransport(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return roundtrip.Func(func(r *http.Request) (*http.Response, error) {
+		start := time.Now()
+		response, err := transport.RoundTrip(r)
+		status := StatusError
+		if err == nil {
+			status = strconv.Itoa(response.StatusCode)
+		}
+		outboundRequests.WithLabelValues(r.URL.Host, status).Observe(time.Since(start).Seconds())
+		return response, err
+	})
+}
+
+// InstrumentClient returns a copy of the HTTP client recording its outbound requests.
+func InstrumentClient(client *http.Client) *http.Client {
+	instrumented := *client
+	instrumented.Transport = InstrumentTransport(client.Transport)
+	return &instrumented
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape returns the metrics exported by the endpoint.
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	response := httptest.NewRecorder()
+	Handler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, Path, nil))
+	if response.Code != http.StatusOK {
+		t.Fatalf("scrape metrics: status code %d", response.Code)
+	}
+	return response.Body.String()
+}
+
+func TestWithEndpoint(t *testing.T) {
+	var called bool
+	handler := WithEndpoint(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, Path, nil))
+	if called {
+		t.Errorf("GET %s is delegated to the handler", Path)
+	}
+	if body := response.Body.String(); !strings.Contains(body, "# HELP") {
+		t.Errorf("GET %s body = %q, want metrics", Path, body)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/search", nil))
+	if !called {
+		t.Errorf("POST /search is not delegated to the handler")
+	}
+}
+
+func TestObserve(t *testing.T) {
+	ObserveRequest("on_search", StatusNACK, time.Second)
+	AuthFailure("Authorization", "invalid_signature")
+	RateLimited("bap.example.com", "search")
+	PolicyRejected("bap.example.com", "denied")
+	ObserveRegistryCall("lookup", errors.New("registry is down"), time.Second)
+	ObservePubSubMessage("search-sub", "search", OutcomeSuccess, time.Second)
+
+	got := scrape(t)
+	for _, want := range []string{
+		`ondc_requests_total{action="on_search",status="NACK"} 1`,
+		`ondc_request_duration_seconds_count{action="on_search",status="NACK"} 1`,
+		`ondc_auth_failures_total{header="Authorization",reason="invalid_signature"} 1`,
+		`ondc_rate_limited_requests_total{action="search",subscriber_id="bap.example.com"} 1`,
+		`ondc_policy_rejected_requests_total{reason="denied",subscriber_id="bap.example.com"} 1`,
+		`ondc_registry_call_duration_seconds_count{api="lookup",outcome="failure"} 1`,
+		`ondc_pubsub_message_duration_seconds_count{action="search",outcome="success",subscription="search-sub"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+}
+
+func TestInstrumentClient(t *testing.T) {
+	counterparty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer counterparty.Close()
+
+	client := InstrumentClient(http.DefaultClient)
+	response, err := client.Post(counterparty.URL+"/on_search", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Post() failed: %v", err)
+	}
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+
+	u, err := url.Parse(counterparty.URL)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	want := `ondc_outbound_request_duration_seconds_count{counterparty="` + u.Host + `",status="400"} 1`
+	if got := scrape(t); !strings.Contains(got, want) {
+		t.Errorf("metrics do not contain %q", want)
+	}
+	if http.DefaultClient.Transport != nil {
+		t.Errorf("InstrumentClient() modified the given client")
+	}
+}
@@ -17,19 +17,34 @@ package middleware
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/benbjohnson/clock"
-	log "github.com/golang/glog"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"golang.org/x/exp/slog"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/compression"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/errorcode"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/logging"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/metrics"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/policy"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/ratelimit"
 	auth "partner-innovation.googlesource.com/googleondcaccelerator.git/shared/signing-authentication/authentication"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/tracing"
 )
 
+// DefaultMaxBodySize is the default maximum size in bytes of request bodies.
+const DefaultMaxBodySize = 64 << 20
+
 // Adapter wraps an handler and return a new handler
 type Adapter func(handler http.Handler) http.Handler
 
@@ -38,6 +53,21 @@ type RegistryClient interface {
 	PublicSigningKey(subscriberID, uniqueKeyID string, domain model.Context) ([]byte, error)
 }
 
+// subscriberIDKey is the context key of the authenticated subscriber ID.
+type subscriberIDKey struct{}
+
+// bodyKey is the context key of the request body read by the ReadBody middleware.
+type bodyKey struct{}
+
+// ondcContextKey is the context key of the ONDC context of an authenticated request.
+type ondcContextKey struct{}
+
+// AuthenticatedSubscriber returns the subscriber ID authenticated by the authentication middleware.
+func AuthenticatedSubscriber(ctx context.Context) (string, bool) {
+	subscriberID, ok := ctx.Value(subscriberIDKey{}).(string)
+	return subscriberID, ok
+}
+
 // Adapt wraps the given handler with a list of adapters.
 //
 // The first adapter of the parameters is the innermost middleware.
@@ -53,7 +83,7 @@ func OnlyPostMethod() Adapter {
 	return func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.Method != http.MethodPost {
-				log.Errorf("Invalid HTTP method: got %q, want %q", r.Method, http.MethodPost)
+				slog.ErrorContext(r.Context(), "Invalid HTTP method", "method", r.Method)
 				w.WriteHeader(http.StatusMethodNotAllowed)
 				return
 			}
@@ -65,21 +95,246 @@ func OnlyPostMethod() Adapter {
 }
 
 // Logging is a middleware for logging incoming request detail.
+//
+// It adds the correlation fields of the ONDC context in the request body to the request context,
+// and logs the body with personal data redacted at DEBUG level.
 func Logging() Adapter {
 	return func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			log.Infof("Got a request from %s", r.Host)
-			if log.V(1) {
-				body, _ := io.ReadAll(r.Body)
-				r.Body = io.NopCloser(bytes.NewBuffer(body))
-				log.Infof("Request body:\n%s", body)
+			body, _ := RequestBody(r)
+
+			ctx := logging.WithPayloadContext(r.Context(), body)
+			slog.InfoContext(ctx, "Got a request", "host", r.Host, "path", r.URL.Path)
+			slog.DebugContext(ctx, "Request body", logging.Payload(body))
+
+			handler.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// unknownAction is the action of the requests to the paths not registered in the mux.
+const unknownAction = "unknown"
+
+// requestAction returns the pattern of the mux handling the request without the leading slash, or unknownAction for
+// the unregistered paths, so the callers cannot create a metric series or a rate limit bucket per path.
+func requestAction(mux *http.ServeMux, r *http.Request) string {
+	if _, pattern := mux.Handler(r); pattern != "" {
+		return strings.TrimPrefix(pattern, "/")
+	}
+	return unknownAction
+}
+
+// Metrics is a middleware for recording the count and latency of requests per action and ACK status.
+//
+// The action is the pattern of the mux handling the request without the leading slash, or "unknown" for the
+// unregistered paths, so the callers cannot create a metric series per path.
+func Metrics(mux *http.ServeMux) Adapter {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+
+			handler.ServeHTTP(recorder, r)
+
+			metrics.ObserveRequest(requestAction(mux, r), ackStatus(recorder.statusCode), time.Since(start))
+		})
+	}
+}
+
+// Tracing is a middleware for starting a server span of each request, continuing the trace of the caller.
+//
+// It should be the outermost middleware, so the span covers the authentication.
+func Tracing() Adapter {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := tracing.StartHTTPServerSpan(r)
+			defer span.End()
+			recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+
+			handler.ServeHTTP(recorder, r.WithContext(ctx))
+
+			span.SetAttributes(semconv.HTTPStatusCode(recorder.statusCode))
+			if recorder.statusCode >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(recorder.statusCode))
+			}
+		})
+	}
+}
+
+// ReadBody is a middleware for reading the request body once into a buffer shared by the following middleware and handler.
+//
+// The body, decompressed if it is gzip encoded, is limited to maxBodySize bytes, and larger requests are rejected with 413.
+// It must be outside the other middleware reading the body, which get the buffer with RequestBody.
+// The responses advertise gzip support in the Accept-Encoding header, so the network participants may compress their requests.
+func ReadBody(maxBodySize int64, role errorcode.Role) Adapter {
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Accept-Encoding", compression.Gzip)
+			body, err := compression.ReadBody(r, maxBodySize)
+			r.Body.Close()
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Reading request body failed", "content_encoding", r.Header.Get("Content-Encoding"), "content_length", r.ContentLength, "error", err)
+				statusCode := http.StatusBadRequest
+				if errors.Is(err, compression.ErrTooLarge) {
+					statusCode = http.StatusRequestEntityTooLarge
+				}
+				nackError(w, role, errorcode.ErrInvalidRequest, "JSON-ERROR", statusCode, err.Error())
+				return
+			}
+
+			// The body is decompressed, so the headers describe it as received without encoding.
+			r.Header.Del("Content-Encoding")
+			r.ContentLength = int64(len(body))
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), bodyKey{}, body)))
+		})
+	}
+}
+
+// RequestBody returns the body of the request read by the ReadBody middleware.
+//
+// The returned buffer is shared, so it must not be modified.
+// The body is read from the request if the request did not pass through the ReadBody middleware.
+func RequestBody(r *http.Request) ([]byte, error) {
+	if body, ok := r.Context().Value(bodyKey{}).([]byte); ok {
+		return body, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// RateLimit is a middleware for limiting the requests of each network participant per action.
+//
+// It must be inside an authentication middleware, so the requests are limited by the authenticated subscriber ID.
+// Requests without an authenticated subscriber are not limited.
+// The action is the pattern of the mux handling the request without the leading slash, or "unknown" for the
+// unregistered paths, which share a limit.
+func RateLimit(mux *http.ServeMux, limiter *ratelimit.Limiter, role errorcode.Role) Adapter {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			subscriberID, ok := AuthenticatedSubscriber(r.Context())
+			if !ok {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			action := requestAction(mux, r)
+			if allowed, retryAfter := limiter.Allow(subscriberID, action); !allowed {
+				slog.WarnContext(r.Context(), "Rate limit exceeded", "retry_after", retryAfter)
+				metrics.RateLimited(subscriberID, action)
+				// Retry-After is in seconds, rounded up so the retry is not limited again.
+				w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+				policyError(w, role, http.StatusTooManyRequests, "Rate limit exceeded")
+				return
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Policy is a middleware for rejecting the requests of network participants not allowed by the policy.
+//
+// It must be inside an authentication middleware, so the requests are evaluated by the authenticated subscriber ID
+// and the domain and city of the ONDC context. Requests without an authenticated subscriber are not evaluated.
+func Policy(p *policy.Policy, role errorcode.Role) Adapter {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			subscriberID, ok := AuthenticatedSubscriber(r.Context())
+			if !ok {
+				handler.ServeHTTP(w, r)
+				return
 			}
 
+			var domain, city string
+			if ondcCtx, ok := r.Context().Value(ondcContextKey{}).(model.Context); ok {
+				if ondcCtx.Domain != nil {
+					domain = ondcCtx.Domain.Value
+				}
+				if ondcCtx.City != nil {
+					city = *ondcCtx.City
+				}
+			}
+
+			if allowed, reason := p.Evaluate(subscriberID, domain, city); !allowed {
+				slog.WarnContext(r.Context(), "Request is rejected by the policy", "reason", reason, "domain", domain, "city", city)
+				metrics.PolicyRejected(subscriberID, reason)
+				policyError(w, role, http.StatusForbidden, "Network participant is not allowed")
+				return
+			}
 			handler.ServeHTTP(w, r)
 		})
 	}
 }
 
+// policyError writes a NACK response of a POLICY-ERROR with the status code.
+func policyError(w http.ResponseWriter, role errorcode.Role, statusCode int, message string) {
+	nackError(w, role, errorcode.ErrPolicy, "POLICY-ERROR", statusCode, message)
+}
+
+// nackError writes a NACK response of the error with the status code.
+func nackError(w http.ResponseWriter, role errorcode.Role, errType errorcode.ErrType, nackType string, statusCode int, message string) {
+	errCode, ok := errorcode.Lookup(role, errType)
+	if !ok {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	errCodeStr := strconv.Itoa(errCode)
+
+	response := model.AckResponse{
+		Message: &model.MessageAck{
+			Ack: &model.Ack{
+				Status: "NACK",
+			},
+		},
+		Error: &model.Error{
+			Type:    nackType,
+			Code:    &errCodeStr,
+			Message: message,
+		},
+	}
+	responseJSON, err := json.Marshal(&response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(responseJSON)
+}
+
+// statusRecorder records the status code written by the handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+// ackStatus maps the status code of a response to its ACK status.
+//
+// The services respond with 400, 401, 403, 413 or 429 only for NACK responses.
+func ackStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusOK:
+		return metrics.StatusACK
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return metrics.StatusNACK
+	default:
+		return metrics.StatusError
+	}
+}
+
 // BGAuthentication is a middleware for authenticating a signature from the Gateway.
 func BGAuthentication(registryClient RegistryClient, clock clock.Clock, role errorcode.Role, subscriberID string) Adapter {
 	authenticator := &authenticator{
@@ -122,62 +377,72 @@ type authenticator struct {
 // authentication is a generic middleware for authenticating a signature from both BG and BAP/BPP.
 func (a *authenticator) authentication(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
 		header := r.Header.Get(a.verifyingHeader)
 		info, err := auth.ExtractInfoFromHeader(header)
 		if err != nil {
-			log.Errorf("Invalid %q header format: %s", a.verifyingHeader, err)
-			log.Errorf("Invalid %q header value: %q", a.verifyingHeader, header)
-			a.unauthenticated(w)
+			slog.ErrorContext(ctx, "Invalid header format", "header", a.verifyingHeader, "value", header, "error", err)
+			a.unauthenticated(w, "invalid_header")
 			return
 		}
+		ctx = logging.With(ctx, slog.String(logging.SubscriberIDKey, info.SubscriberID))
+		r = r.WithContext(ctx)
 
 		if info.Algorithm != info.KeyIDAlgorithm {
-			log.Errorf("Invalid %q header: algorithms do not match", a.verifyingHeader)
-			log.Errorf("Invalid %q header: algorithm=%q, Key ID algorithm=%q", a.verifyingHeader, info.Algorithm, info.KeyIDAlgorithm)
-			a.unauthenticated(w)
+			slog.ErrorContext(ctx, "Invalid header: algorithms do not match", "header", a.verifyingHeader, "algorithm", info.Algorithm, "key_id_algorithm", info.KeyIDAlgorithm)
+			a.unauthenticated(w, "algorithm_mismatch")
 			return
 		}
 
 		currentTimestamp := a.clock.Now().Unix()
 		if info.Created > currentTimestamp || info.Expired < currentTimestamp {
-			log.Errorf("Invalid %q header: invalid timestamps: created=%d, expired=%d", a.verifyingHeader, info.Created, info.Expired)
-			a.unauthenticated(w)
+			slog.ErrorContext(ctx, "Invalid header: invalid timestamps", "header", a.verifyingHeader, "created", info.Created, "expired", info.Expired)
+			a.unauthenticated(w, "invalid_timestamp")
 			return
 		}
 
-		body, _ := io.ReadAll(r.Body)
-		r.Body = io.NopCloser(bytes.NewBuffer(body))
+		body, err := RequestBody(r)
+		if err != nil {
+			slog.ErrorContext(ctx, "Read request body failed", "error", err)
+			a.unauthenticated(w, "invalid_body")
+			return
+		}
 
 		// Extract only the ONDC context of the request for key lookup.
 		var ondcCtx struct {
 			Context model.Context `json:"context"`
 		}
-		decoder := json.NewDecoder(bytes.NewReader(body))
-		if err := decoder.Decode(&ondcCtx); err != nil {
-			log.Errorf("Decode context failed: %s", err)
-			a.unauthenticated(w)
+		if err := json.Unmarshal(body, &ondcCtx); err != nil {
+			slog.ErrorContext(ctx, "Decode context failed", "error", err)
+			a.unauthenticated(w, "invalid_context")
 			return
 		}
+		tracing.SetContextAttributes(r.Context(), ondcCtx.Context)
+		tracing.SetCounterparty(r.Context(), info.SubscriberID)
 
 		ed25519PublicKey, err := a.registryClient.PublicSigningKey(info.SubscriberID, info.UniqueKeyID, ondcCtx.Context)
 		if err != nil {
-			log.Errorf("Get public signing key from registry failed: %s", err)
-			a.unauthenticated(w)
+			slog.ErrorContext(ctx, "Get public signing key from registry failed", "error", err)
+			a.unauthenticated(w, "key_lookup_failed")
 			return
 		}
 
 		if err := auth.VerifySignature(info.Signature, body, ed25519PublicKey, info.Created, info.Expired); err != nil {
-			log.Errorf("Verify signature failed: %s", err)
-			a.unauthenticated(w)
+			slog.ErrorContext(ctx, "Verify signature failed", "error", err)
+			a.unauthenticated(w, "invalid_signature")
 			return
 		}
 
-		handler.ServeHTTP(w, r)
+		ctx = context.WithValue(r.Context(), subscriberIDKey{}, info.SubscriberID)
+		ctx = context.WithValue(ctx, ondcContextKey{}, ondcCtx.Context)
+		handler.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// unauthenticated writes a proper response when the request authentication fails.
-func (a *authenticator) unauthenticated(w http.ResponseWriter) {
+// unauthenticated writes a proper response when the request authentication fails for the reason.
+func (a *authenticator) unauthenticated(w http.ResponseWriter, reason string) {
+	metrics.AuthFailure(a.verifyingHeader, reason)
+
 	errCode, ok := errorcode.Lookup(a.role, errorcode.ErrInvalidSignature)
 	if !ok {
 		http.Error(w, "", http.StatusInternalServerError)
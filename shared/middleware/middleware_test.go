@@ -15,8 +15,9 @@
 package middleware
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/base64"
-	"flag"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -25,8 +26,20 @@ import (
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"golang.org/x/exp/slog"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/clients/registryclienttest"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
 	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/errorcode"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/logging"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/metrics"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/policy"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/ratelimit"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/tracing"
 )
 
 // Valid test case data for authentication middlewares
@@ -213,8 +226,13 @@ func TestOnlyPostMethod(t *testing.T) {
 }
 
 func TestLogging(t *testing.T) {
-	flag.Set("v", "1")
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(logging.NewHandler(&logs, slog.LevelDebug)))
+	defer slog.SetDefault(defaultLogger)
+
 	echoHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "Handling the request")
 		body, _ := io.ReadAll(r.Body)
 		w.Write(body)
 	})
@@ -224,6 +242,7 @@ func TestLogging(t *testing.T) {
 	}{
 		{body: "Test Body"},
 		{body: ""},
+		{body: testPayload},
 	}
 
 	for _, tc := range tests {
@@ -237,6 +256,19 @@ func TestLogging(t *testing.T) {
 			t.Errorf("Response body: got %q, want %q", got, want)
 		}
 	}
+
+	// test that the handler logs carry the correlation fields and the payload is redacted.
+	for _, want := range []string{
+		`"msg":"Handling the request","action":"search","transaction_id":"e6d9f908-1d26-4ff3-a6d1-3af3d3721054","message_id":"a2fe6d52-9fe4-4d1a-9d0b-dccb8b48522d"`,
+		`"gps":"[REDACTED]"`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs do not contain %q:\n%s", want, logs.String())
+		}
+	}
+	if strings.Contains(logs.String(), "76.347517") {
+		t.Errorf("logs contain the GPS location of the customer:\n%s", logs.String())
+	}
 }
 
 func createMocksForAuthMiddleware(t *testing.T, signingPublicKey string, timestamp int) (*registryclienttest.Stub, *clock.Mock) {
@@ -257,3 +289,323 @@ func createMocksForAuthMiddleware(t *testing.T, signingPublicKey string, timesta
 
 	return stubRegistryClient, mockClock
 }
+
+func TestMetrics(t *testing.T) {
+	stubRegistryClient, mockClock := createMocksForAuthMiddleware(t, testSigningPublicKey, testCurrentTimestamp)
+	mux := http.NewServeMux()
+	mux.Handle("/select", testEmptyHandler)
+	testHandler := Adapt(
+		mux,
+		NPAuthentication(stubRegistryClient, mockClock, errorcode.RoleSellerApp, "bpp.com"),
+		Metrics(mux),
+	)
+
+	// Valid signature
+	request := httptest.NewRequest(http.MethodPost, "/select", strings.NewReader(testPayload))
+	request.Header.Set("Authorization", testAuthHeader)
+	testHandler.ServeHTTP(httptest.NewRecorder(), request)
+
+	// Missing signature
+	request = httptest.NewRequest(http.MethodPost, "/select", strings.NewReader(testPayload))
+	testHandler.ServeHTTP(httptest.NewRecorder(), request)
+
+	// Unregistered path
+	request = httptest.NewRequest(http.MethodPost, "/select-"+strings.Repeat("x", 8), strings.NewReader(testPayload))
+	request.Header.Set("Authorization", testAuthHeader)
+	testHandler.ServeHTTP(httptest.NewRecorder(), request)
+
+	response := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, metrics.Path, nil))
+	for _, want := range []string{
+		`ondc_requests_total{action="select",status="ACK"} 1`,
+		`ondc_requests_total{action="select",status="NACK"} 1`,
+		`ondc_requests_total{action="unknown"`,
+		// Other tests also fail the authentication, so only the presence is checked.
+		`ondc_auth_failures_total{header="Authorization",reason="invalid_header"}`,
+	} {
+		if !strings.Contains(response.Body.String(), want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	stubRegistryClient, mockClock := createMocksForAuthMiddleware(t, testSigningPublicKey, testCurrentTimestamp)
+	var gotBody []byte
+	testHandler := Adapt(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotBody, _ = RequestBody(r)
+		}),
+		NPAuthentication(stubRegistryClient, mockClock, errorcode.RoleSellerApp, "bpp.com"),
+		Logging(),
+		ReadBody(DefaultMaxBodySize, errorcode.RoleSellerApp),
+	)
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(testPayload))
+	zw.Close()
+
+	// The signature is computed over the uncompressed payload.
+	request := httptest.NewRequest(http.MethodPost, "/search", &compressed)
+	request.Header.Set("Authorization", testAuthHeader)
+	request.Header.Set("Content-Encoding", "gzip")
+	response := httptest.NewRecorder()
+
+	testHandler.ServeHTTP(response, request)
+
+	if got, want := response.Code, http.StatusOK; got != want {
+		t.Errorf("Status: got %d, want %d", got, want)
+	}
+	if got, want := string(gotBody), testPayload; got != want {
+		t.Errorf("Body: got %q, want %q", got, want)
+	}
+	if got, want := response.Header().Get("Accept-Encoding"), "gzip"; got != want {
+		t.Errorf("Accept-Encoding Header: got %q, want %q", got, want)
+	}
+}
+
+func TestReadBodyFail(t *testing.T) {
+	tests := []struct {
+		name       string
+		encoding   string
+		maxSize    int64
+		wantStatus int
+	}{
+		{
+			name:       "invalid gzip",
+			encoding:   "gzip",
+			maxSize:    DefaultMaxBodySize,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "too large",
+			maxSize:    int64(len(testPayload) - 1),
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testHandler := Adapt(testEmptyHandler, ReadBody(test.maxSize, errorcode.RoleSellerApp))
+			request := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(testPayload))
+			if test.encoding != "" {
+				request.Header.Set("Content-Encoding", test.encoding)
+			}
+			response := httptest.NewRecorder()
+
+			testHandler.ServeHTTP(response, request)
+
+			if got, want := response.Code, test.wantStatus; got != want {
+				t.Errorf("Status: got %d, want %d", got, want)
+			}
+			if got, want := response.Body.String(), `"status":"NACK"`; !strings.Contains(got, want) {
+				t.Errorf("Body: got %q, want to contain %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	stubRegistryClient, mockClock := createMocksForAuthMiddleware(t, testSigningPublicKey, testCurrentTimestamp)
+	limiter, err := ratelimit.New(config.RateLimitConfig{
+		Default: config.RateLimit{RequestsPerSecond: 1},
+	}, mockClock)
+	if err != nil {
+		t.Fatalf("ratelimit.New() failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/confirm", testEmptyHandler)
+	testHandler := Adapt(
+		mux,
+		RateLimit(mux, limiter, errorcode.RoleSellerApp),
+		NPAuthentication(stubRegistryClient, mockClock, errorcode.RoleSellerApp, "bpp.com"),
+		Metrics(mux),
+	)
+
+	send := func(path string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(testPayload))
+		request.Header.Set("Authorization", testAuthHeader)
+		response := httptest.NewRecorder()
+		testHandler.ServeHTTP(response, request)
+		return response
+	}
+
+	if got, want := send("/confirm").Code, http.StatusOK; got != want {
+		t.Fatalf("Status: got %d, want %d", got, want)
+	}
+
+	response := send("/confirm")
+	if got, want := response.Code, http.StatusTooManyRequests; got != want {
+		t.Fatalf("Status over the limit: got %d, want %d", got, want)
+	}
+	if got, want := response.Header().Get("Retry-After"), "1"; got != want {
+		t.Errorf("Retry-After Header: got %q, want %q", got, want)
+	}
+	if got, want := response.Body.String(), `"status":"NACK"`; !strings.Contains(got, want) {
+		t.Errorf("Body: got %q, want to contain %q", got, want)
+	}
+	if got, want := response.Body.String(), `"code":"50000"`; !strings.Contains(got, want) {
+		t.Errorf("Body: got %q, want to contain %q", got, want)
+	}
+
+	mockClock.Add(time.Second)
+	if got, want := send("/confirm").Code, http.StatusOK; got != want {
+		t.Errorf("Status after refill: got %d, want %d", got, want)
+	}
+
+	// The unregistered paths share a limit.
+	if got, want := send("/random-1").Code, http.StatusNotFound; got != want {
+		t.Errorf("Status of unregistered path: got %d, want %d", got, want)
+	}
+	if got, want := send("/random-2").Code, http.StatusTooManyRequests; got != want {
+		t.Errorf("Status of another unregistered path: got %d, want %d", got, want)
+	}
+
+	response = httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, metrics.Path, nil))
+	for _, want := range []string{
+		`ondc_rate_limited_requests_total{action="confirm",subscriber_id="example-bap.com"} 1`,
+		`ondc_rate_limited_requests_total{action="unknown",subscriber_id="example-bap.com"} 1`,
+		`ondc_requests_total{action="confirm",status="NACK"} 1`,
+	} {
+		if !strings.Contains(response.Body.String(), want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+}
+
+func TestRateLimitUnauthenticated(t *testing.T) {
+	limiter, err := ratelimit.New(config.RateLimitConfig{
+		Default: config.RateLimit{RequestsPerSecond: 1},
+	}, clock.NewMock())
+	if err != nil {
+		t.Fatalf("ratelimit.New() failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/confirm", testEmptyHandler)
+	testHandler := Adapt(mux, RateLimit(mux, limiter, errorcode.RoleSellerApp))
+
+	for i := 0; i < 3; i++ {
+		response := httptest.NewRecorder()
+		testHandler.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/confirm", strings.NewReader(testPayload)))
+		if got, want := response.Code, http.StatusOK; got != want {
+			t.Errorf("Status: got %d, want %d", got, want)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		conf       config.PolicyConfig
+		wantStatus int
+	}{
+		{
+			name:       "no rules",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "allowed city",
+			conf: config.PolicyConfig{
+				Allow: []config.PolicyRule{{Domains: []string{"nic2004:60212"}, Cities: []string{"Kochi"}}},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "not allowed",
+			conf: config.PolicyConfig{
+				Allow: []config.PolicyRule{{SubscriberIDs: []string{"pilot-bap.com"}}},
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "denied",
+			conf: config.PolicyConfig{
+				Deny: []config.PolicyRule{{SubscriberIDs: []string{"example-bap.com"}}},
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stubRegistryClient, mockClock := createMocksForAuthMiddleware(t, testSigningPublicKey, testCurrentTimestamp)
+			testHandler := Adapt(
+				testEmptyHandler,
+				Policy(policy.New(test.conf), errorcode.RoleSellerApp),
+				NPAuthentication(stubRegistryClient, mockClock, errorcode.RoleSellerApp, "bpp.com"),
+			)
+
+			request := httptest.NewRequest(http.MethodPost, "/select", strings.NewReader(testPayload))
+			request.Header.Set("Authorization", testAuthHeader)
+			response := httptest.NewRecorder()
+
+			testHandler.ServeHTTP(response, request)
+
+			if got, want := response.Code, test.wantStatus; got != want {
+				t.Errorf("Status: got %d, want %d", got, want)
+			}
+			if test.wantStatus == http.StatusForbidden {
+				if got, want := response.Body.String(), `"type":"POLICY-ERROR"`; !strings.Contains(got, want) {
+					t.Errorf("Body: got %q, want to contain %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(tracerProvider)
+		otel.SetTextMapPropagator(propagator)
+	}()
+
+	stubRegistryClient, mockClock := createMocksForAuthMiddleware(t, testSigningPublicKey, testCurrentTimestamp)
+	testHandler := Adapt(
+		testEmptyHandler,
+		NPAuthentication(stubRegistryClient, mockClock, errorcode.RoleSellerApp, "bpp.com"),
+		Tracing(),
+	)
+
+	const (
+		callerTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		callerSpanID  = "00f067aa0ba902b7"
+	)
+	request := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(testPayload))
+	request.Header.Set("Authorization", testAuthHeader)
+	request.Header.Set("traceparent", "00-"+callerTraceID+"-"+callerSpanID+"-01")
+	testHandler.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if got := span.SpanContext().TraceID().String(); got != callerTraceID {
+		t.Errorf("span trace ID = %q, want %q", got, callerTraceID)
+	}
+	if got := span.Parent().SpanID().String(); got != callerSpanID {
+		t.Errorf("span parent = %q, want %q", got, callerSpanID)
+	}
+
+	attrs := make(map[attribute.Key]string)
+	for _, attr := range span.Attributes() {
+		attrs[attr.Key] = attr.Value.Emit()
+	}
+	for key, want := range map[attribute.Key]string{
+		tracing.TransactionIDKey: "e6d9f908-1d26-4ff3-a6d1-3af3d3721054",
+		tracing.MessageIDKey:     "a2fe6d52-9fe4-4d1a-9d0b-dccb8b48522d",
+		tracing.ActionKey:        "search",
+		tracing.CounterpartyKey:  "example-bap.com",
+		"http.status_code":       "200",
+	} {
+		if got := attrs[key]; got != want {
+			t.Errorf("span attribute %q = %q, want %q", key, got, want)
+		}
+	}
+}
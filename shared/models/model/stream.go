@@ -0,0 +1,165 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DecodeOnSearchRequest decodes an on_search request, decoding the providers of the catalog one at a time.
+//
+// The providers hold nearly all the data of large catalogs. Each provider is validated as it is decoded and then
+// discarded, so the decoded request holds a single provider at a time instead of the whole catalog. The returned
+// request has no providers, and the rest of it is validated like a request decoded by json.Unmarshal.
+//
+// On error, the request decoded so far is returned, e.g. with the context for recording the rejected request.
+func DecodeOnSearchRequest(r io.Reader) (OnSearchRequest, error) {
+	var req OnSearchRequest
+	dec := json.NewDecoder(r)
+	_, err := decodeObject(dec, func(key string) error {
+		switch {
+		case strings.EqualFold(key, "context"):
+			return dec.Decode(&req.Context)
+		case strings.EqualFold(key, "error"):
+			return dec.Decode(&req.Error)
+		case strings.EqualFold(key, "message"):
+			var msg OnSearchMessage
+			isNull, err := decodeObject(dec, func(key string) error {
+				if !strings.EqualFold(key, "catalog") {
+					return skipValue(dec)
+				}
+				var catalog Catalog
+				isNull, err := decodeCatalog(dec, &catalog)
+				if !isNull {
+					msg.Catalog = &catalog
+				}
+				return err
+			})
+			if !isNull {
+				req.Message = &msg
+			}
+			return err
+		default:
+			return skipValue(dec)
+		}
+	})
+	if err != nil {
+		return req, fmt.Errorf("decode on_search request: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return req, fmt.Errorf("decode on_search request: invalid data after the request")
+	}
+	return req, nil
+}
+
+// providerValidator validates the providers and items of the decoded catalogs.
+var providerValidator = Validator()
+
+// decodeCatalog decodes a catalog without its providers, validating each provider and its items.
+func decodeCatalog(dec *json.Decoder, catalog *Catalog) (bool, error) {
+	fields := map[string]any{
+		"bpp/descriptor":   &catalog.BppDescriptor,
+		"bpp/categories":   &catalog.BppCategories,
+		"bpp/fulfillments": &catalog.BppFulfillments,
+		"bpp/payments":     &catalog.BppPayments,
+		"bpp/offers":       &catalog.BppOffers,
+		"exp":              &catalog.Exp,
+	}
+	return decodeObject(dec, func(key string) error {
+		if strings.EqualFold(key, "bpp/providers") {
+			return decodeArray(dec, func() error {
+				var provider Provider
+				if err := dec.Decode(&provider); err != nil {
+					return err
+				}
+				if err := providerValidator.Struct(provider); err != nil {
+					return fmt.Errorf("provider %q: %v", provider.ID, err)
+				}
+				// The items are not validated with the provider, as the slice elements are not validated.
+				for _, item := range provider.Items {
+					if err := providerValidator.Struct(item); err != nil {
+						return fmt.Errorf("provider %q: item %q: %v", provider.ID, item.ID, err)
+					}
+				}
+				return nil
+			})
+		}
+		for name, field := range fields {
+			if strings.EqualFold(key, name) {
+				return dec.Decode(field)
+			}
+		}
+		return skipValue(dec)
+	})
+}
+
+// decodeObject decodes a JSON object calling decodeField for each key, which must decode the value of the key.
+//
+// It returns true if the value is null.
+func decodeObject(dec *json.Decoder, decodeField func(key string) error) (bool, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return false, err
+	}
+	if tok == nil {
+		return true, nil
+	}
+	if tok != json.Delim('{') {
+		return false, fmt.Errorf("got %v, want an object", tok)
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return false, err
+		}
+		if err := decodeField(tok.(string)); err != nil {
+			return false, err
+		}
+	}
+	_, err = dec.Token()
+	return false, err
+}
+
+// decodeArray decodes a JSON array calling decodeElement for each element, which must decode the element.
+func decodeArray(dec *json.Decoder, decodeElement func() error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("got %v, want an array", tok)
+	}
+
+	for dec.More() {
+		if err := decodeElement(); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// skipValue skips the next JSON value.
+func skipValue(dec *json.Decoder) error {
+	var v json.RawMessage
+	return dec.Decode(&v)
+}
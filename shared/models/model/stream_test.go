@@ -0,0 +1,134 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testOnSearchRequest = `{
+	"context": {
+		"domain": "nic2004:52110",
+		"country": "IND",
+		"city": "std:080",
+		"action": "on_search",
+		"core_version": "1.2.0",
+		"bap_id": "bap.com",
+		"bap_uri": "https://bap.com",
+		"transaction_id": "transaction-id",
+		"message_id": "message-id",
+		"timestamp": "2023-04-12T07:22:55.623Z"
+	},
+	"message": {
+		"catalog": {
+			"bpp/descriptor": {"name": "Seller"},
+			"bpp/categories": [{"id": "category"}],
+			"bpp/providers": [
+				{"id": "provider-1", "items": [{"id": "item-1"}]},
+				{"id": "provider-2", "items": [{"id": "item-2"}]}
+			],
+			"unknown": {"ignored": [1, 2]},
+			"exp": "2023-04-13T07:22:55.623Z"
+		}
+	}
+}`
+
+func TestDecodeOnSearchRequest(t *testing.T) {
+	got, err := DecodeOnSearchRequest(strings.NewReader(testOnSearchRequest))
+	if err != nil {
+		t.Fatalf("DecodeOnSearchRequest() failed: %v", err)
+	}
+
+	// The request is decoded as by json.Unmarshal, except the providers.
+	var want OnSearchRequest
+	if err := json.Unmarshal([]byte(testOnSearchRequest), &want); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(want.Message.Catalog.BppProviders), 2; got != want {
+		t.Fatalf("json.Unmarshal() providers = %d, want %d", got, want)
+	}
+	want.Message.Catalog.BppProviders = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeOnSearchRequest() = %+v, want %+v", got, want)
+	}
+	if err := validate.Struct(got); err != nil {
+		t.Errorf("Validate decoded request failed: %v", err)
+	}
+}
+
+func TestDecodeOnSearchRequestNull(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    OnSearchRequest
+	}{
+		{
+			payload: `{"message": null}`,
+		},
+		{
+			payload: `{"message": {"catalog": null}}`,
+			want:    OnSearchRequest{Message: &OnSearchMessage{}},
+		},
+		{
+			payload: `{"message": {"catalog": {"bpp/providers": null}}}`,
+			want:    OnSearchRequest{Message: &OnSearchMessage{Catalog: &Catalog{}}},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := DecodeOnSearchRequest(strings.NewReader(test.payload))
+		if err != nil {
+			t.Errorf("DecodeOnSearchRequest(%s) failed: %v", test.payload, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("DecodeOnSearchRequest(%s) = %+v, want %+v", test.payload, got, test.want)
+		}
+	}
+}
+
+func TestDecodeOnSearchRequestFailed(t *testing.T) {
+	tests := []string{
+		``,
+		`[]`,
+		`{"context": "invalid"}`,
+		`{"message": {"catalog": {"bpp/providers": {}}}}`,
+		`{"message": {"catalog": {"bpp/providers": [{"id": 1}]}}}`,
+		`{"message": {"catalog": {"bpp/providers": [{"id": "provider"}`,
+		`{"message": {}} {}`,
+		`{"message": {"catalog": {"bpp/providers": [{"id": "provider", "items": [{"id": "item", "price": {"value": "free"}}]}]}}}`,
+	}
+
+	for _, payload := range tests {
+		if _, err := DecodeOnSearchRequest(strings.NewReader(payload)); err == nil {
+			t.Errorf("DecodeOnSearchRequest(%s) succeeded unexpectedly", payload)
+		}
+	}
+}
+
+func TestDecodeOnSearchRequestFailedKeepsContext(t *testing.T) {
+	// The price value must be a string.
+	payload := strings.Replace(testOnSearchRequest, `{"id": "item-2"}`, `{"id": "item-2", "price": {"value": 12}}`, 1)
+
+	got, err := DecodeOnSearchRequest(strings.NewReader(payload))
+	if err == nil {
+		t.Fatal("DecodeOnSearchRequest() succeeded unexpectedly")
+	}
+	if got.Context == nil || got.Context.TransactionID == nil || *got.Context.TransactionID != "transaction-id" {
+		t.Errorf("DecodeOnSearchRequest() context = %+v, want the decoded context", got.Context)
+	}
+}
@@ -106,13 +106,8 @@ type LookupResponseInner struct {
 	// UUID.
 	UkID string `json:"ukId,omitempty"`
 
-	// UUID.
-	//
-	// We need to use `any` instead of `string` because the registry return this field as int in the staging environment.
-	// In the other environment (pre-prod and prod) return this field as UUID string.
-	// This is a work-a-round so that we can unmarshall the response from the staging registry without an error.
-	// We do not use this field for anything. It should be fine to use `any`
-	BrID any `json:"br_id,omitempty"`
+	// UUID. The staging registry returns it as a number.
+	BrID FlexibleString `json:"br_id,omitempty"`
 
 	// Country code
 	Country string `json:"country,omitempty"`
@@ -123,6 +118,12 @@ type LookupResponseInner struct {
 	// Industry domain of the subscriber.
 	Domain string `json:"domain,omitempty"`
 
+	// buyerApp, sellerApp or gateway
+	Type string `json:"type,omitempty"`
+
+	// Callback URL of the subscriber
+	SubscriberURL string `json:"subscriber_url,omitempty"`
+
 	// Signing Public Key
 	SigningPublicKey string `json:"signing_public_key,omitempty"`
 
@@ -239,6 +240,9 @@ type Entity struct {
 
 	SubscriberID string `json:"subscriber_id,omitempty"`
 
+	// UUID of the key pair. It is used as the key ID of the Authorization header.
+	UniqueKeyID string `json:"unique_key_id,omitempty"`
+
 	// it should be relative to subscriber_id mentioned domain. In below example with subscriber _id as abc.com, regsitry will call https://abc.com/ondc/onboarding/on_subscribe
 	CallbackURL string `json:"callback_url,omitempty"`
 
@@ -301,7 +305,7 @@ type NetworkParticipant struct {
 
 	Type *string `json:"type,omitempty" validate:"omitempty,oneof=buyerApp sellerApp gateway"`
 
-	MSN string `json:"msn,omitempty"`
+	MSN bool `json:"msn,omitempty"`
 
 	CityCode []string `json:"city_code,omitempty"`
 
@@ -395,3 +399,21 @@ func (ct CustomTime) MarshalJSON() ([]byte, error) {
 	result := time.Time(ct).Format("2006-01-02T15:04:05.000Z07:00")
 	return json.Marshal(result)
 }
+
+// FlexibleString - string that can also be unmarshaled from a JSON number
+type FlexibleString string
+
+func (fs *FlexibleString) UnmarshalJSON(b []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err == nil {
+		*fs = FlexibleString(n)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*fs = FlexibleString(s)
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ordering publishes the Pub/Sub messages of an ONDC transaction in order.
+//
+// The messages are published with the transaction ID as the ordering key, so subscriptions with message ordering
+// enabled receive the messages of a transaction in the order they were published, e.g. on_status before on_update.
+package ordering
+
+import (
+	"context"
+	"encoding/json"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// Topic returns the topic of the client publishing messages with ordering keys.
+func Topic(client *pubsub.Client, topicID string) *pubsub.Topic {
+	topic := client.Topic(topicID)
+	topic.EnableMessageOrdering = true
+	return topic
+}
+
+// Key returns the ordering key of the ONDC payload, which is the transaction ID of its context.
+//
+// It returns an empty string if the payload has no transaction ID, so the message is published without ordering.
+func Key(payload []byte) string {
+	var body struct {
+		Context struct {
+			TransactionID string `json:"transaction_id"`
+		} `json:"context"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return ""
+	}
+	return body.Context.TransactionID
+}
+
+// Publish publishes the message and waits for the result.
+//
+// A failed publish pauses the ordering key of the message, failing the following messages of the transaction.
+// Publish resumes the key, so the caller can retry the failed message or give up on it and carry on.
+func Publish(ctx context.Context, topic *pubsub.Topic, msg *pubsub.Message) (string, error) {
+	msgID, err := topic.Publish(ctx, msg).Get(ctx)
+	if err != nil && msg.OrderingKey != "" {
+		topic.ResumePublish(msg.OrderingKey)
+	}
+	return msgID, err
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ordering
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/pubsubtest"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{payload: `{"context":{"transaction_id":"transaction-1","message_id":"message-1"},"message":{}}`, want: "transaction-1"},
+		{payload: `{"context":{"message_id":"message-1"}}`, want: ""},
+		{payload: `not JSON`, want: ""},
+	}
+	for _, test := range tests {
+		if got := Key([]byte(test.payload)); got != test.want {
+			t.Errorf("Key(%s) = %q, want %q", test.payload, got, test.want)
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+	psSrv, opt := pubsubtest.InitServer(t, "test-project", []pubsubtest.PubsubSetup{{TopicID: "test-topic"}})
+	client, err := pubsub.NewClient(ctx, "test-project", opt)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	topic := Topic(client, "test-topic")
+	defer topic.Stop()
+
+	msgID, err := Publish(ctx, topic, &pubsub.Message{Data: []byte("on_status"), OrderingKey: "transaction-1"})
+	if err != nil {
+		t.Fatalf("Publish() failed: %v", err)
+	}
+	if got, want := psSrv.Message(msgID).OrderingKey, "transaction-1"; got != want {
+		t.Errorf("Publish() ordering key = %q, want %q", got, want)
+	}
+}
+
+func TestPublishResumesKey(t *testing.T) {
+	ctx := context.Background()
+	_, opt := pubsubtest.InitServer(t, "test-project", []pubsubtest.PubsubSetup{{TopicID: "test-topic"}})
+	client, err := pubsub.NewClient(ctx, "test-project", opt)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	topic := Topic(client, "missing-topic")
+	defer topic.Stop()
+
+	for i := 0; i < 2; i++ {
+		_, err := Publish(ctx, topic, &pubsub.Message{Data: []byte("on_status"), OrderingKey: "transaction-1"})
+		if err == nil {
+			t.Fatalf("Publish() #%d to a missing topic succeeded unexpectedly", i)
+		}
+		// A paused ordering key fails without sending the message.
+		if _, ok := err.(pubsub.ErrPublishingPaused); ok {
+			t.Errorf("Publish() #%d failed with %v, want the key to be resumed", i, err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policy allows or denies the requests of network participants by the rules of a PolicyConfig.
+package policy
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+)
+
+// ReloadInterval is the interval between checking the policy file for changes.
+const ReloadInterval = 30 * time.Second
+
+// Reasons of rejecting a request.
+const (
+	ReasonDenied     = "denied"
+	ReasonNotAllowed = "not_allowed"
+)
+
+// Policy evaluates requests by the current rules.
+//
+// It is safe for concurrent use, and the rules can be replaced while serving.
+type Policy struct {
+	conf atomic.Pointer[config.PolicyConfig]
+}
+
+// New creates a policy of the rules.
+func New(conf config.PolicyConfig) *Policy {
+	p := &Policy{}
+	p.Update(conf)
+	return p
+}
+
+// Load creates a policy of the rules in the file.
+func Load(path string) (*Policy, error) {
+	conf, err := config.Read[config.PolicyConfig](path)
+	if err != nil {
+		return nil, err
+	}
+	return New(conf), nil
+}
+
+// Update replaces the rules of the policy.
+func (p *Policy) Update(conf config.PolicyConfig) {
+	p.conf.Store(&conf)
+}
+
+// Watch reloads the rules from the file every interval until ctx is done.
+//
+// Invalid files are logged and ignored, so the previous rules stay in effect.
+func (p *Policy) Watch(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		conf, err := config.Read[config.PolicyConfig](path)
+		if err != nil {
+			slog.Error("Reload policy failed, keeping the previous rules", "path", path, "error", err)
+			continue
+		}
+		if reflect.DeepEqual(conf, *p.conf.Load()) {
+			continue
+		}
+		p.Update(conf)
+		slog.Info("Policy is reloaded", "path", path, "allow_rules", len(conf.Allow), "deny_rules", len(conf.Deny))
+	}
+}
+
+// Evaluate returns whether the request of the subscriber in the domain and city is allowed.
+//
+// If the request is rejected, it also returns the reason.
+func (p *Policy) Evaluate(subscriberID, domain, city string) (bool, string) {
+	conf := p.conf.Load()
+	for _, rule := range conf.Deny {
+		if matches(rule, subscriberID, domain, city) {
+			return false, ReasonDenied
+		}
+	}
+	if len(conf.Allow) == 0 {
+		return true, ""
+	}
+	for _, rule := range conf.Allow {
+		if matches(rule, subscriberID, domain, city) {
+			return true, ""
+		}
+	}
+	return false, ReasonNotAllowed
+}
+
+func matches(rule config.PolicyRule, subscriberID, domain, city string) bool {
+	return contains(rule.SubscriberIDs, subscriberID) && contains(rule.Domains, domain) && contains(rule.Cities, city)
+}
+
+// contains reports whether the value is in the list. An empty list contains any value.
+func contains(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
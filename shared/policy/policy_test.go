@@ -0,0 +1,111 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+)
+
+func TestEvaluate(t *testing.T) {
+	p := New(config.PolicyConfig{
+		Allow: []config.PolicyRule{
+			{SubscriberIDs: []string{"pilot-bap.com", "blocked-bap.com"}},
+			{Domains: []string{"ONDC:RET10"}, Cities: []string{"std:080"}},
+		},
+		Deny: []config.PolicyRule{
+			{SubscriberIDs: []string{"blocked-bap.com"}},
+		},
+	})
+
+	tests := []struct {
+		subscriberID string
+		domain       string
+		city         string
+		wantAllowed  bool
+		wantReason   string
+	}{
+		{subscriberID: "pilot-bap.com", domain: "ONDC:RET11", city: "std:011", wantAllowed: true},
+		{subscriberID: "other-bap.com", domain: "ONDC:RET10", city: "std:080", wantAllowed: true},
+		{subscriberID: "other-bap.com", domain: "ONDC:RET10", city: "std:011", wantReason: ReasonNotAllowed},
+		{subscriberID: "blocked-bap.com", domain: "ONDC:RET10", city: "std:080", wantReason: ReasonDenied},
+	}
+	for _, test := range tests {
+		allowed, reason := p.Evaluate(test.subscriberID, test.domain, test.city)
+		if allowed != test.wantAllowed || reason != test.wantReason {
+			t.Errorf("Evaluate(%q, %q, %q) = (%t, %q), want (%t, %q)", test.subscriberID, test.domain, test.city, allowed, reason, test.wantAllowed, test.wantReason)
+		}
+	}
+}
+
+func TestEvaluateEmpty(t *testing.T) {
+	if allowed, _ := New(config.PolicyConfig{}).Evaluate("bap.com", "ONDC:RET10", "std:080"); !allowed {
+		t.Errorf("Evaluate() of an empty policy = false, want true")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	writeFile(t, path, `{"deny": [{"subscriberIDs": ["bap.com"]}]}`)
+
+	p, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if allowed, _ := p.Evaluate("bap.com", "", ""); allowed {
+		t.Fatalf("Evaluate() = true, want false by the loaded policy")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Watch(ctx, path, 10*time.Millisecond)
+
+	// Invalid files are ignored.
+	writeFile(t, path, `{"deny": `)
+	time.Sleep(50 * time.Millisecond)
+	if allowed, _ := p.Evaluate("bap.com", "", ""); allowed {
+		t.Fatalf("Evaluate() = true after an invalid file, want false by the previous policy")
+	}
+
+	writeFile(t, path, `{}`)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if allowed, _ := p.Evaluate("bap.com", "", ""); allowed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Evaluate() = false, want true by the reloaded policy")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLoadFailed(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("Load() of a missing file succeeded unexpectedly")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
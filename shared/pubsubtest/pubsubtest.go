@@ -77,8 +77,9 @@ func InitServer(t *testing.T, projectID string, setups []PubsubSetup) (*pstest.S
 
 		for _, subSetup := range setup.SubSetups {
 			subConfig := pubsub.SubscriptionConfig{
-				Topic:  topic,
-				Filter: subSetup.Filter,
+				Topic:                 topic,
+				Filter:                subSetup.Filter,
+				EnableMessageOrdering: true,
 			}
 			_, err := client.CreateSubscription(ctx, subSetup.SubID, subConfig)
 			if err != nil {
@@ -0,0 +1,169 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit limits the request rate of each network participant per action with token buckets.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+)
+
+// sweepInterval is the minimum interval between removing the full buckets.
+const sweepInterval = time.Minute
+
+type key struct {
+	subscriberID string
+	action       string
+}
+
+// Limiter keeps a token bucket per subscriber ID and action.
+//
+// It is safe for concurrent use.
+type Limiter struct {
+	conf config.RateLimitConfig
+	clk  clock.Clock
+
+	mu        sync.Mutex
+	buckets   map[key]*bucket
+	lastSweep time.Time
+}
+
+// New creates a limiter of the config.
+func New(conf config.RateLimitConfig, clk clock.Clock) (*Limiter, error) {
+	if err := validate("default", conf.Default); err != nil {
+		return nil, err
+	}
+	for action, limit := range conf.Actions {
+		if err := validate(fmt.Sprintf("action %q", action), limit); err != nil {
+			return nil, err
+		}
+	}
+	for subscriberID, limit := range conf.Subscribers {
+		if err := validate(fmt.Sprintf("subscriber %q", subscriberID), limit); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Limiter{
+		conf:      conf,
+		clk:       clk,
+		buckets:   make(map[key]*bucket),
+		lastSweep: clk.Now(),
+	}, nil
+}
+
+func validate(name string, limit config.RateLimit) error {
+	if limit.RequestsPerSecond < 0 || math.IsInf(limit.RequestsPerSecond, 0) || math.IsNaN(limit.RequestsPerSecond) {
+		return fmt.Errorf("new rate limiter: invalid requests per second of %s: %v", name, limit.RequestsPerSecond)
+	}
+	if limit.Burst < 0 {
+		return fmt.Errorf("new rate limiter: invalid burst of %s: %d", name, limit.Burst)
+	}
+	return nil
+}
+
+// Allow takes a token from the bucket of the subscriber ID and action.
+//
+// If the bucket is empty, it returns false and the time until the next token.
+func (l *Limiter) Allow(subscriberID, action string) (bool, time.Duration) {
+	limit := l.limit(subscriberID, action)
+	if limit.RequestsPerSecond == 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clk.Now()
+	l.sweep(now)
+
+	k := key{subscriberID: subscriberID, action: action}
+	b, ok := l.buckets[k]
+	if !ok {
+		b = newBucket(limit, now)
+		l.buckets[k] = b
+	}
+	return b.take(now)
+}
+
+// limit looks up the limit of the subscriber ID and action.
+func (l *Limiter) limit(subscriberID, action string) config.RateLimit {
+	if limit, ok := l.conf.Subscribers[subscriberID]; ok {
+		return limit
+	}
+	if limit, ok := l.conf.Actions[action]; ok {
+		return limit
+	}
+	return l.conf.Default
+}
+
+// sweep removes the full buckets, which behave the same as new buckets.
+//
+// It bounds the memory of the buckets by the recently active subscribers.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for k, b := range l.buckets {
+		if b.refill(now) >= b.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(limit config.RateLimit, now time.Time) *bucket {
+	burst := float64(limit.Burst)
+	if burst == 0 {
+		burst = math.Ceil(limit.RequestsPerSecond)
+	}
+	return &bucket{
+		rate:   limit.RequestsPerSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+// refill adds the tokens since the last refill and returns the current tokens.
+func (b *bucket) refill(now time.Time) float64 {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+	return b.tokens
+}
+
+func (b *bucket) take(now time.Time) (bool, time.Duration) {
+	if b.refill(now) >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / b.rate
+	return false, time.Duration(math.Ceil(wait * float64(time.Second)))
+}
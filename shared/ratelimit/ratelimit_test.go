@@ -0,0 +1,134 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/config"
+)
+
+func TestAllow(t *testing.T) {
+	clk := clock.NewMock()
+	limiter, err := New(config.RateLimitConfig{
+		Default: config.RateLimit{RequestsPerSecond: 2, Burst: 3},
+	}, clk)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow("bap.example.com", "search"); !ok {
+			t.Fatalf("Allow() #%d = false, want true within the burst", i)
+		}
+	}
+	ok, retryAfter := limiter.Allow("bap.example.com", "search")
+	if ok {
+		t.Fatalf("Allow() = true, want false after the burst")
+	}
+	if want := 500 * time.Millisecond; retryAfter != want {
+		t.Errorf("Allow() retry after = %v, want %v", retryAfter, want)
+	}
+
+	// Other subscribers and actions have their own buckets.
+	if ok, _ := limiter.Allow("other.example.com", "search"); !ok {
+		t.Errorf("Allow() of another subscriber = false, want true")
+	}
+	if ok, _ := limiter.Allow("bap.example.com", "select"); !ok {
+		t.Errorf("Allow() of another action = false, want true")
+	}
+
+	clk.Add(500 * time.Millisecond)
+	if ok, _ := limiter.Allow("bap.example.com", "search"); !ok {
+		t.Errorf("Allow() after refill = false, want true")
+	}
+	if ok, _ := limiter.Allow("bap.example.com", "search"); ok {
+		t.Errorf("Allow() = true, want false after taking the refilled token")
+	}
+}
+
+func TestAllowOverrides(t *testing.T) {
+	clk := clock.NewMock()
+	limiter, err := New(config.RateLimitConfig{
+		Default: config.RateLimit{RequestsPerSecond: 1},
+		Actions: map[string]config.RateLimit{
+			"search": {RequestsPerSecond: 1, Burst: 2},
+		},
+		Subscribers: map[string]config.RateLimit{
+			"trusted.example.com": {},
+		},
+	}, clk)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	tests := []struct {
+		subscriberID string
+		action       string
+		allowed      int
+	}{
+		{subscriberID: "bap.example.com", action: "select", allowed: 1},
+		{subscriberID: "bap.example.com", action: "search", allowed: 2},
+		{subscriberID: "trusted.example.com", action: "search", allowed: 100},
+	}
+	for _, test := range tests {
+		allowed := 0
+		for i := 0; i < 100; i++ {
+			if ok, _ := limiter.Allow(test.subscriberID, test.action); ok {
+				allowed++
+			}
+		}
+		if allowed != test.allowed {
+			t.Errorf("Allow(%q, %q) allowed %d requests, want %d", test.subscriberID, test.action, allowed, test.allowed)
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	clk := clock.NewMock()
+	limiter, err := New(config.RateLimitConfig{
+		Default: config.RateLimit{RequestsPerSecond: 1, Burst: 5},
+	}, clk)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	limiter.Allow("idle.example.com", "search")
+	clk.Add(sweepInterval)
+	limiter.Allow("bap.example.com", "search")
+
+	if _, ok := limiter.buckets[key{subscriberID: "idle.example.com", action: "search"}]; ok {
+		t.Errorf("bucket of idle subscriber is not removed")
+	}
+	if got, want := len(limiter.buckets), 1; got != want {
+		t.Errorf("len(buckets) = %d, want %d", got, want)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	tests := []config.RateLimitConfig{
+		{Default: config.RateLimit{RequestsPerSecond: -1}},
+		{Actions: map[string]config.RateLimit{"search": {Burst: -1}}},
+		{Subscribers: map[string]config.RateLimit{"bap.example.com": {RequestsPerSecond: -2}}},
+	}
+	for _, conf := range tests {
+		if _, err := New(conf, clock.NewMock()); err == nil {
+			t.Errorf("New(%+v) succeeded unexpectedly", conf)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package roundtrip adapts functions to http.RoundTripper, for the transports wrapping other transports.
+package roundtrip
+
+import "net/http"
+
+// Func is an http.RoundTripper calling itself.
+type Func func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(r).
+func (f Func) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
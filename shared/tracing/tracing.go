@@ -0,0 +1,224 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing provides OpenTelemetry tracing shared by the services.
+//
+// The trace context is propagated in W3C Trace Context format through HTTP headers
+// and Pub/Sub message attributes, so a transaction can be followed across services.
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"cloud.google.com/go/pubsub"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/models/model"
+	"partner-innovation.googlesource.com/googleondcaccelerator.git/shared/roundtrip"
+)
+
+// ExporterEnv is the environment variable selecting the span exporter.
+//
+// The OTLP exporter is configured by the standard OTEL_EXPORTER_OTLP_* environment variables.
+const ExporterEnv = "OTEL_TRACES_EXPORTER"
+
+// Span exporters.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+const instrumentationName = "partner-innovation.googlesource.com/googleondcaccelerator.git/shared/tracing"
+
+// Attribute keys of the spans.
+const (
+	TransactionIDKey = attribute.Key("ondc.transaction_id")
+	MessageIDKey     = attribute.Key("ondc.message_id")
+	ActionKey        = attribute.Key("ondc.action")
+	CounterpartyKey  = attribute.Key("ondc.counterparty")
+	PubSubMessageKey = attribute.Key("messaging.message.id")
+)
+
+// Init installs the global propagator and the tracer provider exporting spans of the service.
+//
+// The exporter is selected by the ExporterEnv environment variable. Spans are not exported if it is
+// empty or none, but the trace context is still propagated.
+// The returned function flushes and stops the exporter.
+func Init(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	switch name := os.Getenv(ExporterEnv); name {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		e, err := otlptracegrpc.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("init tracing: %v", err)
+		}
+		exporter = e
+	case ExporterStdout:
+		e, err := stdouttrace.New()
+		if err != nil {
+			return nil, fmt.Errorf("init tracing: %v", err)
+		}
+		exporter = e
+	default:
+		return nil, fmt.Errorf("init tracing: unknown exporter %q", name)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("init tracing: %v", err)
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tracerProvider)
+	return tracerProvider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the services.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// ContextAttributes returns the span attributes identifying the ONDC message.
+func ContextAttributes(msgContext model.Context) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{ActionKey.String(msgContext.Action)}
+	if msgContext.TransactionID != nil {
+		attrs = append(attrs, TransactionIDKey.String(*msgContext.TransactionID))
+	}
+	if msgContext.MessageID != nil {
+		attrs = append(attrs, MessageIDKey.String(*msgContext.MessageID))
+	}
+	return attrs
+}
+
+// SetContextAttributes adds the attributes of the ONDC message to the current span.
+func SetContextAttributes(ctx context.Context, msgContext model.Context) {
+	trace.SpanFromContext(ctx).SetAttributes(ContextAttributes(msgContext)...)
+}
+
+// SetPayloadAttributes adds the attributes of the ONDC message in the JSON payload to the current span.
+//
+// Payloads without a valid context are ignored, since tracing must not fail the request.
+func SetPayloadAttributes(ctx context.Context, payload []byte) {
+	var body struct {
+		Context model.Context `json:"context"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return
+	}
+	SetContextAttributes(ctx, body.Context)
+}
+
+// SetCounterparty adds the subscriber ID of the other network participant to the current span.
+func SetCounterparty(ctx context.Context, subscriberID string) {
+	trace.SpanFromContext(ctx).SetAttributes(CounterpartyKey.String(subscriberID))
+}
+
+// InjectPubSub adds the trace context to the attributes of the Pub/Sub message.
+func InjectPubSub(ctx context.Context, msg *pubsub.Message) {
+	if msg.Attributes == nil {
+		msg.Attributes = make(map[string]string)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(msg.Attributes))
+}
+
+// StartPubSubSpan starts a consumer span of the Pub/Sub message, continuing the trace of the publisher.
+func StartPubSubSpan(ctx context.Context, subscriptionID string, msg *pubsub.Message) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(msg.Attributes))
+	return Tracer().Start(ctx, subscriptionID+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSourceName(subscriptionID),
+			PubSubMessageKey.String(msg.ID),
+			ActionKey.String(msg.Attributes["action"]),
+		),
+	)
+}
+
+// StartHTTPServerSpan starts a server span of the incoming request, continuing the trace of the caller.
+func StartHTTPServerSpan(r *http.Request) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return Tracer().Start(ctx, r.Method+" "+r.URL.Path,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPMethod(r.Method),
+			semconv.HTTPTarget(r.URL.Path),
+		),
+	)
+}
+
+// RecordError marks the span failed with the error.
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// InstrumentTransport starts a client span for each outbound request and propagates the trace context in its headers.
+//
+// The request must carry the context of the parent span, e.g. created by http.NewRequestWithContext.
+func InstrumentTransport(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return roundtrip.Func(func(r *http.Request) (*http.Response, error) {
+		ctx, span := Tracer().Start(r.Context(), r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.HTTPMethod(r.Method),
+				semconv.HTTPURL(r.URL.String()),
+				CounterpartyKey.String(r.URL.Host),
+			),
+		)
+		defer span.End()
+
+		// The request must not be modified by a RoundTripper.
+		r = r.Clone(ctx)
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+		response, err := transport.RoundTrip(r)
+		if err != nil {
+			RecordError(span, err)
+			return nil, err
+		}
+		span.SetAttributes(semconv.HTTPStatusCode(response.StatusCode))
+		if response.StatusCode >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, response.Status)
+		}
+		return response, nil
+	})
+}
+
+// InstrumentClient returns a copy of the HTTP client tracing its outbound requests.
+func InstrumentClient(client *http.Client) *http.Client {
+	instrumented := *client
+	instrumented.Transport = InstrumentTransport(client.Transport)
+	return &instrumented
+}
@@ -0,0 +1,157 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider recording the ended spans for the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(tracerProvider)
+		otel.SetTextMapPropagator(propagator)
+	})
+	return recorder
+}
+
+// attributeValue returns the value of the attribute of the span.
+func attributeValue(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestInit(t *testing.T) {
+	for _, exporter := range []string{"", ExporterNone, ExporterStdout} {
+		t.Run(exporter, func(t *testing.T) {
+			t.Setenv(ExporterEnv, exporter)
+			shutdown, err := Init(context.Background(), "test-service")
+			if err != nil {
+				t.Fatalf("Init() failed: %v", err)
+			}
+			if err := shutdown(context.Background()); err != nil {
+				t.Errorf("shutdown() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestInitUnknownExporter(t *testing.T) {
+	t.Setenv(ExporterEnv, "zipkin")
+	if _, err := Init(context.Background(), "test-service"); err == nil {
+		t.Errorf("Init() with unknown exporter succeeded unexpectedly")
+	}
+}
+
+func TestPubSubPropagation(t *testing.T) {
+	recorder := recordSpans(t)
+
+	ctx, parent := Tracer().Start(context.Background(), "publish")
+	msg := &pubsub.Message{ID: "1", Data: []byte(`{"context":{"action":"search","transaction_id":"tx-1","message_id":"msg-1"}}`)}
+	InjectPubSub(ctx, msg)
+	parent.End()
+
+	ctx, span := StartPubSubSpan(context.Background(), "search-sub", msg)
+	SetPayloadAttributes(ctx, msg.Data)
+	span.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	consumer := spans[1]
+	if got, want := consumer.Parent().SpanID(), parent.SpanContext().SpanID(); got != want {
+		t.Errorf("consumer span parent = %v, want %v", got, want)
+	}
+	if got, want := consumer.SpanKind(), trace.SpanKindConsumer; got != want {
+		t.Errorf("consumer span kind = %v, want %v", got, want)
+	}
+	for key, want := range map[attribute.Key]string{
+		TransactionIDKey: "tx-1",
+		MessageIDKey:     "msg-1",
+		ActionKey:        "search",
+		PubSubMessageKey: "1",
+	} {
+		if got := attributeValue(consumer, key); got != want {
+			t.Errorf("consumer span attribute %q = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestInstrumentClient(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var traceparent string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer testServer.Close()
+
+	ctx, parent := Tracer().Start(context.Background(), "handle")
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, testServer.URL+"/search", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := InstrumentClient(http.DefaultClient).Do(request)
+	if err != nil {
+		t.Fatalf("Do() failed: %v", err)
+	}
+	response.Body.Close()
+	parent.End()
+
+	if request.Header.Get("traceparent") != "" {
+		t.Errorf("the original request is modified")
+	}
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	client := spans[0]
+	if got, want := client.Parent().SpanID(), parent.SpanContext().SpanID(); got != want {
+		t.Errorf("client span parent = %v, want %v", got, want)
+	}
+	if traceparent == "" || traceparent[36:52] != client.SpanContext().SpanID().String() {
+		t.Errorf("traceparent header = %q, want the client span %v", traceparent, client.SpanContext().SpanID())
+	}
+	serverURL, err := url.Parse(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := attributeValue(client, CounterpartyKey), serverURL.Host; got != want {
+		t.Errorf("client span counterparty = %q, want %q", got, want)
+	}
+}
@@ -84,6 +84,16 @@ func NewDatabase(ctx context.Context, t *testing.T, projectID, instanceID, datab
               ReqReceivedTime TIMESTAMP,
               AdditionalData JSON,)
               PRIMARY KEY(TransactionID, TransactionType, MessageID, RequestID)`,
+			`
+            CREATE TABLE InboundMessage(
+              SubscriberID STRING(255) NOT NULL,
+              TransactionID STRING(36) NOT NULL,
+              MessageID STRING(36) NOT NULL,
+              Action STRING(20) NOT NULL,
+              PubSubMessageID STRING(255),
+              ReceivedTime TIMESTAMP NOT NULL
+              OPTIONS (allow_commit_timestamp = TRUE),)
+              PRIMARY KEY(SubscriberID, TransactionID, MessageID, Action)`,
 		},
 	})
 	if err != nil {
@@ -0,0 +1,175 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webhook signs the callbacks delivered to the buyer app and retries their delivery.
+//
+// A delivery is signed with HMAC-SHA256 over "<timestamp>.<body>", where the timestamp is the Unix time of the attempt
+// in the TimestampHeader, so the buyer app can reject forged callbacks as well as callbacks replayed later on.
+// Every attempt of a delivery has the same DeliveryIDHeader, so the buyer app can drop the duplicates of a retry.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of the deliveries.
+const (
+	SignatureHeader  = "X-ONDC-Signature"
+	TimestampHeader  = "X-ONDC-Timestamp"
+	DeliveryIDHeader = "X-ONDC-Delivery-ID"
+)
+
+// Sign returns the hex encoded HMAC-SHA256 of the body delivered at the timestamp.
+func Sign(key []byte, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%d.", timestamp.Unix())
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of a delivery of the body, and that its timestamp is within tolerance of now.
+func Verify(key []byte, header http.Header, body []byte, now time.Time, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s header", TimestampHeader)
+	}
+	timestamp := time.Unix(unix, 0)
+	if d := now.Sub(timestamp); d > tolerance || d < -tolerance {
+		return fmt.Errorf("timestamp %v is not within %v", timestamp, tolerance)
+	}
+	signature, err := hex.DecodeString(header.Get(SignatureHeader))
+	if err != nil || len(signature) == 0 {
+		return fmt.Errorf("invalid %s header", SignatureHeader)
+	}
+	want, _ := hex.DecodeString(Sign(key, timestamp, body))
+	if !hmac.Equal(signature, want) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// Result is the outcome of a delivery.
+type Result struct {
+	// Attempts is the number of requests made.
+	Attempts int
+	// StatusCode is the status of the last response, zero if no response was received.
+	StatusCode int
+}
+
+// Deliverer delivers signed requests, retrying the failed attempts with exponential backoff.
+//
+// Attempts failing with a transport error, a 408, a 429 or a 5xx status are retried.
+// Other statuses than 200 are failures of the callback itself, which would fail again.
+type Deliverer struct {
+	client         *http.Client
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// NewDeliverer creates a new Deliverer making up to maxAttempts requests per delivery.
+// The backoff doubles from initialBackoff after every failed attempt, up to maxBackoff.
+func NewDeliverer(client *http.Client, maxAttempts int, initialBackoff, maxBackoff time.Duration) (*Deliverer, error) {
+	if client == nil {
+		return nil, errors.New("HTTP client is nil")
+	}
+	if maxAttempts < 1 {
+		return nil, fmt.Errorf("max attempts %d is less than 1", maxAttempts)
+	}
+	if initialBackoff < 0 || maxBackoff < initialBackoff {
+		return nil, fmt.Errorf("invalid backoff from %v to %v", initialBackoff, maxBackoff)
+	}
+	return &Deliverer{
+		client:         client,
+		maxAttempts:    maxAttempts,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+	}, nil
+}
+
+// Deliver posts the JSON body to the URL until an attempt succeeds, fails without retry, or the attempts run out.
+//
+// The requests are signed with the key, unless it is empty.
+func (d *Deliverer) Deliver(ctx context.Context, url, deliveryID string, key, body []byte) (Result, error) {
+	var (
+		result  Result
+		backoff = d.initialBackoff
+	)
+	for {
+		result.Attempts++
+		statusCode, err := d.attempt(ctx, url, deliveryID, key, body)
+		result.StatusCode = statusCode
+		if err == nil {
+			return result, nil
+		}
+		if !retryable(statusCode) || result.Attempts >= d.maxAttempts {
+			return result, err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, fmt.Errorf("%v, and stopped retrying: %v", err, ctx.Err())
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > d.maxBackoff {
+			backoff = d.maxBackoff
+		}
+	}
+}
+
+// attempt makes a request of the delivery, and returns the response status and an error unless it is 200.
+func (d *Deliverer) attempt(ctx context.Context, url, deliveryID string, key, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryIDHeader, deliveryID)
+	if len(key) > 0 {
+		now := time.Now()
+		req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+		req.Header.Set(SignatureHeader, Sign(key, now, body))
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+	if err != nil {
+		return res.StatusCode, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return res.StatusCode, fmt.Errorf("status %d: %s", res.StatusCode, resBody)
+	}
+	return res.StatusCode, nil
+}
+
+// retryable reports whether an attempt with the response status, zero if there was no response, can be retried.
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
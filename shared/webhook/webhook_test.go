@@ -0,0 +1,154 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var key = []byte("test-key")
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"context":{}}`)
+	header := http.Header{}
+	header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	header.Set(SignatureHeader, Sign(key, now, body))
+
+	if err := Verify(key, header, body, now, time.Minute); err != nil {
+		t.Errorf("Verify() failed: %v", err)
+	}
+}
+
+func TestVerifyFailed(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"context":{}}`)
+	signed := func(timestamp time.Time, signature string) http.Header {
+		header := http.Header{}
+		header.Set(TimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+		header.Set(SignatureHeader, signature)
+		return header
+	}
+
+	tests := []struct {
+		name   string
+		key    []byte
+		header http.Header
+		body   []byte
+	}{
+		{name: "no headers", key: key, header: http.Header{}, body: body},
+		{name: "other key", key: []byte("other-key"), header: signed(now, Sign(key, now, body)), body: body},
+		{name: "modified body", key: key, header: signed(now, Sign(key, now, body)), body: []byte(`{"context":{"x":1}}`)},
+		{name: "modified timestamp", key: key, header: signed(now.Add(-time.Second), Sign(key, now, body)), body: body},
+		{name: "replayed", key: key, header: signed(now.Add(-time.Hour), Sign(key, now.Add(-time.Hour), body)), body: body},
+		{name: "invalid signature", key: key, header: signed(now, "not-hex"), body: body},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := Verify(test.key, test.header, test.body, now, time.Minute); err == nil {
+				t.Error("Verify() succeeded unexpectedly")
+			}
+		})
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxAttempts  int
+		wantAttempts int
+		wantStatus   int
+		wantErr      bool
+	}{
+		{name: "success", statuses: []int{200}, maxAttempts: 3, wantAttempts: 1, wantStatus: 200},
+		{name: "retried", statuses: []int{503, 429, 200}, maxAttempts: 3, wantAttempts: 3, wantStatus: 200},
+		{name: "attempts run out", statuses: []int{500, 500, 500}, maxAttempts: 2, wantAttempts: 2, wantStatus: 500, wantErr: true},
+		{name: "not retried", statuses: []int{400, 200}, maxAttempts: 3, wantAttempts: 1, wantStatus: 400, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := []byte(`{"context":{}}`)
+			var requests int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotBody, _ := io.ReadAll(r.Body)
+				if err := Verify(key, r.Header, gotBody, time.Now(), time.Minute); err != nil {
+					t.Errorf("Verify() of the delivery failed: %v", err)
+				}
+				if got := r.Header.Get(DeliveryIDHeader); got != "delivery-1" {
+					t.Errorf("%s = %q, want %q", DeliveryIDHeader, got, "delivery-1")
+				}
+				w.WriteHeader(test.statuses[requests])
+				requests++
+			}))
+			defer srv.Close()
+
+			d, err := NewDeliverer(srv.Client(), test.maxAttempts, time.Millisecond, 2*time.Millisecond)
+			if err != nil {
+				t.Fatalf("NewDeliverer() failed: %v", err)
+			}
+			result, err := d.Deliver(context.Background(), srv.URL, "delivery-1", key, body)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("Deliver() error = %v, want error %v", err, test.wantErr)
+			}
+			if result.Attempts != test.wantAttempts || result.StatusCode != test.wantStatus {
+				t.Errorf("Deliver() = %+v, want %d attempts with status %d", result, test.wantAttempts, test.wantStatus)
+			}
+		})
+	}
+}
+
+func TestDeliverStopsOnCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	d, err := NewDeliverer(srv.Client(), 10, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDeliverer() failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	result, err := d.Deliver(ctx, srv.URL, "delivery-1", nil, nil)
+	if err == nil || result.Attempts != 1 {
+		t.Errorf("Deliver() = %+v, %v, want an error after 1 attempt", result, err)
+	}
+}
+
+func TestNewDelivererFailed(t *testing.T) {
+	tests := []struct {
+		name           string
+		client         *http.Client
+		maxAttempts    int
+		initialBackoff time.Duration
+		maxBackoff     time.Duration
+	}{
+		{name: "nil client", maxAttempts: 1},
+		{name: "no attempts", client: http.DefaultClient},
+		{name: "max backoff below initial", client: http.DefaultClient, maxAttempts: 1, initialBackoff: time.Second},
+	}
+	for _, test := range tests {
+		if _, err := NewDeliverer(test.client, test.maxAttempts, test.initialBackoff, test.maxBackoff); err == nil {
+			t.Errorf("NewDeliverer() of %s succeeded unexpectedly", test.name)
+		}
+	}
+}
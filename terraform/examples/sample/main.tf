@@ -61,6 +61,7 @@ locals {
 
   subscriber_id    = "example.com"
   request_id       = "484be40a-3806-475d-a168-a6ec03d7b310"
+  registration_id  = "484be40a3806475da168a6ec03d7b310"
   key_id           = "ec7ae8e8-f211-40ac-946f-a3407d0a76bb"
   ondc_environment = "pre-production"
 
@@ -114,10 +115,10 @@ module "dev_key_rotation" {
     google_service_account.dev_seller_cluster.email,
   ]
 
-  registry_url  = local.registry_url
-  subscriber_id = local.subscriber_id
-  request_id    = local.request_id
-  location      = local.location
+  ondc_environment = local.ondc_environment
+  subscriber_id    = local.subscriber_id
+  request_id       = local.request_id
+  location         = local.location
 }
 
 module "dev_onboarding" {
@@ -127,13 +128,19 @@ module "dev_onboarding" {
   prefix            = "dev-"
   artifact_registry = local.artifact_registry
 
-  secret_id                = module.dev_key_rotation.secret_id
-  request_id               = local.request_id
-  registry_encrypt_pub_key = "MCowBQYDK2VuAyEAa9Wbpvd9SsrpOZFcynyt/TO3x0Yrqyys4NUGIvyxX2Q="
-  location                 = local.location
+  secret_id        = module.dev_key_rotation.secret_id
+  registration_id  = local.registration_id
+  ondc_environment = local.ondc_environment
+  location         = local.location
+  admin_api_key    = var.onboarding_admin_api_key
+
+  // Registration details are stored in the seller database.
+  spanner_instance_name = "dev-seller-spanner-instance"
+  spanner_database_name = "dev-seller-spanner-database"
 
   depends_on = [
-    module.dev_key_rotation
+    module.dev_key_rotation,
+    module.dev_seller_app
   ]
 }
 
@@ -16,3 +16,9 @@ variable "project_id" {
   type        = string
   description = "GCP Project ID"
 }
+
+variable "onboarding_admin_api_key" {
+  type        = string
+  description = "Bearer token for the onboarding `/admin/registration` API"
+  sensitive   = true
+}
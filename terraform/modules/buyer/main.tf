@@ -113,6 +113,37 @@ resource "google_project_iam_member" "viewer" {
   member  = "serviceAccount:${var.service_account}"
 }
 
+// CLAIM CHECK STORE
+resource "google_storage_bucket_iam_member" "claimCheckObjectAdmin" {
+  provider = google
+
+  bucket = google_storage_bucket.claim_check.name
+  role   = "roles/storage.objectAdmin"
+  member = "serviceAccount:${var.service_account}"
+}
+
+// --- CLAIM CHECK --- //
+// Payloads too large for Pub/Sub messages are offloaded to the bucket.
+resource "google_storage_bucket" "claim_check" {
+  provider = google
+
+  project                     = local.project_id
+  name                        = "${local.env_prefix}buyer-claim-check-${random_id.suffix.hex}"
+  location                    = var.region == "" ? "us-central1" : var.region
+  uniform_bucket_level_access = true
+  force_destroy               = true
+
+  // The services delete the payloads after processing them. The rule deletes the payloads of failed messages.
+  lifecycle_rule {
+    condition {
+      age = 7
+    }
+    action {
+      type = "Delete"
+    }
+  }
+}
+
 // --- PUBSUB --- //
 module "pubsub" {
   source = "../internal/pubsub"
@@ -346,7 +377,11 @@ locals {
       buyer_app = {
         url = local.buyer_app_url
       }
+      claim_check = {
+        url = "gs://${google_storage_bucket.claim_check.name}"
+      }
       pubsub           = module.pubsub
+      spanner          = module.spanner
       ondc_environment = var.ondc_environment
     }
     bap_apis_config = {
@@ -359,6 +394,9 @@ locals {
       registry = {
         url = local.registry_url
       }
+      claim_check = {
+        url = "gs://${google_storage_bucket.claim_check.name}"
+      }
       pubsub           = module.pubsub
       spanner          = module.spanner
       ondc_environment = var.ondc_environment
@@ -369,6 +407,9 @@ locals {
       port             = 8080,
       pubsub           = module.pubsub
       ondc_environment = var.ondc_environment
+      claim_check = {
+        url = "gs://${google_storage_bucket.claim_check.name}"
+      }
     }
 
     request_action_config = {
@@ -387,6 +428,9 @@ locals {
         id  = local.subscriber_id
         url = var.subscriber_url
       }
+      claim_check = {
+        url = "gs://${google_storage_bucket.claim_check.name}"
+      }
       pubsub           = module.pubsub
       spanner          = module.spanner
       ondc_environment = var.ondc_environment
@@ -13,29 +13,16 @@
 # limitations under the License.
 
 locals {
+  # Messages of a transaction are ordered within a subscription, so all actions but search share a subscription
+  # to receive e.g. on_status and on_update of a transaction in order.
+  # Search is separated since its messages are the most frequent and are not ordered with the others.
   send_subscriptions = {
     0 : { name : "send-search", filter : "attributes.action = \"search\"" },
-    1 : { name : "send-select", filter : "attributes.action = \"select\"" },
-    2 : { name : "send-init", filter : "attributes.action = \"init\"" },
-    3 : { name : "send-confirm", filter : "attributes.action = \"confirm\"" },
-    4 : { name : "send-status", filter : "attributes.action = \"status\"" },
-    5 : { name : "send-track", filter : "attributes.action = \"track\"" },
-    6 : { name : "send-cancel", filter : "attributes.action = \"cancel\"" },
-    7 : { name : "send-update", filter : "attributes.action = \"update\"" },
-    8 : { name : "send-rating", filter : "attributes.action = \"rating\"" },
-    9 : { name : "send-support", filter : "attributes.action = \"support\"" },
+    1 : { name : "send-transaction", filter : "attributes.action != \"search\"" },
   }
   callback_subscriptions = {
     0 : { name : "callback-on-search", filter : "attributes.action = \"on_search\"" },
-    1 : { name : "callback-on-select", filter : "attributes.action = \"on_select\"" },
-    2 : { name : "callback-on-init", filter : "attributes.action = \"on_init\"" },
-    3 : { name : "callback-on-confirm", filter : "attributes.action = \"on_confirm\"" },
-    4 : { name : "callback-on-status", filter : "attributes.action = \"on_status\"" },
-    5 : { name : "callback-on-track", filter : "attributes.action = \"on_track\"" },
-    6 : { name : "callback-on-cancel", filter : "attributes.action = \"on_cancel\"" },
-    7 : { name : "callback-on-update", filter : "attributes.action = \"on_update\"" },
-    8 : { name : "callback-on-rating", filter : "attributes.action = \"on_rating\"" },
-    9 : { name : "callback-on-support", filter : "attributes.action = \"on_support\"" },
+    1 : { name : "callback-transaction", filter : "attributes.action != \"on_search\"" },
   }
 }
 
@@ -69,6 +56,9 @@ resource "google_pubsub_subscription" "send" {
   message_retention_duration   = var.send_message_retention_duration
   enable_exactly_once_delivery = true
   filter                       = each.value.filter
+
+  // Messages are published with the transaction ID as the ordering key.
+  enable_message_ordering = true
 }
 
 // Create Pub/Sub topic (callback)
@@ -91,4 +81,7 @@ resource "google_pubsub_subscription" "callback" {
   message_retention_duration   = var.callback_message_retention_duration
   enable_exactly_once_delivery = true
   filter                       = each.value.filter
+
+  // Messages are published with the transaction ID as the ordering key.
+  enable_message_ordering = true
 }
@@ -48,6 +48,27 @@ resource "google_spanner_instance" "spanner_instance" {
 locals {
   registration_ddl = split("\n\n", file("${path.module}/sql/registration_table.sql"))[1]
   transaction_ddl  = split("\n\n", file("${path.module}/sql/transaction_table.sql"))[1]
+
+  # Subscriber IDs are FQDNs, which do not fit in the original STRING(10) column.
+  registration_subscriber_id_ddl = split("\n\n", file("${path.module}/sql/registration_subscriber_id.sql"))[1]
+
+  # Inbound requests received in the last 7 days, for acknowledging their retries without processing.
+  inbound_message_ddl = split("\n\n", file("${path.module}/sql/inbound_message_table.sql"))[1]
+
+  # Catalog pushed by the seller system for answering searches, and the buyer apps subscribed to its updates.
+  catalog_ddl              = split("\n\n", file("${path.module}/sql/catalog_table.sql"))[1]
+  catalog_provider_ddl     = split("\n\n", file("${path.module}/sql/catalog_provider_table.sql"))[1]
+  catalog_subscription_ddl = split("\n\n", file("${path.module}/sql/catalog_subscription_table.sql"))[1]
+
+  # Offers of the on_search responses received by the buyer platform in the last day, for querying the merged results.
+  search_result_ddl = split("\n\n", file("${path.module}/sql/search_result_table.sql"))[1]
+
+  # Callback deliveries to the buyer app in the last 7 days, for reconciling the callbacks.
+  webhook_delivery_ddl = split("\n\n", file("${path.module}/sql/webhook_delivery_table.sql"))[1]
+
+  # Requests accepted by the seller system for answering later, and the index for expiring them.
+  pending_request_ddl             = split("\n\n", file("${path.module}/sql/pending_request_table.sql"))[1]
+  pending_request_expire_time_ddl = split("\n\n", file("${path.module}/sql/pending_request_expire_time_index.sql"))[1]
 }
 
 // Create spanner database
@@ -58,6 +79,15 @@ resource "google_spanner_database" "spanner_database" {
   name     = local.database_name
   ddl = [
     local.registration_ddl,
-    local.transaction_ddl
+    local.transaction_ddl,
+    local.registration_subscriber_id_ddl,
+    local.inbound_message_ddl,
+    local.catalog_ddl,
+    local.catalog_provider_ddl,
+    local.catalog_subscription_ddl,
+    local.search_result_ddl,
+    local.webhook_delivery_ddl,
+    local.pending_request_ddl,
+    local.pending_request_expire_time_ddl
   ]
 }
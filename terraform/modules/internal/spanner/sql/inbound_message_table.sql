@@ -0,0 +1,24 @@
+-- Copyright 2023 Google LLC
+--
+-- Licensed under the Apache License, Version 2.0 (the "License");
+-- you may not use this file except in compliance with the License.
+-- You may obtain a copy of the License at
+--
+--     http://www.apache.org/licenses/LICENSE-2.0
+--
+-- Unless required by applicable law or agreed to in writing, software
+-- distributed under the License is distributed on an "AS IS" BASIS,
+-- WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+-- See the License for the specific language governing permissions and
+-- limitations under the License.
+
+CREATE TABLE InboundMessage(
+  SubscriberID STRING(255) NOT NULL,
+  TransactionID STRING(36) NOT NULL,
+  MessageID STRING(36) NOT NULL,
+  Action STRING(20) NOT NULL,
+  PubSubMessageID STRING(255),
+  ReceivedTime TIMESTAMP NOT NULL
+  OPTIONS (allow_commit_timestamp = TRUE),)
+  PRIMARY KEY(SubscriberID, TransactionID, MessageID, Action),
+  ROW DELETION POLICY (OLDER_THAN(ReceivedTime, INTERVAL 7 DAY))
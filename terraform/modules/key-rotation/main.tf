@@ -139,12 +139,13 @@ resource "google_cloud_run_service" "key_rotater" {
         }
         dynamic "env" {
           for_each = {
-            "PROJECT_ID"      = var.project_id,
-            "SECRET_ID"       = google_secret_manager_secret.keys.id,
-            "REGISTRY_URL"    = var.registry_url
-            "REQUEST_ID"      = var.request_id
-            "SUBSCRIBER_ID"   = var.subscriber_id
-            "ROTATION_PERIOD" = var.rotation_period
+            "PROJECT_ID"       = var.project_id,
+            "SECRET_ID"        = google_secret_manager_secret.keys.id,
+            "REGISTRY_URL"     = var.registry_url
+            "ONDC_ENVIRONMENT" = var.ondc_environment
+            "REQUEST_ID"       = var.request_id
+            "SUBSCRIBER_ID"    = var.subscriber_id
+            "ROTATION_PERIOD"  = var.rotation_period
           }
           content {
             name  = env.key
@@ -29,11 +29,6 @@ variable "service_accounts" {
   description = "Service Accounts List as Secret Manager Admins"
 }
 
-variable "registry_url" {
-  type        = string
-  description = "ONDC Registry URL"
-}
-
 variable "request_id" {
   type        = string
   description = "Arbitary ID (eg. UUID). This will be used when sending key rotation request to ONDC registry. It should be the same ID you will use in `onboarding` module."
@@ -60,6 +55,18 @@ variable "artifact_registry" {
 
 // OPTIONAL VARIABLES //
 
+variable "ondc_environment" {
+  type        = string
+  description = "Network environment of ONDC. It should be one of staging, pre-production, production"
+  default     = "pre-production"
+}
+
+variable "registry_url" {
+  type        = string
+  description = "ONDC Registry URL. Default to the registry of `ondc_environment`"
+  default     = ""
+}
+
 variable "rotation_period" {
   type        = string
   description = "Time between each key rotation. Default to 6 months. **WARNING**: changing this field after created the Secret Manager secret can delete all sercet versions. See this [issue](https://github.com/hashicorp/terraform-provider-google/issues/13770)"
@@ -14,7 +14,7 @@
 
 locals {
   secret_id               = var.secret_id
-  request_id              = var.request_id
+  registration_id         = var.registration_id
   onboarding_account_id   = "${var.prefix}onboarding-service-account"
   onboarding_display_name = "On Boarding Service Account"
 
@@ -68,6 +68,16 @@ resource "google_secret_manager_secret_iam_member" "read" {
   member    = "serviceAccount:${google_service_account.onboarding.email}"
 }
 
+resource "google_spanner_database_iam_member" "registration" {
+  provider = google
+
+  project  = var.project_id
+  instance = var.spanner_instance_name
+  database = var.spanner_database_name
+  role     = "roles/spanner.databaseUser"
+  member   = "serviceAccount:${google_service_account.onboarding.email}"
+}
+
 locals {
   location = var.location
 }
@@ -96,8 +106,12 @@ resource "google_cloud_run_service" "onboarding" {
           for_each = {
             "PROJECT_ID"               = var.project_id,
             "SECRET_ID"                = local.secret_id,
-            "REQUEST_ID"               = local.request_id
-            "REGISTRY_ENCRYPT_PUB_KEY" = var.registry_encrypt_pub_key
+            "INSTANCE_ID"              = var.spanner_instance_name,
+            "DATABASE_ID"              = var.spanner_database_name,
+            "REGISTRATION_ID"          = local.registration_id,
+            "ONDC_ENVIRONMENT"         = var.ondc_environment,
+            "REGISTRY_ENCRYPT_PUB_KEY" = var.registry_encrypt_pub_key,
+            "ADMIN_API_KEY"            = var.admin_api_key
           }
           content {
             name  = env.key
@@ -24,9 +24,19 @@ variable "secret_id" {
   description = "Secret Manager's Secret ID that store our key pairs"
 }
 
-variable "request_id" {
+variable "registration_id" {
   type        = string
-  description = "Request ID (ex. uuid). This should be the same ID you will use for `/subscribe` API."
+  description = "ID of the registration record (at most 35 characters). It is used as the request ID of `/subscribe` API."
+}
+
+variable "spanner_instance_name" {
+  type        = string
+  description = "Spanner instance that contains the `Registration` table"
+}
+
+variable "spanner_database_name" {
+  type        = string
+  description = "Spanner database that contains the `Registration` table"
 }
 
 variable "artifact_registry" {
@@ -38,20 +48,33 @@ variable "artifact_registry" {
   description = "Artifact Registry where the Docker images stored"
 }
 
-variable "registry_encrypt_pub_key" {
-  type        = string
-  description = "Encryption public key of the ONDC registry. This info should be avalable in the [ONDC onboarding document](https://github.com/ONDC-Official/developer-docs/blob/main/registry/Onboarding%20of%20Participants.md)"
-}
-
 variable "location" {
   type        = string
   description = "Cloud Run Location of onboarding service"
 }
 
 // OPTIONAL VARIABLES //
+variable "ondc_environment" {
+  type        = string
+  description = "Network environment of ONDC. It should be one of staging, pre-production, production"
+  default     = "pre-production"
+}
+
+variable "registry_encrypt_pub_key" {
+  type        = string
+  description = "Encryption public key of the ONDC registry. Default to the key of `ondc_environment`. This info should be avalable in the [ONDC onboarding document](https://github.com/ONDC-Official/developer-docs/blob/main/registry/Onboarding%20of%20Participants.md)"
+  default     = ""
+}
+
 variable "prefix" {
   type        = string
   description = "Resouce Prefix. If it's not empty, it should contains `-` as a last character eg. `dev-`"
   default     = ""
 }
 
+variable "admin_api_key" {
+  type        = string
+  description = "Bearer token for the `/admin/registration` API. The API is disabled if it's empty."
+  default     = ""
+  sensitive   = true
+}